@@ -2,18 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"gobus/internal/config"
+	"gobus/internal/geocode"
 	"gobus/internal/gtfs"
 	"gobus/internal/nextrip"
 	"gobus/internal/realtime"
+	"gobus/internal/reliability"
 	"gobus/internal/server"
 	"gobus/internal/storage"
+	"gobus/internal/walk"
 )
 
 func main() {
@@ -21,17 +28,45 @@ func main() {
 		Level: slog.LevelInfo,
 	}))
 
-	cfg := config.Load()
-
-	// CLI flags
+	// CLI flags, applied over the config file and environment
+	configPath := flag.String("config", "", "TOML config file (default $GOBUS_CONFIG)")
 	importOnly := flag.Bool("import-gtfs", false, "Download and import GTFS data, then exit")
-	flag.IntVar(&cfg.Port, "port", cfg.Port, "HTTP server port")
-	flag.BoolVar(&cfg.TestMode, "test-mode", cfg.TestMode, "Enable test mode (fixture data, mock APIs)")
-	flag.StringVar(&cfg.GTFSDir, "gtfs-dir", cfg.GTFSDir, "Directory for GTFS data files")
+	importAddrs := flag.String("import-addresses", "", "Load the offline address gazetteer from a CSV file, then exit")
+	importOSM := flag.String("import-osm", "", "Build the walking network from an OSM PBF extract, then exit")
+	port := flag.Int("port", 0, "HTTP server port")
+	testMode := flag.Bool("test-mode", false, "Enable test mode (fixture data, mock APIs)")
+	gtfsDir := flag.String("gtfs-dir", "", "Directory for GTFS data files")
 	flag.Parse()
+	applyFlags := func(c *config.Config) {
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "port":
+				c.Port = *port
+			case "test-mode":
+				c.TestMode = *testMode
+			case "gtfs-dir":
+				c.GTFSDir = *gtfsDir
+			}
+		})
+	}
+
+	cfg, err := config.Load(*configPath, applyFlags)
+	if err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
 	cfg.ImportGTFS = *importOnly
 
-	// Context with cancellation for graceful shutdown
+	// Handle --import-osm flag (needs no database)
+	if *importOSM != "" {
+		if err := importWalkGraph(*importOSM, cfg.WalkGraph, logger); err != nil {
+			logger.Error("OSM import failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Cancelled on shutdown to stop the background pollers
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -41,7 +76,17 @@ func main() {
 		logger.Error("failed to open database", "error", err)
 		os.Exit(1)
 	}
-	defer db.Close()
+
+	// Handle --import-addresses flag
+	if *importAddrs != "" {
+		err := importAddresses(ctx, db, *importAddrs, logger)
+		db.Close()
+		if err != nil {
+			logger.Error("address import failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Set up GTFS scheduler
 	downloader := gtfs.NewDownloader(cfg.GTFSURL, cfg.GTFSDir, logger)
@@ -50,7 +95,9 @@ func main() {
 	// Handle --import-gtfs flag
 	if cfg.ImportGTFS {
 		logger.Info("force importing GTFS data")
-		if err := scheduler.EnsureData(ctx); err != nil {
+		err := scheduler.EnsureData(ctx)
+		db.Close()
+		if err != nil {
 			logger.Error("GTFS import failed", "error", err)
 			os.Exit(1)
 		}
@@ -58,48 +105,189 @@ func main() {
 		return
 	}
 
+	// Background goroutines that use the database; shutdown waits for them
+	// before closing it
+	var bg sync.WaitGroup
+	goBackground := func(fn func()) {
+		bg.Add(1)
+		go func() {
+			defer bg.Done()
+			fn()
+		}()
+	}
+
 	// Create NexTrip API client
 	nt := nextrip.NewClient(cfg.NexTripBaseURL, logger)
 
+	// Keep the predictions riders see as a history of when trips really left
+	var recorder *reliability.Recorder
+	if cfg.HistoryDays > 0 {
+		recorder = reliability.NewRecorder(db, cfg.HistoryDays, logger)
+		nt.SetObserver(recorder.Observe)
+	}
+
 	// Start GTFS-RT realtime alerts fetcher
 	rtStore := realtime.NewStore()
-	alertsFetcher := realtime.NewFetcher(
-		"https://svc.metrotransit.org/mtgtfs/alerts.pb",
-		rtStore, logger,
-	)
-	go alertsFetcher.Start(ctx)
+	alertsFetcher := realtime.NewFetcher(cfg.AlertsURL, rtStore, logger)
+	goBackground(func() { alertsFetcher.Start(ctx) })
 
 	// Start HTTP server (serves loading page until GTFS data is ready)
 	srv := server.New(cfg, db, nt, rtStore, logger)
+	srv.SetScheduler(scheduler)
+	goBackground(func() { srv.RunChallengeSweep(ctx) })
 
 	// Download GTFS data in the background — server shows loading page until done
-	go func() {
+	goBackground(func() {
 		if err := scheduler.EnsureData(ctx); err != nil {
 			logger.Error("failed to ensure GTFS data", "error", err)
 		}
+		if ctx.Err() != nil {
+			return // shut down during the initial import
+		}
 		srv.SetReady()
 
 		// Start background GTFS update scheduler
-		go scheduler.StartBackground(ctx)
+		goBackground(func() { scheduler.StartBackground(ctx) })
+
+		// Start arrival reminder scheduler (needs schedule data to match trips)
+		goBackground(func() { srv.RunReminders(ctx) })
+
+		// Save observed departures (needs schedule data to match trips)
+		if recorder != nil {
+			goBackground(func() { recorder.Run(ctx) })
+		}
 
 		// Check for updates on first access today
-		if err := scheduler.CheckAndUpdate(ctx); err != nil {
+		if err := scheduler.CheckAndUpdate(ctx); err != nil && !errors.Is(err, gtfs.ErrStopped) {
 			logger.Error("daily GTFS check failed", "error", err)
 		}
-	}()
+	})
 
-	// Graceful shutdown on SIGINT/SIGTERM
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	exitCode := 0
+	var stopSig os.Signal
+	for stopSig == nil && exitCode == 0 {
+		select {
+		case err := <-serveErr:
+			logger.Error("server error", "error", err)
+			exitCode = 1
+		case sig := <-sigCh:
+			if sig == syscall.SIGHUP {
+				cfg = reload(cfg, *configPath, applyFlags, srv, logger)
+			} else {
+				stopSig = sig
+			}
+		}
+	}
+	grace := time.Duration(cfg.ShutdownTimeoutSec) * time.Second
+	if stopSig != nil {
+		logger.Info("shutting down", "signal", stopSig.String(), "timeout", grace)
+		// A second signal skips the wait
+		go func() {
+			for sig := range sigCh {
+				if sig != syscall.SIGHUP {
+					logger.Warn("second signal, exiting immediately")
+					os.Exit(1)
+				}
+			}
+		}()
+	}
+
+	shutdown(srv, scheduler, db, cancel, &bg, grace, logger)
+	os.Exit(exitCode)
+}
+
+// reload re-reads the config file and environment on SIGHUP and applies the
+// settings that can change at runtime. On any error the running
+// configuration is kept.
+func reload(cfg *config.Config, path string, applyFlags func(*config.Config), srv *server.Server, logger *slog.Logger) *config.Config {
+	next, err := config.Load(path, applyFlags)
+	if err != nil {
+		logger.Error("config reload failed, keeping current settings", "error", err)
+		return cfg
+	}
+	merged, changed, ignored := cfg.Reload(next)
+	if len(ignored) > 0 {
+		logger.Warn("config reload: these settings need a restart to change", "settings", strings.Join(ignored, ", "))
+	}
+	if len(changed) == 0 {
+		logger.Info("config reloaded, nothing changed")
+		return cfg
+	}
+	srv.Reload(merged)
+	logger.Info("config reloaded", "changed", strings.Join(changed, ", "))
+	return merged
+}
+
+// shutdown stops everything in dependency order within one deadline:
+// drain HTTP requests and SSE streams, stop the pollers, let a running GTFS
+// import finish (or roll it back if time runs out), then close the database
+// once nothing is using it.
+func shutdown(srv *server.Server, scheduler *gtfs.Scheduler, db *storage.DB, cancel context.CancelFunc, bg *sync.WaitGroup, grace time.Duration, logger *slog.Logger) {
+	ctx, done := context.WithTimeout(context.Background(), grace)
+	defer done()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Warn("HTTP shutdown incomplete", "error", err)
+	}
+	cancel()
+	if err := scheduler.Shutdown(ctx); err != nil {
+		logger.Warn("GTFS update aborted", "error", err)
+	}
+
+	stopped := make(chan struct{})
 	go func() {
-		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-		<-sigCh
-		logger.Info("shutting down")
-		cancel()
-		os.Exit(0)
+		bg.Wait()
+		close(stopped)
 	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		logger.Warn("background tasks still running at shutdown deadline")
+	}
 
-	if err := srv.ListenAndServe(); err != nil {
-		logger.Error("server error", "error", err)
-		os.Exit(1)
+	if err := db.Close(); err != nil {
+		logger.Error("closing database", "error", err)
+	}
+	logger.Info("shutdown complete")
+}
+
+// importAddresses replaces the geocoding gazetteer with the addresses in
+// the CSV file at path.
+func importAddresses(ctx context.Context, db *storage.DB, path string, logger *slog.Logger) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	start := time.Now()
+	n, err := geocode.ImportAddresses(ctx, db, f)
+	if err != nil {
+		return err
+	}
+	logger.Info("addresses imported", "count", n, "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func importWalkGraph(pbfPath, graphPath string, logger *slog.Logger) error {
+	f, err := os.Open(pbfPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	start := time.Now()
+	g, err := walk.Import(f)
+	if err != nil {
+		return err
+	}
+	if err := g.SaveFile(graphPath); err != nil {
+		return err
 	}
+	logger.Info("walking network imported", "path", graphPath,
+		"vertices", g.Vertices(), "edges", g.Edges(), "duration", time.Since(start).Round(time.Millisecond))
+	return nil
 }
@@ -3,6 +3,7 @@ module gobus
 go 1.24.0
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs v1.0.0
 	github.com/a-h/templ v0.3.977
 	github.com/mattn/go-sqlite3 v1.14.34
@@ -1,65 +1,332 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"reflect"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"gobus/internal/geocode"
 )
 
-// Config holds application configuration from environment variables.
+// Config holds application configuration. Every setting can be given in the
+// TOML config file under the key in its toml tag, or as an environment
+// variable named GOBUS_ followed by the key in upper case; the environment
+// wins. Settings tagged reload:"true" take effect on SIGHUP, the rest need a
+// restart.
 type Config struct {
-	Port           int
-	DBPath         string
-	GTFSDir        string
-	GTFSURL        string
-	NexTripBaseURL string
-	TestMode       bool
-	ImportGTFS     bool // CLI flag: force GTFS re-import
-
-	CookieSecret    string // HMAC key for signing session cookies
-	MaxUsers        int    // Maximum number of registered users (0 = unlimited)
-	MaxDevicesTotal int    // Absolute cap on devices per user (oldest evicted)
-	MaxDevicesRecent int   // Max devices per user in rolling window
-	DeviceWindowMin int    // Rolling window size in minutes
+	Port               int    `toml:"port"`
+	DBPath             string `toml:"db_path"`
+	GTFSDir            string `toml:"gtfs_dir"`
+	GTFSURL            string `toml:"gtfs_url"`
+	NexTripBaseURL     string `toml:"nextrip_url"`
+	AlertsURL          string `toml:"alerts_url"`           // GTFS-RT service alerts feed
+	Geocoder           string `toml:"geocoder"`             // Address search backend: nominatim, photon, pelias, gazetteer or none
+	GeocodeURL         string `toml:"geocode_url"`          // Nominatim, Photon or Pelias base URL, for address search and location labels
+	GeocodeRatePerMin  int    `toml:"geocode_rate_per_min"` // Requests a minute sent to the geocoder (0 = unlimited); Nominatim allows 60
+	GeocodeCacheDays   int    `toml:"geocode_cache_days"`   // How long geocoder answers are reused
+	WalkGraph          string `toml:"walk_graph"`           // Street network written by --import-osm; walks are estimated from straight lines without it
+	HistoryDays        int    `toml:"history_days"`         // How long observed departures are kept for reliability stats (0 = don't record)
+	TestMode           bool   `toml:"test_mode"`
+	ImportGTFS         bool   `toml:"-"`                                  // CLI flag: force GTFS re-import
+	ShutdownTimeoutSec int    `toml:"shutdown_timeout_sec" reload:"true"` // How long shutdown waits for requests and a running GTFS import
+
+	CookieSecret         string `toml:"cookie_secret"`                    // HMAC key for session IDs and signed tokens
+	CookieSecretPrevious string `toml:"cookie_secret_previous"`           // Secret being rotated out; its sessions stay valid for CookieGraceDays
+	CookieGraceDays      int    `toml:"cookie_grace_days"`                // How long sessions keyed with the previous secret are honored
+	MaxUsers             int    `toml:"max_users" reload:"true"`          // Maximum number of registered users (0 = unlimited); an invite code bypasses it
+	InviteOnly           bool   `toml:"invite_only" reload:"true"`        // Registration requires an invite code
+	MaxDevicesTotal      int    `toml:"max_devices_total" reload:"true"`  // Absolute cap on devices per user (oldest evicted; 0 = unlimited)
+	MaxDevicesRecent     int    `toml:"max_devices_recent" reload:"true"` // Max devices per user in rolling window (0 = unlimited)
+	DeviceWindowMin      int    `toml:"device_window_min" reload:"true"`  // Rolling window size in minutes
+
+	LoginFreeAttempts int    `toml:"login_free_attempts" reload:"true"` // Failed sign-ins allowed before backoff starts (per IP and per username)
+	LoginMaxDelaySec  int    `toml:"login_max_delay_sec" reload:"true"` // Cap on the backoff between failed sign-ins
+	LoginLockoutUser  int    `toml:"login_lockout_user" reload:"true"`  // Failures that lock a username out (0 = never)
+	LoginLockoutIP    int    `toml:"login_lockout_ip" reload:"true"`    // Failures that lock a client IP out (0 = never)
+	LoginLockoutMin   int    `toml:"login_lockout_min" reload:"true"`   // Lockout duration in minutes
+	TrustProxy        bool   `toml:"trust_proxy" reload:"true"`         // Take the client IP from X-Forwarded-For (only behind a reverse proxy)
+	AdminUsers        string `toml:"admin_users" reload:"true"`         // Comma-separated usernames allowed into /admin
+
+	VAPIDPrivateKey string `toml:"vapid_private_key"`             // Web Push signing key (base64url); generated if empty
+	VAPIDSubject    string `toml:"vapid_subject"`                 // Contact URL sent to push services ("mailto:..." or "https://...")
+	PushAllowHTTP   bool   `toml:"push_allow_http" reload:"true"` // Accept http:// and private-address push endpoints (local push service stand-in)
+
+	WebAuthnOrigin string `toml:"webauthn_origin"` // Origin passkeys are bound to, e.g. "https://gobus.example.org"; empty = derive from request
+	WebAuthnRPID   string `toml:"webauthn_rp_id"`  // Passkey relying party ID; defaults to the origin's host
+
+	MetricsToken string `toml:"metrics_token" reload:"true"` // Bearer token required to scrape /metrics; empty = open
 }
 
-// Load reads configuration from environment variables with defaults.
-func Load() *Config {
+// DefaultGeocodeURL is the public Nominatim server.
+const DefaultGeocodeURL = "https://nominatim.openstreetmap.org"
+
+// Default returns the configuration used when nothing is set.
+func Default() *Config {
 	return &Config{
-		Port:           envInt("GOBUS_PORT", 8080),
-		DBPath:         envStr("GOBUS_DB_PATH", "./gobus.db"),
-		GTFSDir:        envStr("GOBUS_GTFS_DIR", "./data"),
-		GTFSURL:        envStr("GOBUS_GTFS_URL", "https://svc.metrotransit.org/mtgtfs/gtfs.zip"),
-		NexTripBaseURL: envStr("GOBUS_NEXTRIP_URL", "https://svc.metrotransit.org/nextrip"),
-		TestMode:       envBool("GOBUS_TEST_MODE", false),
-		CookieSecret:    envStr("GOBUS_COOKIE_SECRET", ""),
-		MaxUsers:        envInt("GOBUS_MAX_USERS", 100),
-		MaxDevicesTotal: envInt("GOBUS_MAX_DEVICES_TOTAL", 5),
-		MaxDevicesRecent: envInt("GOBUS_MAX_DEVICES_RECENT", 3),
-		DeviceWindowMin: envInt("GOBUS_DEVICE_WINDOW_MIN", 10),
+		Port:               8080,
+		DBPath:             "./gobus.db",
+		GTFSDir:            "./data",
+		GTFSURL:            "https://svc.metrotransit.org/mtgtfs/gtfs.zip",
+		NexTripBaseURL:     "https://svc.metrotransit.org/nextrip",
+		AlertsURL:          "https://svc.metrotransit.org/mtgtfs/alerts.pb",
+		Geocoder:           "nominatim",
+		GeocodeURL:         DefaultGeocodeURL,
+		GeocodeRatePerMin:  60,
+		GeocodeCacheDays:   30,
+		WalkGraph:          "./walk.graph",
+		HistoryDays:        90,
+		ShutdownTimeoutSec: 25,
+		CookieGraceDays:    7,
+		MaxUsers:           100,
+		MaxDevicesTotal:    5,
+		MaxDevicesRecent:   3,
+		DeviceWindowMin:    10,
+		LoginFreeAttempts:  5,
+		LoginMaxDelaySec:   60,
+		LoginLockoutUser:   10,
+		LoginLockoutIP:     50,
+		LoginLockoutMin:    15,
+		VAPIDSubject:       "mailto:admin@localhost",
+	}
+}
+
+// Load builds the configuration from the defaults, the TOML file at path
+// (GOBUS_CONFIG if path is empty; no file if both are), and GOBUS_*
+// environment variables, in that order. override, if not nil, is applied
+// last, for command-line flags. Unknown keys, malformed values and invalid
+// settings are all reported together in the returned error.
+func Load(path string, override func(*Config)) (*Config, error) {
+	return load(path, os.Environ(), override)
+}
+
+func load(path string, environ []string, override func(*Config)) (*Config, error) {
+	c := Default()
+	var errs []error
+	if path == "" {
+		path = lookup(environ, "GOBUS_CONFIG")
+	}
+	if path != "" {
+		md, err := toml.DecodeFile(path, c)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+		for _, k := range md.Undecoded() {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, k.String()))
+		}
+	}
+	errs = append(errs, c.applyEnv(environ)...)
+	if override != nil {
+		override(c)
+	}
+	errs = append(errs, c.validate()...)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func lookup(environ []string, name string) string {
+	for _, kv := range environ {
+		if k, v, _ := strings.Cut(kv, "="); k == name {
+			return v
+		}
+	}
+	return ""
+}
+
+// envName returns the environment variable for a config key.
+func envName(key string) string {
+	return "GOBUS_" + strings.ToUpper(key)
+}
+
+// applyEnv sets fields from GOBUS_* variables. Empty variables are treated
+// as unset. A variable that matches no setting is an error rather than
+// silently ignored, since it is almost always a typo.
+func (c *Config) applyEnv(environ []string) []error {
+	fields := make(map[string]reflect.Value)
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if key := v.Type().Field(i).Tag.Get("toml"); key != "-" {
+			fields[envName(key)] = v.Field(i)
+		}
+	}
+
+	sorted := append([]string(nil), environ...)
+	sort.Strings(sorted)
+	var errs []error
+	for _, kv := range sorted {
+		name, val, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, "GOBUS_") || name == "GOBUS_CONFIG" {
+			continue
+		}
+		f, ok := fields[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting", name))
+			continue
+		}
+		if val == "" {
+			continue
+		}
+		if err := setField(f, val); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
 	}
+	return errs
 }
 
-func envStr(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+func setField(f reflect.Value, s string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", s)
+		}
+		f.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", s)
+		}
+		f.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.Kind())
 	}
-	return fallback
+	return nil
 }
 
-func envInt(key string, fallback int) int {
-	if v := os.Getenv(key); v != "" {
-		if n, err := strconv.Atoi(v); err == nil {
-			return n
+// validate checks the settings make sense together. Errors name the file
+// key; the environment variable is GOBUS_ plus the key in upper case.
+func (c *Config) validate() []error {
+	var errs []error
+	bad := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		bad("port", "must be between 1 and 65535 (got %d)", c.Port)
+	}
+	if c.DBPath == "" {
+		bad("db_path", "must not be empty")
+	}
+	if c.GTFSDir == "" {
+		bad("gtfs_dir", "must not be empty")
+	}
+	for _, u := range []struct{ key, val string }{
+		{"gtfs_url", c.GTFSURL},
+		{"nextrip_url", c.NexTripBaseURL},
+		{"alerts_url", c.AlertsURL},
+		{"geocode_url", c.GeocodeURL},
+	} {
+		if err := checkHTTPURL(u.val); err != nil {
+			bad(u.key, "%v", err)
+		}
+	}
+	switch {
+	case !slices.Contains(geocode.Kinds, c.Geocoder):
+		kinds := geocode.Kinds
+		bad("geocoder", "must be %s or %s (got %q)",
+			strings.Join(kinds[:len(kinds)-1], ", "), kinds[len(kinds)-1], c.Geocoder)
+	case c.Geocoder == "nominatim":
+		if c.GeocodeURL == DefaultGeocodeURL && (c.GeocodeRatePerMin == 0 || c.GeocodeRatePerMin > 60) {
+			bad("geocode_rate_per_min", "must be between 1 and 60 for the public Nominatim server (got %d)", c.GeocodeRatePerMin)
+		}
+	case geocode.Remote(c.Geocoder):
+		if c.GeocodeURL == DefaultGeocodeURL {
+			bad("geocode_url", "must point at your %s server when geocoder is %q", c.Geocoder, c.Geocoder)
+		}
+	}
+
+	for _, n := range []struct {
+		key string
+		val int
+		min int
+	}{
+		{"shutdown_timeout_sec", c.ShutdownTimeoutSec, 1},
+		{"geocode_rate_per_min", c.GeocodeRatePerMin, 0},
+		{"geocode_cache_days", c.GeocodeCacheDays, 1},
+		{"history_days", c.HistoryDays, 0},
+		{"cookie_grace_days", c.CookieGraceDays, 0},
+		{"max_users", c.MaxUsers, 0},
+		{"max_devices_total", c.MaxDevicesTotal, 0},
+		{"max_devices_recent", c.MaxDevicesRecent, 0},
+		{"device_window_min", c.DeviceWindowMin, 1},
+		{"login_free_attempts", c.LoginFreeAttempts, 0},
+		{"login_max_delay_sec", c.LoginMaxDelaySec, 1},
+		{"login_lockout_user", c.LoginLockoutUser, 0},
+		{"login_lockout_ip", c.LoginLockoutIP, 0},
+		{"login_lockout_min", c.LoginLockoutMin, 1},
+	} {
+		if n.val < n.min {
+			bad(n.key, "must be at least %d (got %d)", n.min, n.val)
 		}
 	}
-	return fallback
+
+	if c.CookieSecret != "" && len(c.CookieSecret) < 16 {
+		bad("cookie_secret", "must be at least 16 characters")
+	}
+	if c.CookieSecretPrevious != "" && c.CookieSecret == "" {
+		bad("cookie_secret_previous", "is only used together with cookie_secret")
+	}
+	if !strings.HasPrefix(c.VAPIDSubject, "mailto:") && !strings.HasPrefix(c.VAPIDSubject, "https://") {
+		bad("vapid_subject", "must start with mailto: or https:// (got %q)", c.VAPIDSubject)
+	}
+
+	if c.WebAuthnOrigin != "" {
+		u, err := url.Parse(c.WebAuthnOrigin)
+		switch {
+		case err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http"):
+			bad("webauthn_origin", "must be an origin like https://gobus.example.org (got %q)", c.WebAuthnOrigin)
+		case strings.TrimRight(u.Path, "/") != "" || u.RawQuery != "":
+			bad("webauthn_origin", "must not have a path or query (got %q)", c.WebAuthnOrigin)
+		case c.WebAuthnRPID != "" && u.Hostname() != c.WebAuthnRPID && !strings.HasSuffix(u.Hostname(), "."+c.WebAuthnRPID):
+			bad("webauthn_rp_id", "%q must be the origin's host or a parent domain of it", c.WebAuthnRPID)
+		}
+	}
+	if strings.ContainsAny(c.WebAuthnRPID, ":/") {
+		bad("webauthn_rp_id", "must be a bare domain name (got %q)", c.WebAuthnRPID)
+	}
+	return errs
 }
 
-func envBool(key string, fallback bool) bool {
-	if v := os.Getenv(key); v != "" {
-		if b, err := strconv.ParseBool(v); err == nil {
-			return b
+func checkHTTPURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http:// or https:// URL (got %q)", s)
+	}
+	return nil
+}
+
+// Reload returns a copy of c with the reloadable settings taken from next,
+// which should come from Load. changed lists the keys whose value was
+// applied; ignored lists keys that differ in next but need a restart.
+func (c *Config) Reload(next *Config) (merged *Config, changed, ignored []string) {
+	m := *c
+	mv, nv := reflect.ValueOf(&m).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < mv.NumField(); i++ {
+		f := mv.Type().Field(i)
+		key := f.Tag.Get("toml")
+		if key == "-" || mv.Field(i).Equal(nv.Field(i)) {
+			continue
+		}
+		if f.Tag.Get("reload") == "true" {
+			mv.Field(i).Set(nv.Field(i))
+			changed = append(changed, key)
+		} else {
+			ignored = append(ignored, key)
 		}
 	}
-	return fallback
+	return &m, changed, ignored
 }
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     []string
+		check   func(*Config) bool
+		wantErr []string // substrings that must all appear in the error
+	}{
+		{
+			name:  "defaults",
+			check: func(c *Config) bool { return c.Port == 8080 && c.MaxUsers == 100 },
+		},
+		{
+			name: "environment overrides file",
+			file: "max_users = 5\ninvite_only = true\nalerts_url = \"http://localhost:9000/alerts.pb\"\n",
+			env:  []string{"GOBUS_MAX_USERS=7", "HOME=/root"},
+			check: func(c *Config) bool {
+				return c.MaxUsers == 7 && c.InviteOnly && c.AlertsURL == "http://localhost:9000/alerts.pb"
+			},
+		},
+		{
+			name:  "empty variable is unset",
+			env:   []string{"GOBUS_PORT="},
+			check: func(c *Config) bool { return c.Port == 8080 },
+		},
+		{
+			name:    "malformed number",
+			env:     []string{"GOBUS_MAX_USERS=lots"},
+			wantErr: []string{`GOBUS_MAX_USERS: "lots" is not a whole number`},
+		},
+		{
+			name:    "unknown variable",
+			env:     []string{"GOBUS_MAX_USER=5"},
+			wantErr: []string{"GOBUS_MAX_USER: unknown setting"},
+		},
+		{
+			name:    "unknown file key",
+			file:    "max_user = 5\n",
+			wantErr: []string{`unknown setting "max_user"`},
+		},
+		{
+			name:    "every problem reported",
+			file:    "port = 0\ngeocode_url = \"nominatim.local\"\n",
+			env:     []string{"GOBUS_LOGIN_LOCKOUT_MIN=0", "GOBUS_VAPID_SUBJECT=admin@example.org"},
+			wantErr: []string{"port: must be between", "geocode_url: must be an http", "login_lockout_min: must be at least 1", "vapid_subject"},
+		},
+		{
+			name:    "unknown geocoder",
+			env:     []string{"GOBUS_GEOCODER=google"},
+			wantErr: []string{"geocoder: must be nominatim"},
+		},
+		{
+			name:    "photon needs its own server",
+			env:     []string{"GOBUS_GEOCODER=photon"},
+			wantErr: []string{"geocode_url: must point at your photon server"},
+		},
+		{
+			name:    "public nominatim over its rate limit",
+			env:     []string{"GOBUS_GEOCODE_RATE_PER_MIN=0"},
+			wantErr: []string{"geocode_rate_per_min: must be between 1 and 60"},
+		},
+		{
+			name:  "own nominatim unlimited",
+			env:   []string{"GOBUS_GEOCODE_URL=http://nominatim.internal:8080", "GOBUS_GEOCODE_RATE_PER_MIN=0"},
+			check: func(c *Config) bool { return c.GeocodeRatePerMin == 0 },
+		},
+		{
+			name:  "photon server",
+			file:  "geocoder = \"photon\"\ngeocode_url = \"http://localhost:2322\"\n",
+			check: func(c *Config) bool { return c.Geocoder == "photon" && c.GeocodeURL == "http://localhost:2322" },
+		},
+		{
+			name:    "origin with path",
+			env:     []string{"GOBUS_WEBAUTHN_ORIGIN=https://gobus.example.org/app"},
+			wantErr: []string{"webauthn_origin: must not have a path"},
+		},
+		{
+			name:    "rp id unrelated to origin",
+			env:     []string{"GOBUS_WEBAUTHN_ORIGIN=https://gobus.example.org", "GOBUS_WEBAUTHN_RP_ID=example.com"},
+			wantErr: []string{"webauthn_rp_id"},
+		},
+		{
+			name:  "rp id parent of origin",
+			env:   []string{"GOBUS_WEBAUTHN_ORIGIN=https://gobus.example.org", "GOBUS_WEBAUTHN_RP_ID=example.org"},
+			check: func(c *Config) bool { return c.WebAuthnRPID == "example.org" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path string
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), "gobus.toml")
+				if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c, err := load(path, tt.env, nil)
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("want error containing %q, got none", tt.wantErr)
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("error %q does not mention %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.check(c) {
+				t.Errorf("unexpected config: %+v", c)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPathFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gobus.toml")
+	if err := os.WriteFile(path, []byte("port = 9090\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := load("", []string{"GOBUS_CONFIG=" + path}, func(c *Config) { c.TestMode = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != 9090 || !c.TestMode {
+		t.Errorf("Port = %d, TestMode = %v; want 9090, true", c.Port, c.TestMode)
+	}
+}
+
+func TestReload(t *testing.T) {
+	cur := Default()
+	next := Default()
+	next.MaxUsers = 10
+	next.TrustProxy = true
+	next.Port = 9090
+	next.DBPath = "/tmp/other.db"
+	next.ImportGTFS = true
+
+	merged, changed, ignored := cur.Reload(next)
+	if want := []string{"max_users", "trust_proxy"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	if want := []string{"port", "db_path"}; !reflect.DeepEqual(ignored, want) {
+		t.Errorf("ignored = %v, want %v", ignored, want)
+	}
+	if merged.MaxUsers != 10 || !merged.TrustProxy || merged.Port != 8080 || merged.DBPath != "./gobus.db" || merged.ImportGTFS {
+		t.Errorf("unexpected merged config: %+v", merged)
+	}
+	if cur.MaxUsers != 100 {
+		t.Error("Reload modified the current config")
+	}
+}
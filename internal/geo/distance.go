@@ -23,6 +23,22 @@ func BoundingBoxRadius(lat, radiusMeters float64) (latDeg, lonDeg float64) {
 	return latDeg, lonDeg
 }
 
+// Bounds is a latitude/longitude bounding box.
+type Bounds struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// Pad returns b grown by meters on every side.
+func (b Bounds) Pad(meters float64) Bounds {
+	latDeg, lonDeg := BoundingBoxRadius(max(math.Abs(b.MinLat), math.Abs(b.MaxLat)), meters)
+	return Bounds{b.MinLat - latDeg, b.MinLon - lonDeg, b.MaxLat + latDeg, b.MaxLon + lonDeg}
+}
+
+// Center returns the middle of b.
+func (b Bounds) Center() (lat, lon float64) {
+	return (b.MinLat + b.MaxLat) / 2, (b.MinLon + b.MaxLon) / 2
+}
+
 // ManhattanDistance returns the city-block walking distance in meters
 // between two lat/lon points (|N-S| + |E-W|). Better approximates actual
 // walking distance on a street grid than straight-line Haversine.
@@ -33,6 +49,29 @@ func ManhattanDistance(lat1, lon1, lat2, lon2 float64) float64 {
 	return nsMeters + ewMeters
 }
 
+// DetourFactor is roughly how much longer a walk along streets is than the
+// straight line between its ends.
+const DetourFactor = 1.3
+
+// WalkingSpeed is a typical walking pace, 3 mph, in meters per minute.
+const WalkingSpeed = 80.467
+
+// WalkDistance estimates the walking distance in meters between two
+// lat/lon points: the straight line stretched by DetourFactor.
+func WalkDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	return Haversine(lat1, lon1, lat2, lon2) * DetourFactor
+}
+
+// WalkMinutes returns the whole minutes it takes to walk meters at
+// metersPerMin, rounded up and at least 1. A speed of zero or less means
+// WalkingSpeed.
+func WalkMinutes(meters, metersPerMin float64) int {
+	if metersPerMin <= 0 {
+		metersPerMin = WalkingSpeed
+	}
+	return max(1, int(math.Ceil(meters/metersPerMin)))
+}
+
 // MetersToMiles converts meters to miles.
 func MetersToMiles(m float64) float64 {
 	return m / 1609.344
@@ -89,6 +89,20 @@ func TestBoundingBoxRadius(t *testing.T) {
 	}
 }
 
+func TestBoundsPad(t *testing.T) {
+	b := Bounds{MinLat: 44.8, MinLon: -93.5, MaxLat: 45.1, MaxLon: -92.9}.Pad(1000)
+	// About 0.009° of latitude and 0.013° of longitude at 45°
+	if math.Abs(b.MinLat-44.791) > 0.001 || math.Abs(b.MaxLat-45.109) > 0.001 {
+		t.Errorf("padded latitudes = %f..%f", b.MinLat, b.MaxLat)
+	}
+	if math.Abs(b.MinLon-(-93.5128)) > 0.001 || math.Abs(b.MaxLon-(-92.8872)) > 0.001 {
+		t.Errorf("padded longitudes = %f..%f", b.MinLon, b.MaxLon)
+	}
+	if lat, lon := b.Center(); math.Abs(lat-44.95) > 1e-9 || math.Abs(lon-(-93.2)) > 1e-9 {
+		t.Errorf("center = %f, %f", lat, lon)
+	}
+}
+
 func TestManhattanDistance(t *testing.T) {
 	tests := []struct {
 		name                   string
@@ -144,6 +158,33 @@ func TestManhattanDistance_Symmetry(t *testing.T) {
 	}
 }
 
+func TestWalkDistance(t *testing.T) {
+	hav := Haversine(44.97780, -93.26500, 44.97780, -93.26370)
+	got := WalkDistance(44.97780, -93.26500, 44.97780, -93.26370)
+	if math.Abs(got-hav*DetourFactor) > 0.001 {
+		t.Errorf("WalkDistance() = %.1f m, want %.1f m", got, hav*DetourFactor)
+	}
+}
+
+func TestWalkMinutes(t *testing.T) {
+	tests := []struct {
+		meters, speed float64
+		want          int
+	}{
+		{0, 0, 1},
+		{80, 0, 1},
+		{81, 0, 2},
+		{400, 0, 5},
+		{400, 50, 8},
+		{400, -1, 5},
+	}
+	for _, tt := range tests {
+		if got := WalkMinutes(tt.meters, tt.speed); got != tt.want {
+			t.Errorf("WalkMinutes(%v, %v) = %d, want %d", tt.meters, tt.speed, got, tt.want)
+		}
+	}
+}
+
 func TestMetersToMiles(t *testing.T) {
 	tests := []struct {
 		meters float64
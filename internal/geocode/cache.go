@@ -0,0 +1,201 @@
+package geocode
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"gobus/internal/metrics"
+	"gobus/internal/search"
+	"gobus/internal/storage"
+)
+
+var lookups = metrics.NewCounter("gobus_geocode_lookups_total",
+	"Geocoder lookups by operation and how they were answered: cache, upstream, stale (expired cache entry used because the upstream failed) or error.",
+	"op", "source")
+
+// missTTL is how long a search that found nothing is remembered: new
+// addresses appear in OpenStreetMap, and a typo'd query is rarely repeated.
+const missTTL = 24 * time.Hour
+
+// pruneEvery is how often Cached deletes answers too old to serve even
+// when the upstream is down.
+const pruneEvery = time.Hour
+
+// Cached wraps a remote geocoder with a cache in the database, shared by
+// every user, and a rate limit on what reaches the upstream. Searches are
+// keyed by their search.Normalize form, so "Lake Street" and "lake st"
+// share an answer; reverse lookups by the point rounded to about 10 m.
+// Concurrent lookups of the same key wait for a single upstream request.
+type Cached struct {
+	inner  Geocoder
+	db     *storage.DB
+	limit  *Limiter
+	ttl    time.Duration
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu        sync.Mutex
+	inflight  map[string]*call
+	lastPrune time.Time
+}
+
+// call is an upstream lookup others with the same key are waiting on.
+type call struct {
+	done chan struct{}
+	row  *storage.GeocodeCacheRow
+	err  error
+}
+
+// NewCached caches inner's answers in db for ttl and sends it at most
+// what limit allows (nil: no limit).
+func NewCached(inner Geocoder, db *storage.DB, limit *Limiter, ttl time.Duration, logger *slog.Logger) *Cached {
+	return &Cached{
+		inner:    inner,
+		db:       db,
+		limit:    limit,
+		ttl:      ttl,
+		logger:   logger,
+		now:      time.Now,
+		inflight: make(map[string]*call),
+	}
+}
+
+// Search geocodes query from the cache if it can, else upstream.
+func (c *Cached) Search(ctx context.Context, query string) (*Result, error) {
+	key := search.Normalize(query)
+	if key == "" {
+		return nil, nil
+	}
+	row, err := c.lookup(ctx, "search", key, func(ctx context.Context) (*storage.GeocodeCacheRow, error) {
+		res, err := c.inner.Search(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			return &storage.GeocodeCacheRow{}, nil
+		}
+		return &storage.GeocodeCacheRow{Found: true, Lat: res.Lat, Lon: res.Lon, Name: res.DisplayName}, nil
+	})
+	if err != nil || !row.Found {
+		return nil, err
+	}
+	return &Result{Lat: row.Lat, Lon: row.Lon, DisplayName: row.Name}, nil
+}
+
+// Reverse looks up the address at the rounded point from the cache if it
+// can, else upstream.
+func (c *Cached) Reverse(ctx context.Context, lat, lon float64) (string, error) {
+	lat, lon = math.Round(lat*1e4)/1e4, math.Round(lon*1e4)/1e4
+	key := fmt.Sprintf("%.4f,%.4f", lat, lon)
+	row, err := c.lookup(ctx, "reverse", key, func(ctx context.Context) (*storage.GeocodeCacheRow, error) {
+		addr, err := c.inner.Reverse(ctx, lat, lon)
+		if err != nil {
+			return nil, err
+		}
+		return &storage.GeocodeCacheRow{Found: true, Name: addr}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return row.Name, nil
+}
+
+// lookup answers from a fresh cache entry, or else asks fetch (once for
+// all concurrent callers with this key) and stores what it says. If fetch
+// fails, an expired entry is better than nothing.
+func (c *Cached) lookup(ctx context.Context, op, key string, fetch func(context.Context) (*storage.GeocodeCacheRow, error)) (*storage.GeocodeCacheRow, error) {
+	cached, err := c.db.GetGeocodeCache(ctx, op, key)
+	if err != nil {
+		c.logger.Warn("geocode cache read", "error", err)
+	}
+	if cached != nil && c.fresh(cached) {
+		lookups.Inc(op, "cache")
+		return cached, nil
+	}
+
+	flight := op + "\x00" + key
+	c.mu.Lock()
+	cl, waiting := c.inflight[flight]
+	if !waiting {
+		cl = &call{done: make(chan struct{})}
+		c.inflight[flight] = cl
+	}
+	c.mu.Unlock()
+
+	if !waiting {
+		cl.row, cl.err = c.fetch(ctx, op, key, fetch)
+		c.mu.Lock()
+		delete(c.inflight, flight)
+		c.mu.Unlock()
+		close(cl.done)
+	} else {
+		select {
+		case <-cl.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if cl.err != nil {
+		if cached != nil {
+			lookups.Inc(op, "stale")
+			return cached, nil
+		}
+		lookups.Inc(op, "error")
+		return nil, cl.err
+	}
+	lookups.Inc(op, "upstream")
+	return cl.row, nil
+}
+
+func (c *Cached) fetch(ctx context.Context, op, key string, fetch func(context.Context) (*storage.GeocodeCacheRow, error)) (*storage.GeocodeCacheRow, error) {
+	if err := c.limit.Wait(ctx); err != nil {
+		return nil, err
+	}
+	row, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row.FetchedAt = c.now()
+	// The answer is good even if the request that asked has gone
+	storeCtx := context.WithoutCancel(ctx)
+	if err := c.db.PutGeocodeCache(storeCtx, op, key, *row); err != nil {
+		c.logger.Warn("geocode cache write", "error", err)
+	}
+	c.prune(storeCtx)
+	return row, nil
+}
+
+func (c *Cached) fresh(r *storage.GeocodeCacheRow) bool {
+	ttl := c.ttl
+	if !r.Found {
+		ttl = min(ttl, missTTL)
+	}
+	return c.now().Sub(r.FetchedAt) < ttl
+}
+
+// prune deletes, at most once per pruneEvery, answers older than twice the
+// TTL. Between one and two TTLs old they are only served if the upstream
+// fails.
+func (c *Cached) prune(ctx context.Context) {
+	c.mu.Lock()
+	now := c.now()
+	due := now.Sub(c.lastPrune) >= pruneEvery
+	if due {
+		c.lastPrune = now
+	}
+	c.mu.Unlock()
+	if !due {
+		return
+	}
+	n, err := c.db.PruneGeocodeCache(ctx, now.Add(-2*c.ttl))
+	if err != nil {
+		c.logger.Warn("geocode cache prune", "error", err)
+	} else if n > 0 {
+		c.logger.Info("geocode cache pruned", "entries", n)
+	}
+}
@@ -0,0 +1,163 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gobus/internal/storage"
+)
+
+// fakeGeocoder counts upstream calls and answers from a fixed result.
+type fakeGeocoder struct {
+	calls   atomic.Int32
+	result  *Result
+	err     error
+	release chan struct{} // if set, calls block until it is closed
+}
+
+func (f *fakeGeocoder) Search(ctx context.Context, query string) (*Result, error) {
+	f.calls.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+	return f.result, f.err
+}
+
+func (f *fakeGeocoder) Reverse(ctx context.Context, lat, lon float64) (string, error) {
+	f.calls.Add(1)
+	if f.err != nil {
+		return "", f.err
+	}
+	return "3501 Chicago Ave S", nil
+}
+
+func newTestCache(t *testing.T, inner Geocoder) *Cached {
+	t.Helper()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.db"), slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewCached(inner, db, nil, 30*24*time.Hour, slog.New(slog.DiscardHandler))
+}
+
+func TestCachedSearch(t *testing.T) {
+	ctx := context.Background()
+	inner := &fakeGeocoder{result: &Result{Lat: 44.9386, Lon: -93.2625, DisplayName: "3501 Chicago Ave S"}}
+	c := newTestCache(t, inner)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for _, q := range []string{"3501 Chicago Avenue South", "3501 chicago ave s", "  3501 CHICAGO AVE. S "} {
+		res, err := c.Search(ctx, q)
+		if err != nil || res == nil || res.Lat != 44.9386 {
+			t.Fatalf("Search(%q) = %+v, %v", q, res, err)
+		}
+	}
+	if n := inner.calls.Load(); n != 1 {
+		t.Errorf("upstream called %d times for one normalized query, want 1", n)
+	}
+
+	// Expired: asked again, but the stale answer covers an upstream failure
+	now = now.Add(31 * 24 * time.Hour)
+	inner.err = errors.New("down")
+	res, err := c.Search(ctx, "3501 chicago ave s")
+	if err != nil || res == nil {
+		t.Fatalf("stale Search = %+v, %v; want the expired answer", res, err)
+	}
+	if n := inner.calls.Load(); n != 2 {
+		t.Errorf("upstream called %d times after expiry, want 2", n)
+	}
+}
+
+func TestCachedSearchMiss(t *testing.T) {
+	ctx := context.Background()
+	inner := &fakeGeocoder{}
+	c := newTestCache(t, inner)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for range 2 {
+		if res, err := c.Search(ctx, "nowhere at all"); res != nil || err != nil {
+			t.Fatalf("Search = %+v, %v; want nil, nil", res, err)
+		}
+	}
+	if n := inner.calls.Load(); n != 1 {
+		t.Errorf("upstream called %d times, want the miss cached", n)
+	}
+	now = now.Add(missTTL + time.Minute)
+	c.Search(ctx, "nowhere at all")
+	if n := inner.calls.Load(); n != 2 {
+		t.Errorf("upstream called %d times, want a miss to expire after a day", n)
+	}
+}
+
+func TestCachedReverseRounds(t *testing.T) {
+	ctx := context.Background()
+	inner := &fakeGeocoder{}
+	c := newTestCache(t, inner)
+	// A few meters apart, same rounded point
+	for _, p := range [][2]float64{{44.93861, -93.26252}, {44.93864, -93.26248}} {
+		if addr, err := c.Reverse(ctx, p[0], p[1]); err != nil || addr != "3501 Chicago Ave S" {
+			t.Fatalf("Reverse = %q, %v", addr, err)
+		}
+	}
+	if n := inner.calls.Load(); n != 1 {
+		t.Errorf("upstream called %d times, want 1", n)
+	}
+}
+
+func TestCachedCoalescesConcurrentLookups(t *testing.T) {
+	inner := &fakeGeocoder{result: &Result{Lat: 1, Lon: 2}, release: make(chan struct{})}
+	c := newTestCache(t, inner)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, err := c.Search(context.Background(), "lake st"); err != nil || res == nil {
+				t.Errorf("Search = %+v, %v", res, err)
+			}
+		}()
+	}
+	// Let the lookups pile up behind the first before it answers
+	time.Sleep(50 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+	if n := inner.calls.Load(); n != 1 {
+		t.Errorf("upstream called %d times for concurrent lookups, want 1", n)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(600) // one every 100 ms
+	ctx := context.Background()
+
+	start := time.Now()
+	for range 3 {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 190*time.Millisecond {
+		t.Errorf("3 lookups took %v, want at least 200ms", d)
+	}
+
+	// Queued past the deadline: refused at once
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(short); !errors.Is(err, ErrBusy) {
+		t.Errorf("Wait past deadline = %v, want ErrBusy", err)
+	}
+
+	if err := NewLimiter(0).Wait(ctx); err != nil {
+		t.Errorf("unlimited Wait = %v", err)
+	}
+}
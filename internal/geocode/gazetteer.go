@@ -0,0 +1,183 @@
+package geocode
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gobus/internal/search"
+	"gobus/internal/storage"
+)
+
+// Gazetteer geocodes from the addresses table, filled by ImportAddresses,
+// without any outside service. It knows house addresses only; places and
+// landmarks need a remote geocoder.
+type Gazetteer struct {
+	db *storage.DB
+}
+
+// NewGazetteer creates a geocoder over the addresses in db.
+func NewGazetteer(db *storage.DB) *Gazetteer {
+	return &Gazetteer{db: db}
+}
+
+// reverseRadius is how far Reverse looks for an address point, about a
+// city block.
+const reverseRadius = 120
+
+// Search finds a street address such as "3501 Chicago Ave S" or "3501
+// chicago avenue south, minneapolis". A house number not in the gazetteer
+// gives the nearest one on the same street. Returns nil for anything that
+// isn't a house number and street.
+func (g *Gazetteer) Search(ctx context.Context, query string) (*Result, error) {
+	num, street, city, ok := parseAddress(query)
+	if !ok {
+		return nil, nil
+	}
+	a, err := g.db.FindAddress(ctx, num, street, city)
+	if err != nil || a == nil {
+		return nil, err
+	}
+	name := a.Number + " " + a.Street
+	if a.City != "" {
+		name += ", " + a.City
+	}
+	return &Result{Lat: a.Lat, Lon: a.Lon, DisplayName: name}, nil
+}
+
+// Reverse returns the nearest address point as "123 Main St".
+func (g *Gazetteer) Reverse(ctx context.Context, lat, lon float64) (string, error) {
+	a, err := g.db.NearestAddress(ctx, lat, lon, reverseRadius)
+	if err != nil {
+		return "", err
+	}
+	if a == nil {
+		return "", fmt.Errorf("no address found")
+	}
+	return a.Number + " " + a.Street, nil
+}
+
+// parseAddress splits "3501 Chicago Ave S, Minneapolis, MN" into the
+// house number and the normalized street and city.
+func parseAddress(query string) (num int, street, city string, ok bool) {
+	parts := strings.Split(query, ",")
+	words := strings.Fields(parts[0])
+	if len(words) < 2 {
+		return 0, "", "", false
+	}
+	num, ok = storage.HouseNumber(words[0])
+	if !ok {
+		return 0, "", "", false
+	}
+	street = search.Normalize(strings.Join(words[1:], " "))
+	if len(parts) > 1 {
+		city = search.Normalize(parts[1])
+	}
+	return num, street, city, street != ""
+}
+
+// columns maps header names used by address extracts to fields:
+// OpenAddresses ("LON", "NUMBER"), osmconvert --csv with OSM tags
+// ("@lon", "addr:housenumber"), and plain names.
+var columns = map[string]string{
+	"lon": "lon", "longitude": "lon", "x": "lon",
+	"lat": "lat", "latitude": "lat", "y": "lat",
+	"number": "number", "housenumber": "number", "house_number": "number",
+	"street":   "street",
+	"city":     "city",
+	"postcode": "postcode", "zip": "postcode", "postal_code": "postcode",
+}
+
+// ImportAddresses replaces the gazetteer in db with the addresses in a
+// CSV or tab-separated file with a header line naming at least the
+// longitude, latitude, house number and street columns. Returns how many
+// addresses were stored.
+func ImportAddresses(ctx context.Context, db *storage.DB, r io.Reader) (int, error) {
+	next, err := readAddresses(r)
+	if err != nil {
+		return 0, err
+	}
+	return db.ImportAddresses(ctx, next)
+}
+
+// readAddresses returns a function that reads the next address from r,
+// or nil at the end.
+func readAddresses(r io.Reader) (func() (*storage.AddressRow, error), error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.ReuseRecord = true
+
+	// The header says whether this is comma or tab separated
+	first, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read address header: %w", err)
+	}
+	header := first
+	if len(first) == 1 && strings.Contains(first[0], "\t") {
+		header = strings.Split(first[0], "\t")
+		cr.Comma = '\t'
+	}
+	idx := map[string]int{}
+	for i, h := range header {
+		h = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(h)), "@"), "addr:")
+		if f, ok := columns[h]; ok {
+			if _, dup := idx[f]; !dup {
+				idx[f] = i
+			}
+		}
+	}
+	var missing []string
+	for _, f := range []string{"lon", "lat", "number", "street"} {
+		if _, ok := idx[f]; !ok {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("address file has no %s column", strings.Join(missing, ", "))
+	}
+
+	field := func(rec []string, f string) string {
+		i, ok := idx[f]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+	return func() (*storage.AddressRow, error) {
+		for {
+			rec, err := cr.Read()
+			if errors.Is(err, io.EOF) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("read addresses: %w", err)
+			}
+			lonStr, latStr := field(rec, "lon"), field(rec, "lat")
+			if lonStr == "" || latStr == "" {
+				continue
+			}
+			line, _ := cr.FieldPos(0)
+			lon, err := strconv.ParseFloat(lonStr, 64)
+			if err != nil {
+				return nil, fmt.Errorf("address line %d: bad longitude %q", line, lonStr)
+			}
+			lat, err := strconv.ParseFloat(latStr, 64)
+			if err != nil {
+				return nil, fmt.Errorf("address line %d: bad latitude %q", line, latStr)
+			}
+			return &storage.AddressRow{
+				Number:   field(rec, "number"),
+				Street:   field(rec, "street"),
+				City:     field(rec, "city"),
+				Postcode: field(rec, "postcode"),
+				Lat:      lat,
+				Lon:      lon,
+			}, nil
+		}
+	}, nil
+}
@@ -0,0 +1,89 @@
+// Package geocode turns addresses into coordinates and back, through a
+// Nominatim, Photon or Pelias server or a local gazetteer.
+package geocode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gobus/internal/geo"
+	"gobus/internal/storage"
+)
+
+// Result holds a geocoding result.
+type Result struct {
+	Lat         float64
+	Lon         float64
+	DisplayName string
+}
+
+// Geocoder looks up addresses.
+type Geocoder interface {
+	// Search geocodes a free-form query, biased toward the feed's area.
+	// Returns the top result, or nil if nothing found.
+	Search(ctx context.Context, query string) (*Result, error)
+	// Reverse returns a short address ("123 Main St") for a point.
+	Reverse(ctx context.Context, lat, lon float64) (string, error)
+}
+
+// BoundsFunc returns the area searches should stay within, or ok false
+// if it isn't known yet.
+type BoundsFunc func(ctx context.Context) (b geo.Bounds, ok bool)
+
+// boundsPadding is how far past the outermost stops addresses are still
+// worth finding: people walk to the end of the line.
+const boundsPadding = 3000
+
+// Kinds lists the geocoder backends New accepts; config checks the
+// geocoder setting against it.
+var Kinds = []string{"nominatim", "photon", "pelias", "gazetteer", "none"}
+
+// Remote reports whether the geocoder kind is a server GoBus calls out to,
+// as opposed to a local lookup.
+func Remote(kind string) bool {
+	return kind == "nominatim" || kind == "photon" || kind == "pelias"
+}
+
+// ErrNoGeocoder is returned by Reverse when address lookup is turned off.
+var ErrNoGeocoder = errors.New("no geocoder configured")
+
+// New returns the geocoder of the given kind. baseURL is the server for
+// the remote kinds; db holds the gazetteer. bounds, if not nil, limits
+// searches to the area it returns, padded a little. userAgent identifies
+// GoBus to remote servers, as Nominatim's usage policy requires.
+func New(kind, baseURL, userAgent string, db *storage.DB, bounds BoundsFunc) (Geocoder, error) {
+	if bounds == nil {
+		bounds = func(context.Context) (geo.Bounds, bool) { return geo.Bounds{}, false }
+	}
+	padded := func(ctx context.Context) (geo.Bounds, bool) {
+		b, ok := bounds(ctx)
+		if !ok {
+			return b, false
+		}
+		return b.Pad(boundsPadding), true
+	}
+	switch kind {
+	case "nominatim":
+		return NewNominatim(baseURL, userAgent, padded), nil
+	case "photon":
+		return NewPhoton(baseURL, userAgent, padded), nil
+	case "pelias":
+		return NewPelias(baseURL, userAgent, padded), nil
+	case "gazetteer":
+		return NewGazetteer(db), nil
+	case "none":
+		return none{}, nil
+	}
+	return nil, fmt.Errorf("unknown geocoder %q", kind)
+}
+
+// none is the geocoder when address lookup is turned off: searches find
+// nothing, so search falls back on stop names alone.
+type none struct{}
+
+func (none) Search(context.Context, string) (*Result, error) { return nil, nil }
+
+func (none) Reverse(context.Context, float64, float64) (string, error) {
+	return "", ErrNoGeocoder
+}
@@ -0,0 +1,189 @@
+package geocode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gobus/internal/geo"
+	"gobus/internal/storage"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		query  string
+		num    int
+		street string
+		city   string
+		ok     bool
+	}{
+		{"3501 Chicago Ave S", 3501, "chicago ave s", "", true},
+		{"3501 chicago avenue south, Minneapolis, MN", 3501, "chicago ave s", "minneapolis", true},
+		{"128B  Fourth St", 128, "4th st", "", true},
+		{"Chicago Ave S", 0, "", "", false},
+		{"3501", 0, "", "", false},
+	}
+	for _, tt := range tests {
+		num, street, city, ok := parseAddress(tt.query)
+		if num != tt.num || street != tt.street || city != tt.city || ok != tt.ok {
+			t.Errorf("parseAddress(%q) = %d, %q, %q, %v; want %d, %q, %q, %v",
+				tt.query, num, street, city, ok, tt.num, tt.street, tt.city, tt.ok)
+		}
+	}
+}
+
+func TestReadAddresses(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    []storage.AddressRow
+		wantErr string
+	}{
+		{
+			name: "openaddresses",
+			file: "LON,LAT,NUMBER,STREET,UNIT,CITY,DISTRICT,REGION,POSTCODE,ID,HASH\n" +
+				"-93.2625,44.9386,3501,CHICAGO AVE S,,MINNEAPOLIS,,MN,55407,,abc\n" +
+				",,,,,,,,,,\n",
+			want: []storage.AddressRow{{Number: "3501", Street: "CHICAGO AVE S", City: "MINNEAPOLIS", Postcode: "55407", Lat: 44.9386, Lon: -93.2625}},
+		},
+		{
+			name: "osmconvert tab separated",
+			file: "@lon\t@lat\taddr:housenumber\taddr:street\taddr:city\n" +
+				"-93.1\t44.9\t12\tMain Street\tSaint Paul\n",
+			want: []storage.AddressRow{{Number: "12", Street: "Main Street", City: "Saint Paul", Lat: 44.9, Lon: -93.1}},
+		},
+		{
+			name:    "missing columns",
+			file:    "lon,lat,street\n",
+			wantErr: "no number column",
+		},
+		{
+			name:    "bad coordinate",
+			file:    "lon,lat,number,street\nabc,44.9,1,Main St\n",
+			wantErr: `line 2: bad longitude "abc"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := readAddresses(strings.NewReader(tt.file))
+			var got []storage.AddressRow
+			for err == nil {
+				var a *storage.AddressRow
+				if a, err = next(); a == nil {
+					break
+				}
+				got = append(got, *a)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d addresses, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("address %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func testBounds(context.Context) (geo.Bounds, bool) {
+	return geo.Bounds{MinLat: 44.8, MinLon: -93.5, MaxLat: 45.1, MaxLon: -92.9}, true
+}
+
+func TestRemoteSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		geocoder func(baseURL string) Geocoder
+		path     string
+		params   map[string]string
+		body     string
+		want     Result
+	}{
+		{
+			name:     "nominatim",
+			geocoder: func(u string) Geocoder { return NewNominatim(u, "test", testBounds) },
+			path:     "/search",
+			params:   map[string]string{"q": "3501 Chicago Ave S", "viewbox": "-93.5000,44.8000,-92.9000,45.1000", "bounded": "1"},
+			body:     `[{"lat":"44.9386","lon":"-93.2625","display_name":"3501, Chicago Avenue South, Minneapolis"}]`,
+			want:     Result{Lat: 44.9386, Lon: -93.2625, DisplayName: "3501, Chicago Avenue South, Minneapolis"},
+		},
+		{
+			name:     "photon",
+			geocoder: func(u string) Geocoder { return NewPhoton(u, "test", testBounds) },
+			path:     "/api",
+			params:   map[string]string{"q": "3501 Chicago Ave S", "bbox": "-93.500000,44.800000,-92.900000,45.100000", "lat": "44.950000"},
+			body: `{"features":[{"geometry":{"coordinates":[-93.2625,44.9386]},
+				"properties":{"housenumber":"3501","street":"Chicago Avenue South","city":"Minneapolis"}}]}`,
+			want: Result{Lat: 44.9386, Lon: -93.2625, DisplayName: "3501 Chicago Avenue South, Minneapolis"},
+		},
+		{
+			name:     "pelias",
+			geocoder: func(u string) Geocoder { return NewPelias(u, "test", testBounds) },
+			path:     "/v1/search",
+			params:   map[string]string{"text": "3501 Chicago Ave S", "boundary.rect.min_lat": "44.800000", "focus.point.lon": "-93.200000"},
+			body: `{"features":[{"geometry":{"coordinates":[-93.2625,44.9386]},
+				"properties":{"label":"3501 Chicago Ave S, Minneapolis, MN, USA"}}]}`,
+			want: Result{Lat: 44.9386, Lon: -93.2625, DisplayName: "3501 Chicago Ave S, Minneapolis, MN, USA"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got url.Values
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path {
+					http.NotFound(w, r)
+					return
+				}
+				got = r.URL.Query()
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			res, err := tt.geocoder(srv.URL).Search(context.Background(), "3501 Chicago Ave S")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.params {
+				if got.Get(k) != v {
+					t.Errorf("param %s = %q, want %q", k, got.Get(k), v)
+				}
+			}
+			if res == nil || *res != tt.want {
+				t.Errorf("result = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestNominatimWithoutBounds(t *testing.T) {
+	var got url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	g, err := New("nominatim", srv.URL, "test", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := g.Search(context.Background(), "anything")
+	if err != nil || res != nil {
+		t.Fatalf("Search = %+v, %v; want nil, nil", res, err)
+	}
+	if got.Has("viewbox") || got.Has("bounded") {
+		t.Errorf("searched within a viewbox before the feed was loaded: %v", got)
+	}
+}
@@ -0,0 +1,89 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gobus/internal/metrics"
+)
+
+// ErrBusy is returned when a lookup would have to queue longer than its
+// request can wait for the rate limit.
+var ErrBusy = errors.New("geocoder busy")
+
+// maxQueueWait caps how long a lookup queues for the rate limit when its
+// context has no deadline.
+const maxQueueWait = 10 * time.Second
+
+var queued = metrics.NewGauge("gobus_geocode_queued", "Geocoder lookups waiting for the upstream rate limit.")
+
+// Limiter is a token bucket shared by every lookup sent to one upstream
+// server. Lookups over the rate queue in arrival order until their turn,
+// or fail with ErrBusy if that is past their deadline.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewLimiter allows perMinute lookups a minute, one at a time: Nominatim's
+// usage policy is an absolute maximum of one request per second, not an
+// average. Returns nil, which never waits, if perMinute is 0.
+func NewLimiter(perMinute int) *Limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &Limiter{
+		rate:   float64(perMinute) / 60,
+		burst:  1,
+		tokens: 1,
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// Wait blocks until the caller may send a request.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := l.now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	var delay time.Duration
+	if l.tokens < 1 {
+		delay = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	}
+	deadline, ok := ctx.Deadline()
+	if delay > maxQueueWait || ok && now.Add(delay).After(deadline) {
+		l.mu.Unlock()
+		return ErrBusy
+	}
+	// Take the token now, going into debt, so later callers queue behind
+	l.tokens--
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+
+	queued.Inc()
+	defer queued.Dec()
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// Hand the slot to whoever comes next
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -11,40 +11,41 @@ import (
 	"time"
 )
 
-// Result holds a geocoding result.
-type Result struct {
-	Lat         float64
-	Lon         float64
-	DisplayName string
-}
-
-// Client is a Nominatim geocoding client.
-type Client struct {
+// Nominatim is a Nominatim geocoding client.
+type Nominatim struct {
 	httpClient *http.Client
+	baseURL    string
 	userAgent  string
+	bounds     BoundsFunc
 }
 
-// New creates a Nominatim geocoding client.
+// NewNominatim creates a Nominatim geocoding client for the server at
+// baseURL, e.g. "https://nominatim.openstreetmap.org". Searches stay
+// within bounds once it knows them.
 // userAgent is required by Nominatim's usage policy.
-func New(userAgent string) *Client {
-	return &Client{
+func NewNominatim(baseURL, userAgent string, bounds BoundsFunc) *Nominatim {
+	return &Nominatim{
 		httpClient: &http.Client{Timeout: 5 * time.Second},
+		baseURL:    strings.TrimRight(baseURL, "/"),
 		userAgent:  userAgent,
+		bounds:     bounds,
 	}
 }
 
-// Search geocodes a free-form query, biased toward the Twin Cities area.
+// Search geocodes a free-form query within the feed's area.
 // Returns the top result, or nil if nothing found.
-func (c *Client) Search(ctx context.Context, query string) (*Result, error) {
-	u := "https://nominatim.openstreetmap.org/search?" + url.Values{
+func (c *Nominatim) Search(ctx context.Context, query string) (*Result, error) {
+	params := url.Values{
 		"q":              {query},
 		"format":         {"jsonv2"},
 		"limit":          {"1"},
-		"countrycodes":   {"us"},
-		"viewbox":        {"-93.55,44.85,-92.95,45.10"}, // Twin Cities metro
-		"bounded":        {"1"},
 		"addressdetails": {"0"},
-	}.Encode()
+	}
+	if b, ok := c.bounds(ctx); ok {
+		params.Set("viewbox", fmt.Sprintf("%.4f,%.4f,%.4f,%.4f", b.MinLon, b.MinLat, b.MaxLon, b.MaxLat))
+		params.Set("bounded", "1")
+	}
+	u := c.baseURL + "/search?" + params.Encode()
 
 	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
 	if err != nil {
@@ -93,8 +94,8 @@ func (c *Client) Search(ctx context.Context, query string) (*Result, error) {
 // Reverse performs reverse geocoding: lat/lon → nearest address.
 // Returns a short address string (house number + road), or the full
 // display name if those fields are missing.
-func (c *Client) Reverse(ctx context.Context, lat, lon float64) (string, error) {
-	u := "https://nominatim.openstreetmap.org/reverse?" + url.Values{
+func (c *Nominatim) Reverse(ctx context.Context, lat, lon float64) (string, error) {
+	u := c.baseURL + "/reverse?" + url.Values{
 		"lat":            {strconv.FormatFloat(lat, 'f', 6, 64)},
 		"lon":            {strconv.FormatFloat(lon, 'f', 6, 64)},
 		"format":         {"jsonv2"},
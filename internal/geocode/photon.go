@@ -0,0 +1,198 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Photon is a client for a self-hosted Photon server, or with NewPelias
+// a Pelias one. Both answer with GeoJSON features carrying the address
+// parts as properties; only the endpoints and parameter names differ.
+type Photon struct {
+	httpClient *http.Client
+	baseURL    string
+	userAgent  string
+	bounds     BoundsFunc
+	pelias     bool
+}
+
+// NewPhoton creates a client for the Photon server at baseURL, e.g.
+// "http://localhost:2322".
+func NewPhoton(baseURL, userAgent string, bounds BoundsFunc) *Photon {
+	return &Photon{
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		userAgent:  userAgent,
+		bounds:     bounds,
+	}
+}
+
+// NewPelias creates a client for the Pelias API at baseURL, e.g.
+// "http://localhost:4000".
+func NewPelias(baseURL, userAgent string, bounds BoundsFunc) *Photon {
+	c := NewPhoton(baseURL, userAgent, bounds)
+	c.pelias = true
+	return c
+}
+
+func (c *Photon) name() string {
+	if c.pelias {
+		return "pelias"
+	}
+	return "photon"
+}
+
+// feature is the part of a Photon or Pelias GeoJSON feature GoBus uses.
+type feature struct {
+	Geometry struct {
+		Coordinates []float64 `json:"coordinates"` // lon, lat
+	} `json:"geometry"`
+	Properties struct {
+		Name        string `json:"name"`
+		HouseNumber string `json:"housenumber"`
+		Street      string `json:"street"`
+		City        string `json:"city"`  // Photon
+		Label       string `json:"label"` // Pelias: the whole address
+	} `json:"properties"`
+}
+
+// shortAddress returns "123 Main St", or the place name.
+func (f *feature) shortAddress() string {
+	p := f.Properties
+	if p.Street != "" {
+		if p.HouseNumber != "" {
+			return p.HouseNumber + " " + p.Street
+		}
+		return p.Street
+	}
+	return p.Name
+}
+
+func (f *feature) displayName() string {
+	p := f.Properties
+	if p.Label != "" {
+		return p.Label
+	}
+	var parts []string
+	if s := f.shortAddress(); s != "" {
+		parts = append(parts, s)
+	}
+	if p.Name != "" && p.Street != "" {
+		parts = append([]string{p.Name}, parts...)
+	}
+	if p.City != "" {
+		parts = append(parts, p.City)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Search geocodes a free-form query within the feed's area.
+// Returns the top result, or nil if nothing found.
+func (c *Photon) Search(ctx context.Context, query string) (*Result, error) {
+	b, known := c.bounds(ctx)
+	var u string
+	if c.pelias {
+		params := url.Values{"text": {query}, "size": {"1"}}
+		if known {
+			lat, lon := b.Center()
+			params.Set("boundary.rect.min_lat", formatCoord(b.MinLat))
+			params.Set("boundary.rect.min_lon", formatCoord(b.MinLon))
+			params.Set("boundary.rect.max_lat", formatCoord(b.MaxLat))
+			params.Set("boundary.rect.max_lon", formatCoord(b.MaxLon))
+			params.Set("focus.point.lat", formatCoord(lat))
+			params.Set("focus.point.lon", formatCoord(lon))
+		}
+		u = c.baseURL + "/v1/search?" + params.Encode()
+	} else {
+		params := url.Values{"q": {query}, "limit": {"1"}}
+		if known {
+			lat, lon := b.Center()
+			params.Set("bbox", fmt.Sprintf("%s,%s,%s,%s",
+				formatCoord(b.MinLon), formatCoord(b.MinLat), formatCoord(b.MaxLon), formatCoord(b.MaxLat)))
+			params.Set("lat", formatCoord(lat))
+			params.Set("lon", formatCoord(lon))
+		}
+		u = c.baseURL + "/api?" + params.Encode()
+	}
+
+	f, err := c.get(ctx, u)
+	if err != nil || f == nil {
+		return nil, err
+	}
+	return &Result{
+		Lat:         f.Geometry.Coordinates[1],
+		Lon:         f.Geometry.Coordinates[0],
+		DisplayName: f.displayName(),
+	}, nil
+}
+
+// Reverse performs reverse geocoding: lat/lon → nearest address.
+func (c *Photon) Reverse(ctx context.Context, lat, lon float64) (string, error) {
+	var u string
+	if c.pelias {
+		u = c.baseURL + "/v1/reverse?" + url.Values{
+			"point.lat": {formatCoord(lat)},
+			"point.lon": {formatCoord(lon)},
+			"size":      {"1"},
+		}.Encode()
+	} else {
+		u = c.baseURL + "/reverse?" + url.Values{
+			"lat":   {formatCoord(lat)},
+			"lon":   {formatCoord(lon)},
+			"limit": {"1"},
+		}.Encode()
+	}
+
+	f, err := c.get(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	if f == nil || f.shortAddress() == "" {
+		return "", fmt.Errorf("no address found")
+	}
+	return f.shortAddress(), nil
+}
+
+// get fetches u and returns its first feature, or nil if there are none.
+func (c *Photon) get(ctx context.Context, u string) (*feature, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s request: %w", c.name(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s status %d", c.name(), resp.StatusCode)
+	}
+
+	var fc struct {
+		Features []feature `json:"features"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&fc); err != nil {
+		return nil, fmt.Errorf("%s decode: %w", c.name(), err)
+	}
+	if len(fc.Features) == 0 {
+		return nil, nil
+	}
+	f := &fc.Features[0]
+	if len(f.Geometry.Coordinates) < 2 {
+		return nil, fmt.Errorf("%s: feature without coordinates", c.name())
+	}
+	return f, nil
+}
+
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', 6, 64)
+}
@@ -7,11 +7,17 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
+	"gobus/internal/metrics"
 	"gobus/internal/storage"
 )
 
+var importDuration = metrics.NewGauge("gobus_gtfs_import_duration_seconds",
+	"How long the most recent successful GTFS import took.")
+
 // Importer loads parsed GTFS data into SQLite.
 type Importer struct {
 	db     *storage.DB
@@ -71,6 +77,9 @@ func (imp *Importer) Import(ctx context.Context, feed *Feed, zipPath string) err
 	if err := imp.db.RebuildRTree(ctx, tx); err != nil {
 		return fmt.Errorf("rebuild rtree: %w", err)
 	}
+	if err := imp.db.RebuildSearchIndex(ctx, tx); err != nil {
+		return fmt.Errorf("rebuild search index: %w", err)
+	}
 
 	// Store metadata
 	now := time.Now().UTC().Format(time.RFC3339)
@@ -95,6 +104,7 @@ func (imp *Importer) Import(ctx context.Context, feed *Feed, zipPath string) err
 		return fmt.Errorf("commit: %w", err)
 	}
 
+	importDuration.Set(time.Since(start).Seconds())
 	imp.logger.Info("GTFS import complete",
 		"duration", time.Since(start).Round(time.Millisecond),
 		"routes", len(feed.Routes),
@@ -157,8 +167,8 @@ func (imp *Importer) importRoutes(ctx context.Context, tx *sql.Tx, routes []Rout
 func (imp *Importer) importStops(ctx context.Context, tx *sql.Tx, stops []Stop) error {
 	stmt, err := tx.PrepareContext(ctx,
 		`INSERT INTO stops (stop_id, stop_code, stop_name, stop_desc, stop_lat, stop_lon,
-		 zone_id, stop_url, location_type, parent_station, wheelchair_boarding)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		 zone_id, stop_url, location_type, parent_station, wheelchair_boarding, platform_code)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return fmt.Errorf("prepare stops: %w", err)
 	}
@@ -166,8 +176,8 @@ func (imp *Importer) importStops(ctx context.Context, tx *sql.Tx, stops []Stop)
 
 	for _, s := range stops {
 		if _, err := stmt.ExecContext(ctx, s.StopID, s.StopCode, s.StopName, s.StopDesc,
-			s.StopLat, s.StopLon, s.ZoneID, s.StopURL, s.LocationType,
-			s.ParentStation, s.WheelchairBoarding); err != nil {
+			s.StopLat, s.StopLon, s.ZoneID, s.StopURL, enumValue(s.LocationType),
+			s.ParentStation, enumValue(s.WheelchairBoarding), s.PlatformCode); err != nil {
 			return fmt.Errorf("insert stop %s: %w", s.StopID, err)
 		}
 	}
@@ -215,8 +225,8 @@ func (imp *Importer) importCalendarDates(ctx context.Context, tx *sql.Tx, dates
 func (imp *Importer) importTrips(ctx context.Context, tx *sql.Tx, trips []Trip) error {
 	stmt, err := tx.PrepareContext(ctx,
 		`INSERT INTO trips (trip_id, route_id, service_id, trip_headsign,
-		 direction_id, block_id, shape_id)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`)
+		 direction_id, block_id, shape_id, wheelchair_accessible, bikes_allowed)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return fmt.Errorf("prepare trips: %w", err)
 	}
@@ -224,7 +234,8 @@ func (imp *Importer) importTrips(ctx context.Context, tx *sql.Tx, trips []Trip)
 
 	for _, t := range trips {
 		if _, err := stmt.ExecContext(ctx, t.TripID, t.RouteID, t.ServiceID,
-			t.TripHeadsign, t.DirectionID, t.BlockID, t.ShapeID); err != nil {
+			t.TripHeadsign, t.DirectionID, t.BlockID, t.ShapeID,
+			enumValue(t.WheelchairAccessible), enumValue(t.BikesAllowed)); err != nil {
 			return fmt.Errorf("insert trip %s: %w", t.TripID, err)
 		}
 	}
@@ -259,8 +270,8 @@ func (imp *Importer) streamStopTimes(ctx context.Context, tx *sql.Tx, zipPath st
 
 	stmt, err := tx.PrepareContext(ctx,
 		`INSERT INTO stop_times (trip_id, arrival_time, departure_time, stop_id,
-		 stop_sequence, pickup_type, drop_off_type, timepoint)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+		 stop_sequence, pickup_type, drop_off_type, timepoint, arrival_secs, departure_secs)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return fmt.Errorf("prepare stop_times: %w", err)
 	}
@@ -278,7 +289,8 @@ func (imp *Importer) streamStopTimes(ctx context.Context, tx *sql.Tx, zipPath st
 		}
 
 		if _, err := stmt.ExecContext(ctx, st.TripID, st.ArrivalTime, st.DepartureTime,
-			st.StopID, st.StopSequence, st.PickupType, st.DropOffType, st.Timepoint); err != nil {
+			st.StopID, st.StopSequence, st.PickupType, st.DropOffType, st.Timepoint,
+			gtfsSeconds(st.ArrivalTime), gtfsSeconds(st.DepartureTime)); err != nil {
 			return fmt.Errorf("insert stop_time row %d: %w", count, err)
 		}
 		count++
@@ -292,6 +304,25 @@ func (imp *Importer) streamStopTimes(ctx context.Context, tx *sql.Tx, zipPath st
 	return nil
 }
 
+// gtfsSeconds converts a GTFS time, "H:MM:SS" or "HH:MM:SS" and past 24:00
+// for trips running after midnight, to seconds after midnight. Empty or
+// malformed times, allowed between timepoints, give NULL.
+func gtfsSeconds(s string) sql.NullInt64 {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return sql.NullInt64{}
+	}
+	var secs int64
+	for _, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return sql.NullInt64{}
+		}
+		secs = secs*60 + int64(v)
+	}
+	return sql.NullInt64{Int64: secs, Valid: true}
+}
+
 // streamShapes reads shapes.txt directly from the zip in a streaming fashion.
 func (imp *Importer) streamShapes(ctx context.Context, tx *sql.Tx, zipPath string) error {
 	r, err := zip.OpenReader(zipPath)
@@ -356,3 +387,13 @@ func (imp *Importer) streamShapes(ctx context.Context, tx *sql.Tx, zipPath strin
 	imp.logger.Info("imported shapes", "count", count)
 	return nil
 }
+
+// enumValue parses a GTFS enum field such as wheelchair_boarding. Empty or
+// unrecognized values mean 0, "no information", as the spec says.
+func enumValue(s string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
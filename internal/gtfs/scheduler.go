@@ -2,6 +2,7 @@ package gtfs
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
 	"sync"
@@ -19,8 +20,28 @@ type Scheduler struct {
 
 	mu            sync.Mutex
 	lastCheckDate string // YYYY-MM-DD of last check, prevents multiple checks per day
+	status        Status
+	abort         context.CancelFunc // cancels the running update
+	done          chan struct{}      // closed when the running update finishes
+	stopped       bool               // Shutdown was called; no new updates start
 }
 
+// Status describes the scheduler's recent activity, for the admin console.
+type Status struct {
+	Running     bool      // a check or import is in progress
+	LastCheck   time.Time // last time the feed was checked for changes
+	LastImport  time.Time // last successful import by this process
+	LastError   string
+	LastErrorAt time.Time
+}
+
+// ErrBusy is returned when a check or import is requested while one is
+// already running.
+var ErrBusy = errors.New("a GTFS update is already running")
+
+// ErrStopped is returned when a check or import is requested after Shutdown.
+var ErrStopped = errors.New("GTFS scheduler is shutting down")
+
 // NewScheduler creates a Scheduler.
 func NewScheduler(downloader *Downloader, db *storage.DB, logger *slog.Logger) *Scheduler {
 	return &Scheduler{
@@ -39,7 +60,13 @@ func (s *Scheduler) EnsureData(ctx context.Context) error {
 		return nil
 	}
 	s.logger.Info("no GTFS data found, performing initial import")
-	return s.update(ctx)
+	ctx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	err = s.update(ctx)
+	s.finish(err == nil, err)
+	return err
 }
 
 // CheckAndUpdate checks if the feed has been updated and imports it if so.
@@ -54,18 +81,116 @@ func (s *Scheduler) CheckAndUpdate(ctx context.Context) error {
 	s.lastCheckDate = today
 	s.mu.Unlock()
 
+	return s.Check(ctx)
+}
+
+// Check asks the feed server whether the feed has changed and imports it if
+// so, regardless of when it last checked.
+func (s *Scheduler) Check(ctx context.Context) error {
+	ctx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+
 	lastModified, _ := s.db.GetMetadata(ctx, "last_modified")
 	etag, _ := s.db.GetMetadata(ctx, "etag")
 
 	result, err := s.downloader.Check(ctx, lastModified, etag)
 	if err != nil {
+		s.finish(false, err)
 		return err
 	}
+	s.mu.Lock()
+	s.status.LastCheck = time.Now()
+	s.mu.Unlock()
 	if !result.NeedsUpdate {
+		s.finish(false, nil)
 		return nil
 	}
 
-	return s.update(ctx)
+	err = s.update(ctx)
+	s.finish(err == nil, err)
+	return err
+}
+
+// ForceUpdate downloads and reimports the feed even if it hasn't changed.
+func (s *Scheduler) ForceUpdate(ctx context.Context) error {
+	ctx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	s.logger.Info("forced GTFS reimport")
+	err = s.update(ctx)
+	s.finish(err == nil, err)
+	return err
+}
+
+// Status returns a snapshot of the scheduler's recent activity.
+func (s *Scheduler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// begin marks an update as running, or returns ErrBusy if one already is.
+// The update runs under the returned context, which keeps ctx's values but
+// not its cancellation: once started, an update is only interrupted by
+// Shutdown, so the import transaction is never abandoned half-way.
+func (s *Scheduler) begin(ctx context.Context) (context.Context, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return nil, ErrStopped
+	}
+	if s.status.Running {
+		return nil, ErrBusy
+	}
+	s.status.Running = true
+	ctx, s.abort = context.WithCancel(context.WithoutCancel(ctx))
+	s.done = make(chan struct{})
+	return ctx, nil
+}
+
+// finish records the outcome of an update started with begin.
+func (s *Scheduler) finish(imported bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Running = false
+	s.abort()
+	close(s.done)
+	s.abort, s.done = nil, nil
+	if imported {
+		s.status.LastImport = time.Now()
+	}
+	if err != nil {
+		s.status.LastError = err.Error()
+		s.status.LastErrorAt = time.Now()
+	}
+}
+
+// Shutdown stops new updates from starting and waits for a running one to
+// finish. If ctx expires first, the update is cancelled, which rolls back
+// its import transaction and leaves the previous data in place; Shutdown
+// then waits for the rollback and returns ctx's error.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	abort, done := s.abort, s.done
+	s.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+
+	s.logger.Info("waiting for GTFS update to finish")
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	s.logger.Warn("aborting GTFS update")
+	abort()
+	<-done
+	return ctx.Err()
 }
 
 // StartBackground starts the 3 AM daily check goroutine.
@@ -44,6 +44,7 @@ type Stop struct {
 	LocationType       string `csv:"location_type"`
 	ParentStation      string `csv:"parent_station"`
 	WheelchairBoarding string `csv:"wheelchair_boarding"`
+	PlatformCode       string `csv:"platform_code"`
 }
 
 type Trip struct {
@@ -54,6 +55,9 @@ type Trip struct {
 	DirectionID  string `csv:"direction_id"`
 	BlockID      string `csv:"block_id"`
 	ShapeID      string `csv:"shape_id"`
+
+	WheelchairAccessible string `csv:"wheelchair_accessible"`
+	BikesAllowed         string `csv:"bikes_allowed"`
 }
 
 type StopTime struct {
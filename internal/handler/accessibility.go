@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+
+	"gobus/internal/storage"
+	"gobus/internal/templates"
+)
+
+// accessibleOnly reports whether the signed-in user has asked to see only
+// wheelchair-accessible stops and trips.
+func (h *Handler) accessibleOnly(r *http.Request) bool {
+	return h.riderPrefs(r).accessibleOnly
+}
+
+// accessibleStops drops stops the feed marks as having no wheelchair
+// boarding. Stops it says nothing about are kept: in many feeds that is
+// most of them, and hiding them would leave riders with nothing.
+func accessibleStops(rows []storage.NearbyStopRow) []storage.NearbyStopRow {
+	var out []storage.NearbyStopRow
+	for _, row := range rows {
+		if row.WheelchairBoarding != storage.AccessNo {
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+// accessibleDepartures drops trips the feed marks as not wheelchair
+// accessible, keeping unknown ones as accessibleStops does.
+func accessibleDepartures(deps []templates.DepartureInfo) []templates.DepartureInfo {
+	var out []templates.DepartureInfo
+	for _, dep := range deps {
+		if dep.WheelchairAccessible != storage.AccessNo {
+			out = append(out, dep)
+		}
+	}
+	return out
+}
+
+// combinedAccess is whether a wheelchair user can take a trip from a stop:
+// not if either the stop or the vehicle is inaccessible, and only known to
+// work if both are accessible.
+func combinedAccess(stop, trip int) int {
+	switch {
+	case stop == storage.AccessNo || trip == storage.AccessNo:
+		return storage.AccessNo
+	case stop == storage.AccessYes && trip == storage.AccessYes:
+		return storage.AccessYes
+	default:
+		return storage.AccessUnknown
+	}
+}
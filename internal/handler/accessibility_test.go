@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"testing"
+
+	"gobus/internal/storage"
+	"gobus/internal/templates"
+)
+
+func TestAccessibleStops(t *testing.T) {
+	rows := []storage.NearbyStopRow{
+		{StopID: "yes", WheelchairBoarding: storage.AccessYes},
+		{StopID: "no", WheelchairBoarding: storage.AccessNo},
+		{StopID: "unknown", WheelchairBoarding: storage.AccessUnknown},
+	}
+	got := accessibleStops(rows)
+	if len(got) != 2 || got[0].StopID != "yes" || got[1].StopID != "unknown" {
+		t.Errorf("accessibleStops = %+v, want the accessible and unknown stops", got)
+	}
+}
+
+func TestAccessibleDepartures(t *testing.T) {
+	deps := []templates.DepartureInfo{
+		{TripID: "a", WheelchairAccessible: storage.AccessNo},
+		{TripID: "b", WheelchairAccessible: storage.AccessYes},
+		{TripID: "c"}, // realtime-only: unknown
+	}
+	got := accessibleDepartures(deps)
+	if len(got) != 2 || got[0].TripID != "b" || got[1].TripID != "c" {
+		t.Errorf("accessibleDepartures = %+v, want trips b and c", got)
+	}
+}
+
+func TestCombinedAccess(t *testing.T) {
+	tests := []struct {
+		stop, trip, want int
+	}{
+		{storage.AccessYes, storage.AccessYes, storage.AccessYes},
+		{storage.AccessYes, storage.AccessUnknown, storage.AccessUnknown},
+		{storage.AccessUnknown, storage.AccessYes, storage.AccessUnknown},
+		{storage.AccessNo, storage.AccessYes, storage.AccessNo},
+		{storage.AccessYes, storage.AccessNo, storage.AccessNo},
+		{storage.AccessUnknown, storage.AccessNo, storage.AccessNo},
+	}
+	for _, tt := range tests {
+		if got := combinedAccess(tt.stop, tt.trip); got != tt.want {
+			t.Errorf("combinedAccess(%d, %d) = %d, want %d", tt.stop, tt.trip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"gobus/internal/templates"
+)
+
+// Account shows the signed-in user's devices with forms to sign devices
+// out, change the passphrase and delete the account.
+func (h *Handler) Account(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	h.renderAccount(w, r, userID, "", "")
+}
+
+func (h *Handler) renderAccount(w http.ResponseWriter, r *http.Request, userID int64, notice, errMsg string) {
+	ctx := r.Context()
+	data := templates.AccountData{
+		Page:    h.page("Account", "/account"),
+		Notice:  notice,
+		Error:   errMsg,
+		IsAdmin: h.isAdmin(r),
+	}
+	if user, err := h.db.GetUserByID(ctx, userID); err == nil {
+		data.Username = user.Username
+		data.AccessibleOnly = user.AccessibleOnly
+		data.WalkSpeed = user.WalkSpeed
+	} else {
+		h.logger.Error("account: user lookup", "error", err)
+	}
+
+	var current string
+	if c, err := r.Cookie(deviceCookie); err == nil {
+		current = c.Value
+	}
+	rows, err := h.db.ListDevices(ctx, userID)
+	if err != nil {
+		h.logger.Error("listing devices", "error", err)
+	}
+	for _, d := range rows {
+		name := d.Name
+		if name == "" {
+			name = deviceName(d.UserAgent)
+		}
+		data.Devices = append(data.Devices, templates.Device{
+			ID:       d.ID,
+			Name:     name,
+			LastSeen: d.LastSeen,
+			Current:  d.DeviceID == current,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if errMsg != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	if err := templates.AccountPage(data).Render(ctx, w); err != nil {
+		h.logger.Error("rendering account page", "error", err)
+	}
+}
+
+// RevokeDevice signs one of the user's devices out. Its session cookie stops
+// working on its next request.
+func (h *Handler) RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.RevokeDevice(r.Context(), userID, id); err != nil {
+		h.logger.Error("revoking device", "error", err)
+	}
+	h.logger.Info("device signed out", "user", userID, "device_row", id)
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// RenameDevice sets a device's friendly name.
+func (h *Handler) RenameDevice(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > 60 {
+		h.renderAccount(w, r, userID, "", "Device name must be 1-60 characters.")
+		return
+	}
+	if err := h.db.RenameDevice(r.Context(), userID, id, name); err != nil {
+		h.logger.Error("renaming device", "error", err)
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// SetAccessibility saves the "accessible only" preference, which hides
+// stops and trips marked not wheelchair accessible.
+func (h *Handler) SetAccessibility(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	on := r.FormValue("accessible_only") == "1"
+	if err := h.db.SetAccessibleOnly(r.Context(), userID, on); err != nil {
+		h.logger.Error("saving accessibility preference", "error", err)
+		h.renderAccount(w, r, userID, "", "Something went wrong. Please try again.")
+		return
+	}
+	notice := "Showing all stops and trips."
+	if on {
+		notice = "Showing wheelchair-accessible stops and trips only."
+	}
+	h.renderAccount(w, r, userID, notice, "")
+}
+
+// SetWalkSpeed saves the user's walking speed, one of
+// templates.WalkSpeedOptions, used for walk times on the nearby page.
+func (h *Handler) SetWalkSpeed(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	speed, err := strconv.ParseFloat(r.FormValue("walk_speed"), 64)
+	if err != nil || !validWalkSpeed(speed) {
+		h.renderAccount(w, r, userID, "", "Choose a walking speed from the list.")
+		return
+	}
+	if err := h.db.SetWalkSpeed(r.Context(), userID, speed); err != nil {
+		h.logger.Error("saving walking speed", "error", err)
+		h.renderAccount(w, r, userID, "", "Something went wrong. Please try again.")
+		return
+	}
+	h.renderAccount(w, r, userID, "Walking speed saved.", "")
+}
+
+func validWalkSpeed(speed float64) bool {
+	for _, o := range templates.WalkSpeedOptions {
+		if o.MetersPerMin == speed {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangePassphrase replaces the passphrase after checking the current one,
+// then signs out every other device.
+func (h *Handler) ChangePassphrase(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	current := r.FormValue("current")
+	next := r.FormValue("passphrase")
+
+	if !h.checkPassphrase(r, userID, current) {
+		h.renderAccount(w, r, userID, "", "Your current passphrase is incorrect.")
+		return
+	}
+	if len(next) < 8 {
+		h.renderAccount(w, r, userID, "", "New passphrase must be at least 8 characters.")
+		return
+	}
+	if next != r.FormValue("confirm") {
+		h.renderAccount(w, r, userID, "", "The new passphrases don't match.")
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(next), bcrypt.DefaultCost)
+	if err != nil {
+		h.logger.Error("change passphrase: bcrypt", "error", err)
+		h.renderAccount(w, r, userID, "", "Something went wrong. Please try again.")
+		return
+	}
+	if err := h.db.UpdatePassphrase(ctx, userID, string(hash)); err != nil {
+		h.logger.Error("change passphrase: update", "error", err)
+		h.renderAccount(w, r, userID, "", "Something went wrong. Please try again.")
+		return
+	}
+	if c, err := r.Cookie(deviceCookie); err == nil {
+		if err := h.db.RevokeOtherDevices(ctx, userID, c.Value); err != nil {
+			h.logger.Error("change passphrase: revoke other devices", "error", err)
+		}
+	}
+	h.logger.Info("passphrase changed", "user", userID)
+	h.renderAccount(w, r, userID, "Passphrase changed. Your other devices have been signed out.", "")
+}
+
+// DeleteAccount permanently removes the user and everything stored for them,
+// after confirming the passphrase.
+func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if !h.checkPassphrase(r, userID, r.FormValue("passphrase")) {
+		h.renderAccount(w, r, userID, "", "Your passphrase is incorrect. Your account was not deleted.")
+		return
+	}
+	if err := h.db.DeleteUser(r.Context(), userID); err != nil {
+		h.logger.Error("deleting account", "error", err)
+		h.renderAccount(w, r, userID, "", "Something went wrong. Your account was not deleted.")
+		return
+	}
+	h.clearCookie(w)
+	h.logger.Info("account deleted", "user", userID)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// checkPassphrase reports whether passphrase is the user's current one.
+func (h *Handler) checkPassphrase(r *http.Request, userID int64, passphrase string) bool {
+	if passphrase == "" {
+		return false
+	}
+	user, err := h.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("checking passphrase: user lookup", "error", err)
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.PassphraseHash), []byte(passphrase)) == nil
+}
+
+// deviceName makes a friendly default name such as "Firefox on Android"
+// from a User-Agent header. Order matters: Edge and Samsung Internet also
+// claim to be Chrome, and Chrome claims to be Safari.
+func deviceName(ua string) string {
+	browser := ""
+	switch {
+	case strings.Contains(ua, "Edg/"), strings.Contains(ua, "EdgA/"), strings.Contains(ua, "EdgiOS/"):
+		browser = "Edge"
+	case strings.Contains(ua, "SamsungBrowser/"):
+		browser = "Samsung Internet"
+	case strings.Contains(ua, "Firefox/"), strings.Contains(ua, "FxiOS/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"), strings.Contains(ua, "CriOS/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	}
+
+	os := ""
+	switch {
+	case strings.Contains(ua, "iPhone"):
+		os = "iPhone"
+	case strings.Contains(ua, "iPad"):
+		os = "iPad"
+	case strings.Contains(ua, "Android"):
+		os = "Android"
+	case strings.Contains(ua, "CrOS"):
+		os = "ChromeOS"
+	case strings.Contains(ua, "Windows"):
+		os = "Windows"
+	case strings.Contains(ua, "Mac OS X"), strings.Contains(ua, "Macintosh"):
+		os = "Mac"
+	case strings.Contains(ua, "Linux"):
+		os = "Linux"
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	default:
+		return "Unknown device"
+	}
+}
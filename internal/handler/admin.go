@@ -0,0 +1,359 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"gobus/internal/gtfs"
+	"gobus/internal/templates"
+	"gobus/internal/throttle"
+	"gobus/internal/upstream"
+)
+
+// SetScheduler gives the admin console the GTFS scheduler, so operators can
+// see feed status and trigger updates.
+func (h *Handler) SetScheduler(s *gtfs.Scheduler) {
+	h.feed = s
+}
+
+// isAdmin reports whether the signed-in user has the admin role, or is
+// listed in GOBUS_ADMIN_USERS (which bootstraps the first admin).
+func (h *Handler) isAdmin(r *http.Request) bool {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		return false
+	}
+	user, err := h.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("admin check: user lookup", "error", err)
+		return false
+	}
+	return !user.Disabled && (user.IsAdmin || h.configAdmin(user.Username))
+}
+
+// configAdmin reports whether username is listed in GOBUS_ADMIN_USERS.
+func (h *Handler) configAdmin(username string) bool {
+	for _, name := range strings.Split(h.cfg.Load().AdminUsers, ",") {
+		if name = strings.TrimSpace(name); name != "" && strings.EqualFold(name, username) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireAdmin wraps an /admin handler. Non-admins get a 404 so the admin
+// area's existence isn't advertised.
+func (h *Handler) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.isAdmin(r) {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// --- Overview ---
+
+// Admin shows feed status, upstream health and cache stats, with buttons to
+// check for a new feed or force a reimport.
+func (h *Handler) Admin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data := templates.AdminData{
+		Page:     h.page("Admin", "/admin"),
+		Notice:   r.URL.Query().Get("notice"),
+		MaxUsers: h.cfg.Load().MaxUsers,
+	}
+
+	if c, err := h.db.CountSite(ctx); err == nil {
+		data.Users, data.DisabledUsers, data.Devices, data.Sessions = c.Users, c.DisabledUsers, c.Devices, c.Sessions
+	} else {
+		h.logger.Error("admin: count site", "error", err)
+	}
+
+	if meta, err := h.db.ListMetadata(ctx); err == nil {
+		keys := make([]string, 0, len(meta))
+		for k := range meta {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			data.FeedMetadata = append(data.FeedMetadata, templates.AdminKV{Key: k, Value: meta[k]})
+		}
+	} else {
+		h.logger.Error("admin: feed metadata", "error", err)
+	}
+	if c, err := h.db.CountFeed(ctx); err == nil {
+		data.Routes, data.Stops, data.Trips = c.Routes, c.Stops, c.Trips
+	} else {
+		h.logger.Error("admin: count feed", "error", err)
+	}
+	if h.feed != nil {
+		st := h.feed.Status()
+		data.FeedRunning = st.Running
+		data.LastCheck = adminTime(st.LastCheck)
+		data.LastImport = adminTime(st.LastImport)
+		data.LastError = st.LastError
+		data.LastErrorAt = adminTime(st.LastErrorAt)
+		data.CanUpdate = true
+	}
+
+	data.Upstreams = []templates.AdminUpstream{
+		adminUpstream("NexTrip API", h.cfg.Load().NexTripBaseURL, h.nt.Health()),
+		adminUpstream("GTFS-RT alerts", h.cfg.Load().AlertsURL, h.rt.AlertsHealth()),
+	}
+
+	cs := h.nt.CacheStats()
+	data.CacheEntries, data.CacheHits, data.CacheMisses = cs.Entries, cs.Hits, cs.Misses
+	data.CacheTTL = cs.TTL.String()
+	if total := cs.Hits + cs.Misses; total > 0 {
+		data.CacheHitRate = fmt.Sprintf("%.0f%%", float64(cs.Hits)*100/float64(total))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.AdminPage(data).Render(ctx, w); err != nil {
+		h.logger.Error("rendering admin page", "error", err)
+	}
+}
+
+func adminUpstream(name, url string, s upstream.Status) templates.AdminUpstream {
+	return templates.AdminUpstream{
+		Name:        name,
+		URL:         url,
+		OK:          s.OK(),
+		Requests:    s.Requests,
+		Failures:    s.Failures,
+		LastSuccess: adminTime(s.LastSuccess),
+		LastFailure: adminTime(s.LastFailure),
+		LastError:   s.LastError,
+	}
+}
+
+// adminTime formats a timestamp for the admin console, or "" if unset.
+func adminTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format("Jan 2 3:04:05 PM")
+}
+
+// AdminFeedCheck asks the feed server for a new GTFS feed and imports it if
+// it changed. It runs in the background; progress shows on the overview.
+func (h *Handler) AdminFeedCheck(w http.ResponseWriter, r *http.Request) {
+	h.runFeedUpdate(w, r, false)
+}
+
+// AdminFeedReimport downloads and reimports the GTFS feed unconditionally.
+func (h *Handler) AdminFeedReimport(w http.ResponseWriter, r *http.Request) {
+	h.runFeedUpdate(w, r, true)
+}
+
+func (h *Handler) runFeedUpdate(w http.ResponseWriter, r *http.Request, force bool) {
+	if h.feed == nil {
+		http.Redirect(w, r, "/admin?notice="+url.QueryEscape("The GTFS scheduler isn't running."), http.StatusSeeOther)
+		return
+	}
+	if h.feed.Status().Running {
+		http.Redirect(w, r, "/admin?notice="+url.QueryEscape("An update is already running."), http.StatusSeeOther)
+		return
+	}
+	action, run := "check", h.feed.Check
+	if force {
+		action, run = "reimport", h.feed.ForceUpdate
+	}
+	h.logger.Info("admin: GTFS "+action+" requested", "admin", h.currentUserID(r))
+	go func() {
+		// Detached from the request: an import outlives the redirect
+		if err := run(context.Background()); err != nil && !errors.Is(err, gtfs.ErrBusy) {
+			h.logger.Error("admin: GTFS "+action+" failed", "error", err)
+		}
+	}()
+	http.Redirect(w, r, "/admin?notice="+url.QueryEscape("GTFS "+action+" started."), http.StatusSeeOther)
+}
+
+// --- Users ---
+
+// AdminUsers lists every account with controls to disable, reset or promote.
+func (h *Handler) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	h.renderAdminUsers(w, r, r.URL.Query().Get("notice"), "")
+}
+
+func (h *Handler) renderAdminUsers(w http.ResponseWriter, r *http.Request, notice, tempPassphrase string) {
+	rows, err := h.db.ListUsers(r.Context())
+	if err != nil {
+		h.logger.Error("admin: list users", "error", err)
+	}
+	data := templates.AdminUsersData{
+		Page:           h.page("Users", "/admin"),
+		Notice:         notice,
+		TempPassphrase: tempPassphrase,
+		MaxUsers:       h.cfg.Load().MaxUsers,
+		CurrentUserID:  h.currentUserID(r),
+	}
+	for _, u := range rows {
+		data.Users = append(data.Users, templates.AdminUser{
+			ID:          u.ID,
+			Username:    u.Username,
+			CreatedAt:   u.CreatedAt,
+			IsAdmin:     u.IsAdmin || h.configAdmin(u.Username),
+			ConfigAdmin: h.configAdmin(u.Username),
+			Disabled:    u.Disabled,
+			Devices:     u.Devices,
+			LastSeen:    u.LastSeen,
+			Invite:      u.Invite,
+		})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.AdminUsersPage(data).Render(r.Context(), w); err != nil {
+		h.logger.Error("rendering admin users page", "error", err)
+	}
+}
+
+// AdminUserAction applies one of disable, enable, reset, promote or demote
+// to the user in the path. Admins can't disable or demote themselves, so
+// there is always someone left to undo a mistake.
+func (h *Handler) AdminUserAction(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	user, err := h.db.GetUserByID(ctx, id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	action := r.PathValue("action")
+	adminID := h.currentUserID(r)
+	if id == adminID && (action == "disable" || action == "demote") {
+		h.renderAdminUsers(w, r, "You can't "+action+" your own account.", "")
+		return
+	}
+
+	var notice, temp string
+	switch action {
+	case "disable":
+		err = h.db.SetUserDisabled(ctx, id, true)
+		notice = user.Username + " is disabled and has been signed out everywhere."
+	case "enable":
+		err = h.db.SetUserDisabled(ctx, id, false)
+		notice = user.Username + " is enabled."
+	case "promote":
+		err = h.db.SetUserAdmin(ctx, id, true)
+		notice = user.Username + " is now an admin."
+	case "demote":
+		err = h.db.SetUserAdmin(ctx, id, false)
+		notice = user.Username + " is no longer an admin."
+		if h.configAdmin(user.Username) {
+			notice += " They stay an admin while listed in GOBUS_ADMIN_USERS."
+		}
+	case "reset":
+		temp, err = h.resetPassphrase(ctx, id, user.Username)
+		notice = "Passphrase reset for " + user.Username + ". They have been signed out everywhere; give them the temporary passphrase below."
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		h.logger.Error("admin: user "+action, "user", id, "error", err)
+		h.renderAdminUsers(w, r, "Something went wrong. Please try again.", "")
+		return
+	}
+	h.logger.Info("admin: user "+action, "user", id, "username", user.Username, "admin", adminID)
+
+	if temp != "" {
+		// Shown once, so render rather than redirect
+		h.renderAdminUsers(w, r, notice, temp)
+		return
+	}
+	http.Redirect(w, r, "/admin/users?notice="+url.QueryEscape(notice), http.StatusSeeOther)
+}
+
+// resetPassphrase replaces a user's passphrase with a random temporary one,
+// signs them out everywhere and lifts any sign-in lockout.
+func (h *Handler) resetPassphrase(ctx context.Context, userID int64, username string) (string, error) {
+	temp := readableCode()
+	hash, err := bcrypt.GenerateFromPassword([]byte(temp), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	if err := h.db.UpdatePassphrase(ctx, userID, string(hash)); err != nil {
+		return "", err
+	}
+	if err := h.db.RevokeOtherDevices(ctx, userID, ""); err != nil {
+		return "", err
+	}
+	h.loginUsers.Reset(usernameKey(username))
+	return temp, nil
+}
+
+// --- Sign-in security ---
+
+// AdminSecurity lists current sign-in lockouts and recent lockout events.
+func (h *Handler) AdminSecurity(w http.ResponseWriter, r *http.Request) {
+	cfg := h.cfg.Load()
+	data := templates.AdminSecurityData{
+		Page:         h.page("Sign-in security", "/admin"),
+		Unlocked:     r.URL.Query().Get("unlocked"),
+		FreeAttempts: cfg.LoginFreeAttempts,
+		LockoutUser:  cfg.LoginLockoutUser,
+		LockoutIP:    cfg.LoginLockoutIP,
+		LockoutMin:   cfg.LoginLockoutMin,
+	}
+	for _, l := range slices.Concat(h.loginUsers.Locks(), h.loginIPs.Locks(), h.registerIPs.Locks(), h.passkeyIPs.Locks()) {
+		data.Locks = append(data.Locks, templates.AuthLock{
+			Key:      l.Key,
+			Failures: l.Failures,
+			Until:    l.Until.Local().Format("3:04 PM"),
+		})
+	}
+
+	events := slices.Concat(h.loginUsers.Events(), h.loginIPs.Events(), h.registerIPs.Events(), h.passkeyIPs.Events())
+	sort.Slice(events, func(i, j int) bool { return events[i].At.After(events[j].At) })
+	for _, ev := range events {
+		data.Events = append(data.Events, templates.AuthLockout{
+			Key:      ev.Key,
+			Failures: ev.Failures,
+			At:       ev.At.Local().Format("Jan 2 3:04 PM"),
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.AdminSecurityPage(data).Render(r.Context(), w); err != nil {
+		h.logger.Error("rendering admin security page", "error", err)
+	}
+}
+
+// AdminUnlock lifts a lockout early, e.g. for a user locked out by someone
+// else guessing at their username.
+func (h *Handler) AdminUnlock(w http.ResponseWriter, r *http.Request) {
+	key := r.FormValue("key")
+	var l *throttle.Limiter
+	switch {
+	case strings.HasPrefix(key, "user:"):
+		l = h.loginUsers
+	case strings.HasPrefix(key, "ip:"):
+		// The same key may be locked for sign-in, registration and
+		// passkey sign-in
+		h.registerIPs.Reset(key)
+		h.passkeyIPs.Reset(key)
+		l = h.loginIPs
+	default:
+		http.Error(w, "unknown lockout", http.StatusBadRequest)
+		return
+	}
+	l.Reset(key)
+	h.logger.Info("auth lockout lifted", "key", key, "admin", h.currentUserID(r))
+	http.Redirect(w, r, "/admin/security?unlocked="+url.QueryEscape(key), http.StatusSeeOther)
+}
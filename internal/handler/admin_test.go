@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"regexp"
+	"testing"
+
+	"gobus/internal/config"
+)
+
+func TestConfigAdmin(t *testing.T) {
+	h := &Handler{}
+	h.cfg.Store(&config.Config{AdminUsers: " Root, ops ,"})
+	tests := map[string]bool{"root": true, "ROOT": true, "ops": true, "alice": false, "": false}
+	for name, want := range tests {
+		if got := h.configAdmin(name); got != want {
+			t.Errorf("configAdmin(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestReadableCode(t *testing.T) {
+	re := regexp.MustCompile(`^[a-hjkmnp-z2-9]{4}-[a-hjkmnp-z2-9]{4}-[a-hjkmnp-z2-9]{4}$`)
+	a, b := readableCode(), readableCode()
+	if !re.MatchString(a) {
+		t.Errorf("readableCode() = %q, want xxxx-xxxx-xxxx without look-alike characters", a)
+	}
+	if len(a) < 8 {
+		t.Errorf("code %q is too short to use as a temporary passphrase", a)
+	}
+	if a == b {
+		t.Error("two calls returned the same code")
+	}
+}
+
+func TestNormalizeInviteCode(t *testing.T) {
+	tests := map[string]string{
+		"k7qm-3xtp-9wfa":     "k7qm-3xtp-9wfa",
+		"  K7QM-3XTP-9WFA  ": "k7qm-3xtp-9wfa",
+		"k7qm 3xtp  9wfa":    "k7qm-3xtp-9wfa",
+		"":                   "",
+	}
+	for in, want := range tests {
+		if got := normalizeInviteCode(in); got != want {
+			t.Errorf("normalizeInviteCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"gobus/internal/geo"
+	"gobus/internal/templates"
+	"gobus/internal/walk"
+)
+
+// --- JSON helpers ---
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// --- API response types ---
+
+type apiStop struct {
+	StopID             string   `json:"stop_id"`
+	StopCode           string   `json:"stop_code,omitempty"`
+	Name               string   `json:"name"`
+	Description        string   `json:"description,omitempty"`
+	Lat                float64  `json:"lat"`
+	Lon                float64  `json:"lon"`
+	WheelchairBoarding int      `json:"wheelchair_boarding"`
+	DistanceM          *float64 `json:"distance_m,omitempty"`
+}
+
+type apiDeparture struct {
+	TripID        string     `json:"trip_id,omitempty"`
+	RouteID       string     `json:"route_id"`
+	RouteShort    string     `json:"route_short"`
+	DirectionID   int        `json:"direction_id"`
+	Direction     string     `json:"direction,omitempty"`
+	Headsign      string     `json:"headsign"`
+	ScheduledTime time.Time  `json:"scheduled_time"`
+	PredictedTime *time.Time `json:"predicted_time,omitempty"`
+	MinutesAway   int        `json:"minutes_away"`
+	IsRealtime    bool       `json:"is_realtime"`
+	IsLate        bool       `json:"is_late"`
+
+	WheelchairAccessible int `json:"wheelchair_accessible"`
+	BikesAllowed         int `json:"bikes_allowed"`
+}
+
+type apiRoute struct {
+	RouteID   string `json:"route_id"`
+	Short     string `json:"short_name"`
+	Long      string `json:"long_name"`
+	Type      int    `json:"route_type"`
+	Color     string `json:"color,omitempty"`
+	TextColor string `json:"text_color,omitempty"`
+}
+
+type apiRouteDirection struct {
+	DirectionID int       `json:"direction_id"`
+	Name        string    `json:"name"`
+	Stops       []apiStop `json:"stops"`
+}
+
+type apiAlert struct {
+	Header      string   `json:"header"`
+	Description string   `json:"description,omitempty"`
+	Effect      string   `json:"effect"`
+	RouteIDs    []string `json:"route_ids,omitempty"`
+	StopIDs     []string `json:"stop_ids,omitempty"`
+}
+
+type apiSearchResult struct {
+	Name   string  `json:"name"`
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+	Source string  `json:"source"` // "stops" or "geocoder"
+}
+
+func toAPIDeparture(d templates.DepartureInfo) apiDeparture {
+	out := apiDeparture{
+		TripID:        d.TripID,
+		RouteID:       d.RouteID,
+		RouteShort:    d.RouteShort,
+		DirectionID:   d.DirectionID,
+		Direction:     d.DirectionText,
+		Headsign:      d.Headsign,
+		ScheduledTime: d.ScheduledAt,
+		MinutesAway:   d.MinutesAway,
+		IsRealtime:    d.IsRealtime,
+		IsLate:        d.IsLate,
+
+		WheelchairAccessible: d.WheelchairAccessible,
+		BikesAllowed:         d.BikesAllowed,
+	}
+	if !d.RealtimeAt.IsZero() {
+		t := d.RealtimeAt
+		out.PredictedTime = &t
+	}
+	return out
+}
+
+// --- Handlers ---
+
+// APINearby returns stops near a point, nearest first.
+// Query: lat, lon (required), radius in meters (default 450), limit (default 20).
+func (h *Handler) APINearby(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	lat, err1 := strconv.ParseFloat(q.Get("lat"), 64)
+	lon, err2 := strconv.ParseFloat(q.Get("lon"), 64)
+	if err1 != nil || err2 != nil {
+		writeJSONError(w, http.StatusBadRequest, "lat and lon are required")
+		return
+	}
+	radius, _ := strconv.ParseFloat(q.Get("radius"), 64)
+	if radius <= 0 || radius > radiusTiers[len(radiusTiers)-1] {
+		radius = radiusTiers[0]
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	latDeg, lonDeg := geo.BoundingBoxRadius(lat, radius)
+	rows, err := h.db.NearbyStops(r.Context(), lat, lon, latDeg, lonDeg, limit)
+	if err != nil {
+		h.logger.Error("api nearby", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	stops := make([]apiStop, 0, len(rows))
+	for _, row := range rows {
+		dist := geo.Haversine(lat, lon, row.StopLat, row.StopLon)
+		stops = append(stops, apiStop{
+			StopID:             row.StopID,
+			StopCode:           row.StopCode,
+			Name:               row.StopName,
+			Description:        row.StopDesc,
+			Lat:                row.StopLat,
+			Lon:                row.StopLon,
+			WheelchairBoarding: row.WheelchairBoarding,
+			DistanceM:          &dist,
+		})
+	}
+	sort.Slice(stops, func(i, j int) bool { return *stops[i].DistanceM < *stops[j].DistanceM })
+	writeJSON(w, http.StatusOK, map[string]any{"stops": stops})
+}
+
+// APIWalk returns a walking leg between two points as a GeoJSON Feature:
+// a LineString along the streets when a walking network has been
+// imported and has a path, else a straight line with an estimated length
+// (routed false). Query: from_lat, from_lon, to_lat, to_lon (required).
+func (h *Handler) APIWalk(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var coords [4]float64
+	for i, name := range []string{"from_lat", "from_lon", "to_lat", "to_lon"} {
+		v, err := strconv.ParseFloat(q.Get(name), 64)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "from_lat, from_lon, to_lat and to_lon are required")
+			return
+		}
+		coords[i] = v
+	}
+	from := walk.Point{Lat: coords[0], Lon: coords[1]}
+	to := walk.Point{Lat: coords[2], Lon: coords[3]}
+
+	path := walk.Path{
+		Meters: geo.WalkDistance(from.Lat, from.Lon, to.Lat, to.Lon),
+		Points: []walk.Point{from, to},
+	}
+	routed := false
+	if h.walk != nil {
+		if p, ok := h.walk.Route(from, to, maxRouteMeters); ok {
+			path, routed = p, true
+		}
+	}
+	line := make([][2]float64, len(path.Points))
+	for i, p := range path.Points {
+		line[i] = [2]float64{p.Lon, p.Lat}
+	}
+	writeJSON(w, http.StatusOK, geoJSONFeature{
+		Type:     "Feature",
+		Geometry: geoJSONGeometry{Type: "LineString", Coordinates: line},
+		Properties: map[string]any{
+			"meters":  math.Round(path.Meters),
+			"minutes": geo.WalkMinutes(path.Meters, 0),
+			"routed":  routed,
+		},
+	})
+}
+
+// APIStop returns a stop's details and alerts.
+func (h *Handler) APIStop(w http.ResponseWriter, r *http.Request) {
+	stop, ok := h.apiLookupStop(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"stop":   stop,
+		"alerts": toAPIAlerts(h.alertsForStop(r.Context(), stop.StopID)),
+	})
+}
+
+// APIStopDepartures returns merged scheduled + realtime departures for a stop.
+// Query: limit (default 15, max 100).
+func (h *Handler) APIStopDepartures(w http.ResponseWriter, r *http.Request) {
+	stop, ok := h.apiLookupStop(w, r)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 15
+	}
+
+	deps := h.fetchDepartures(r.Context(), stop.StopID, time.Now(), limit)
+	out := make([]apiDeparture, 0, len(deps))
+	for _, d := range deps {
+		out = append(out, toAPIDeparture(d))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"stop": stop, "departures": out})
+}
+
+// apiLookupStop loads the {id} stop or writes a JSON error.
+func (h *Handler) apiLookupStop(w http.ResponseWriter, r *http.Request) (apiStop, bool) {
+	row, err := h.db.GetStop(r.Context(), r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		writeJSONError(w, http.StatusNotFound, "stop not found")
+		return apiStop{}, false
+	}
+	if err != nil {
+		h.logger.Error("api stop lookup", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return apiStop{}, false
+	}
+	return apiStop{
+		StopID:             row.StopID,
+		StopCode:           row.StopCode,
+		Name:               row.StopName,
+		Description:        row.StopDesc,
+		Lat:                row.StopLat,
+		Lon:                row.StopLon,
+		WheelchairBoarding: row.WheelchairBoarding,
+	}, true
+}
+
+// APIRoutes lists all routes.
+func (h *Handler) APIRoutes(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.AllRoutes(r.Context())
+	if err != nil {
+		h.logger.Error("api routes", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	routes := make([]apiRoute, 0, len(rows))
+	for _, row := range rows {
+		routes = append(routes, apiRoute{
+			RouteID:   row.RouteID,
+			Short:     row.RouteShort,
+			Long:      row.RouteLong,
+			Type:      row.RouteType,
+			Color:     row.RouteColor,
+			TextColor: row.RouteTextColor,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"routes": routes})
+}
+
+// APIRouteStops returns the stops served by a route today, per direction.
+func (h *Handler) APIRouteStops(w http.ResponseWriter, r *http.Request) {
+	routeID := r.PathValue("id")
+	route, found, err := h.findRoute(r.Context(), routeID)
+	if err != nil {
+		h.logger.Error("api route lookup", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !found {
+		writeJSONError(w, http.StatusNotFound, "route not found")
+		return
+	}
+
+	dirs := []apiRouteDirection{}
+	for _, d := range h.loadRouteDirections(r.Context(), routeID, time.Now()) {
+		ad := apiRouteDirection{DirectionID: d.DirectionID, Name: d.Name}
+		for _, s := range d.Stops {
+			ad.Stops = append(ad.Stops, apiStop{
+				StopID: s.StopID,
+				Name:   s.StopName,
+				Lat:    s.StopLat,
+				Lon:    s.StopLon,
+			})
+		}
+		dirs = append(dirs, ad)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"route": apiRoute{
+			RouteID:   route.RouteID,
+			Short:     route.RouteShort,
+			Long:      route.RouteLong,
+			Type:      route.RouteType,
+			Color:     route.RouteColor,
+			TextColor: route.RouteTextColor,
+		},
+		"directions": dirs,
+	})
+}
+
+// APIAlerts returns active service alerts, optionally filtered by ?route= or ?stop=.
+func (h *Handler) APIAlerts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var alerts []apiAlert
+	switch {
+	case q.Get("stop") != "":
+		alerts = toAPIAlerts(h.alertsForStop(r.Context(), q.Get("stop")))
+	case q.Get("route") != "":
+		alerts = toAPIAlerts(h.alertsForRoute(q.Get("route")))
+	default:
+		for _, a := range h.rt.AllAlerts() {
+			alerts = append(alerts, apiAlert{
+				Header:      a.HeaderText,
+				Description: a.DescText,
+				Effect:      a.Effect,
+				RouteIDs:    a.RouteIDs,
+				StopIDs:     a.StopIDs,
+			})
+		}
+	}
+	if alerts == nil {
+		alerts = []apiAlert{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"alerts": alerts})
+}
+
+func toAPIAlerts(alerts []templates.AlertDisplay) []apiAlert {
+	out := make([]apiAlert, 0, len(alerts))
+	for _, a := range alerts {
+		out = append(out, apiAlert{Header: a.HeaderText, Description: a.DescText, Effect: a.Effect})
+	}
+	return out
+}
+
+// APISearch resolves a location query the same way the search page does:
+// cross-street stop search first, then the geocoder.
+func (h *Handler) APISearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		writeJSONError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	results := []apiSearchResult{}
+	stops, err := h.db.SearchStops(r.Context(), query)
+	if err != nil {
+		h.logger.Error("api search stops", "query", query, "error", err)
+	}
+	for _, c := range clusterSearchResults(stops, 500) {
+		results = append(results, apiSearchResult{Name: c.Name, Lat: c.Lat, Lon: c.Lon, Source: "stops"})
+	}
+
+	if len(results) == 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		geoResult, err := h.geo.Search(ctx, query)
+		if err != nil {
+			h.logger.Warn("api geocoding failed", "query", query, "error", err)
+			writeJSONError(w, http.StatusBadGateway, "geocoder unavailable")
+			return
+		}
+		if geoResult != nil {
+			results = append(results, apiSearchResult{
+				Name:   geoResult.DisplayName,
+				Lat:    geoResult.Lat,
+				Lon:    geoResult.Lon,
+				Source: "geocoder",
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"query": query, "results": results})
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gobus/internal/templates"
+)
+
+const apiTokenPrefix = "gbt_"
+
+type ctxKey int
+
+const (
+	apiUserKey     ctxKey = iota // user ID resolved from a bearer token
+	sessionUserKey               // user ID resolved from the session cookie
+)
+
+// generateAPIToken returns a new random bearer token, e.g. "gbt_3f9a…".
+func generateAPIToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return apiTokenPrefix + hex.EncodeToString(b)
+}
+
+// hashAPIToken returns the SHA-256 hex digest stored in api_tokens.token_hash.
+// Tokens are high-entropy, so a fast hash is sufficient (unlike passphrases).
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// feedToken is bearerToken falling back to the RFC 6750 access_token query
+// parameter, for feed consumers (signage, trip planners) that can't set
+// headers. Query strings end up in logs, so only the feeds accept it.
+func feedToken(r *http.Request) string {
+	if token := bearerToken(r); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// RequireAPIToken wraps an /api/v1 handler with bearer-token auth.
+// The session cookie is deliberately not accepted here: API clients are
+// widgets and bots, not browsers.
+func (h *Handler) RequireAPIToken(next http.HandlerFunc) http.HandlerFunc {
+	return h.requireToken(next, bearerToken)
+}
+
+// RequireFeedToken is RequireAPIToken for the GTFS-realtime feeds, which
+// also take the token as an access_token query parameter.
+func (h *Handler) RequireFeedToken(next http.HandlerFunc) http.HandlerFunc {
+	return h.requireToken(next, feedToken)
+}
+
+func (h *Handler) requireToken(next http.HandlerFunc, tokenFrom func(*http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := tokenFrom(r)
+		if !strings.HasPrefix(token, apiTokenPrefix) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gobus"`)
+			writeJSONError(w, http.StatusUnauthorized, "missing or malformed bearer token")
+			return
+		}
+		userID, err := h.db.UserForAPIToken(r.Context(), hashAPIToken(token))
+		if err != nil {
+			h.logger.Error("api token lookup", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		if userID == 0 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gobus", error="invalid_token"`)
+			writeJSONError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), apiUserKey, userID)))
+	}
+}
+
+// currentUserID returns the signed-in user's ID, or 0. The session is
+// resolved once per request by Authenticate (via the auth middleware).
+func (h *Handler) currentUserID(r *http.Request) int64 {
+	userID, _ := r.Context().Value(sessionUserKey).(int64)
+	return userID
+}
+
+// APITokens handles GET (list tokens) and POST (create a token) for the
+// signed-in user. A newly created token is shown exactly once.
+func (h *Handler) APITokens(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	var newToken, errMsg string
+	if r.Method == http.MethodPost {
+		name := strings.TrimSpace(r.FormValue("name"))
+		switch {
+		case name == "":
+			errMsg = "Give the token a name so you can recognize it later."
+		case len(name) > 60:
+			errMsg = "Token name must be 60 characters or fewer."
+		default:
+			token := generateAPIToken()
+			if _, err := h.db.CreateAPIToken(r.Context(), userID, name, hashAPIToken(token)); err != nil {
+				h.logger.Error("creating api token", "error", err)
+				errMsg = "Something went wrong. Please try again."
+			} else {
+				newToken = token
+				h.logger.Info("api token created", "user", userID, "name", name)
+			}
+		}
+	}
+
+	h.renderAPITokens(w, r, userID, newToken, errMsg)
+}
+
+// RevokeAPIToken deletes one of the signed-in user's tokens.
+func (h *Handler) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	tokenID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.RevokeAPIToken(r.Context(), userID, tokenID); err != nil {
+		h.logger.Error("revoking api token", "error", err)
+	}
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+func (h *Handler) renderAPITokens(w http.ResponseWriter, r *http.Request, userID int64, newToken, errMsg string) {
+	rows, err := h.db.ListAPITokens(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("listing api tokens", "error", err)
+	}
+	data := templates.APITokensData{
+		Page:     h.page("API Tokens", "/account"),
+		NewToken: newToken,
+		Error:    errMsg,
+	}
+	for _, t := range rows {
+		data.Tokens = append(data.Tokens, templates.APIToken{
+			ID:        t.ID,
+			Name:      t.Name,
+			CreatedAt: t.CreatedAt,
+			LastUsed:  t.LastUsed,
+		})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if errMsg != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	if err := templates.APITokensPage(data).Render(r.Context(), w); err != nil {
+		h.logger.Error("rendering api tokens page", "error", err)
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIToken_Format(t *testing.T) {
+	a, b := generateAPIToken(), generateAPIToken()
+	if !strings.HasPrefix(a, apiTokenPrefix) {
+		t.Errorf("token %q missing prefix %q", a, apiTokenPrefix)
+	}
+	if len(a) != len(apiTokenPrefix)+64 {
+		t.Errorf("token length = %d, want %d", len(a), len(apiTokenPrefix)+64)
+	}
+	if a == b {
+		t.Error("two generated tokens should differ")
+	}
+	if hashAPIToken(a) == a || len(hashAPIToken(a)) != 64 {
+		t.Errorf("hashAPIToken(%q) = %q, want a 64-char hex digest", a, hashAPIToken(a))
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"Bearer gbt_abc", "gbt_abc"},
+		{"bearer gbt_abc", "gbt_abc"},
+		{"Bearer  gbt_abc ", "gbt_abc"},
+		{"Basic dXNlcjpwYXNz", ""},
+		{"Bearer ", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/v1/routes", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		if got := bearerToken(r); got != tt.want {
+			t.Errorf("bearerToken(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestFeedToken_QueryParam(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/v1/gtfs-rt/alerts.pb?access_token=gbt_xyz", nil)
+	if got := feedToken(r); got != "gbt_xyz" {
+		t.Errorf("feedToken(query) = %q, want gbt_xyz", got)
+	}
+	if got := bearerToken(r); got != "" {
+		t.Errorf("bearerToken should ignore the query parameter, got %q", got)
+	}
+	r.Header.Set("Authorization", "Bearer gbt_header")
+	if got := feedToken(r); got != "gbt_header" {
+		t.Errorf("header should take precedence, got %q", got)
+	}
+}
+
+func TestOpenAPIDocument_IsValidJSON(t *testing.T) {
+	var doc struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal([]byte(openAPIDocument), &doc); err != nil {
+		t.Fatalf("openapi.json does not parse: %v", err)
+	}
+	for _, p := range []string{"/nearby", "/stops/{id}", "/stops/{id}/departures", "/routes", "/routes/{id}/stops", "/alerts", "/search", "/walk"} {
+		if _, ok := doc.Paths[p]["get"]; !ok {
+			t.Errorf("openapi.json missing GET %s", p)
+		}
+	}
+}
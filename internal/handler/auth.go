@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -14,6 +15,7 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 
+	"gobus/internal/storage"
 	"gobus/internal/templates"
 )
 
@@ -24,21 +26,15 @@ const (
 	timeGateMinSec = 3                  // minimum seconds between form load and submit
 )
 
-// --- Cookie signing / verification ---
+// accountDisabledMsg is shown when a disabled account signs in with the
+// right credentials. Wrong credentials get the usual message.
+const accountDisabledMsg = "This account has been disabled. Contact the site operator."
 
-// signCookie produces "userID.expiry.hmac" for a session cookie.
-func (h *Handler) signCookie(userID int64) string {
-	expiry := time.Now().Unix() + cookieMaxAge
-	payload := fmt.Sprintf("%d.%d", userID, expiry)
-	mac := hmac.New(sha256.New, h.cookieSecret)
-	mac.Write([]byte(payload))
-	sig := hex.EncodeToString(mac.Sum(nil))
-	return payload + "." + sig
-}
+// --- Session cookie ---
 
-// VerifyCookie checks a "userID.expiry.hmac" cookie value.
-// Returns userID on success, 0 on failure.
-// Exported so middleware can share the same implementation.
+// VerifyCookie checks a "userID.expiry.hmac" cookie value, the stateless
+// format used before server-side sessions. Returns userID on success, 0 on
+// failure. Authenticate still accepts these once, to upgrade them.
 func VerifyCookie(value string, secret []byte) int64 {
 	parts := strings.SplitN(value, ".", 3)
 	if len(parts) != 3 {
@@ -67,11 +63,11 @@ func (h *Handler) verifyCookie(value string) int64 {
 	return VerifyCookie(value, h.cookieSecret)
 }
 
-// setCookie sets the session cookie on the response.
-func (h *Handler) setCookie(w http.ResponseWriter, userID int64) {
+// setCookie sets the session cookie to an opaque session token.
+func (h *Handler) setCookie(w http.ResponseWriter, token string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     cookieName,
-		Value:    h.signCookie(userID),
+		Value:    token,
 		Path:     "/",
 		MaxAge:   cookieMaxAge,
 		HttpOnly: true,
@@ -121,36 +117,37 @@ func generateDeviceID() string {
 // If the absolute cap is reached, the oldest device is evicted to make room.
 func (h *Handler) checkDeviceLimits(r *http.Request, userID int64, deviceID string) string {
 	ctx := r.Context()
+	cfg := h.cfg.Load()
 
 	// Check temporal limit: too many distinct devices in the rolling window?
-	if h.cfg.MaxDevicesRecent > 0 {
+	if cfg.MaxDevicesRecent > 0 {
 		// First check if this device is already known in the window
-		alreadyKnown, err := h.db.IsDeviceRecent(ctx, userID, deviceID, h.cfg.DeviceWindowMin)
+		alreadyKnown, err := h.db.IsDeviceRecent(ctx, userID, deviceID, cfg.DeviceWindowMin)
 		if err != nil {
 			h.logger.Error("device limit: check device recent", "error", err)
 			return "Something went wrong. Please try again."
 		}
 		if !alreadyKnown {
 			// This would be a new device — check if we're at the limit
-			recent, err := h.db.CountRecentDevices(ctx, userID, h.cfg.DeviceWindowMin)
+			recent, err := h.db.CountRecentDevices(ctx, userID, cfg.DeviceWindowMin)
 			if err != nil {
 				h.logger.Error("device limit: count recent", "error", err)
 				return "Something went wrong. Please try again."
 			}
-			if recent >= h.cfg.MaxDevicesRecent {
+			if recent >= cfg.MaxDevicesRecent {
 				return fmt.Sprintf("Too many devices. This account is active on %d devices right now. Please try again later.", recent)
 			}
 		}
 	}
 
 	// Enforce absolute cap: evict oldest if at limit
-	if h.cfg.MaxDevicesTotal > 0 {
+	if cfg.MaxDevicesTotal > 0 {
 		total, err := h.db.CountDevicesForUser(ctx, userID)
 		if err != nil {
 			h.logger.Error("device limit: count total", "error", err)
 			return "Something went wrong. Please try again."
 		}
-		for total >= h.cfg.MaxDevicesTotal {
+		for total >= cfg.MaxDevicesTotal {
 			if err := h.db.EvictOldestDevice(ctx, userID); err != nil {
 				h.logger.Error("device limit: evict", "error", err)
 				break
@@ -162,9 +159,14 @@ func (h *Handler) checkDeviceLimits(r *http.Request, userID int64, deviceID stri
 	return ""
 }
 
-// recordDevice upserts the device session for tracking.
+// recordDevice upserts the device session. The session cookie is only
+// honored while this row exists, so deleting it signs the device out.
 func (h *Handler) recordDevice(r *http.Request, userID int64, deviceID string) {
-	if err := h.db.UpsertDeviceSession(r.Context(), userID, deviceID); err != nil {
+	ua := r.UserAgent()
+	if len(ua) > 512 {
+		ua = ua[:512]
+	}
+	if err := h.db.UpsertDeviceSession(r.Context(), userID, deviceID, deviceName(ua), ua); err != nil {
 		h.logger.Error("recording device session", "error", err)
 	}
 }
@@ -198,7 +200,7 @@ func (h *Handler) verifyTimeGate(token string) bool {
 	return time.Now().Unix()-ts >= timeGateMinSec
 }
 
-// TestSignCookie creates a signed cookie for testing purposes.
+// TestSignCookie creates a legacy stateless cookie for testing purposes.
 // expiryOffset is seconds from now (positive = future, negative = expired).
 func TestSignCookie(userID int64, expiryOffset int64, secret []byte) string {
 	expiry := time.Now().Unix() + expiryOffset
@@ -221,6 +223,11 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) renderLogin(w http.ResponseWriter, r *http.Request, errMsg string) {
+	h.renderLoginStatus(w, r, errMsg, http.StatusUnprocessableEntity)
+}
+
+// renderLoginStatus renders the login page, using status if there's an error.
+func (h *Handler) renderLoginStatus(w http.ResponseWriter, r *http.Request, errMsg string, status int) {
 	data := templates.AuthData{
 		Page:     h.page("Login", "/login"),
 		IsLogin:  true,
@@ -229,7 +236,7 @@ func (h *Handler) renderLogin(w http.ResponseWriter, r *http.Request, errMsg str
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if errMsg != "" {
-		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.WriteHeader(status)
 	}
 	if err := templates.AuthPage(data).Render(r.Context(), w); err != nil {
 		h.logger.Error("rendering login page", "error", err)
@@ -245,6 +252,17 @@ func (h *Handler) loginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Brute-force protection: the attempt is counted before bcrypt, so a
+	// burst of guesses costs us nothing and can't all get in before the
+	// first one fails. Unknown usernames are tracked too, so lockouts don't
+	// reveal which accounts exist.
+	ip := h.clientIP(r)
+	if wait := h.loginAttempt(ip, username, "login"); wait > 0 {
+		setRetryAfter(w, wait)
+		h.renderLoginStatus(w, r, throttledMessage(wait), http.StatusTooManyRequests)
+		return
+	}
+
 	user, err := h.db.GetUserByUsername(r.Context(), username)
 	if err == sql.ErrNoRows {
 		h.renderLogin(w, r, "Invalid username or passphrase.")
@@ -260,6 +278,14 @@ func (h *Handler) loginPost(w http.ResponseWriter, r *http.Request) {
 		h.renderLogin(w, r, "Invalid username or passphrase.")
 		return
 	}
+	// Only the username's count is undone. The IP's attempts run out with
+	// the throttle window, or signing in to one's own account would reset a
+	// credential-stuffing run from the same address.
+	h.loginUsers.Reset(usernameKey(username))
+	if user.Disabled {
+		h.renderLogin(w, r, accountDisabledMsg)
+		return
+	}
 
 	// Device limiting
 	deviceID := h.getOrCreateDeviceID(w, r)
@@ -269,7 +295,11 @@ func (h *Handler) loginPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.recordDevice(r, int64(user.ID), deviceID)
-	h.setCookie(w, int64(user.ID))
+	if err := h.startSession(w, r, int64(user.ID), deviceID); err != nil {
+		h.logger.Error("login: start session", "error", err)
+		h.renderLogin(w, r, "Something went wrong. Please try again.")
+		return
+	}
 	h.logger.Info("user logged in", "username", username, "device", deviceID[:8])
 	http.Redirect(w, r, "/nearby", http.StatusSeeOther)
 }
@@ -284,16 +314,24 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) renderRegister(w http.ResponseWriter, r *http.Request, errMsg string) {
+	h.renderRegisterStatus(w, r, errMsg, http.StatusUnprocessableEntity)
+}
+
+// renderRegisterStatus renders the registration page, using status if
+// there's an error.
+func (h *Handler) renderRegisterStatus(w http.ResponseWriter, r *http.Request, errMsg string, status int) {
 	data := templates.AuthData{
-		Page:     h.page("Register", "/register"),
-		IsLogin:  false,
-		Error:    errMsg,
-		Username: r.FormValue("username"),
-		TimeGate: h.timeGateToken(),
+		Page:       h.page("Register", "/register"),
+		IsLogin:    false,
+		Error:      errMsg,
+		Username:   r.FormValue("username"),
+		TimeGate:   h.timeGateToken(),
+		Invite:     r.FormValue("invite"),
+		InviteOnly: h.cfg.Load().InviteOnly,
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if errMsg != "" {
-		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.WriteHeader(status)
 	}
 	if err := templates.AuthPage(data).Render(r.Context(), w); err != nil {
 		h.logger.Error("rendering register page", "error", err)
@@ -301,6 +339,15 @@ func (h *Handler) renderRegister(w http.ResponseWriter, r *http.Request, errMsg
 }
 
 func (h *Handler) registerPost(w http.ResponseWriter, r *http.Request) {
+	// Every registration attempt counts against the client IP, successful
+	// or not, so one address can't mint accounts in bulk or probe for taken
+	// usernames and invite codes at full speed.
+	if wait := h.registrationAttempt(h.clientIP(r)); wait > 0 {
+		setRetryAfter(w, wait)
+		h.renderRegisterStatus(w, r, throttledMessage(wait), http.StatusTooManyRequests)
+		return
+	}
+
 	// Honeypot check — if the hidden "website" field is filled, silently reject
 	if r.FormValue("website") != "" {
 		h.logger.Info("registration rejected: honeypot triggered")
@@ -332,15 +379,31 @@ func (h *Handler) registerPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check registration cap
-	if h.cfg.MaxUsers > 0 {
+	// An invite code lets someone in past the cap and in invite-only mode;
+	// it is only used up when the account is actually created, below.
+	invite := normalizeInviteCode(r.FormValue("invite"))
+	if invite != "" {
+		ok, err := h.db.InviteUsable(r.Context(), invite)
+		if err != nil {
+			h.logger.Error("registration: check invite", "error", err)
+			h.renderRegister(w, r, "Something went wrong. Please try again.")
+			return
+		}
+		if !ok {
+			h.renderRegister(w, r, inviteInvalidMsg)
+			return
+		}
+	} else if h.cfg.Load().InviteOnly {
+		h.renderRegister(w, r, "Registration is by invitation only. Enter your invite code.")
+		return
+	} else if maxUsers := h.cfg.Load().MaxUsers; maxUsers > 0 {
 		count, err := h.db.CountUsers(r.Context())
 		if err != nil {
 			h.logger.Error("registration: count users", "error", err)
 			h.renderRegister(w, r, "Something went wrong. Please try again.")
 			return
 		}
-		if count >= h.cfg.MaxUsers {
+		if count >= maxUsers {
 			h.renderRegister(w, r, "Registration is currently closed.")
 			return
 		}
@@ -355,8 +418,17 @@ func (h *Handler) registerPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create user
-	userID, err := h.db.CreateUser(r.Context(), username, string(hash))
+	var userID int64
+	if invite != "" {
+		userID, err = h.db.CreateUserWithInvite(r.Context(), username, string(hash), invite)
+	} else {
+		userID, err = h.db.CreateUser(r.Context(), username, string(hash))
+	}
 	if err != nil {
+		if errors.Is(err, storage.ErrInviteInvalid) {
+			h.renderRegister(w, r, inviteInvalidMsg)
+			return
+		}
 		if strings.Contains(err.Error(), "UNIQUE constraint") {
 			h.renderRegister(w, r, "That username is already taken.")
 			return
@@ -369,19 +441,27 @@ func (h *Handler) registerPost(w http.ResponseWriter, r *http.Request) {
 	// Record device for new user (no limit check needed — first device)
 	deviceID := h.getOrCreateDeviceID(w, r)
 	h.recordDevice(r, userID, deviceID)
+	if err := h.startSession(w, r, userID, deviceID); err != nil {
+		h.logger.Error("registration: start session", "error", err)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
 
-	h.setCookie(w, userID)
-	h.logger.Info("user registered", "username", username, "id", userID, "device", deviceID[:8])
+	h.logger.Info("user registered", "username", username, "id", userID, "device", deviceID[:8], "invited", invite != "")
 	http.Redirect(w, r, "/nearby", http.StatusSeeOther)
 }
 
-// Logout clears the session cookie.
+// Logout revokes this session, signs this device out and clears the
+// session cookie.
 func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	h.endSession(r)
+	if userID := h.currentUserID(r); userID != 0 {
+		if c, err := r.Cookie(deviceCookie); err == nil {
+			if err := h.db.DeleteDeviceSession(r.Context(), userID, c.Value); err != nil {
+				h.logger.Error("logout: delete device session", "error", err)
+			}
+		}
+	}
 	h.clearCookie(w)
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
-
-// CookieSecret returns the handler's cookie secret for use by middleware.
-func (h *Handler) CookieSecret() []byte {
-	return h.cookieSecret
-}
@@ -14,13 +14,13 @@ func newTestHandler() *Handler {
 	}
 }
 
-func TestSignCookie_Format(t *testing.T) {
+func TestLegacyCookie_Format(t *testing.T) {
 	h := newTestHandler()
-	signed := h.signCookie(42)
+	signed := TestSignCookie(42, cookieMaxAge, h.cookieSecret)
 
 	parts := strings.SplitN(signed, ".", 3)
 	if len(parts) != 3 {
-		t.Fatalf("signCookie should produce 3 dot-separated parts, got %d: %q", len(parts), signed)
+		t.Fatalf("legacy cookies should have 3 dot-separated parts, got %d: %q", len(parts), signed)
 	}
 	if parts[0] != "42" {
 		t.Errorf("first part should be userID '42', got %q", parts[0])
@@ -35,17 +35,17 @@ func TestSignVerifyCookie_RoundTrip(t *testing.T) {
 
 	tests := []int64{1, 42, 100, 999999}
 	for _, userID := range tests {
-		signed := h.signCookie(userID)
+		signed := TestSignCookie(userID, cookieMaxAge, h.cookieSecret)
 		got := h.verifyCookie(signed)
 		if got != userID {
-			t.Errorf("verifyCookie(signCookie(%d)) = %d, want %d", userID, got, userID)
+			t.Errorf("verifyCookie(TestSignCookie(%d)) = %d, want %d", userID, got, userID)
 		}
 	}
 }
 
 func TestVerifyCookie_TamperedSignature(t *testing.T) {
 	h := newTestHandler()
-	signed := h.signCookie(42)
+	signed := TestSignCookie(42, cookieMaxAge, h.cookieSecret)
 
 	tampered := signed[:len(signed)-1] + "x"
 	if got := h.verifyCookie(tampered); got != 0 {
@@ -55,7 +55,7 @@ func TestVerifyCookie_TamperedSignature(t *testing.T) {
 
 func TestVerifyCookie_TamperedUserID(t *testing.T) {
 	h := newTestHandler()
-	signed := h.signCookie(42)
+	signed := TestSignCookie(42, cookieMaxAge, h.cookieSecret)
 
 	parts := strings.SplitN(signed, ".", 3)
 	tampered := "99." + parts[1] + "." + parts[2]
@@ -68,7 +68,7 @@ func TestVerifyCookie_WrongSecret(t *testing.T) {
 	h1 := &Handler{cookieSecret: []byte("secret-one-32-bytes-long-xxxxxx!")}
 	h2 := &Handler{cookieSecret: []byte("secret-two-32-bytes-long-xxxxxx!")}
 
-	signed := h1.signCookie(42)
+	signed := TestSignCookie(42, cookieMaxAge, h1.cookieSecret)
 	if got := h2.verifyCookie(signed); got != 0 {
 		t.Errorf("different secret should return 0, got %d", got)
 	}
@@ -116,7 +116,7 @@ func TestVerifyCookie_MalformedInputs(t *testing.T) {
 
 func TestVerifyCookie_ExportedMatchesMethod(t *testing.T) {
 	h := newTestHandler()
-	signed := h.signCookie(42)
+	signed := TestSignCookie(42, cookieMaxAge, h.cookieSecret)
 
 	// The exported VerifyCookie and the method should agree
 	got1 := h.verifyCookie(signed)
@@ -7,20 +7,13 @@ import (
 	"time"
 
 	"gobus/internal/nextrip"
+	"gobus/internal/storage"
 	"gobus/internal/templates"
 )
 
 // fetchDepartures gets merged scheduled + realtime departures for a stop.
 // Returns up to `limit` departures sorted by time.
 func (h *Handler) fetchDepartures(ctx context.Context, stopID string, now time.Time, limit int) []templates.DepartureInfo {
-	// 1. Get scheduled departures from GTFS
-	afterTime := now.Format("15:04:05")
-	schedRows, err := h.db.DeparturesForStop(ctx, stopID, now, afterTime, limit*2)
-	if err != nil {
-		h.logger.Error("fetching scheduled departures", "stop", stopID, "error", err)
-	}
-
-	// 2. Get realtime departures from NexTrip API
 	var rtDeps []nextrip.Departure
 	ntResp, err := h.nt.DeparturesForStop(ctx, stopID)
 	if err != nil {
@@ -28,6 +21,20 @@ func (h *Handler) fetchDepartures(ctx context.Context, stopID string, now time.T
 	} else {
 		rtDeps = ntResp.Departures
 	}
+	return h.mergeDepartures(ctx, stopID, now, limit, rtDeps)
+}
+
+// mergeDepartures merges a stop's scheduled departures with the realtime
+// ones given. Returns up to `limit` departures sorted by time.
+func (h *Handler) mergeDepartures(ctx context.Context, stopID string, now time.Time, limit int, rtDeps []nextrip.Departure) []templates.DepartureInfo {
+	// 1. Get scheduled departures from GTFS
+	afterTime := now.Format("15:04:05")
+	schedRows, err := h.db.DeparturesForStop(ctx, stopID, now, afterTime, limit*2)
+	if err != nil {
+		h.logger.Error("fetching scheduled departures", "stop", stopID, "error", err)
+	}
+
+	// 2. Realtime departures from NexTrip are in rtDeps
 
 	// 3. Build a map of realtime data keyed by trip_id for merging
 	rtByTrip := make(map[string]nextrip.Departure)
@@ -56,13 +63,19 @@ func (h *Handler) fetchDepartures(ctx context.Context, stopID string, now time.T
 		}
 
 		dep := templates.DepartureInfo{
-			RouteID:     sched.RouteID,
-			RouteShort:  routeShort,
-			RouteColor:  sched.RouteColor,
-			Headsign:    sched.TripHeadsign,
-			DirectionID: sched.DirectionID,
-			Scheduled:   scheduledTime,
-			MinutesAway: minutesAway,
+			TripID:       sched.TripID,
+			StopSequence: sched.StopSequence,
+			RouteID:      sched.RouteID,
+			RouteShort:   routeShort,
+			RouteColor:   sched.RouteColor,
+			Headsign:     sched.TripHeadsign,
+			DirectionID:  sched.DirectionID,
+			Scheduled:    scheduledTime,
+			MinutesAway:  minutesAway,
+			ScheduledAt:  parseGTFSTime(sched.DepartureTime, now),
+
+			WheelchairAccessible: sched.WheelchairAccessible,
+			BikesAllowed:         sched.BikesAllowed,
 		}
 
 		// Try to get direction text from NexTrip data for this route+direction
@@ -80,6 +93,7 @@ func (h *Handler) fetchDepartures(ctx context.Context, stopID string, now time.T
 			if rt.Actual {
 				rtTime := time.Unix(rt.DepartureTime, 0).In(now.Location())
 				dep.Realtime = rtTime.Format("3:04 PM")
+				dep.RealtimeAt = rtTime
 				dep.MinutesAway = int(time.Until(rtTime).Minutes())
 				if dep.MinutesAway < 0 {
 					dep.MinutesAway = 0
@@ -105,7 +119,8 @@ func (h *Handler) fetchDepartures(ctx context.Context, stopID string, now time.T
 			continue
 		}
 
-		result = append(result, templates.DepartureInfo{
+		dep := templates.DepartureInfo{
+			TripID:        rt.TripID,
 			RouteID:       rt.RouteID,
 			RouteShort:    rt.RouteShortName,
 			Headsign:      rt.Description,
@@ -115,7 +130,12 @@ func (h *Handler) fetchDepartures(ctx context.Context, stopID string, now time.T
 			Realtime:      rtTime.Format("3:04 PM"),
 			MinutesAway:   minutesAway,
 			IsRealtime:    rt.Actual,
-		})
+			ScheduledAt:   rtTime,
+		}
+		if rt.Actual {
+			dep.RealtimeAt = rtTime
+		}
+		result = append(result, dep)
 	}
 
 	// 6. Sort by minutes away
@@ -132,9 +152,12 @@ func (h *Handler) fetchDepartures(ctx context.Context, stopID string, now time.T
 }
 
 // fetchDeparturesForStopView returns departures grouped by route+direction
-// with individual time entries (for the stops-centric nearby view).
-func (h *Handler) fetchDeparturesForStopView(ctx context.Context, stopID string, now time.Time) []templates.StopRouteGroup {
-	allDeps := h.fetchDepartures(ctx, stopID, now, 30)
+// with individual time entries (for the stops-centric nearby view). Each
+// time says when to leave to walk walkMin minutes to the stop, or that it
+// can't be made. With accessibleOnly, trips marked not wheelchair
+// accessible are left out.
+func (h *Handler) fetchDeparturesForStopView(ctx context.Context, row storage.NearbyStopRow, now time.Time, walkMin int, accessibleOnly bool) []templates.StopRouteGroup {
+	allDeps := h.nearbyDepartures(ctx, row, now, 30, accessibleOnly)
 
 	type routeKey struct {
 		routeID     string
@@ -166,6 +189,7 @@ func (h *Handler) fetchDeparturesForStopView(ctx context.Context, stopID string,
 			RouteTextColor: deps[0].RouteTextColor,
 			DirectionText:  deps[0].DirectionText,
 			Headsign:       deps[0].Headsign,
+			Platform:       deps[0].Platform,
 		}
 		for _, dep := range deps {
 			rg.Times = append(rg.Times, templates.StopRouteDeparture{
@@ -174,6 +198,9 @@ func (h *Handler) fetchDeparturesForStopView(ctx context.Context, stopID string,
 				MinutesAway: dep.MinutesAway,
 				IsRealtime:  dep.IsRealtime,
 				IsLate:      dep.IsLate,
+				Wheelchair:  dep.WheelchairAccessible,
+				LeaveIn:     dep.MinutesAway - walkMin,
+				Unreachable: dep.MinutesAway < walkMin,
 			})
 		}
 		result = append(result, rg)
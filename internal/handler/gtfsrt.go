@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	gtfs "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"gobus/internal/realtime"
+	"gobus/internal/templates"
+)
+
+// GTFSRTTripUpdates serves the merged schedule + NexTrip predictions as a
+// GTFS-RT TripUpdates feed. Only stops already in the NexTrip cache are
+// included, so consumers never cause extra upstream requests.
+func (h *Handler) GTFSRTTripUpdates(w http.ResponseWriter, r *http.Request) {
+	h.writeFeed(w, r, h.tripUpdatesFeed(r.Context(), time.Now()))
+}
+
+// GTFSRTAlerts serves the stored service alerts as a GTFS-RT Alerts feed.
+func (h *Handler) GTFSRTAlerts(w http.ResponseWriter, r *http.Request) {
+	h.writeFeed(w, r, h.rt.AlertsFeed(time.Now()))
+}
+
+// writeFeed encodes a feed as protobuf, or as JSON when the request path
+// ends in .json (handy for eyeballing the feed in a browser or with jq).
+func (h *Handler) writeFeed(w http.ResponseWriter, r *http.Request, feed *gtfs.FeedMessage) {
+	var (
+		body []byte
+		err  error
+	)
+	if strings.HasSuffix(r.URL.Path, ".json") {
+		body, err = protojson.MarshalOptions{Multiline: true, UseProtoNames: true}.Marshal(feed)
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		body, err = proto.Marshal(feed)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}
+	if err != nil {
+		h.logger.Error("encoding gtfs-rt feed", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(body)
+}
+
+// tripUpdatesFeed builds a TripUpdates feed from the cached stops. It reads
+// the cache only: a stop whose entry expires while the feed is built is
+// left out rather than fetched.
+func (h *Handler) tripUpdatesFeed(ctx context.Context, now time.Time) *gtfs.FeedMessage {
+	byStop := make(map[string][]templates.DepartureInfo)
+	for _, stopID := range h.nt.CachedStopIDs() {
+		resp, ok := h.nt.CachedDepartures(stopID)
+		if !ok {
+			continue
+		}
+		byStop[stopID] = h.mergeDepartures(ctx, stopID, now, 30, resp.Departures)
+	}
+	return buildTripUpdatesFeed(byStop, now)
+}
+
+// buildTripUpdatesFeed groups realtime predictions by trip. Each trip becomes
+// one entity with its stop time updates ordered by stop_sequence, as the
+// spec requires. Trips NexTrip reports that aren't in the schedule are
+// marked ADDED.
+func buildTripUpdatesFeed(byStop map[string][]templates.DepartureInfo, now time.Time) *gtfs.FeedMessage {
+	type stopUpdate struct {
+		stopID string
+		dep    templates.DepartureInfo
+	}
+	trips := make(map[string][]stopUpdate)
+	for stopID, deps := range byStop {
+		for _, d := range deps {
+			if d.TripID == "" || d.RealtimeAt.IsZero() {
+				continue
+			}
+			trips[d.TripID] = append(trips[d.TripID], stopUpdate{stopID, d})
+		}
+	}
+
+	tripIDs := make([]string, 0, len(trips))
+	for id := range trips {
+		tripIDs = append(tripIDs, id)
+	}
+	sort.Strings(tripIDs)
+
+	feed := realtime.NewFeedMessage(now)
+	for _, tripID := range tripIDs {
+		updates := trips[tripID]
+		sort.Slice(updates, func(i, j int) bool {
+			if updates[i].dep.StopSequence != updates[j].dep.StopSequence {
+				return updates[i].dep.StopSequence < updates[j].dep.StopSequence
+			}
+			return updates[i].dep.RealtimeAt.Before(updates[j].dep.RealtimeAt)
+		})
+
+		first := updates[0].dep
+		trip := &gtfs.TripDescriptor{
+			TripId:      proto.String(tripID),
+			RouteId:     proto.String(first.RouteID),
+			DirectionId: proto.Uint32(uint32(first.DirectionID)),
+		}
+		// A trip is ADDED only if none of its stops matched the schedule
+		added := updates[len(updates)-1].dep.StopSequence == 0
+		if added {
+			trip.ScheduleRelationship = gtfs.TripDescriptor_ADDED.Enum()
+		}
+
+		tu := &gtfs.TripUpdate{Trip: trip, Timestamp: proto.Uint64(uint64(now.Unix()))}
+		for _, u := range updates {
+			event := &gtfs.TripUpdate_StopTimeEvent{Time: proto.Int64(u.dep.RealtimeAt.Unix())}
+			if !added {
+				event.Delay = proto.Int32(int32(u.dep.RealtimeAt.Sub(u.dep.ScheduledAt).Seconds()))
+			}
+			stu := &gtfs.TripUpdate_StopTimeUpdate{
+				StopId:    proto.String(u.stopID),
+				Departure: event,
+			}
+			if u.dep.StopSequence > 0 {
+				stu.StopSequence = proto.Uint32(uint32(u.dep.StopSequence))
+			}
+			tu.StopTimeUpdate = append(tu.StopTimeUpdate, stu)
+		}
+
+		feed.Entity = append(feed.Entity, &gtfs.FeedEntity{
+			Id:         proto.String(fmt.Sprintf("tu-%s", tripID)),
+			TripUpdate: tu,
+		})
+	}
+	return feed
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	gtfs "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+
+	"gobus/internal/templates"
+)
+
+func TestBuildTripUpdatesFeed(t *testing.T) {
+	now := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	sched := now.Add(10 * time.Minute)
+	byStop := map[string][]templates.DepartureInfo{
+		"200": {{TripID: "T1", RouteID: "18", StopSequence: 12, ScheduledAt: sched.Add(5 * time.Minute), RealtimeAt: sched.Add(7 * time.Minute)}},
+		"100": {
+			{TripID: "T1", RouteID: "18", StopSequence: 4, ScheduledAt: sched, RealtimeAt: sched.Add(2 * time.Minute)},
+			{TripID: "T2", RouteID: "18", StopSequence: 5, ScheduledAt: sched}, // schedule only
+			{TripID: "X9", RouteID: "21", ScheduledAt: sched, RealtimeAt: sched},
+		},
+	}
+
+	feed := buildTripUpdatesFeed(byStop, now)
+
+	// Round-trip through the wire format to catch missing required fields
+	b, err := proto.Marshal(feed)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var got gtfs.FeedMessage
+	if err := proto.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if got.GetHeader().GetGtfsRealtimeVersion() != "2.0" {
+		t.Errorf("version = %q", got.GetHeader().GetGtfsRealtimeVersion())
+	}
+	if len(got.Entity) != 2 {
+		t.Fatalf("got %d entities, want 2 (schedule-only trips are omitted)", len(got.Entity))
+	}
+
+	t1 := got.Entity[0].GetTripUpdate()
+	if t1.GetTrip().GetTripId() != "T1" {
+		t.Fatalf("first entity trip = %q, want T1", t1.GetTrip().GetTripId())
+	}
+	stus := t1.GetStopTimeUpdate()
+	if len(stus) != 2 || stus[0].GetStopSequence() != 4 || stus[1].GetStopSequence() != 12 {
+		t.Errorf("stop time updates not ordered by stop_sequence: %v", stus)
+	}
+	if d := stus[0].GetDeparture().GetDelay(); d != 120 {
+		t.Errorf("delay = %d, want 120", d)
+	}
+
+	x9 := got.Entity[1].GetTripUpdate()
+	if x9.GetTrip().GetScheduleRelationship() != gtfs.TripDescriptor_ADDED {
+		t.Errorf("unscheduled trip relationship = %v, want ADDED", x9.GetTrip().GetScheduleRelationship())
+	}
+	if x9.GetStopTimeUpdate()[0].GetDeparture().Delay != nil {
+		t.Error("added trip should not report a delay")
+	}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"crypto/md5"
 	"crypto/rand"
 	"encoding/hex"
@@ -13,45 +14,89 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"gobus/internal/config"
 	"gobus/internal/geocode"
+	"gobus/internal/gtfs"
 	"gobus/internal/nextrip"
 	"gobus/internal/realtime"
 	"gobus/internal/storage"
 	"gobus/internal/templates"
+	"gobus/internal/throttle"
+	"gobus/internal/walk"
+	"gobus/internal/webpush"
 	"gobus/web"
 )
 
-// cachedLocation stores a user's last reverse-geocoded location.
-type cachedLocation struct {
-	Lat     float64
-	Lon     float64
-	Address string
-}
-
 // Handler holds shared dependencies for all HTTP handlers.
 type Handler struct {
-	db           *storage.DB
-	nt           *nextrip.Client
-	rt           *realtime.Store
-	geo          *geocode.Client
-	cfg          *config.Config
-	logger       *slog.Logger
-	version      string     // content hash of static assets, for cache busting
-	cookieSecret []byte     // HMAC key for signing session cookies
-	locationCache sync.Map  // userID (int64) → *cachedLocation
+	db              *storage.DB
+	nt              *nextrip.Client
+	rt              *realtime.Store
+	geo             geocode.Geocoder
+	push            *webpush.Sender
+	cfg             atomic.Pointer[config.Config] // swapped by Reload
+	logger          *slog.Logger
+	version         string            // content hash of static assets, for cache busting
+	cookieSecret    []byte            // HMAC key for session IDs and signed tokens
+	previousSecrets [][]byte          // secrets being rotated out (GOBUS_COOKIE_SECRET_PREVIOUS)
+	previousUntil   time.Time         // end of the rotation grace period
+	challenges      challengeStore    // outstanding passkey ceremonies
+	conns           connCache         // recent reachability search windows
+	loginIPs        *throttle.Limiter // failed sign-in attempts per client IP
+	registerIPs     *throttle.Limiter // registration attempts per client IP
+	passkeyIPs      *throttle.Limiter // passkey sign-in starts per client IP
+	loginUsers      *throttle.Limiter // failed sign-in attempts per username
+	feed            *gtfs.Scheduler   // set by SetScheduler; nil in --import-gtfs runs and tests
+	walk            *walk.Graph       // set by SetWalkGraph; nil without an imported street network
+	streamsDone     chan struct{}     // closed by CloseStreams to end SSE streams
+	closeStreams    sync.Once
 }
 
 // New creates a Handler.
-func New(db *storage.DB, nt *nextrip.Client, rt *realtime.Store, geo *geocode.Client, cfg *config.Config, logger *slog.Logger) *Handler {
+func New(db *storage.DB, nt *nextrip.Client, rt *realtime.Store, geo geocode.Geocoder, cfg *config.Config, logger *slog.Logger) *Handler {
 	v := computeAssetVersion(web.StaticFiles)
 	logger.Info("asset version computed", "version", v)
 
 	// Derive cookie secret: env var > file on disk > generate and save
 	secret := loadOrCreateSecret(cfg, logger)
+	push := webpush.NewSender(loadOrCreateVAPIDKeys(cfg, logger), cfg.VAPIDSubject)
+	push.SetAllowPrivate(cfg.PushAllowHTTP)
+
+	h := &Handler{db: db, nt: nt, rt: rt, geo: geo, push: push, logger: logger, version: v, cookieSecret: secret,
+		loginIPs:    throttle.New(loginPolicy(cfg, cfg.LoginLockoutIP)),
+		loginUsers:  throttle.New(loginPolicy(cfg, cfg.LoginLockoutUser)),
+		registerIPs: throttle.New(loginPolicy(cfg, cfg.LoginLockoutIP)),
+		passkeyIPs:  throttle.New(loginPolicy(cfg, cfg.LoginLockoutIP)),
+		streamsDone: make(chan struct{}),
+	}
+	h.cfg.Store(cfg)
+	if prev := previousSecretsFrom(cfg.CookieSecretPrevious); prev != nil {
+		until, err := rotationDeadline(context.Background(), db, secret, cfg.CookieGraceDays)
+		if err != nil {
+			logger.Error("cookie secret rotation: reading rotation time", "error", err)
+		}
+		h.previousSecrets, h.previousUntil = prev, until
+		logger.Info("accepting sessions from previous cookie secret", "until", until.Format(time.RFC3339))
+	}
+	h.registerMetrics()
+	return h
+}
 
-	return &Handler{db: db, nt: nt, rt: rt, geo: geo, cfg: cfg, logger: logger, version: v, cookieSecret: secret}
+// Reload switches to a new configuration. Requests already running keep the
+// one they started with. Only settings marked reloadable in config.Config
+// should differ from the current ones; see config.Config.Reload.
+func (h *Handler) Reload(cfg *config.Config) {
+	h.cfg.Store(cfg)
+	if h.push != nil {
+		h.push.SetAllowPrivate(cfg.PushAllowHTTP)
+	}
+	h.loginIPs.SetPolicy(loginPolicy(cfg, cfg.LoginLockoutIP))
+	h.loginUsers.SetPolicy(loginPolicy(cfg, cfg.LoginLockoutUser))
+	h.registerIPs.SetPolicy(loginPolicy(cfg, cfg.LoginLockoutIP))
+	h.passkeyIPs.SetPolicy(loginPolicy(cfg, cfg.LoginLockoutIP))
 }
 
 // computeAssetVersion hashes all CSS and JS files in the embedded static FS
@@ -129,3 +174,40 @@ func loadOrCreateSecret(cfg *config.Config, logger *slog.Logger) []byte {
 	}
 	return secret
 }
+
+// loadOrCreateVAPIDKeys resolves the Web Push signing key the same way as
+// the cookie secret: env var, then .vapid_key next to the database, then a
+// freshly generated key saved for next time. Changing the key invalidates
+// every existing push subscription, so it must survive restarts.
+func loadOrCreateVAPIDKeys(cfg *config.Config, logger *slog.Logger) *webpush.Keys {
+	if cfg.VAPIDPrivateKey != "" {
+		keys, err := webpush.ParsePrivateKey(cfg.VAPIDPrivateKey)
+		if err != nil {
+			logger.Error("invalid GOBUS_VAPID_PRIVATE_KEY", "error", err)
+			os.Exit(1)
+		}
+		return keys
+	}
+
+	keyPath := filepath.Join(filepath.Dir(cfg.DBPath), ".vapid_key")
+	if data, err := os.ReadFile(keyPath); err == nil {
+		if keys, err := webpush.ParsePrivateKey(strings.TrimSpace(string(data))); err == nil {
+			logger.Info("VAPID key loaded from file", "path", keyPath)
+			return keys
+		}
+	}
+
+	keys, err := webpush.GenerateKeys()
+	if err != nil {
+		logger.Error("failed to generate VAPID key", "error", err)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err == nil {
+		if err := os.WriteFile(keyPath, []byte(keys.PrivateKey()+"\n"), 0600); err == nil {
+			logger.Info("VAPID key generated and saved", "path", keyPath)
+		} else {
+			logger.Warn("could not save VAPID key to file — push subscriptions won't survive restart", "error", err)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"gobus/internal/metrics"
+)
+
+// Check statuses. "warn" is reported but doesn't make the server unready:
+// an upstream outage affects every replica alike, so pulling them all out
+// of rotation would only make things worse.
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// alertsStaleAfter is how old the last good alerts fetch can be before
+// readiness warns. The feed is polled every minute.
+const alertsStaleAfter = 5 * time.Minute
+
+type healthCheck struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Detail     string  `json:"detail,omitempty"`
+	AgeSeconds float64 `json:"age_seconds,omitempty"`
+}
+
+type healthResponse struct {
+	Status        string        `json:"status"`
+	UptimeSeconds float64       `json:"uptime_seconds"`
+	Checks        []healthCheck `json:"checks,omitempty"`
+}
+
+// Healthz reports that the process is up and serving. It checks nothing
+// else, so a slow database or upstream never gets the process restarted.
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, healthResponse{
+		Status:        "ok",
+		UptimeSeconds: metrics.Uptime().Seconds(),
+	})
+}
+
+// Readyz reports whether the server can usefully take traffic: schedule
+// data loaded and still in service, the database writable. Realtime data
+// age is reported as a warning only. Responds 503 if any check fails.
+// Anyone can call it, so errors go to the log, not into the details.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	checks := []healthCheck{
+		h.checkGTFSLoaded(ctx),
+		h.checkFeedCurrent(ctx, time.Now()),
+		h.checkDBWritable(ctx),
+		h.checkAlerts(time.Now()),
+		h.checkNexTrip(),
+	}
+	resp := healthResponse{Status: "ready", UptimeSeconds: metrics.Uptime().Seconds(), Checks: checks}
+	status := http.StatusOK
+	for _, c := range checks {
+		if c.Status == checkFail {
+			resp.Status = "not_ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, resp)
+}
+
+func (h *Handler) checkGTFSLoaded(ctx context.Context) healthCheck {
+	c := healthCheck{Name: "gtfs_loaded", Status: checkPass}
+	if !h.db.HasData(ctx) {
+		c.Status, c.Detail = checkFail, "no schedule data imported yet"
+		return c
+	}
+	if imported, _ := h.db.GetMetadata(ctx, "imported_at"); imported != "" {
+		if t, err := time.Parse(time.RFC3339, imported); err == nil {
+			c.Detail = "imported " + t.Format(time.RFC3339)
+			c.AgeSeconds = time.Since(t).Seconds()
+		}
+	}
+	return c
+}
+
+// checkFeedCurrent fails once the imported schedule has no service left,
+// which happens if the daily update keeps failing past the feed's end date.
+func (h *Handler) checkFeedCurrent(ctx context.Context, now time.Time) healthCheck {
+	c := healthCheck{Name: "feed_current", Status: checkPass}
+	end, err := h.db.ServiceEndDate(ctx)
+	if err != nil {
+		h.logger.Error("readiness: service end date", "error", err)
+		c.Status, c.Detail = checkFail, "unavailable"
+		return c
+	}
+	return feedCurrent(c, end, now)
+}
+
+func feedCurrent(c healthCheck, end string, now time.Time) healthCheck {
+	endDate, err := time.ParseInLocation("20060102", end, now.Location())
+	if err != nil {
+		c.Status, c.Detail = checkFail, "no service dates in the schedule"
+		return c
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch days := int(math.Round(endDate.Sub(today).Hours() / 24)); {
+	case days < 0:
+		c.Status, c.Detail = checkFail, fmt.Sprintf("schedule expired on %s", endDate.Format("2006-01-02"))
+	case days < 7:
+		c.Status, c.Detail = checkWarn, fmt.Sprintf("schedule ends %s, in %d days", endDate.Format("2006-01-02"), days)
+	default:
+		c.Detail = "service through " + endDate.Format("2006-01-02")
+	}
+	return c
+}
+
+func (h *Handler) checkDBWritable(ctx context.Context) healthCheck {
+	c := healthCheck{Name: "db_writable", Status: checkPass}
+	start := time.Now()
+	if err := h.db.CheckWritable(ctx); err != nil {
+		h.logger.Error("readiness: database write", "error", err)
+		c.Status, c.Detail = checkFail, "unavailable"
+		return c
+	}
+	c.Detail = fmt.Sprintf("write took %s", time.Since(start).Round(time.Microsecond))
+	return c
+}
+
+func (h *Handler) checkAlerts(now time.Time) healthCheck {
+	c := healthCheck{Name: "realtime_alerts", Status: checkPass}
+	s := h.rt.AlertsHealth()
+	if s.LastSuccess.IsZero() {
+		c.Status, c.Detail = checkWarn, "alerts feed not fetched yet"
+		if s.LastError != "" {
+			c.Detail += "; last attempt failed"
+		}
+		return c
+	}
+	c.AgeSeconds = now.Sub(s.LastSuccess).Seconds()
+	c.Detail = "last fetched " + s.LastSuccess.Format(time.RFC3339)
+	if now.Sub(s.LastSuccess) > alertsStaleAfter {
+		c.Status = checkWarn
+		if s.LastError != "" {
+			c.Detail += "; fetches failing since"
+		}
+	}
+	return c
+}
+
+// checkNexTrip reports the outcome of the last NexTrip request. NexTrip is
+// only called when someone views a stop, so there's no age to judge by.
+func (h *Handler) checkNexTrip() healthCheck {
+	c := healthCheck{Name: "realtime_nextrip", Status: checkPass}
+	s := h.nt.Health()
+	switch {
+	case s.Requests == 0:
+		c.Detail = "no requests yet"
+	case !s.OK():
+		c.Status, c.Detail = checkWarn, "last request failed"
+	default:
+		c.AgeSeconds = time.Since(s.LastSuccess).Seconds()
+		c.Detail = "last succeeded " + s.LastSuccess.Format(time.RFC3339)
+	}
+	return c
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeedCurrent(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		end        string
+		wantStatus string
+	}{
+		{"20260630", checkPass},
+		{"20260317", checkPass}, // exactly a week left
+		{"20260316", checkWarn},
+		{"20260310", checkWarn}, // last day of service is still today
+		{"20260309", checkFail},
+		{"", checkFail},
+	}
+	for _, tt := range tests {
+		got := feedCurrent(healthCheck{Name: "feed_current", Status: checkPass}, tt.end, now)
+		if got.Status != tt.wantStatus {
+			t.Errorf("feedCurrent(%q) = %s (%s), want %s", tt.end, got.Status, got.Detail, tt.wantStatus)
+		}
+	}
+}
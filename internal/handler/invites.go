@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"crypto/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gobus/internal/templates"
+)
+
+// inviteInvalidMsg is shown for any invite code that can't be redeemed.
+// Unknown, revoked, used-up and expired codes look the same to the user.
+const inviteInvalidMsg = "That invite code is invalid, used up or expired."
+
+// codeAlphabet omits look-alikes (0/o, 1/l/i) so codes survive being read
+// aloud or copied by hand.
+const codeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// readableCode returns a random code like "k7qm-3xtp-9wfa", used for invite
+// codes and temporary passphrases. That's about 59 bits of entropy.
+func readableCode() string {
+	var sb strings.Builder
+	buf := make([]byte, 1)
+	for n := 0; n < 12; {
+		rand.Read(buf)
+		// Reject the top of the byte range so every letter is equally likely
+		if int(buf[0]) >= 256/len(codeAlphabet)*len(codeAlphabet) {
+			continue
+		}
+		if n > 0 && n%4 == 0 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(codeAlphabet[int(buf[0])%len(codeAlphabet)])
+		n++
+	}
+	return sb.String()
+}
+
+// normalizeInviteCode undoes common retyping mistakes: case, surrounding
+// spaces, and spaces instead of dashes.
+func normalizeInviteCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.Join(strings.Fields(code), "-")
+}
+
+// AdminInvites lists invite codes with a form to create one.
+func (h *Handler) AdminInvites(w http.ResponseWriter, r *http.Request) {
+	h.renderAdminInvites(w, r, "", "")
+}
+
+func (h *Handler) renderAdminInvites(w http.ResponseWriter, r *http.Request, newCode, errMsg string) {
+	rows, err := h.db.ListInvites(r.Context())
+	if err != nil {
+		h.logger.Error("admin: list invites", "error", err)
+	}
+	data := templates.AdminInvitesData{
+		Page:       h.page("Invites", "/admin"),
+		Error:      errMsg,
+		InviteOnly: h.cfg.Load().InviteOnly,
+	}
+	if newCode != "" {
+		data.NewCode = newCode
+		data.NewLink = h.relyingParty(r).Origin + "/register?invite=" + newCode
+	}
+	now := time.Now()
+	for _, inv := range rows {
+		item := templates.AdminInvite{
+			ID:        inv.ID,
+			Code:      inv.Code,
+			Note:      inv.Note,
+			Uses:      inv.Uses,
+			MaxUses:   inv.MaxUses,
+			CreatedBy: inv.CreatedBy,
+			CreatedAt: inv.CreatedAt,
+			Users:     inv.Users,
+		}
+		if !inv.ExpiresAt.IsZero() {
+			item.Expires = inv.ExpiresAt.Local().Format("Jan 2, 2006 3:04 PM")
+		}
+		switch {
+		case inv.Revoked:
+			item.Status = "Revoked"
+		case !inv.ExpiresAt.IsZero() && !now.Before(inv.ExpiresAt):
+			item.Status = "Expired"
+		case inv.MaxUses > 0 && inv.Uses >= inv.MaxUses:
+			item.Status = "Used up"
+		default:
+			item.Active = true
+		}
+		data.Invites = append(data.Invites, item)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if errMsg != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	if err := templates.AdminInvitesPage(data).Render(r.Context(), w); err != nil {
+		h.logger.Error("rendering admin invites page", "error", err)
+	}
+}
+
+// AdminCreateInvite creates an invite code. uses = 0 allows unlimited
+// redemptions and days = 0 never expires.
+func (h *Handler) AdminCreateInvite(w http.ResponseWriter, r *http.Request) {
+	note := strings.TrimSpace(r.FormValue("note"))
+	uses, err1 := strconv.Atoi(r.FormValue("uses"))
+	days, err2 := strconv.Atoi(r.FormValue("days"))
+	switch {
+	case len(note) > 100:
+		h.renderAdminInvites(w, r, "", "Note must be 100 characters or fewer.")
+		return
+	case err1 != nil || uses < 0 || uses > 10000:
+		h.renderAdminInvites(w, r, "", "Uses must be a number from 0 (unlimited) to 10000.")
+		return
+	case err2 != nil || days < 0 || days > 3650:
+		h.renderAdminInvites(w, r, "", "Expiry must be a number of days from 0 (never) to 3650.")
+		return
+	}
+	var expires time.Time
+	if days > 0 {
+		expires = time.Now().Add(time.Duration(days) * 24 * time.Hour)
+	}
+
+	code := readableCode()
+	adminID := h.currentUserID(r)
+	id, err := h.db.CreateInvite(r.Context(), code, note, uses, expires, adminID)
+	if err != nil {
+		h.logger.Error("admin: create invite", "error", err)
+		h.renderAdminInvites(w, r, "", "Something went wrong. Please try again.")
+		return
+	}
+	h.logger.Info("admin: invite created", "invite", id, "uses", uses, "days", days, "admin", adminID)
+	h.renderAdminInvites(w, r, code, "")
+}
+
+// AdminRevokeInvite stops an invite code from being redeemed. Accounts
+// already created with it are unaffected.
+func (h *Handler) AdminRevokeInvite(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.RevokeInvite(r.Context(), id); err != nil {
+		h.logger.Error("admin: revoke invite", "error", err)
+	}
+	h.logger.Info("admin: invite revoked", "invite", id, "admin", h.currentUserID(r))
+	http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+}
@@ -54,6 +54,9 @@ func (h *Handler) LaterArrivals(w http.ResponseWriter, r *http.Request) {
 
 	// Fetch a large number of departures and filter to this route+direction
 	allDeps := h.fetchDepartures(ctx, stopID, now, 200)
+	if h.accessibleOnly(r) {
+		allDeps = accessibleDepartures(allDeps)
+	}
 	var departures []templates.DepartureInfo
 	for _, dep := range allDeps {
 		if dep.RouteID == routeID && dep.DirectionID == directionID {
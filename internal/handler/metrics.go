@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"gobus/internal/metrics"
+)
+
+// Metrics serves Prometheus metrics. It is exempt from session auth so a
+// scraper can reach it; set GOBUS_METRICS_TOKEN to require a bearer token.
+func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
+	if want := h.cfg.Load().MetricsToken; want != "" {
+		if subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gobus-metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	metrics.Handler().ServeHTTP(w, r)
+}
+
+// registerMetrics exposes numbers the NexTrip client, the realtime store and
+// the database already keep, read at scrape time.
+func (h *Handler) registerMetrics() {
+	metrics.NewCounterFunc("gobus_nextrip_requests_total", "Requests made to the NexTrip API.",
+		func() float64 { return float64(h.nt.Health().Requests) })
+	metrics.NewCounterFunc("gobus_nextrip_request_failures_total", "NexTrip API requests that failed or returned non-200.",
+		func() float64 { return float64(h.nt.Health().Failures) })
+	metrics.NewCounterFunc("gobus_nextrip_cache_hits_total", "NexTrip lookups answered from the response cache.",
+		func() float64 { return float64(h.nt.CacheStats().Hits) })
+	metrics.NewCounterFunc("gobus_nextrip_cache_misses_total", "NexTrip lookups that went to the API.",
+		func() float64 { return float64(h.nt.CacheStats().Misses) })
+	metrics.NewGaugeFunc("gobus_nextrip_cache_entries", "Responses held in the NexTrip cache, including expired ones not yet cleaned up.",
+		func() float64 { return float64(h.nt.CacheStats().Entries) })
+
+	metrics.NewCounterFunc("gobus_gtfsrt_fetches_total", "Fetches of the GTFS-RT alerts feed.",
+		func() float64 { return float64(h.rt.AlertsHealth().Requests) })
+	metrics.NewCounterFunc("gobus_gtfsrt_fetch_failures_total", "GTFS-RT alerts feed fetches that failed.",
+		func() float64 { return float64(h.rt.AlertsHealth().Failures) })
+	metrics.NewGaugeFunc("gobus_gtfsrt_alerts_age_seconds", "Seconds since alerts were last fetched successfully (since startup if never).",
+		func() float64 {
+			last := h.rt.AlertsHealth().LastSuccess
+			if last.IsZero() {
+				return metrics.Uptime().Seconds()
+			}
+			return time.Since(last).Seconds()
+		})
+	metrics.NewGaugeFunc("gobus_gtfsrt_alerts", "Service alerts currently in effect.",
+		func() float64 { return float64(len(h.rt.AllAlerts())) })
+
+	metrics.NewGaugeFunc("gobus_gtfs_last_import_timestamp_seconds", "Unix time of the last successful GTFS import (0 if none).",
+		func() float64 {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			v, err := h.db.GetMetadata(ctx, "imported_at")
+			if err != nil {
+				return 0
+			}
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return 0
+			}
+			return float64(t.Unix())
+		})
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gobus/internal/config"
+)
+
+func TestMetricsToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string // configured
+		header string
+		want   int
+	}{
+		{"open", "", "", http.StatusOK},
+		{"missing", "s3cret", "", http.StatusUnauthorized},
+		{"wrong", "s3cret", "Bearer nope", http.StatusUnauthorized},
+		{"right", "s3cret", "Bearer s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{}
+			h.cfg.Store(&config.Config{MetricsToken: tt.token})
+			r := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.Metrics(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && !strings.Contains(w.Body.String(), "# TYPE gobus_sse_connections gauge") {
+				t.Errorf("body doesn't look like Prometheus output:\n%s", w.Body.String())
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"html"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -84,6 +85,11 @@ func (h *Handler) Nearby(w http.ResponseWriter, r *http.Request) {
 		Lon:   lonStr,
 		Query: query,
 	}
+	if !partial {
+		data.Pinned = h.pinnedFavorites(r)
+	}
+	prefs := h.riderPrefs(r)
+	data.AccessibleOnly = prefs.accessibleOnly
 
 	// If we have coordinates, find nearby stops/routes
 	if latStr != "" && lonStr != "" {
@@ -93,7 +99,7 @@ func (h *Handler) Nearby(w http.ResponseWriter, r *http.Request) {
 			switch view {
 			case "stops":
 				limit := 5
-				stopViews, hasMore, err := h.findNearbyStopsView(r, lat, lon, offset, limit, radius)
+				stopViews, hasMore, err := h.findNearbyStopsView(r, lat, lon, offset, limit, radius, prefs)
 				if err != nil {
 					h.logger.Error("finding nearby stops (stop view)", "error", err)
 				} else {
@@ -105,7 +111,7 @@ func (h *Handler) Nearby(w http.ResponseWriter, r *http.Request) {
 							break
 						}
 						radius = nextR
-						stopViews, hasMore, err = h.findNearbyStopsView(r, lat, lon, newOffset, limit, radius)
+						stopViews, hasMore, err = h.findNearbyStopsView(r, lat, lon, newOffset, limit, radius, prefs)
 						if err != nil {
 							h.logger.Error("finding nearby stops (stop view)", "error", err)
 							break
@@ -129,7 +135,7 @@ func (h *Handler) Nearby(w http.ResponseWriter, r *http.Request) {
 				if partial {
 					limit = 10
 				}
-				routes, hasMore, err := h.findNearbyRoutes(r, lat, lon, offset, limit, radius)
+				routes, hasMore, err := h.findNearbyRoutes(r, lat, lon, offset, limit, radius, prefs)
 				if err != nil {
 					h.logger.Error("finding nearby routes", "error", err)
 				} else {
@@ -141,7 +147,7 @@ func (h *Handler) Nearby(w http.ResponseWriter, r *http.Request) {
 							break
 						}
 						radius = nextR
-						routes, hasMore, err = h.findNearbyRoutes(r, lat, lon, newOffset, limit, radius)
+						routes, hasMore, err = h.findNearbyRoutes(r, lat, lon, newOffset, limit, radius, prefs)
 						if err != nil {
 							h.logger.Error("finding nearby routes", "error", err)
 							break
@@ -193,7 +199,10 @@ func (h *Handler) Nearby(w http.ResponseWriter, r *http.Request) {
 // findNearbyRoutes builds the flat route-first nearby view data.
 // It queries a wider area than the stop view, groups departures by route+direction,
 // pairs opposite directions across nearby stops, computes intervals, and paginates.
-func (h *Handler) findNearbyRoutes(r *http.Request, lat, lon float64, offset, limit int, halfSide float64) ([]templates.RouteNearbyRow, bool, error) {
+// With prefs.accessibleOnly, stops and trips marked not wheelchair accessible
+// are skipped. Departures the user couldn't walk to in time at their pace
+// are left out.
+func (h *Handler) findNearbyRoutes(r *http.Request, lat, lon float64, offset, limit int, halfSide float64, prefs riderPrefs) ([]templates.RouteNearbyRow, bool, error) {
 	ctx := r.Context()
 	now := time.Now()
 
@@ -205,17 +214,26 @@ func (h *Handler) findNearbyRoutes(r *http.Request, lat, lon float64, offset, li
 	if err != nil {
 		return nil, false, fmt.Errorf("query nearby stops: %w", err)
 	}
+	if prefs.accessibleOnly {
+		rows = accessibleStops(rows)
+	}
+	rows = collapseStations(rows)
 
-	// Compute distances for ordering (Haversine for display accuracy)
+	// Order by walking distance; show the straight-line distance
 	type stopWithDist struct {
 		row      int
 		distance float64
+		walk     float64
 	}
 	var allStops []stopWithDist
+	walks := h.walkDistances(lat, lon, rows)
 	for i, row := range rows {
 		dist := geo.Haversine(lat, lon, row.StopLat, row.StopLon)
-		allStops = append(allStops, stopWithDist{row: i, distance: dist})
+		allStops = append(allStops, stopWithDist{row: i, distance: dist, walk: walks[i]})
 	}
+	sort.SliceStable(allStops, func(i, j int) bool {
+		return allStops[i].walk < allStops[j].walk
+	})
 
 	// Take top display stops (scaled by radius)
 	displayStops := allStops
@@ -256,6 +274,8 @@ func (h *Handler) findNearbyRoutes(r *http.Request, lat, lon float64, offset, li
 		stopName string
 		stopLat  float64
 		stopLon  float64
+		access   int // the stop's wheelchair_boarding
+		walkMin  int
 	}
 	groups := make(map[routeKey]*routeGroup)
 	var order []routeKey
@@ -263,7 +283,8 @@ func (h *Handler) findNearbyRoutes(r *http.Request, lat, lon float64, offset, li
 	fetchStops := append(displayStops, companionStops...)
 	for _, sd := range fetchStops {
 		row := rows[sd.row]
-		deps := h.fetchDepartures(ctx, row.StopID, now, 30)
+		walkMin := geo.WalkMinutes(sd.walk, prefs.walkSpeed)
+		deps := reachableDepartures(h.nearbyDepartures(ctx, row, now, 30, prefs.accessibleOnly), walkMin)
 		for _, dep := range deps {
 			key := routeKey{dep.RouteID, dep.DirectionID}
 			if g, ok := groups[key]; ok {
@@ -271,12 +292,20 @@ func (h *Handler) findNearbyRoutes(r *http.Request, lat, lon float64, offset, li
 					g.deps = append(g.deps, dep)
 				}
 			} else {
+				// At a station, the row is for the platform it leaves from
+				stopID, stopName := row.StopID, row.StopName
+				if dep.StopID != "" {
+					stopID = dep.StopID
+					stopName += " · " + dep.Platform
+				}
 				groups[key] = &routeGroup{
 					deps:     []templates.DepartureInfo{dep},
-					stopID:   row.StopID,
-					stopName: row.StopName,
+					stopID:   stopID,
+					stopName: stopName,
 					stopLat:  row.StopLat,
 					stopLon:  row.StopLon,
+					access:   row.WheelchairBoarding,
+					walkMin:  walkMin,
 				}
 				order = append(order, key)
 			}
@@ -303,12 +332,14 @@ func (h *Handler) findNearbyRoutes(r *http.Request, lat, lon float64, offset, li
 			StopID:         g.stopID,
 			StopName:       g.stopName,
 			DistanceM:      geo.Haversine(lat, lon, g.stopLat, g.stopLon),
-			WalkDistM:      geo.ManhattanDistance(lat, lon, g.stopLat, g.stopLon),
+			WalkMin:        g.walkMin,
 			Scheduled:      dep.Scheduled,
 			Realtime:       dep.Realtime,
 			MinutesAway:    dep.MinutesAway,
 			IsRealtime:     dep.IsRealtime,
 			IsLate:         dep.IsLate,
+			Wheelchair:     combinedAccess(g.access, dep.WheelchairAccessible),
+			LeaveIn:        dep.MinutesAway - g.walkMin,
 		}
 
 		// Later times
@@ -363,10 +394,12 @@ func (h *Handler) findNearbyRoutes(r *http.Request, lat, lon float64, offset, li
 			allRoutes[pi].AltMinutesAway = allRoutes[ai].MinutesAway
 			allRoutes[pi].AltIsRealtime = allRoutes[ai].IsRealtime
 			allRoutes[pi].AltIsLate = allRoutes[ai].IsLate
+			allRoutes[pi].AltWheelchair = allRoutes[ai].Wheelchair
+			allRoutes[pi].AltLeaveIn = allRoutes[ai].LeaveIn
 			allRoutes[pi].AltLaterTimes = allRoutes[ai].LaterTimes
 			allRoutes[pi].AltInterval = allRoutes[ai].Interval
 			allRoutes[pi].AltDistanceM = allRoutes[ai].DistanceM
-			allRoutes[pi].AltWalkDistM = allRoutes[ai].WalkDistM
+			allRoutes[pi].AltWalkMin = allRoutes[ai].WalkMin
 			// Mark alt for removal
 			allRoutes[ai].RouteID = "" // sentinel for removal
 			break
@@ -395,8 +428,9 @@ func (h *Handler) findNearbyRoutes(r *http.Request, lat, lon float64, offset, li
 }
 
 // findNearbyStopsView builds the stop-first view data with pagination.
-// Each stop shows all routes serving it, with no cross-stop pairing.
-func (h *Handler) findNearbyStopsView(r *http.Request, lat, lon float64, offset, limit int, halfSide float64) ([]templates.StopViewData, bool, error) {
+// Each stop shows all routes serving it, with no cross-stop pairing, and
+// departures the user couldn't walk to in time are flagged.
+func (h *Handler) findNearbyStopsView(r *http.Request, lat, lon float64, offset, limit int, halfSide float64, prefs riderPrefs) ([]templates.StopViewData, bool, error) {
 	ctx := r.Context()
 	now := time.Now()
 
@@ -407,17 +441,26 @@ func (h *Handler) findNearbyStopsView(r *http.Request, lat, lon float64, offset,
 	if err != nil {
 		return nil, false, fmt.Errorf("query nearby stops: %w", err)
 	}
+	if prefs.accessibleOnly {
+		rows = accessibleStops(rows)
+	}
+	rows = collapseStations(rows)
 
-	// Compute distances for ordering (Haversine for display accuracy)
+	// Order by walking distance; show the straight-line distance
 	type stopWithDist struct {
 		row      int
 		distance float64
+		walk     float64
 	}
 	var allStops []stopWithDist
+	walks := h.walkDistances(lat, lon, rows)
 	for i, row := range rows {
 		dist := geo.Haversine(lat, lon, row.StopLat, row.StopLon)
-		allStops = append(allStops, stopWithDist{row: i, distance: dist})
+		allStops = append(allStops, stopWithDist{row: i, distance: dist, walk: walks[i]})
 	}
+	sort.SliceStable(allStops, func(i, j int) bool {
+		return allStops[i].walk < allStops[j].walk
+	})
 
 	// Paginate
 	if offset >= len(allStops) {
@@ -439,14 +482,18 @@ func (h *Handler) findNearbyStopsView(r *http.Request, lat, lon float64, offset,
 	var result []templates.StopViewData
 	for _, s := range pageStops {
 		row := rows[s.row]
-		rg := h.fetchDeparturesForStopView(ctx, row.StopID, now)
+		walkMin := geo.WalkMinutes(s.walk, prefs.walkSpeed)
+		rg := h.fetchDeparturesForStopView(ctx, row, now, walkMin, prefs.accessibleOnly)
 
 		sv := templates.StopViewData{
 			StopID:      row.StopID,
 			StopName:    row.StopName,
 			DistanceM:   s.distance,
-			WalkDistM:   geo.ManhattanDistance(lat, lon, row.StopLat, row.StopLon),
+			WalkMin:     walkMin,
 			RouteGroups: rg,
+
+			WheelchairBoarding: row.WheelchairBoarding,
+			IsStation:          row.LocationType == 1,
 		}
 
 		// Disambiguate if multiple stops share the same name
@@ -485,7 +532,8 @@ func formatStopDesc(desc string) string {
 
 // LocationLabel handles async reverse geocoding for the nearby page location label.
 // Returns an HTML span with the street address, or 204 if unavailable.
-// Caches the result per user — skips the Nominatim call if the user hasn't moved >25m.
+// The geocoder caches answers for everyone by rounded position, so a user
+// who hasn't moved much doesn't cause another upstream call.
 func (h *Handler) LocationLabel(w http.ResponseWriter, r *http.Request) {
 	latStr := r.URL.Query().Get("lat")
 	lonStr := r.URL.Query().Get("lon")
@@ -496,23 +544,6 @@ func (h *Handler) LocationLabel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Identify user from session cookie for caching
-	userID := int64(0)
-	if cookie, err := r.Cookie(cookieName); err == nil {
-		userID = h.verifyCookie(cookie.Value)
-	}
-
-	// Check cache: if user hasn't moved >25m, return cached address
-	if userID > 0 {
-		if cached, ok := h.locationCache.Load(userID); ok {
-			cl := cached.(*cachedLocation)
-			if geo.Haversine(lat, lon, cl.Lat, cl.Lon) < 25 {
-				h.renderLocationLabel(w, cl.Address)
-				return
-			}
-		}
-	}
-
 	ctx, cancel := context.WithTimeout(r.Context(), 4*time.Second)
 	defer cancel()
 
@@ -522,11 +553,6 @@ func (h *Handler) LocationLabel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Cache the result for this user
-	if userID > 0 {
-		h.locationCache.Store(userID, &cachedLocation{Lat: lat, Lon: lon, Address: addr})
-	}
-
 	h.renderLocationLabel(w, addr)
 }
 
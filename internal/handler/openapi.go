@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// OpenAPI serves the OpenAPI 3 description of the /api/v1 surface.
+// It is public so client generators can fetch it without a token.
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	fmt.Fprint(w, openAPIDocument)
+}
+
+const openAPIDocument = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "GoBus API",
+    "version": "1.0.0",
+    "description": "Read-only JSON access to the data behind the GoBus pages: nearby stops, merged scheduled and realtime departures, routes, alerts, location search and walking legs. Create a token on the /account/tokens page and send it as a bearer token."
+  },
+  "servers": [{ "url": "/api/v1" }],
+  "security": [{ "bearerAuth": [] }],
+  "components": {
+    "securitySchemes": {
+      "bearerAuth": { "type": "http", "scheme": "bearer" }
+    },
+    "responses": {
+      "Error": {
+        "description": "Error",
+        "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Error" } } }
+      }
+    },
+    "schemas": {
+      "Error": {
+        "type": "object",
+        "properties": { "error": { "type": "string" } },
+        "required": ["error"]
+      },
+      "Stop": {
+        "type": "object",
+        "properties": {
+          "stop_id": { "type": "string" },
+          "stop_code": { "type": "string" },
+          "name": { "type": "string" },
+          "description": { "type": "string" },
+          "lat": { "type": "number" },
+          "lon": { "type": "number" },
+          "wheelchair_boarding": { "type": "integer", "description": "GTFS wheelchair_boarding: 0 unknown, 1 accessible, 2 not accessible" },
+          "distance_m": { "type": "number", "description": "Straight-line distance from the query point (nearby only)" }
+        },
+        "required": ["stop_id", "name", "lat", "lon"]
+      },
+      "Departure": {
+        "type": "object",
+        "properties": {
+          "trip_id": { "type": "string" },
+          "route_id": { "type": "string" },
+          "route_short": { "type": "string" },
+          "direction_id": { "type": "integer" },
+          "direction": { "type": "string", "example": "Southbound" },
+          "headsign": { "type": "string" },
+          "scheduled_time": { "type": "string", "format": "date-time" },
+          "predicted_time": { "type": "string", "format": "date-time", "description": "Present only when a realtime prediction exists" },
+          "minutes_away": { "type": "integer" },
+          "is_realtime": { "type": "boolean" },
+          "is_late": { "type": "boolean" },
+          "wheelchair_accessible": { "type": "integer", "description": "GTFS wheelchair_accessible: 0 unknown, 1 accessible, 2 not accessible" },
+          "bikes_allowed": { "type": "integer", "description": "GTFS bikes_allowed: 0 unknown, 1 allowed, 2 not allowed" }
+        },
+        "required": ["route_id", "route_short", "direction_id", "scheduled_time", "minutes_away", "is_realtime", "is_late", "wheelchair_accessible", "bikes_allowed"]
+      },
+      "Route": {
+        "type": "object",
+        "properties": {
+          "route_id": { "type": "string" },
+          "short_name": { "type": "string" },
+          "long_name": { "type": "string" },
+          "route_type": { "type": "integer" },
+          "color": { "type": "string" },
+          "text_color": { "type": "string" }
+        },
+        "required": ["route_id", "short_name", "long_name", "route_type"]
+      },
+      "Alert": {
+        "type": "object",
+        "properties": {
+          "header": { "type": "string" },
+          "description": { "type": "string" },
+          "effect": { "type": "string" },
+          "route_ids": { "type": "array", "items": { "type": "string" } },
+          "stop_ids": { "type": "array", "items": { "type": "string" } }
+        },
+        "required": ["header", "effect"]
+      },
+      "SearchResult": {
+        "type": "object",
+        "properties": {
+          "name": { "type": "string" },
+          "lat": { "type": "number" },
+          "lon": { "type": "number" },
+          "source": { "type": "string", "enum": ["stops", "geocoder"] }
+        },
+        "required": ["name", "lat", "lon", "source"]
+      }
+    }
+  },
+  "paths": {
+    "/nearby": {
+      "get": {
+        "summary": "Stops near a point, nearest first",
+        "parameters": [
+          { "name": "lat", "in": "query", "required": true, "schema": { "type": "number" } },
+          { "name": "lon", "in": "query", "required": true, "schema": { "type": "number" } },
+          { "name": "radius", "in": "query", "schema": { "type": "number", "default": 450 }, "description": "Search half-width in meters" },
+          { "name": "limit", "in": "query", "schema": { "type": "integer", "default": 20, "maximum": 100 } }
+        ],
+        "responses": {
+          "200": {
+            "description": "Nearby stops",
+            "content": { "application/json": { "schema": {
+              "type": "object",
+              "properties": { "stops": { "type": "array", "items": { "$ref": "#/components/schemas/Stop" } } }
+            } } }
+          },
+          "400": { "$ref": "#/components/responses/Error" },
+          "401": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/stops/{id}": {
+      "get": {
+        "summary": "Stop details and alerts",
+        "parameters": [{ "name": "id", "in": "path", "required": true, "schema": { "type": "string" } }],
+        "responses": {
+          "200": {
+            "description": "Stop",
+            "content": { "application/json": { "schema": {
+              "type": "object",
+              "properties": {
+                "stop": { "$ref": "#/components/schemas/Stop" },
+                "alerts": { "type": "array", "items": { "$ref": "#/components/schemas/Alert" } }
+              }
+            } } }
+          },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/stops/{id}/departures": {
+      "get": {
+        "summary": "Upcoming departures, scheduled merged with realtime predictions",
+        "parameters": [
+          { "name": "id", "in": "path", "required": true, "schema": { "type": "string" } },
+          { "name": "limit", "in": "query", "schema": { "type": "integer", "default": 15, "maximum": 100 } }
+        ],
+        "responses": {
+          "200": {
+            "description": "Departures",
+            "content": { "application/json": { "schema": {
+              "type": "object",
+              "properties": {
+                "stop": { "$ref": "#/components/schemas/Stop" },
+                "departures": { "type": "array", "items": { "$ref": "#/components/schemas/Departure" } }
+              }
+            } } }
+          },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/routes": {
+      "get": {
+        "summary": "All routes",
+        "responses": {
+          "200": {
+            "description": "Routes",
+            "content": { "application/json": { "schema": {
+              "type": "object",
+              "properties": { "routes": { "type": "array", "items": { "$ref": "#/components/schemas/Route" } } }
+            } } }
+          }
+        }
+      }
+    },
+    "/routes/{id}/stops": {
+      "get": {
+        "summary": "Stops served by a route today, per direction",
+        "parameters": [{ "name": "id", "in": "path", "required": true, "schema": { "type": "string" } }],
+        "responses": {
+          "200": {
+            "description": "Route stops",
+            "content": { "application/json": { "schema": {
+              "type": "object",
+              "properties": {
+                "route": { "$ref": "#/components/schemas/Route" },
+                "directions": { "type": "array", "items": {
+                  "type": "object",
+                  "properties": {
+                    "direction_id": { "type": "integer" },
+                    "name": { "type": "string" },
+                    "stops": { "type": "array", "items": { "$ref": "#/components/schemas/Stop" } }
+                  }
+                } }
+              }
+            } } }
+          },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/alerts": {
+      "get": {
+        "summary": "Active service alerts",
+        "parameters": [
+          { "name": "route", "in": "query", "schema": { "type": "string" } },
+          { "name": "stop", "in": "query", "schema": { "type": "string" } }
+        ],
+        "responses": {
+          "200": {
+            "description": "Alerts",
+            "content": { "application/json": { "schema": {
+              "type": "object",
+              "properties": { "alerts": { "type": "array", "items": { "$ref": "#/components/schemas/Alert" } } }
+            } } }
+          }
+        }
+      }
+    },
+    "/gtfs-rt/trip-updates.pb": {
+      "get": {
+        "summary": "GTFS-RT TripUpdates feed built from merged schedule and realtime predictions",
+        "description": "Covers stops with recently requested predictions. Append .json instead of .pb for a JSON rendering. Clients that cannot send headers may pass ?access_token=.",
+        "responses": {
+          "200": { "description": "FeedMessage", "content": { "application/x-protobuf": {} } },
+          "401": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/gtfs-rt/alerts.pb": {
+      "get": {
+        "summary": "GTFS-RT Alerts feed",
+        "description": "Append .json instead of .pb for a JSON rendering.",
+        "responses": {
+          "200": { "description": "FeedMessage", "content": { "application/x-protobuf": {} } },
+          "401": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/search": {
+      "get": {
+        "summary": "Resolve cross streets or an address to coordinates",
+        "parameters": [{ "name": "q", "in": "query", "required": true, "schema": { "type": "string" } }],
+        "responses": {
+          "200": {
+            "description": "Search results",
+            "content": { "application/json": { "schema": {
+              "type": "object",
+              "properties": {
+                "query": { "type": "string" },
+                "results": { "type": "array", "items": { "$ref": "#/components/schemas/SearchResult" } }
+              }
+            } } }
+          },
+          "400": { "$ref": "#/components/responses/Error" },
+          "502": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/walk": {
+      "get": {
+        "summary": "A walking leg between two points, along the streets when the server has a walking network",
+        "parameters": [
+          { "name": "from_lat", "in": "query", "required": true, "schema": { "type": "number" } },
+          { "name": "from_lon", "in": "query", "required": true, "schema": { "type": "number" } },
+          { "name": "to_lat", "in": "query", "required": true, "schema": { "type": "number" } },
+          { "name": "to_lon", "in": "query", "required": true, "schema": { "type": "number" } }
+        ],
+        "responses": {
+          "200": {
+            "description": "GeoJSON LineString Feature from start to end",
+            "content": { "application/json": { "schema": {
+              "type": "object",
+              "properties": {
+                "type": { "type": "string", "enum": ["Feature"] },
+                "geometry": { "type": "object" },
+                "properties": {
+                  "type": "object",
+                  "properties": {
+                    "meters": { "type": "number", "description": "Walking distance" },
+                    "minutes": { "type": "integer", "description": "Walking time at 3 mph" },
+                    "routed": { "type": "boolean", "description": "false if the path is a straight-line estimate: no walking network, or no path within 5 km" }
+                  }
+                }
+              }
+            } } }
+          },
+          "400": { "$ref": "#/components/responses/Error" },
+          "401": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    }
+  }
+}
+`
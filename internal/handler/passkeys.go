@@ -0,0 +1,390 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gobus/internal/templates"
+	"gobus/internal/webauthn"
+)
+
+const (
+	passkeyCookie       = "gobus_webauthn"
+	passkeyChallengeTTL = 5 * time.Minute
+	maxPasskeys         = 10
+	// maxPasskeyChallenges caps the ceremonies in progress at once, so a
+	// flood of sign-in starts can't grow the challenge map without bound.
+	maxPasskeyChallenges = 10000
+)
+
+// errTooManyChallenges is returned by issueChallenge when
+// maxPasskeyChallenges ceremonies are already in progress.
+var errTooManyChallenges = errors.New("too many passkey ceremonies in progress")
+
+// passkeyChallenge is an outstanding registration or sign-in ceremony.
+// userID is 0 for sign-in, where the user isn't known until the assertion
+// names a credential.
+type passkeyChallenge struct {
+	challenge []byte
+	userID    int64
+	expires   time.Time
+}
+
+// challengeStore holds outstanding ceremonies by base64url challenge.
+// RunChallengeSweep drops the expired ones.
+type challengeStore struct {
+	mu sync.Mutex
+	m  map[string]passkeyChallenge
+}
+
+// add stores a challenge, unless the store is full.
+func (s *challengeStore) add(key string, pc passkeyChallenge) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.m) >= maxPasskeyChallenges {
+		return false
+	}
+	if s.m == nil {
+		s.m = make(map[string]passkeyChallenge)
+	}
+	s.m[key] = pc
+	return true
+}
+
+// take removes and returns a challenge.
+func (s *challengeStore) take(key string) (passkeyChallenge, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pc, ok := s.m[key]
+	delete(s.m, key)
+	return pc, ok
+}
+
+// sweep drops challenges that expired before now.
+func (s *challengeStore) sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, pc := range s.m {
+		if now.After(pc.expires) {
+			delete(s.m, k)
+		}
+	}
+}
+
+// RunChallengeSweep drops expired passkey challenges every minute until ctx
+// is cancelled.
+func (h *Handler) RunChallengeSweep(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			h.challenges.sweep(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// relyingParty returns the WebAuthn relying party for this request. With no
+// GOBUS_WEBAUTHN_ORIGIN configured it is derived from the request, which
+// suits localhost and single-host deployments.
+func (h *Handler) relyingParty(r *http.Request) webauthn.RelyingParty {
+	cfg := h.cfg.Load()
+	origin := cfg.WebAuthnOrigin
+	if origin == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		origin = scheme + "://" + r.Host
+	}
+	origin = strings.TrimRight(origin, "/")
+
+	id := cfg.WebAuthnRPID
+	if id == "" {
+		if u, err := url.Parse(origin); err == nil {
+			id = u.Hostname()
+		}
+	}
+	return webauthn.RelyingParty{ID: id, Name: "GoBus", Origin: origin}
+}
+
+// issueChallenge starts a ceremony: it remembers a fresh challenge and hands
+// the browser a short-lived cookie naming it.
+func (h *Handler) issueChallenge(w http.ResponseWriter, userID int64) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	key := base64.RawURLEncoding.EncodeToString(challenge)
+	if !h.challenges.add(key, passkeyChallenge{challenge: challenge, userID: userID, expires: time.Now().Add(passkeyChallengeTTL)}) {
+		return nil, errTooManyChallenges
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeyCookie,
+		Value:    key,
+		Path:     "/",
+		MaxAge:   int(passkeyChallengeTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return challenge, nil
+}
+
+// takeChallenge consumes the challenge named by the request's cookie. Each
+// challenge can be used once, and only by the user it was issued to.
+func (h *Handler) takeChallenge(w http.ResponseWriter, r *http.Request, userID int64) ([]byte, bool) {
+	http.SetCookie(w, &http.Cookie{Name: passkeyCookie, Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	c, err := r.Cookie(passkeyCookie)
+	if err != nil {
+		return nil, false
+	}
+	pc, ok := h.challenges.take(c.Value)
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(pc.expires) || pc.userID != userID {
+		return nil, false
+	}
+	return pc.challenge, true
+}
+
+// --- Sign-in ---
+
+// PasskeyLoginBegin returns options for navigator.credentials.get. Every
+// start counts against the client IP in a limiter of its own, so a client
+// can't hold open challenges at full speed.
+func (h *Handler) PasskeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	ip := h.clientIP(r)
+	if wait, _ := h.passkeyIPs.Check(ipKey(ip)); wait > 0 {
+		setRetryAfter(w, wait)
+		writeJSONError(w, http.StatusTooManyRequests, throttledMessage(wait))
+		return
+	}
+	h.passkeyStarted(ip)
+
+	challenge, err := h.issueChallenge(w, 0)
+	if errors.Is(err, errTooManyChallenges) {
+		h.logger.Warn("passkey login: challenge limit reached", "ip", ip)
+		writeJSONError(w, http.StatusServiceUnavailable, "Too many sign-ins in progress. Please try again shortly.")
+		return
+	}
+	if err != nil {
+		h.logger.Error("passkey login: challenge", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "Something went wrong. Please try again.")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.relyingParty(r).RequestOptions(challenge))
+}
+
+// PasskeyLoginFinish verifies a passkey assertion and signs the user in,
+// applying the same device limits as a passphrase login.
+func (h *Handler) PasskeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var resp webauthn.AssertionResponse
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&resp); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid passkey response.")
+		return
+	}
+	challenge, ok := h.takeChallenge(w, r, 0)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "Sign-in timed out. Please try again.")
+		return
+	}
+
+	cred, err := h.db.GetPasskey(ctx, resp.RawID)
+	if err == sql.ErrNoRows {
+		writeJSONError(w, http.StatusUnauthorized, "That passkey isn't registered with GoBus.")
+		return
+	}
+	if err != nil {
+		h.logger.Error("passkey login: db lookup", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "Something went wrong. Please try again.")
+		return
+	}
+
+	stored := webauthn.Credential{ID: cred.CredentialID, PublicKey: cred.PublicKey, SignCount: cred.SignCount}
+	count, err := h.relyingParty(r).VerifyAssertion(challenge, stored, resp)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrCloned) {
+			h.logger.Warn("passkey login: signature counter regressed", "user", cred.UserID, "passkey", cred.ID)
+		} else {
+			h.logger.Info("passkey login: verification failed", "user", cred.UserID, "error", err)
+		}
+		writeJSONError(w, http.StatusUnauthorized, "Passkey sign-in failed.")
+		return
+	}
+	if err := h.db.RecordPasskeyUse(ctx, cred.ID, count); err != nil {
+		h.logger.Error("passkey login: record use", "error", err)
+	}
+	if user, err := h.db.GetUserByID(ctx, cred.UserID); err != nil || user.Disabled {
+		if err != nil {
+			h.logger.Error("passkey login: user lookup", "error", err)
+		}
+		writeJSONError(w, http.StatusForbidden, accountDisabledMsg)
+		return
+	}
+
+	deviceID := h.getOrCreateDeviceID(w, r)
+	if msg := h.checkDeviceLimits(r, cred.UserID, deviceID); msg != "" {
+		writeJSONError(w, http.StatusForbidden, msg)
+		return
+	}
+
+	h.recordDevice(r, cred.UserID, deviceID)
+	if err := h.startSession(w, r, cred.UserID, deviceID); err != nil {
+		h.logger.Error("passkey login: start session", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "Something went wrong. Please try again.")
+		return
+	}
+	h.logger.Info("user logged in with passkey", "user", cred.UserID, "device", deviceID[:8])
+	writeJSON(w, http.StatusOK, map[string]string{"redirect": "/nearby"})
+}
+
+// --- Managing passkeys ---
+
+// Passkeys shows the signed-in user's passkeys with add and remove controls.
+func (h *Handler) Passkeys(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	rows, err := h.db.ListPasskeys(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("listing passkeys", "error", err)
+	}
+	data := templates.PasskeysData{Page: h.page("Passkeys", "/account/passkeys")}
+	for _, p := range rows {
+		data.Passkeys = append(data.Passkeys, templates.Passkey{ID: p.ID, Name: p.Name, CreatedAt: p.CreatedAt, LastUsed: p.LastUsed})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.PasskeysPage(data).Render(r.Context(), w); err != nil {
+		h.logger.Error("rendering passkeys page", "error", err)
+	}
+}
+
+// PasskeyRegisterBegin returns options for navigator.credentials.create.
+// Passkeys can only be added from an existing session.
+func (h *Handler) PasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		writeJSONError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+	user, err := h.db.GetUserByID(ctx, userID)
+	if err != nil {
+		h.logger.Error("passkey register: user lookup", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "Something went wrong. Please try again.")
+		return
+	}
+	existing, err := h.db.ListPasskeys(ctx, userID)
+	if err != nil {
+		h.logger.Error("passkey register: list", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "Something went wrong. Please try again.")
+		return
+	}
+	if len(existing) >= maxPasskeys {
+		writeJSONError(w, http.StatusConflict, "You already have the maximum number of passkeys. Remove one first.")
+		return
+	}
+	exclude := make([][]byte, 0, len(existing))
+	for _, p := range existing {
+		exclude = append(exclude, p.CredentialID)
+	}
+
+	challenge, err := h.issueChallenge(w, userID)
+	if errors.Is(err, errTooManyChallenges) {
+		writeJSONError(w, http.StatusServiceUnavailable, "Too many passkey requests in progress. Please try again shortly.")
+		return
+	}
+	if err != nil {
+		h.logger.Error("passkey register: challenge", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "Something went wrong. Please try again.")
+		return
+	}
+	opts := h.relyingParty(r).CreationOptions(challenge, webauthn.User{
+		ID:          []byte(strconv.FormatInt(userID, 10)),
+		Name:        user.Username,
+		DisplayName: user.Username,
+	}, exclude)
+	writeJSON(w, http.StatusOK, opts)
+}
+
+// PasskeyRegisterFinish verifies a new credential and stores it.
+// Body: {"name": "...", "credential": RegistrationResponseJSON}.
+func (h *Handler) PasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		writeJSONError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+	var body struct {
+		Name       string                        `json:"name"`
+		Credential webauthn.RegistrationResponse `json:"credential"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid passkey response.")
+		return
+	}
+	challenge, ok := h.takeChallenge(w, r, userID)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "Passkey setup timed out. Please try again.")
+		return
+	}
+
+	cred, err := h.relyingParty(r).VerifyRegistration(challenge, body.Credential)
+	if err != nil {
+		h.logger.Info("passkey register: verification failed", "user", userID, "error", err)
+		writeJSONError(w, http.StatusBadRequest, "The passkey couldn't be verified.")
+		return
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > 60 {
+		name = name[:60]
+	}
+	if _, err := h.db.CreatePasskey(r.Context(), userID, cred.ID, cred.PublicKey, cred.SignCount, name); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint") {
+			writeJSONError(w, http.StatusConflict, "That passkey is already registered.")
+			return
+		}
+		h.logger.Error("passkey register: store", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "Something went wrong. Please try again.")
+		return
+	}
+	h.logger.Info("passkey added", "user", userID)
+	writeJSON(w, http.StatusCreated, map[string]string{"redirect": "/account/passkeys"})
+}
+
+// DeletePasskey removes one of the signed-in user's passkeys.
+func (h *Handler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.DeletePasskey(r.Context(), userID, id); err != nil {
+		h.logger.Error("deleting passkey", "error", err)
+	}
+	http.Redirect(w, r, "/account/passkeys", http.StatusSeeOther)
+}
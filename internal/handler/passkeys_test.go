@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"gobus/internal/config"
+)
+
+func TestRelyingParty(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        config.Config
+		host       string
+		proto      string
+		wantID     string
+		wantOrigin string
+	}{
+		{"derived from localhost", config.Config{}, "localhost:8080", "", "localhost", "http://localhost:8080"},
+		{"behind TLS proxy", config.Config{}, "gobus.example.org", "https", "gobus.example.org", "https://gobus.example.org"},
+		{"configured origin", config.Config{WebAuthnOrigin: "https://bus.example.org/"}, "10.0.0.5:8080", "", "bus.example.org", "https://bus.example.org"},
+		{"configured rp id", config.Config{WebAuthnOrigin: "https://app.example.org", WebAuthnRPID: "example.org"}, "x", "", "example.org", "https://app.example.org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{}
+			h.cfg.Store(&tt.cfg)
+			r := httptest.NewRequest("POST", "/login/passkey/begin", nil)
+			r.Host = tt.host
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			rp := h.relyingParty(r)
+			if rp.ID != tt.wantID || rp.Origin != tt.wantOrigin {
+				t.Errorf("relyingParty = (%q, %q), want (%q, %q)", rp.ID, rp.Origin, tt.wantID, tt.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestTakeChallenge(t *testing.T) {
+	h := &Handler{}
+	issue := httptest.NewRecorder()
+	challenge, err := h.issueChallenge(issue, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := issue.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != passkeyCookie {
+		t.Fatalf("cookies = %v, want one %s cookie", cookies, passkeyCookie)
+	}
+
+	take := func(userID int64) ([]byte, bool) {
+		r := httptest.NewRequest("POST", "/account/passkeys/finish", nil)
+		r.AddCookie(cookies[0])
+		return h.takeChallenge(httptest.NewRecorder(), r, userID)
+	}
+
+	if _, ok := take(8); ok {
+		t.Error("challenge issued to user 7 was accepted for user 8")
+	}
+	if _, ok := take(7); ok {
+		t.Error("a rejected attempt should still consume the challenge")
+	}
+
+	issue = httptest.NewRecorder()
+	challenge, _ = h.issueChallenge(issue, 7)
+	cookies = issue.Result().Cookies()
+	got, ok := take(7)
+	if !ok || !bytes.Equal(got, challenge) {
+		t.Fatalf("take(7) = (%x, %v), want (%x, true)", got, ok, challenge)
+	}
+	if _, ok := take(7); ok {
+		t.Error("challenge was accepted twice")
+	}
+}
+
+func TestChallengeStore(t *testing.T) {
+	var s challengeStore
+	now := time.Now()
+	for i := range maxPasskeyChallenges {
+		expires := now.Add(passkeyChallengeTTL)
+		if i%2 == 0 {
+			expires = now.Add(-time.Second)
+		}
+		if !s.add(strconv.Itoa(i), passkeyChallenge{expires: expires}) {
+			t.Fatalf("add %d refused below the cap", i)
+		}
+	}
+	if s.add("one more", passkeyChallenge{expires: now.Add(passkeyChallengeTTL)}) {
+		t.Error("add past maxPasskeyChallenges was accepted")
+	}
+
+	s.sweep(now)
+	if len(s.m) != maxPasskeyChallenges/2 {
+		t.Errorf("after sweep %d challenges, want the %d unexpired", len(s.m), maxPasskeyChallenges/2)
+	}
+	if _, ok := s.take("1"); !ok {
+		t.Error("unexpired challenge was swept")
+	}
+	if !s.add("one more", passkeyChallenge{expires: now.Add(passkeyChallengeTTL)}) {
+		t.Error("add after sweep was refused")
+	}
+}
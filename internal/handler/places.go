@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gobus/internal/storage"
+	"gobus/internal/templates"
+)
+
+// maxSavedPlaces caps how many saved places one user can store.
+const maxSavedPlaces = 50
+
+// savedPlace is the JSON shape app.js uses for saved locations. lat/lon come
+// from data attributes, so older localStorage entries hold them as strings.
+type savedPlace struct {
+	StopID string    `json:"stopID"`
+	Name   string    `json:"name"`
+	Label  string    `json:"label"`
+	Lat    flexFloat `json:"lat"`
+	Lon    flexFloat `json:"lon"`
+}
+
+// flexFloat decodes a JSON number or a numeric string.
+type flexFloat float64
+
+func (f *flexFloat) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*f = 0
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*f = flexFloat(v)
+	return nil
+}
+
+func (p savedPlace) valid() bool {
+	return p.StopID != "" && len(p.StopID) <= 64 && p.Name != "" &&
+		len(p.Name) <= 200 && len(p.Label) <= 60
+}
+
+func (p savedPlace) row() storage.SavedPlaceRow {
+	label := strings.TrimSpace(p.Label)
+	if label == "" {
+		label = p.Name
+	}
+	return storage.SavedPlaceRow{StopID: p.StopID, Name: p.Name, Label: label, Lat: float64(p.Lat), Lon: float64(p.Lon)}
+}
+
+// SavedPlaces returns the signed-in user's saved places as JSON.
+func (h *Handler) SavedPlaces(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		writeJSONError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+	h.writeSavedPlaces(w, r, userID)
+}
+
+// AddSavedPlace saves (or relabels) one place and returns the updated list.
+func (h *Handler) AddSavedPlace(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		writeJSONError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+	var p savedPlace
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&p); err != nil || !p.valid() {
+		writeJSONError(w, http.StatusBadRequest, "invalid place")
+		return
+	}
+	existing, err := h.db.ListSavedPlaces(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("listing saved places", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if len(existing) >= maxSavedPlaces && !containsPlace(existing, p.StopID) {
+		writeJSONError(w, http.StatusConflict, "too many saved places")
+		return
+	}
+	if err := h.db.SaveSavedPlace(r.Context(), userID, p.row()); err != nil {
+		h.logger.Error("saving place", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	h.writeSavedPlaces(w, r, userID)
+}
+
+// DeleteSavedPlace removes a saved stop and returns the updated list.
+func (h *Handler) DeleteSavedPlace(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		writeJSONError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+	if err := h.db.DeleteSavedPlace(r.Context(), userID, r.PathValue("stopID")); err != nil {
+		h.logger.Error("deleting saved place", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	h.writeSavedPlaces(w, r, userID)
+}
+
+// ImportSavedPlaces merges the browser's localStorage list into the account.
+// app.js calls this once per device, the first time it runs signed in, so
+// places saved before registering carry over to every device.
+func (h *Handler) ImportSavedPlaces(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		writeJSONError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+	var body struct {
+		Places []savedPlace `json:"places"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid places")
+		return
+	}
+	var rows []storage.SavedPlaceRow
+	for _, p := range body.Places {
+		if p.valid() && len(rows) < maxSavedPlaces {
+			rows = append(rows, p.row())
+		}
+	}
+	added, err := h.db.ImportSavedPlaces(r.Context(), userID, rows, maxSavedPlaces)
+	if err != nil {
+		h.logger.Error("importing saved places", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	h.logger.Info("saved places imported", "user", userID, "count", added, "offered", len(rows))
+	h.writeSavedPlaces(w, r, userID)
+}
+
+func (h *Handler) writeSavedPlaces(w http.ResponseWriter, r *http.Request, userID int64) {
+	rows, err := h.db.ListSavedPlaces(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("listing saved places", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	places := make([]savedPlace, 0, len(rows))
+	for _, p := range rows {
+		places = append(places, savedPlace{StopID: p.StopID, Name: p.Name, Label: p.Label, Lat: flexFloat(p.Lat), Lon: flexFloat(p.Lon)})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"places": places})
+}
+
+func containsPlace(places []storage.SavedPlaceRow, stopID string) bool {
+	for _, p := range places {
+		if p.StopID == stopID {
+			return true
+		}
+	}
+	return false
+}
+
+// ToggleFavorite pins or unpins a stop or route, then returns to the page
+// the form was on. Form: kind ("stop" or "route"), id, pinned ("1" or "0").
+func (h *Handler) ToggleFavorite(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	ctx := r.Context()
+	kind, refID := r.FormValue("kind"), r.FormValue("id")
+	pinned := r.FormValue("pinned") == "1"
+
+	// Look the name up rather than trusting the form
+	fav := storage.FavoriteRow{Kind: kind, RefID: refID}
+	var back string
+	switch kind {
+	case "stop":
+		stop, err := h.db.GetStop(ctx, refID)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		fav.Name = stop.StopName
+		back = "/stops/" + refID
+	case "route":
+		route, found, err := h.findRoute(ctx, refID)
+		if err != nil || !found {
+			http.NotFound(w, r)
+			return
+		}
+		fav.Name = route.RouteShort
+		if route.RouteLong != "" {
+			fav.Name += " " + route.RouteLong
+		}
+		back = "/routes/" + refID
+	default:
+		http.Error(w, "Invalid favorite", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.SetFavorite(ctx, userID, fav, pinned); err != nil {
+		h.logger.Error("setting favorite", "error", err)
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// isPinned reports whether the signed-in user has pinned a stop or route.
+func (h *Handler) isPinned(r *http.Request, kind, refID string) bool {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		return false
+	}
+	pinned, err := h.db.IsFavorite(r.Context(), userID, kind, refID)
+	if err != nil {
+		h.logger.Error("checking favorite", "error", err)
+	}
+	return pinned
+}
+
+// pinnedFavorites returns the signed-in user's pinned stops and routes.
+func (h *Handler) pinnedFavorites(r *http.Request) []templates.Favorite {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		return nil
+	}
+	rows, err := h.db.ListFavorites(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("listing favorites", "error", err)
+		return nil
+	}
+	var favs []templates.Favorite
+	for _, f := range rows {
+		url := "/stops/" + f.RefID
+		if f.Kind == "route" {
+			url = "/routes/" + f.RefID
+		}
+		favs = append(favs, templates.Favorite{Kind: f.Kind, RefID: f.RefID, Name: f.Name, URL: url})
+	}
+	return favs
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSavedPlace_DecodesStringCoordinates(t *testing.T) {
+	// Entries written by older app.js versions store lat/lon as strings
+	var p savedPlace
+	raw := `{"stopID":"1234","name":"Lake St Station","label":"Home","lat":"44.948123","lon":-93.298}`
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if float64(p.Lat) != 44.948123 || float64(p.Lon) != -93.298 {
+		t.Errorf("lat/lon = %v/%v", p.Lat, p.Lon)
+	}
+	if !p.valid() {
+		t.Error("place should be valid")
+	}
+}
+
+func TestSavedPlace_Row(t *testing.T) {
+	tests := []struct {
+		name  string
+		place savedPlace
+		label string
+		valid bool
+	}{
+		{"label kept", savedPlace{StopID: "1", Name: "Lake St", Label: " Work "}, "Work", true},
+		{"empty label uses name", savedPlace{StopID: "1", Name: "Lake St"}, "Lake St", true},
+		{"missing stop", savedPlace{Name: "Lake St"}, "Lake St", false},
+		{"missing name", savedPlace{StopID: "1"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.place.valid(); got != tt.valid {
+				t.Errorf("valid() = %v, want %v", got, tt.valid)
+			}
+			if tt.valid && tt.place.row().Label != tt.label {
+				t.Errorf("row().Label = %q, want %q", tt.place.row().Label, tt.label)
+			}
+		})
+	}
+}
@@ -149,6 +149,66 @@ self.addEventListener('fetch', function (event) {
   }
 });
 
+// Arrival reminders: the server sends {title, body, url, tag}
+self.addEventListener('push', function (event) {
+  var data = {};
+  try { data = event.data ? event.data.json() : {}; } catch (e) { /* ignore */ }
+  event.waitUntil(
+    self.registration.showNotification(data.title || 'GoBus', {
+      body: data.body || '',
+      tag: data.tag,
+      renotify: true,
+      icon: '/static/icons/icon-192.png',
+      badge: '/static/icons/icon-192.png',
+      data: { url: data.url || '/nearby' }
+    })
+  );
+});
+
+self.addEventListener('notificationclick', function (event) {
+  event.notification.close();
+  var url = (event.notification.data && event.notification.data.url) || '/nearby';
+  event.waitUntil(
+    self.clients.matchAll({ type: 'window', includeUncontrolled: true }).then(function (list) {
+      for (var i = 0; i < list.length; i++) {
+        if (new URL(list[i].url).pathname === url && 'focus' in list[i]) {
+          return list[i].focus();
+        }
+      }
+      return self.clients.openWindow(url);
+    })
+  );
+});
+
+self.addEventListener('pushsubscriptionchange', function (event) {
+  event.waitUntil(
+    fetch('/push/key', { credentials: 'same-origin' })
+      .then(function (r) { return r.json(); })
+      .then(function (k) {
+        return self.registration.pushManager.subscribe({
+          userVisibleOnly: true,
+          applicationServerKey: urlBase64ToUint8Array(k.publicKey)
+        });
+      })
+      .then(function (sub) {
+        return fetch('/push/subscribe', {
+          method: 'POST',
+          credentials: 'same-origin',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify(sub)
+        });
+      })
+  );
+});
+
+function urlBase64ToUint8Array(s) {
+  var padded = (s + '===='.slice((s.length + 3) %% 4)).replace(/-/g, '+').replace(/_/g, '/');
+  var raw = atob(padded);
+  var out = new Uint8Array(raw.length);
+  for (var i = 0; i < raw.length; i++) out[i] = raw.charCodeAt(i);
+  return out;
+}
+
 function trimCache(cacheName, maxItems) {
   caches.open(cacheName).then(function (cache) {
     cache.keys().then(function (keys) {
@@ -0,0 +1,376 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gobus/internal/geo"
+	"gobus/internal/reach"
+	"gobus/internal/storage"
+	"gobus/internal/templates"
+)
+
+const (
+	// defaultReachMinutes is the travel budget when none is asked for,
+	// and maxReachMinutes the largest allowed.
+	defaultReachMinutes = 30
+	maxReachMinutes     = 90
+	// maxAccessMeters bounds the walk from the origin to the first stop.
+	maxAccessMeters = 1500
+	// maxReachList is how many stops the page lists; the GeoJSON has all
+	// of them.
+	maxReachList = 300
+	// reachBandMinutes is the width of each group in the list.
+	reachBandMinutes = 10
+)
+
+// reachMinuteOptions are the travel budgets the reach page offers.
+var reachMinuteOptions = []int{15, 30, 45, 60, 90}
+
+// reachQuery is a parsed reachability request.
+type reachQuery struct {
+	name     string
+	lat, lon float64
+	start    time.Time
+	minutes  int
+}
+
+// reachStop is a stop reachable in the budget.
+type reachStop struct {
+	stop    storage.StopRow
+	minutes int
+	rides   int
+	route   string
+}
+
+// Reach serves the reachability page: every stop reachable from a stop,
+// a position or a place name within a number of minutes, grouped by
+// travel time.
+func (h *Handler) Reach(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := time.Now()
+	data := templates.ReachData{
+		Page:          h.page("Where can I get to?", "/reach"),
+		From:          q.Get("q"),
+		Minutes:       reachMinutes(q.Get("minutes")),
+		Date:          q.Get("date"),
+		Time:          q.Get("time"),
+		MinuteOptions: reachMinuteOptions,
+	}
+	if data.Date == "" {
+		data.Date = now.Format("2006-01-02")
+	}
+	if data.Time == "" {
+		data.Time = now.Format("15:04")
+	}
+
+	if q.Get("stop") != "" || q.Get("lat") != "" || q.Get("q") != "" {
+		rq, msg, err := h.parseReach(r.Context(), q, now)
+		switch {
+		case err != nil:
+			h.logger.Error("reach: resolving origin", "error", err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		case msg != "":
+			data.Error = msg
+		default:
+			prefs := h.riderPrefs(r)
+			stops, err := h.reachable(r.Context(), rq, prefs)
+			if err != nil {
+				h.logger.Error("reach search", "error", err)
+				http.Error(w, "Internal error", http.StatusInternalServerError)
+				return
+			}
+			data.Origin = rq.name
+			data.AccessibleOnly = prefs.accessibleOnly
+			if data.From == "" {
+				data.From = rq.name
+			}
+			data.Total = len(stops)
+			data.Bands = reachBands(stops, maxReachList)
+			data.GeoJSONURL = reachGeoJSONURL(rq)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ReachPage(data).Render(r.Context(), w); err != nil {
+		h.logger.Error("rendering reach page", "error", err)
+	}
+}
+
+// ReachGeoJSON serves the same result as Reach as a GeoJSON
+// FeatureCollection: the origin and a Point for each reachable stop.
+func (h *Handler) ReachGeoJSON(w http.ResponseWriter, r *http.Request) {
+	rq, msg, err := h.parseReach(r.Context(), r.URL.Query(), time.Now())
+	if err != nil {
+		h.logger.Error("reach geojson: resolving origin", "error", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	stops, err := h.reachable(r.Context(), rq, h.riderPrefs(r))
+	if err != nil {
+		h.logger.Error("reach geojson search", "error", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	if err := json.NewEncoder(w).Encode(reachGeoJSON(rq, stops)); err != nil {
+		h.logger.Error("encoding reach geojson", "error", err)
+	}
+}
+
+// parseReach resolves the origin and departure of a request. msg explains
+// a request that can't be answered; err is for lookups that failed.
+func (h *Handler) parseReach(ctx context.Context, q url.Values, now time.Time) (rq reachQuery, msg string, err error) {
+	rq.minutes = reachMinutes(q.Get("minutes"))
+	rq.start = now
+	if d, t := q.Get("date"), q.Get("time"); d != "" || t != "" {
+		if d == "" {
+			d = now.Format("2006-01-02")
+		}
+		if t == "" {
+			t = now.Format("15:04")
+		}
+		start, err := time.ParseInLocation("2006-01-02 15:04", d+" "+t, now.Location())
+		if err != nil {
+			return rq, "Enter the date as YYYY-MM-DD and the time as HH:MM.", nil
+		}
+		rq.start = start
+	}
+
+	switch {
+	case q.Get("stop") != "":
+		stop, err := h.db.GetStop(ctx, q.Get("stop"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return rq, "That stop isn't in the schedule.", nil
+		}
+		if err != nil {
+			return rq, "", fmt.Errorf("get stop: %w", err)
+		}
+		rq.name, rq.lat, rq.lon = stop.StopName, stop.StopLat, stop.StopLon
+	case q.Get("lat") != "" || q.Get("lon") != "":
+		lat, err1 := strconv.ParseFloat(q.Get("lat"), 64)
+		lon, err2 := strconv.ParseFloat(q.Get("lon"), 64)
+		if err1 != nil || err2 != nil || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+			return rq, "That isn't a valid position.", nil
+		}
+		rq.name, rq.lat, rq.lon = q.Get("name"), lat, lon
+		if rq.name == "" {
+			rq.name = fmt.Sprintf("%.5f, %.5f", lat, lon)
+		}
+	case q.Get("q") != "":
+		query := q.Get("q")
+		stops, err := h.db.SearchStops(ctx, query)
+		if err != nil {
+			h.logger.Error("reach search stops", "query", query, "error", err)
+		}
+		if c := clusterSearchResults(stops, 500); len(c) > 0 {
+			rq.name, rq.lat, rq.lon = c[0].Name, c[0].Lat, c[0].Lon
+			break
+		}
+		geoCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		res, err := h.geo.Search(geoCtx, query)
+		if err != nil {
+			h.logger.Warn("reach geocoding failed", "query", query, "error", err)
+			return rq, "Address lookup is unavailable right now. Try cross streets or a stop number instead.", nil
+		}
+		if res == nil {
+			return rq, fmt.Sprintf("No place found for %q.", query), nil
+		}
+		rq.name, rq.lat, rq.lon = res.DisplayName, res.Lat, res.Lon
+	default:
+		return rq, "Choose where to start from.", nil
+	}
+	return rq, "", nil
+}
+
+// reachMinutes parses the minutes parameter, falling back to
+// defaultReachMinutes for anything outside 5–maxReachMinutes.
+func reachMinutes(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 5 || n > maxReachMinutes {
+		return defaultReachMinutes
+	}
+	return n
+}
+
+// reachable runs the search for rq at the rider's walking speed and
+// returns the stops reached, soonest first. For riders who want only
+// accessible service, stops and trips marked not wheelchair accessible are
+// left out.
+func (h *Handler) reachable(ctx context.Context, rq reachQuery, prefs riderPrefs) ([]reachStop, error) {
+	walkSpeed := prefs.walkSpeed
+	if walkSpeed <= 0 {
+		walkSpeed = geo.WalkingSpeed
+	}
+	budget := rq.minutes * 60
+	midnight := time.Date(rq.start.Year(), rq.start.Month(), rq.start.Day(), 0, 0, 0, 0, rq.start.Location())
+	start := int(rq.start.Sub(midnight).Seconds())
+
+	// Stops to walk to first
+	radius := min(walkSpeed*float64(rq.minutes), maxAccessMeters)
+	latDeg, lonDeg := geo.BoundingBoxRadius(rq.lat, radius)
+	near, err := h.db.NearbyStops(ctx, rq.lat, rq.lon, latDeg, lonDeg, 500)
+	if err != nil {
+		return nil, fmt.Errorf("query nearby stops: %w", err)
+	}
+	if prefs.accessibleOnly {
+		near = accessibleStops(near)
+	}
+	var access []reach.Access
+	for i, d := range h.walkDistances(rq.lat, rq.lon, near) {
+		if near[i].LocationType != 0 || d > radius {
+			continue
+		}
+		if secs := int(math.Ceil(d / walkSpeed * 60)); secs <= budget {
+			access = append(access, reach.Access{Stop: near[i].StopID, Walk: secs})
+		}
+	}
+	if len(access) == 0 {
+		return nil, nil
+	}
+
+	rows, err := h.db.BoardingStops(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]storage.StopRow, len(rows))
+	stops := make([]reach.Stop, 0, len(rows))
+	for _, s := range rows {
+		if prefs.accessibleOnly && s.WheelchairBoarding == storage.AccessNo {
+			continue
+		}
+		byID[s.StopID] = s
+		stops = append(stops, reach.Stop{ID: s.StopID, Lat: s.StopLat, Lon: s.StopLon})
+	}
+
+	connRows, err := h.connections(ctx, rq.start, start, start+budget)
+	if err != nil {
+		return nil, err
+	}
+	conns := make([]reach.Connection, 0, len(connRows))
+	for _, c := range connRows {
+		conn := reach.Connection{
+			Trip: c.TripID, Route: c.RouteShort,
+			From: c.FromStop, To: c.ToStop,
+			Dep: c.Departure, Arr: c.Arrival,
+			NoPickup: c.NoPickup, NoDropOff: c.NoDropOff,
+		}
+		if prefs.accessibleOnly {
+			if c.WheelchairAccessible == storage.AccessNo {
+				continue
+			}
+			// The vehicle still passes inaccessible stops, but the rider
+			// can't get on or off there
+			_, fromOK := byID[c.FromStop]
+			_, toOK := byID[c.ToStop]
+			conn.NoPickup = conn.NoPickup || !fromOK
+			conn.NoDropOff = conn.NoDropOff || !toOK
+		}
+		conns = append(conns, conn)
+	}
+
+	arrivals := reach.Search(stops, conns, access, reach.Options{
+		Start:     start,
+		Budget:    budget,
+		WalkSpeed: walkSpeed,
+	})
+	out := make([]reachStop, 0, len(arrivals))
+	for _, a := range arrivals {
+		s, ok := byID[a.Stop]
+		if !ok {
+			continue
+		}
+		out = append(out, reachStop{
+			stop:    s,
+			minutes: (a.Time - start + 59) / 60,
+			rides:   a.Rides,
+			route:   a.Route,
+		})
+	}
+	return out, nil
+}
+
+// reachBands groups stops into reachBandMinutes-wide bands by travel
+// time, listing at most limit stops in all.
+func reachBands(stops []reachStop, limit int) []templates.ReachBand {
+	var bands []templates.ReachBand
+	for i, s := range stops {
+		if i == limit {
+			break
+		}
+		hi := max(1, (s.minutes+reachBandMinutes-1)/reachBandMinutes) * reachBandMinutes
+		label := fmt.Sprintf("Within %d minutes", hi)
+		if len(bands) == 0 || bands[len(bands)-1].Label != label {
+			bands = append(bands, templates.ReachBand{Label: label})
+		}
+		b := &bands[len(bands)-1]
+		b.Stops = append(b.Stops, templates.ReachStop{
+			StopID:    s.stop.StopID,
+			Name:      s.stop.StopName,
+			StopCode:  s.stop.StopCode,
+			Minutes:   s.minutes,
+			Route:     s.route,
+			Transfers: max(0, s.rides-1),
+			WalkOnly:  s.rides == 0,
+		})
+	}
+	return bands
+}
+
+// reachGeoJSONURL links the GeoJSON for rq, by position so the origin
+// isn't looked up again.
+func reachGeoJSONURL(rq reachQuery) string {
+	v := url.Values{}
+	v.Set("lat", strconv.FormatFloat(rq.lat, 'f', 6, 64))
+	v.Set("lon", strconv.FormatFloat(rq.lon, 'f', 6, 64))
+	v.Set("name", rq.name)
+	v.Set("minutes", strconv.Itoa(rq.minutes))
+	v.Set("date", rq.start.Format("2006-01-02"))
+	v.Set("time", rq.start.Format("15:04"))
+	return "/reach.geojson?" + v.Encode()
+}
+
+// reachGeoJSON builds the FeatureCollection for a reachability result.
+// GeoJSON coordinates are [lon, lat].
+func reachGeoJSON(rq reachQuery, stops []reachStop) geoJSONFeatureCollection {
+	fc := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{{
+		Type:     "Feature",
+		Geometry: geoJSONGeometry{Type: "Point", Coordinates: [2]float64{rq.lon, rq.lat}},
+		Properties: map[string]any{
+			"kind":    "origin",
+			"name":    rq.name,
+			"depart":  rq.start.Format(time.RFC3339),
+			"minutes": rq.minutes,
+		},
+	}}}
+	for _, s := range stops {
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geoJSONGeometry{Type: "Point", Coordinates: [2]float64{s.stop.StopLon, s.stop.StopLat}},
+			Properties: map[string]any{
+				"kind":      "stop",
+				"stop_id":   s.stop.StopID,
+				"stop_name": s.stop.StopName,
+				"minutes":   s.minutes,
+				"transfers": max(0, s.rides-1),
+				"route":     s.route,
+			},
+		})
+	}
+	return fc
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"gobus/internal/storage"
+)
+
+func TestReachMinutes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", defaultReachMinutes},
+		{"45", 45},
+		{"5", 5},
+		{"4", defaultReachMinutes},
+		{"91", defaultReachMinutes},
+		{"half an hour", defaultReachMinutes},
+	}
+	for _, tt := range tests {
+		if got := reachMinutes(tt.in); got != tt.want {
+			t.Errorf("reachMinutes(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReachBands(t *testing.T) {
+	stop := func(id string) storage.StopRow { return storage.StopRow{StopID: id, StopName: "Stop " + id} }
+	stops := []reachStop{
+		{stop: stop("a"), minutes: 0},
+		{stop: stop("b"), minutes: 4, rides: 0},
+		{stop: stop("c"), minutes: 10, rides: 1, route: "21"},
+		{stop: stop("d"), minutes: 11, rides: 3, route: "5"},
+		{stop: stop("e"), minutes: 25, rides: 2, route: "Blue"},
+	}
+	bands := reachBands(stops, 4)
+	if len(bands) != 2 {
+		t.Fatalf("reachBands = %+v, want 2 bands", bands)
+	}
+	if bands[0].Label != "Within 10 minutes" || len(bands[0].Stops) != 3 {
+		t.Errorf("first band = %+v", bands[0])
+	}
+	if bands[1].Label != "Within 20 minutes" || len(bands[1].Stops) != 1 {
+		t.Errorf("second band = %+v, want only stop d (limit 4)", bands[1])
+	}
+	if s := bands[0].Stops[1]; !s.WalkOnly {
+		t.Errorf("stop b = %+v, want walk only", s)
+	}
+	if s := bands[1].Stops[0]; s.Transfers != 2 || s.Route != "5" || s.WalkOnly {
+		t.Errorf("stop d = %+v, want 2 transfers ending on route 5", s)
+	}
+}
+
+func TestConnectionsBetween(t *testing.T) {
+	rows := []storage.ConnectionRow{
+		{TripID: "a", Departure: 100, Arrival: 200},
+		{TripID: "b", Departure: 150, Arrival: 400},
+		{TripID: "c", Departure: 300, Arrival: 350},
+		{TripID: "d", Departure: 360, Arrival: 380},
+		{TripID: "e", Departure: 390, Arrival: 500},
+	}
+	var got []string
+	for _, c := range connectionsBetween(rows, 150, 380) {
+		got = append(got, c.TripID)
+	}
+	if want := []string{"c", "d"}; !slices.Equal(got, want) {
+		t.Errorf("connectionsBetween = %v, want %v", got, want)
+	}
+}
+
+func TestConnCache(t *testing.T) {
+	var c connCache
+	now := time.Now()
+	key := func(start int) connWindowKey { return connWindowKey{date: "20261019", start: start} }
+	c.add(key(0), []storage.ConnectionRow{{TripID: "a"}}, now)
+	if rows, ok := c.get(key(0), now.Add(time.Minute)); !ok || len(rows) != 1 {
+		t.Errorf("get = %v, %v; want the window", rows, ok)
+	}
+	if _, ok := c.get(key(0), now.Add(connCacheTTL+time.Second)); ok {
+		t.Error("get after the TTL, want none")
+	}
+	for i := 1; i <= maxConnWindows; i++ {
+		c.add(key(i*connWindowStep), nil, now.Add(time.Duration(i)*time.Second))
+	}
+	if len(c.m) != maxConnWindows {
+		t.Errorf("%d windows, want %d", len(c.m), maxConnWindows)
+	}
+	if _, ok := c.get(key(0), now.Add(time.Minute)); ok {
+		t.Error("oldest window kept past the cap")
+	}
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gobus/internal/storage"
+)
+
+const (
+	// connWindowStep is how far apart cached connection windows start.
+	// Searches starting in the same step share a window, which reaches
+	// maxReachMinutes past the step's end.
+	connWindowStep = 15 * 60
+	// connCacheTTL is how long a window is kept. The schedule only changes
+	// on import, which starts new windows anyway.
+	connCacheTTL = 10 * time.Minute
+	// maxConnWindows caps the windows held at once. A busy feed has tens
+	// of thousands of connections in each.
+	maxConnWindows = 8
+)
+
+// connWindowKey names a window of connections: a service day, where the
+// window starts, and the feed import the rows came from.
+type connWindowKey struct {
+	date     string // YYYYMMDD
+	start    int    // seconds after midnight, a multiple of connWindowStep
+	imported time.Time
+}
+
+type connWindow struct {
+	rows    []storage.ConnectionRow
+	expires time.Time
+}
+
+// connCache holds the connections of recent reachability searches, so
+// searches from the same day and time don't each scan stop_times.
+type connCache struct {
+	mu sync.Mutex
+	m  map[connWindowKey]connWindow
+}
+
+// get returns a window that hasn't expired by now.
+func (c *connCache) get(key connWindowKey, now time.Time) ([]storage.ConnectionRow, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w, ok := c.m[key]
+	if !ok || now.After(w.expires) {
+		return nil, false
+	}
+	return w.rows, true
+}
+
+// add stores a window, first dropping expired ones and, if the cache is
+// still full, the one closest to expiring.
+func (c *connCache) add(key connWindowKey, rows []storage.ConnectionRow, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = make(map[connWindowKey]connWindow)
+	}
+	for k, w := range c.m {
+		if now.After(w.expires) {
+			delete(c.m, k)
+		}
+	}
+	if _, ok := c.m[key]; !ok && len(c.m) >= maxConnWindows {
+		var oldest connWindowKey
+		first := true
+		for k, w := range c.m {
+			if first || w.expires.Before(c.m[oldest].expires) {
+				oldest, first = k, false
+			}
+		}
+		delete(c.m, oldest)
+	}
+	c.m[key] = connWindow{rows: rows, expires: now.Add(connCacheTTL)}
+}
+
+// connections returns the connections on date that leave at or after from
+// and arrive by to, as storage.Connections does, from the cached window
+// covering them.
+func (h *Handler) connections(ctx context.Context, date time.Time, from, to int) ([]storage.ConnectionRow, error) {
+	key := connWindowKey{date: date.Format("20060102"), start: from - from%connWindowStep}
+	if h.feed != nil {
+		key.imported = h.feed.Status().LastImport
+	}
+	end := key.start + connWindowStep + maxReachMinutes*60
+	if to > end {
+		// Longer than any search; not worth caching
+		return h.db.Connections(ctx, date, from, to)
+	}
+	now := time.Now()
+	rows, ok := h.conns.get(key, now)
+	if !ok {
+		var err error
+		rows, err = h.db.Connections(ctx, date, key.start, end)
+		if err != nil {
+			return nil, err
+		}
+		h.conns.add(key, rows, now)
+	}
+	return connectionsBetween(rows, from, to), nil
+}
+
+// connectionsBetween returns the rows, ordered by departure, that leave at
+// or after from and arrive by to.
+func connectionsBetween(rows []storage.ConnectionRow, from, to int) []storage.ConnectionRow {
+	i := sort.Search(len(rows), func(i int) bool { return rows[i].Departure >= from })
+	var out []storage.ConnectionRow
+	for _, c := range rows[i:] {
+		if c.Departure > to {
+			break
+		}
+		if c.Arrival <= to {
+			out = append(out, c)
+		}
+	}
+	return out
+}
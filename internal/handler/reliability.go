@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"gobus/internal/reliability"
+	"gobus/internal/templates"
+)
+
+// reliabilityDays is how far back the stop page looks to say how routes
+// usually run.
+const reliabilityDays = 28
+
+// stopHistory returns the departures observed at a stop lately, by route
+// and direction. The page works without them, so errors are only logged.
+func (h *Handler) stopHistory(ctx context.Context, stopID string, now time.Time) []reliability.Group {
+	rows, err := h.db.DepartureHistory(ctx, stopID, now.AddDate(0, 0, -reliabilityDays))
+	if err != nil {
+		h.logger.Error("fetching departure history", "stop", stopID, "error", err)
+		return nil
+	}
+	return reliability.GroupRows(rows)
+}
+
+// withUsualDelays notes on each departure how late its route usually
+// leaves the stop at that hour, where there is enough history to say.
+func withUsualDelays(deps []templates.DepartureInfo, groups []reliability.Group) []templates.DepartureInfo {
+	for i, dep := range deps {
+		for _, g := range groups {
+			if g.RouteID != dep.RouteID || g.DirectionID != dep.DirectionID {
+				continue
+			}
+			if delay, ok := reliability.TypicalDelay(g.Rows, dep.ScheduledAt.Hour()); ok {
+				deps[i].Usually = reliability.UsuallyText(delay)
+			}
+		}
+	}
+	return deps
+}
+
+// routeReliability summarizes each route and direction with enough
+// history for the stop page. Directions are named as in deps where a
+// departure shows them.
+func routeReliability(groups []reliability.Group, deps []templates.DepartureInfo) []templates.RouteReliability {
+	var out []templates.RouteReliability
+	for _, g := range groups {
+		s := reliability.Summarize(g.Rows)
+		if s.Departures < reliability.MinSamples {
+			continue
+		}
+		rr := templates.RouteReliability{
+			RouteID:    g.RouteID,
+			RouteShort: g.RouteShort,
+			Direction:  directionName(g.DirectionID),
+			Departures: s.Departures,
+			OnTimePct:  int(math.Round(s.OnTime * 100)),
+			AvgDelay:   delayText(s.AvgDelay),
+		}
+		if s.HasRegularity {
+			rr.Regularity = fmt.Sprintf("%d%%", int(math.Round(s.Regularity*100)))
+		}
+		for _, dep := range deps {
+			if dep.RouteID == g.RouteID && dep.DirectionID == g.DirectionID && dep.DirectionText != "" {
+				rr.Direction = dep.DirectionText
+				break
+			}
+		}
+		out = append(out, rr)
+	}
+	return out
+}
+
+// delayText describes an average delay in seconds, e.g. "2 min late".
+func delayText(secs float64) string {
+	m := int(math.Round(secs / 60))
+	switch {
+	case m > 0:
+		return fmt.Sprintf("%d min late", m)
+	case m < 0:
+		return fmt.Sprintf("%d min early", -m)
+	default:
+		return "on time"
+	}
+}
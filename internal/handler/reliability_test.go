@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"gobus/internal/reliability"
+	"gobus/internal/storage"
+	"gobus/internal/templates"
+)
+
+func TestWithUsualDelays(t *testing.T) {
+	var rows []storage.DepartureHistoryRow
+	for i := range 6 {
+		rows = append(rows, storage.DepartureHistoryRow{
+			RouteID: "21", DirectionID: 1, ServiceDate: "20261012",
+			Scheduled: 17*3600 + i*600, Delay: 240,
+		})
+	}
+	groups := reliability.GroupRows(rows)
+	at := func(h int) time.Time { return time.Date(2026, 10, 19, h, 5, 0, 0, time.Local) }
+	deps := withUsualDelays([]templates.DepartureInfo{
+		{RouteID: "21", DirectionID: 1, ScheduledAt: at(17)},
+		{RouteID: "21", DirectionID: 1, ScheduledAt: at(18)}, // no history this hour
+		{RouteID: "21", DirectionID: 0, ScheduledAt: at(17)}, // nor this direction
+	}, groups)
+	want := []string{"usually 4 min late at this time", "", ""}
+	for i, w := range want {
+		if deps[i].Usually != w {
+			t.Errorf("departure %d Usually = %q, want %q", i, deps[i].Usually, w)
+		}
+	}
+
+	rr := routeReliability(groups, []templates.DepartureInfo{{RouteID: "21", DirectionID: 1, DirectionText: "Eastbound"}})
+	if len(rr) != 1 {
+		t.Fatalf("routeReliability = %+v, want one route", rr)
+	}
+	if r := rr[0]; r.Direction != "Eastbound" || r.OnTimePct != 100 || r.AvgDelay != "4 min late" || r.Regularity != "100%" || r.Departures != 6 {
+		t.Errorf("route reliability = %+v", r)
+	}
+	if rr := routeReliability(reliability.GroupRows(rows[:4]), nil); len(rr) != 0 {
+		t.Errorf("routeReliability from 4 departures = %+v, want none", rr)
+	}
+}
+
+func TestDelayText(t *testing.T) {
+	tests := []struct {
+		secs float64
+		want string
+	}{
+		{150, "3 min late"},
+		{29, "on time"},
+		{-70, "1 min early"},
+	}
+	for _, tt := range tests {
+		if got := delayText(tt.secs); got != tt.want {
+			t.Errorf("delayText(%v) = %q, want %q", tt.secs, got, tt.want)
+		}
+	}
+}
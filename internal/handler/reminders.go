@@ -0,0 +1,378 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gobus/internal/storage"
+	"gobus/internal/templates"
+	"gobus/internal/webpush"
+)
+
+// reminderLeadChoices are the "notify me N minutes before" options offered.
+var reminderLeadChoices = []int{2, 5, 10, 15}
+
+// maxReminders caps how many active reminders one user can have. Each one
+// is checked against the realtime feed every scheduler tick.
+const maxReminders = 20
+
+// PushPublicKey returns the VAPID public key the browser needs to subscribe.
+func (h *Handler) PushPublicKey(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"publicKey": h.push.PublicKey()})
+}
+
+// PushSubscribe stores the browser's PushSubscription for the signed-in user.
+func (h *Handler) PushSubscribe(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		writeJSONError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+	var sub webpush.Subscription
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&sub); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid subscription")
+		return
+	}
+	if err := webpush.ValidateEndpoint(r.Context(), sub.Endpoint, h.cfg.Load().PushAllowHTTP); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+		writeJSONError(w, http.StatusBadRequest, "subscription keys missing")
+		return
+	}
+	err := h.db.SavePushSubscription(r.Context(), userID, sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth)
+	if errors.Is(err, storage.ErrPushEndpointTaken) {
+		h.logger.Warn("push endpoint registered to another user", "user", userID)
+		writeJSONError(w, http.StatusConflict, "subscription already registered")
+		return
+	}
+	if err != nil {
+		h.logger.Error("saving push subscription", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PushUnsubscribe forgets a subscription the browser has dropped.
+func (h *Handler) PushUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		writeJSONError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+	var body struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil || body.Endpoint == "" {
+		writeJSONError(w, http.StatusBadRequest, "endpoint required")
+		return
+	}
+	if err := h.db.DeletePushSubscription(r.Context(), userID, body.Endpoint); err != nil {
+		h.logger.Error("deleting push subscription", "error", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateReminder sets a "notify me N minutes before" reminder for the next
+// departure of a route+direction at a stop. The route must be one leaving
+// the stop soon, as offered on the stop page.
+// Form: route ("routeID|directionID"), lead (minutes).
+func (h *Handler) CreateReminder(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	ctx := r.Context()
+	stopID := r.PathValue("id")
+
+	routeID, dirStr, ok := strings.Cut(r.FormValue("route"), "|")
+	directionID, err := strconv.Atoi(dirStr)
+	lead, _ := strconv.Atoi(r.FormValue("lead"))
+	if !ok || err != nil || routeID == "" || lead < 1 || lead > 60 {
+		http.Error(w, "Invalid reminder", http.StatusBadRequest)
+		return
+	}
+
+	stop, err := h.db.GetStop(ctx, stopID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		h.logger.Error("creating reminder: fetching stop", "error", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	back := "/stops/" + url.PathEscape(stop.StopID)
+
+	count, err := h.db.CountReminders(ctx, userID)
+	if err != nil {
+		h.logger.Error("counting reminders", "error", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxReminders {
+		http.Error(w, "You already have the maximum number of reminders. Cancel one first.", http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	deps := h.fetchDepartures(ctx, stopID, now, 30)
+	if !servesRoute(deps, routeID, directionID) {
+		http.Error(w, "That route doesn't leave this stop soon", http.StatusBadRequest)
+		return
+	}
+	rem := newReminder(userID, stopID, routeID, directionID, lead, deps, now)
+	if _, err := h.db.CreateReminder(ctx, rem); err != nil {
+		h.logger.Error("creating reminder", "error", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	h.logger.Info("reminder set", "user", userID, "stop", stopID, "route", routeID, "lead", lead)
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// DeleteReminder cancels one of the signed-in user's reminders.
+func (h *Handler) DeleteReminder(w http.ResponseWriter, r *http.Request) {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.DeleteReminder(r.Context(), userID, id); err != nil {
+		h.logger.Error("deleting reminder", "error", err)
+	}
+	back := "/nearby"
+	if stopID := r.FormValue("stop_id"); stopID != "" {
+		back = "/stops/" + stopID
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// newReminder builds a reminder pinned to the first matching departure that
+// is still more than lead minutes away, so setting "5 min before" when the
+// bus is 3 minutes out targets the following bus rather than firing at once.
+func newReminder(userID int64, stopID, routeID string, directionID, lead int, deps []templates.DepartureInfo, now time.Time) storage.ReminderRow {
+	rem := storage.ReminderRow{
+		UserID:      userID,
+		StopID:      stopID,
+		RouteID:     routeID,
+		DirectionID: directionID,
+		LeadMinutes: lead,
+		Label:       routeID,
+		ExpiresAt:   now.Add(3 * time.Hour),
+	}
+	for _, d := range deps {
+		if d.RouteID != routeID || d.DirectionID != directionID {
+			continue
+		}
+		rem.Label = reminderLabel(d)
+		if departureTime(d).Sub(now) > time.Duration(lead)*time.Minute && d.TripID != "" {
+			rem.TripID = d.TripID
+			rem.ExpiresAt = departureTime(d).Add(15 * time.Minute)
+			break
+		}
+	}
+	return rem
+}
+
+// servesRoute reports whether any of deps is on routeID in directionID.
+func servesRoute(deps []templates.DepartureInfo, routeID string, directionID int) bool {
+	for _, d := range deps {
+		if d.RouteID == routeID && d.DirectionID == directionID {
+			return true
+		}
+	}
+	return false
+}
+
+func reminderLabel(d templates.DepartureInfo) string {
+	if d.DirectionText != "" {
+		return d.RouteShort + " " + d.DirectionText
+	}
+	if d.Headsign != "" {
+		return d.RouteShort + " to " + d.Headsign
+	}
+	return d.RouteShort
+}
+
+// departureTime is the best estimate of when a departure leaves: the
+// realtime prediction if there is one, otherwise the schedule.
+func departureTime(d templates.DepartureInfo) time.Time {
+	if !d.RealtimeAt.IsZero() {
+		return d.RealtimeAt
+	}
+	return d.ScheduledAt
+}
+
+// matchReminder finds the departure a reminder is watching.
+func matchReminder(rem storage.ReminderRow, deps []templates.DepartureInfo) (templates.DepartureInfo, bool) {
+	for _, d := range deps {
+		if rem.TripID != "" {
+			if d.TripID == rem.TripID {
+				return d, true
+			}
+			continue
+		}
+		if d.RouteID == rem.RouteID && d.DirectionID == rem.DirectionID {
+			return d, true
+		}
+	}
+	return templates.DepartureInfo{}, false
+}
+
+// RunReminders evaluates pending reminders every 30 seconds until ctx is
+// cancelled, sending a push notification once the watched departure is within
+// the reminder's lead time.
+func (h *Handler) RunReminders(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.checkReminders(ctx, time.Now())
+		case <-ctx.Done():
+			h.logger.Info("reminder scheduler stopped")
+			return
+		}
+	}
+}
+
+func (h *Handler) checkReminders(ctx context.Context, now time.Time) {
+	reminders, err := h.db.PendingReminders(ctx)
+	if err != nil {
+		h.logger.Error("loading reminders", "error", err)
+		return
+	}
+
+	// Several reminders at one stop share a single departure lookup
+	byStop := make(map[string][]templates.DepartureInfo)
+	for _, rem := range reminders {
+		if now.After(rem.ExpiresAt) {
+			h.logger.Info("reminder expired", "id", rem.ID, "stop", rem.StopID)
+			h.deleteReminder(ctx, rem)
+			continue
+		}
+		deps, ok := byStop[rem.StopID]
+		if !ok {
+			deps = h.fetchDepartures(ctx, rem.StopID, now, 30)
+			byStop[rem.StopID] = deps
+		}
+		dep, found := matchReminder(rem, deps)
+		if !found || departureTime(dep).Sub(now) > time.Duration(rem.LeadMinutes)*time.Minute {
+			continue
+		}
+		// With no notification delivered, try again next tick while the
+		// bus is still to come
+		if !h.sendReminder(ctx, rem, dep, now) && departureTime(dep).After(now) {
+			continue
+		}
+		h.deleteReminder(ctx, rem)
+	}
+}
+
+// deleteReminder removes a reminder the scheduler is done with.
+func (h *Handler) deleteReminder(ctx context.Context, rem storage.ReminderRow) {
+	if err := h.db.DeleteReminder(ctx, 0, rem.ID); err != nil {
+		h.logger.Error("deleting reminder", "id", rem.ID, "error", err)
+	}
+}
+
+// reminderPayload is the JSON the service worker turns into a notification.
+type reminderPayload struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url"`
+	Tag   string `json:"tag"`
+}
+
+func buildReminderPayload(rem storage.ReminderRow, stopName string, dep templates.DepartureInfo, now time.Time) reminderPayload {
+	eta := departureTime(dep)
+	mins := int(eta.Sub(now).Minutes())
+	title := fmt.Sprintf("%s in %d min", reminderLabel(dep), mins)
+	if mins <= 0 {
+		title = reminderLabel(dep) + " is due now"
+	}
+	source := "scheduled"
+	if !dep.RealtimeAt.IsZero() {
+		source = "live"
+	}
+	return reminderPayload{
+		Title: title,
+		Body:  fmt.Sprintf("Departs %s at %s (%s).", stopName, eta.In(now.Location()).Format("3:04 PM"), source),
+		URL:   "/stops/" + rem.StopID,
+		Tag:   fmt.Sprintf("gobus-reminder-%d", rem.ID),
+	}
+}
+
+// sendReminder pushes a reminder to each of the user's subscriptions and
+// reports whether any of them took it.
+func (h *Handler) sendReminder(ctx context.Context, rem storage.ReminderRow, dep templates.DepartureInfo, now time.Time) bool {
+	stopName := rem.StopID
+	if stop, err := h.db.GetStop(ctx, rem.StopID); err == nil {
+		stopName = stop.StopName
+	}
+	payload, _ := json.Marshal(buildReminderPayload(rem, stopName, dep, now))
+
+	subs, err := h.db.PushSubscriptionsForUser(ctx, rem.UserID)
+	if err != nil {
+		h.logger.Error("loading push subscriptions", "user", rem.UserID, "error", err)
+		return false
+	}
+	sent := false
+	for _, s := range subs {
+		var sub webpush.Subscription
+		sub.Endpoint = s.Endpoint
+		sub.Keys.P256dh = s.P256dh
+		sub.Keys.Auth = s.Auth
+
+		// The notification is useless once the bus has left
+		ttl := max(departureTime(dep).Sub(now), time.Minute)
+		err := h.push.Send(ctx, sub, payload, ttl)
+		switch {
+		case errors.Is(err, webpush.ErrGone):
+			h.logger.Info("push subscription gone, removing", "user", rem.UserID)
+			if err := h.db.DeletePushSubscription(ctx, rem.UserID, s.Endpoint); err != nil {
+				h.logger.Error("deleting push subscription", "error", err)
+			}
+		case err != nil:
+			h.logger.Warn("push send failed", "user", rem.UserID, "error", err)
+		default:
+			h.logger.Info("reminder sent", "id", rem.ID, "user", rem.UserID, "stop", rem.StopID)
+			sent = true
+		}
+	}
+	return sent
+}
+
+// reminderOptions lists the route+direction choices for a stop's reminder
+// form, in departure order, one per route+direction.
+func reminderOptions(deps []templates.DepartureInfo) []templates.ReminderOption {
+	seen := make(map[string]bool)
+	var opts []templates.ReminderOption
+	for _, d := range deps {
+		value := fmt.Sprintf("%s|%d", d.RouteID, d.DirectionID)
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		opts = append(opts, templates.ReminderOption{Value: value, Label: reminderLabel(d)})
+	}
+	return opts
+}
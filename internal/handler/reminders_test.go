@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"gobus/internal/storage"
+	"gobus/internal/templates"
+)
+
+func reminderDeps(now time.Time) []templates.DepartureInfo {
+	return []templates.DepartureInfo{
+		{TripID: "T1", RouteID: "18", RouteShort: "18", DirectionID: 1, DirectionText: "Southbound", ScheduledAt: now.Add(3 * time.Minute)},
+		{TripID: "T2", RouteID: "21", RouteShort: "21", DirectionID: 0, DirectionText: "Eastbound", ScheduledAt: now.Add(4 * time.Minute)},
+		{TripID: "T3", RouteID: "18", RouteShort: "18", DirectionID: 1, DirectionText: "Southbound", ScheduledAt: now.Add(12 * time.Minute), RealtimeAt: now.Add(14 * time.Minute)},
+	}
+}
+
+func TestNewReminder_SkipsDepartureInsideLeadTime(t *testing.T) {
+	now := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	rem := newReminder(7, "S1", "18", 1, 5, reminderDeps(now), now)
+
+	if rem.TripID != "T3" {
+		t.Errorf("TripID = %q, want T3 (T1 is only 3 min away)", rem.TripID)
+	}
+	if rem.Label != "18 Southbound" {
+		t.Errorf("Label = %q", rem.Label)
+	}
+	if want := now.Add(29 * time.Minute); !rem.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want %v (prediction + 15 min)", rem.ExpiresAt, want)
+	}
+}
+
+func TestNewReminder_NoDepartures(t *testing.T) {
+	now := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	rem := newReminder(7, "S1", "99", 0, 5, reminderDeps(now), now)
+	if rem.TripID != "" {
+		t.Errorf("TripID = %q, want empty when no departure matches", rem.TripID)
+	}
+	if !rem.ExpiresAt.After(now) {
+		t.Error("reminder without a trip should still expire in the future")
+	}
+}
+
+func TestMatchReminder(t *testing.T) {
+	now := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	deps := reminderDeps(now)
+
+	tests := []struct {
+		name     string
+		rem      storage.ReminderRow
+		wantTrip string
+		found    bool
+	}{
+		{"pinned trip", storage.ReminderRow{RouteID: "18", DirectionID: 1, TripID: "T3"}, "T3", true},
+		{"pinned trip gone", storage.ReminderRow{RouteID: "18", DirectionID: 1, TripID: "T0"}, "", false},
+		{"unpinned takes next", storage.ReminderRow{RouteID: "18", DirectionID: 1}, "T1", true},
+		{"wrong direction", storage.ReminderRow{RouteID: "21", DirectionID: 1}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dep, found := matchReminder(tt.rem, deps)
+			if found != tt.found || dep.TripID != tt.wantTrip {
+				t.Errorf("matchReminder = (%q, %v), want (%q, %v)", dep.TripID, found, tt.wantTrip, tt.found)
+			}
+		})
+	}
+}
+
+func TestBuildReminderPayload(t *testing.T) {
+	now := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	dep := reminderDeps(now)[2]
+	p := buildReminderPayload(storage.ReminderRow{ID: 42, StopID: "S1"}, "Lake St Station", dep, now)
+
+	if p.Title != "18 Southbound in 14 min" {
+		t.Errorf("Title = %q", p.Title)
+	}
+	if p.Body != "Departs Lake St Station at 8:14 AM (live)." {
+		t.Errorf("Body = %q", p.Body)
+	}
+	if p.URL != "/stops/S1" || p.Tag != "gobus-reminder-42" {
+		t.Errorf("URL/Tag = %q/%q", p.URL, p.Tag)
+	}
+}
+
+func TestReminderOptions_Dedup(t *testing.T) {
+	now := time.Now()
+	opts := reminderOptions(reminderDeps(now))
+	if len(opts) != 2 {
+		t.Fatalf("got %d options, want 2", len(opts))
+	}
+	if opts[0].Value != "18|1" || opts[1].Value != "21|0" {
+		t.Errorf("options = %+v", opts)
+	}
+}
+
+func TestServesRoute(t *testing.T) {
+	deps := reminderDeps(time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC))
+	if !servesRoute(deps, "18", 1) {
+		t.Error("servesRoute(18, 1) = false, want true")
+	}
+	if servesRoute(deps, "18", 0) {
+		t.Error("servesRoute(18, 0) = true, want false (wrong direction)")
+	}
+	if servesRoute(deps, "99", 0) {
+		t.Error("servesRoute(99, 0) = true, want false")
+	}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
@@ -47,49 +48,23 @@ func (h *Handler) RouteDetail(w http.ResponseWriter, r *http.Request) {
 	routeID := r.PathValue("id")
 	now := time.Now()
 
-	// Get route info
-	routes, err := h.db.AllRoutes(r.Context())
+	routeInfo, found, err := h.findRoute(r.Context(), routeID)
 	if err != nil {
 		h.logger.Error("fetching route", "error", err)
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
 	}
-
-	var routeInfo templates.RouteInfo
-	found := false
-	for _, row := range routes {
-		if row.RouteID == routeID {
-			routeInfo = templates.RouteInfo{
-				RouteID:        row.RouteID,
-				RouteShort:     row.RouteShort,
-				RouteLong:      row.RouteLong,
-				RouteColor:     row.RouteColor,
-				RouteTextColor: row.RouteTextColor,
-				RouteType:      row.RouteType,
-			}
-			found = true
-			break
-		}
-	}
 	if !found {
 		http.NotFound(w, r)
 		return
 	}
 
-	// Get stops for each direction
+	// Get stops and geometry for each direction
+	routeDirs := h.loadRouteDirections(r.Context(), routeID, now)
 	var directions []templates.DirectionStops
-	for _, dirID := range []int{0, 1} {
-		stops, err := h.db.StopsForRoute(r.Context(), routeID, dirID, now)
-		if err != nil {
-			continue // No stops in this direction
-		}
-		if len(stops) == 0 {
-			continue
-		}
-
-		dirName := directionName(dirID)
+	for _, d := range routeDirs {
 		var routeStops []templates.RouteStop
-		for _, s := range stops {
+		for _, s := range d.Stops {
 			routeStops = append(routeStops, templates.RouteStop{
 				StopID:   s.StopID,
 				StopName: s.StopName,
@@ -98,8 +73,8 @@ func (h *Handler) RouteDetail(w http.ResponseWriter, r *http.Request) {
 		}
 
 		directions = append(directions, templates.DirectionStops{
-			DirectionID:   dirID,
-			DirectionName: dirName,
+			DirectionID:   d.DirectionID,
+			DirectionName: d.Name,
 			Stops:         routeStops,
 		})
 	}
@@ -117,6 +92,8 @@ func (h *Handler) RouteDetail(w http.ResponseWriter, r *http.Request) {
 		RouteType:      routeInfo.RouteType,
 		Directions:     directions,
 		Alerts:         routeAlerts,
+		Map:            buildRouteMap(routeInfo, routeDirs),
+		Pinned:         h.isPinned(r, "route", routeInfo.RouteID),
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -125,6 +102,27 @@ func (h *Handler) RouteDetail(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// findRoute looks up a single route by ID. Returns found=false if it doesn't exist.
+func (h *Handler) findRoute(ctx context.Context, routeID string) (templates.RouteInfo, bool, error) {
+	routes, err := h.db.AllRoutes(ctx)
+	if err != nil {
+		return templates.RouteInfo{}, false, err
+	}
+	for _, row := range routes {
+		if row.RouteID == routeID {
+			return templates.RouteInfo{
+				RouteID:        row.RouteID,
+				RouteShort:     row.RouteShort,
+				RouteLong:      row.RouteLong,
+				RouteColor:     row.RouteColor,
+				RouteTextColor: row.RouteTextColor,
+				RouteType:      row.RouteType,
+			}, true, nil
+		}
+	}
+	return templates.RouteInfo{}, false, nil
+}
+
 func directionName(id int) string {
 	switch id {
 	case 0:
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"gobus/internal/storage"
+	"gobus/internal/templates"
+)
+
+// routeDirection holds the stops and geometry of one direction of a route.
+type routeDirection struct {
+	DirectionID int
+	Name        string
+	Stops       []storage.StopOnRoute
+	Shape       []storage.ShapePoint
+}
+
+// loadRouteDirections fetches stops and shape geometry for both directions of a route.
+// Directions with no service on the given date are omitted.
+func (h *Handler) loadRouteDirections(ctx context.Context, routeID string, now time.Time) []routeDirection {
+	var dirs []routeDirection
+	for _, dirID := range []int{0, 1} {
+		tripID, shapeID, err := h.db.RepresentativeTrip(ctx, routeID, dirID, now)
+		if err != nil {
+			continue // No service in this direction
+		}
+		stops, err := h.db.StopsForTrip(ctx, tripID)
+		if err != nil || len(stops) == 0 {
+			continue // No stops in this direction
+		}
+		shape, err := h.db.Shape(ctx, shapeID)
+		if err != nil {
+			h.logger.Warn("fetching route shape", "route", routeID, "direction", dirID, "error", err)
+		}
+		dirs = append(dirs, routeDirection{
+			DirectionID: dirID,
+			Name:        directionName(dirID),
+			Stops:       stops,
+			Shape:       shape,
+		})
+	}
+	return dirs
+}
+
+// --- GeoJSON ---
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   geoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// RouteShape serves a route's geometry and stops as a GeoJSON FeatureCollection.
+// Each direction is a LineString feature; each stop is a Point feature.
+func (h *Handler) RouteShape(w http.ResponseWriter, r *http.Request) {
+	routeID := r.PathValue("id")
+	ctx := r.Context()
+
+	route, found, err := h.findRoute(ctx, routeID)
+	if err != nil {
+		h.logger.Error("fetching route for shape", "error", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	fc := routeGeoJSON(route, h.loadRouteDirections(ctx, routeID, time.Now()))
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	if err := json.NewEncoder(w).Encode(fc); err != nil {
+		h.logger.Error("encoding route geojson", "error", err)
+	}
+}
+
+// routeGeoJSON builds the FeatureCollection for a route's directions.
+// GeoJSON coordinates are [lon, lat].
+func routeGeoJSON(route templates.RouteInfo, dirs []routeDirection) geoJSONFeatureCollection {
+	fc := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+	for _, d := range dirs {
+		var line [][2]float64
+		for _, p := range d.Shape {
+			line = append(line, [2]float64{p.Lon, p.Lat})
+		}
+		// Fall back to connecting the stops when the feed has no shape
+		if len(line) == 0 {
+			for _, s := range d.Stops {
+				line = append(line, [2]float64{s.StopLon, s.StopLat})
+			}
+		}
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geoJSONGeometry{Type: "LineString", Coordinates: line},
+			Properties: map[string]any{
+				"kind":           "route",
+				"route_id":       route.RouteID,
+				"route_short":    route.RouteShort,
+				"route_color":    route.RouteColor,
+				"direction_id":   d.DirectionID,
+				"direction_name": d.Name,
+			},
+		})
+		for _, s := range d.Stops {
+			fc.Features = append(fc.Features, geoJSONFeature{
+				Type:     "Feature",
+				Geometry: geoJSONGeometry{Type: "Point", Coordinates: [2]float64{s.StopLon, s.StopLat}},
+				Properties: map[string]any{
+					"kind":          "stop",
+					"stop_id":       s.StopID,
+					"stop_name":     s.StopName,
+					"stop_sequence": s.StopSequence,
+					"direction_id":  d.DirectionID,
+				},
+			})
+		}
+	}
+	return fc
+}
+
+// --- SVG map ---
+
+const (
+	routeMapSize    = 600.0 // longest side of the drawing, in SVG units
+	routeMapPadding = 16.0
+)
+
+// buildRouteMap projects route geometry and stops into SVG coordinates.
+// Uses an equirectangular projection scaled by cos(latitude), which is
+// accurate enough at city scale and needs no tile server.
+func buildRouteMap(route templates.RouteInfo, dirs []routeDirection) *templates.RouteMap {
+	minLat, maxLat := math.Inf(1), math.Inf(-1)
+	minLon, maxLon := math.Inf(1), math.Inf(-1)
+	extend := func(lat, lon float64) {
+		minLat, maxLat = math.Min(minLat, lat), math.Max(maxLat, lat)
+		minLon, maxLon = math.Min(minLon, lon), math.Max(maxLon, lon)
+	}
+	for _, d := range dirs {
+		for _, p := range d.Shape {
+			extend(p.Lat, p.Lon)
+		}
+		for _, s := range d.Stops {
+			extend(s.StopLat, s.StopLon)
+		}
+	}
+	if math.IsInf(minLat, 1) {
+		return nil
+	}
+
+	lonScale := math.Cos((minLat + maxLat) / 2 * math.Pi / 180)
+	dx := (maxLon - minLon) * lonScale
+	dy := maxLat - minLat
+	scale := 1.0
+	if span := math.Max(dx, dy); span > 0 {
+		scale = routeMapSize / span
+	}
+	project := func(lat, lon float64) (float64, float64) {
+		x := routeMapPadding + (lon-minLon)*lonScale*scale
+		y := routeMapPadding + (maxLat-lat)*scale // SVG y grows downward
+		return math.Round(x*10) / 10, math.Round(y*10) / 10
+	}
+
+	m := &templates.RouteMap{
+		Width:  math.Ceil(dx*scale + 2*routeMapPadding),
+		Height: math.Ceil(dy*scale + 2*routeMapPadding),
+		Color:  route.RouteColor,
+		Title:  fmt.Sprintf("Map of route %s", route.RouteShort),
+	}
+
+	var descParts []string
+	for i, d := range dirs {
+		var pts []string
+		if len(d.Shape) > 0 {
+			for _, p := range d.Shape {
+				x, y := project(p.Lat, p.Lon)
+				pts = append(pts, fmt.Sprintf("%g,%g", x, y))
+			}
+		} else {
+			for _, s := range d.Stops {
+				x, y := project(s.StopLat, s.StopLon)
+				pts = append(pts, fmt.Sprintf("%g,%g", x, y))
+			}
+		}
+		m.Paths = append(m.Paths, templates.RouteMapPath{
+			DirectionName: d.Name,
+			Points:        strings.Join(pts, " "),
+			Dashed:        i > 0,
+		})
+
+		for j, s := range d.Stops {
+			x, y := project(s.StopLat, s.StopLon)
+			m.Stops = append(m.Stops, templates.RouteMapStop{
+				StopID: s.StopID,
+				X:      x,
+				Y:      y,
+				Label:  fmt.Sprintf("%s, stop %d of %d, %s", s.StopName, j+1, len(d.Stops), d.Name),
+				IsEnd:  j == 0 || j == len(d.Stops)-1,
+			})
+		}
+		if len(d.Stops) > 0 {
+			descParts = append(descParts, fmt.Sprintf("%s: %d stops from %s to %s",
+				d.Name, len(d.Stops), d.Stops[0].StopName, d.Stops[len(d.Stops)-1].StopName))
+		}
+	}
+	m.Desc = strings.Join(descParts, ". ")
+	return m
+}
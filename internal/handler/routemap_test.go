@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"gobus/internal/storage"
+	"gobus/internal/templates"
+)
+
+func testRouteDirections() []routeDirection {
+	return []routeDirection{
+		{
+			DirectionID: 0,
+			Name:        "Outbound",
+			Stops: []storage.StopOnRoute{
+				{StopID: "A", StopName: "Lake St", StopLat: 44.948, StopLon: -93.298, StopSequence: 1},
+				{StopID: "B", StopName: "Franklin Ave", StopLat: 44.963, StopLon: -93.298, StopSequence: 2},
+				{StopID: "C", StopName: "Downtown", StopLat: 44.978, StopLon: -93.270, StopSequence: 3},
+			},
+			Shape: []storage.ShapePoint{
+				{Lat: 44.948, Lon: -93.298},
+				{Lat: 44.963, Lon: -93.298},
+				{Lat: 44.978, Lon: -93.270},
+			},
+		},
+	}
+}
+
+func TestBuildRouteMap_FitsViewBox(t *testing.T) {
+	m := buildRouteMap(templates.RouteInfo{RouteShort: "18"}, testRouteDirections())
+	if m == nil {
+		t.Fatal("buildRouteMap returned nil for a route with stops")
+	}
+	if m.Width > routeMapSize+2*routeMapPadding+1 || m.Height > routeMapSize+2*routeMapPadding+1 {
+		t.Errorf("map size %gx%g exceeds bounds", m.Width, m.Height)
+	}
+	for _, s := range m.Stops {
+		if s.X < 0 || s.X > m.Width || s.Y < 0 || s.Y > m.Height {
+			t.Errorf("stop %s at (%g,%g) is outside the %gx%g viewBox", s.StopID, s.X, s.Y, m.Width, m.Height)
+		}
+	}
+}
+
+func TestBuildRouteMap_NorthIsUp(t *testing.T) {
+	m := buildRouteMap(templates.RouteInfo{RouteShort: "18"}, testRouteDirections())
+	// Stop A is south of stop C, so it should be drawn lower (larger y)
+	if m.Stops[0].Y <= m.Stops[2].Y {
+		t.Errorf("southern stop y=%g should be below northern stop y=%g", m.Stops[0].Y, m.Stops[2].Y)
+	}
+}
+
+func TestBuildRouteMap_StopLabels(t *testing.T) {
+	m := buildRouteMap(templates.RouteInfo{RouteShort: "18"}, testRouteDirections())
+	if len(m.Stops) != 3 {
+		t.Fatalf("got %d stop markers, want 3", len(m.Stops))
+	}
+	want := "Franklin Ave, stop 2 of 3, Outbound"
+	if m.Stops[1].Label != want {
+		t.Errorf("label = %q, want %q", m.Stops[1].Label, want)
+	}
+	if !m.Stops[0].IsEnd || m.Stops[1].IsEnd || !m.Stops[2].IsEnd {
+		t.Error("only the first and last stops should be marked as ends")
+	}
+	if !strings.Contains(m.Desc, "from Lake St to Downtown") {
+		t.Errorf("desc %q should summarize the endpoints", m.Desc)
+	}
+}
+
+func TestBuildRouteMap_Empty(t *testing.T) {
+	if m := buildRouteMap(templates.RouteInfo{}, nil); m != nil {
+		t.Errorf("buildRouteMap(nil) = %+v, want nil", m)
+	}
+}
+
+func TestRouteGeoJSON_Features(t *testing.T) {
+	fc := routeGeoJSON(templates.RouteInfo{RouteID: "18"}, testRouteDirections())
+	if fc.Type != "FeatureCollection" {
+		t.Errorf("type = %q", fc.Type)
+	}
+	// One line + three stops
+	if len(fc.Features) != 4 {
+		t.Fatalf("got %d features, want 4", len(fc.Features))
+	}
+	if fc.Features[0].Geometry.Type != "LineString" {
+		t.Errorf("first feature should be the route line, got %s", fc.Features[0].Geometry.Type)
+	}
+	pt := fc.Features[1].Geometry.Coordinates.([2]float64)
+	if pt[0] != -93.298 || pt[1] != 44.948 {
+		t.Errorf("point coordinates = %v, want [lon, lat]", pt)
+	}
+}
+
+func TestRouteGeoJSON_FallsBackToStops(t *testing.T) {
+	dirs := testRouteDirections()
+	dirs[0].Shape = nil
+	fc := routeGeoJSON(templates.RouteInfo{RouteID: "18"}, dirs)
+	line := fc.Features[0].Geometry.Coordinates.([][2]float64)
+	if len(line) != 3 {
+		t.Errorf("line without a shape should connect the %d stops, got %d points", 3, len(line))
+	}
+}
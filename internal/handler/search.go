@@ -1,19 +1,26 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"gobus/internal/geo"
+	"gobus/internal/search"
 	"gobus/internal/storage"
 	"gobus/internal/templates"
 )
 
 // Search serves the location search page.
 // On GET with no query: shows the search form.
-// On GET with q= parameter: geocodes and redirects to /nearby on success,
-// or shows errors/disambiguation on the search page.
+// On GET with q= parameter: looks the query up as a stop code, route,
+// station or stop name, then as an address. A single match redirects to its
+// page; several show a disambiguation list.
 func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	view := r.URL.Query().Get("view")
@@ -22,7 +29,7 @@ func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := templates.SearchData{
-		Page: h.page("Search Location", "/search"),
+		Page:  h.page("Search Location", "/search"),
 		Query: query,
 		View:  view,
 	}
@@ -36,43 +43,25 @@ func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Try GTFS cross-street search first (works offline)
-	results, err := h.db.SearchStops(r.Context(), query)
-	if err != nil {
-		h.logger.Error("search stops", "query", query, "error", err)
+	// Stop codes, routes and stop names first (works offline)
+	matches := h.searchMatches(r.Context(), query, view, false)
+	if len(matches) == 1 {
+		http.Redirect(w, r, matches[0].URL, http.StatusFound)
+		return
 	}
-
-	if len(results) > 0 {
-		clusters := clusterSearchResults(results, 500)
-		if len(clusters) == 1 {
-			// Single match — redirect to nearby
-			redirectURL := fmt.Sprintf("/nearby?view=%s&lat=%.6f&lon=%.6f&q=%s",
-				view, clusters[0].Lat, clusters[0].Lon, url.QueryEscape(query))
-			http.Redirect(w, r, redirectURL, http.StatusFound)
-			return
-		}
-		// Multiple matches — show disambiguation
-		data.SearchResults = make([]templates.SearchResult, len(clusters))
-		for i, c := range clusters {
-			data.SearchResults[i] = templates.SearchResult{
-				Name: c.Name,
-				Lat:  fmt.Sprintf("%.6f", c.Lat),
-				Lon:  fmt.Sprintf("%.6f", c.Lon),
-			}
-		}
+	if len(matches) > 1 {
+		data.SearchResults = matches
 	} else {
-		// No GTFS match — fall back to Nominatim address geocoding
-		geoResult, err := h.geo.Search(r.Context(), query+", Minneapolis, MN")
+		// No GTFS match — fall back to the address geocoder
+		geoResult, err := h.geo.Search(r.Context(), query)
 		if err != nil {
-			h.logger.Warn("nominatim geocoding failed", "query", query, "error", err)
+			h.logger.Warn("geocoding failed", "query", query, "error", err)
 			data.SearchError = "Address lookup is unavailable right now. Try entering cross streets instead (e.g. \"Lake & Lyndale\") — cross-street search works offline."
 		} else if geoResult == nil {
 			data.SearchError = "No results found for \"" + query + "\". Try nearby cross streets instead (e.g. \"Lake & Lyndale\") — cross-street search works even without internet."
 		} else {
-			// Nominatim success — redirect to nearby
-			redirectURL := fmt.Sprintf("/nearby?view=%s&lat=%.6f&lon=%.6f&q=%s",
-				view, geoResult.Lat, geoResult.Lon, url.QueryEscape(query))
-			http.Redirect(w, r, redirectURL, http.StatusFound)
+			// Geocoder success — redirect to nearby
+			http.Redirect(w, r, nearbyURL(view, geoResult.Lat, geoResult.Lon, query), http.StatusFound)
 			return
 		}
 	}
@@ -84,14 +73,208 @@ func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// maxSuggestions is how many places the search box suggests at once.
+const maxSuggestions = 8
+
+// SearchSuggest returns autocomplete suggestions for the search box as an
+// HTML fragment, requested by HTMX as the user types.
+func (h *Handler) SearchSuggest(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	view := r.URL.Query().Get("view")
+	if view != "stops" {
+		view = "routes"
+	}
+
+	data := templates.SearchSuggestData{View: view}
+	// One letter matches half the stops in the metro; wait for more
+	if len([]rune(query)) >= 2 {
+		data.Query = query
+		data.Results = h.searchMatches(r.Context(), query, view, true)
+		if len(data.Results) > maxSuggestions {
+			data.Results = data.Results[:maxSuggestions]
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.SearchSuggestions(data).Render(r.Context(), w); err != nil {
+		h.logger.Error("rendering search suggestions", "error", err)
+	}
+}
+
+// searchIntent is what a query asks for, judged from its wording alone.
+type searchIntent struct {
+	stopCode string // look up this stop_code
+	route    string // look up this route short name
+	names    bool   // search stop and station names
+}
+
+var (
+	stopCodePattern = regexp.MustCompile(`^stop\s*(?:code|no|number)?\s*#?\s*(\d+)$`)
+	routePattern    = regexp.MustCompile(`^(?:route|rte|rt|bus|line)\s*#?\s*([0-9a-z]+)$`)
+	numberPattern   = regexp.MustCompile(`^\d+[a-z]?$`)
+)
+
+// parseSearchIntent reads a query as a stop code ("stop 12345"),
+// a route ("route 21", "bus 6"), or a place name. A bare number may be a
+// stop code or a route, and short ones like "5" or "18" usually are; it is
+// searched as a name too only if it matches neither.
+func parseSearchIntent(query string) searchIntent {
+	q := strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(query, ".", "")), " "))
+	if m := stopCodePattern.FindStringSubmatch(q); m != nil {
+		return searchIntent{stopCode: m[1]}
+	}
+	if m := routePattern.FindStringSubmatch(q); m != nil {
+		return searchIntent{route: m[1]}
+	}
+	if q = strings.TrimPrefix(q, "#"); numberPattern.MatchString(q) {
+		in := searchIntent{route: q}
+		if _, err := strconv.Atoi(q); err == nil {
+			in.stopCode = q
+		}
+		return in
+	}
+	return searchIntent{names: true}
+}
+
+// matchRoutes returns the routes a query names: by short name ("21",
+// "Blue"), or for a query ending in "line" ("Blue Line", "A Line"), every
+// route whose names contain all its words.
+func matchRoutes(routes []storage.RouteRow, short, query string) []storage.RouteRow {
+	var out []storage.RouteRow
+	if short != "" {
+		for _, r := range routes {
+			if strings.EqualFold(r.RouteShort, short) {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+	terms := search.Terms(query)
+	if len(terms) < 2 || terms[len(terms)-1] != "line" {
+		for _, r := range routes {
+			if r.RouteShort != "" && strings.EqualFold(r.RouteShort, strings.TrimSpace(query)) {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+	for _, r := range routes {
+		names := make(map[string]bool)
+		for _, t := range search.Terms(r.RouteShort + " " + r.RouteLong) {
+			names[t] = true
+		}
+		all := true
+		for _, t := range terms {
+			if !names[t] {
+				all = false
+				break
+			}
+		}
+		if all {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// searchMatches finds everything a query could mean in the local feed, in
+// order: stops by code, routes, then stations and stop names. A code or
+// route hit skips the name search, since "21" matches half the stop names
+// in the metro. Each result links straight to its page.
+func (h *Handler) searchMatches(ctx context.Context, query, view string, typing bool) []templates.SearchResult {
+	intent := parseSearchIntent(query)
+	var out []templates.SearchResult
+
+	if intent.stopCode != "" {
+		stops, err := h.db.StopsByCode(ctx, intent.stopCode)
+		if err != nil {
+			h.logger.Error("search stop code", "query", query, "error", err)
+		}
+		for _, s := range stops {
+			detail := "Stop " + s.StopCode
+			if s.StopDesc != "" {
+				detail += " · " + s.StopDesc
+			}
+			out = append(out, templates.SearchResult{
+				Kind:   "stop",
+				Name:   s.StopName,
+				Detail: detail,
+				URL:    "/stops/" + url.PathEscape(s.StopID),
+			})
+		}
+	}
+
+	if intent.route != "" || intent.names {
+		routes, err := h.db.AllRoutes(ctx)
+		if err != nil {
+			h.logger.Error("search routes", "query", query, "error", err)
+		}
+		for _, r := range matchRoutes(routes, intent.route, query) {
+			// "Route 21 · Selby - Lake", but "METRO Blue Line", not "Route Blue"
+			name, detail := "Route "+r.RouteShort, r.RouteLong
+			if r.RouteShort == "" || slices.Contains(search.Terms(r.RouteLong), strings.ToLower(r.RouteShort)) {
+				name, detail = r.RouteLong, "Route"
+			}
+			out = append(out, templates.SearchResult{
+				Kind:   "route",
+				Name:   name,
+				Detail: detail,
+				URL:    "/routes/" + url.PathEscape(r.RouteID),
+			})
+		}
+	}
+
+	if !intent.names && len(out) > 0 {
+		return out
+	}
+	var results []storage.StopSearchResult
+	var err error
+	if typing {
+		results, err = h.db.SuggestStops(ctx, query, 3*maxSuggestions)
+	} else {
+		results, err = h.db.SearchStops(ctx, query)
+	}
+	if err != nil {
+		h.logger.Error("search stops", "query", query, "error", err)
+	}
+	for _, c := range clusterSearchResults(results, 500) {
+		if c.StationID != "" {
+			out = append(out, templates.SearchResult{
+				Kind:   "station",
+				Name:   c.Name,
+				Detail: "Station",
+				URL:    "/stations/" + url.PathEscape(c.StationID),
+			})
+			continue
+		}
+		// A suggestion names the place picked; a search keeps what was typed
+		q := query
+		if typing {
+			q = c.Name
+		}
+		out = append(out, templates.SearchResult{
+			Kind: "place",
+			Name: c.Name,
+			URL:  nearbyURL(view, c.Lat, c.Lon, q),
+		})
+	}
+	return out
+}
+
+func nearbyURL(view string, lat, lon float64, query string) string {
+	return fmt.Sprintf("/nearby?view=%s&lat=%.6f&lon=%.6f&q=%s", view, lat, lon, url.QueryEscape(query))
+}
+
 // clusterSearchResults groups stop search results by proximity.
 // Results within radiusMeters of each other are merged into one cluster,
-// using the first result's name and the centroid of all members.
+// using the first result's name and the centroid of all members. A station
+// takes over the name of any cluster it joins, as the better destination.
 type searchCluster struct {
-	Name string
-	Lat  float64
-	Lon  float64
-	n    int
+	Name      string
+	Lat       float64
+	Lon       float64
+	StationID string
+	n         int
 }
 
 func clusterSearchResults(results []storage.StopSearchResult, radiusMeters float64) []searchCluster {
@@ -105,16 +288,20 @@ func clusterSearchResults(results []storage.StopSearchResult, radiusMeters float
 				clusters[i].Lat = (clusters[i].Lat*n + r.Lat) / (n + 1)
 				clusters[i].Lon = (clusters[i].Lon*n + r.Lon) / (n + 1)
 				clusters[i].n++
+				if r.StationID != "" && clusters[i].StationID == "" {
+					clusters[i].Name, clusters[i].StationID = r.Name, r.StationID
+				}
 				merged = true
 				break
 			}
 		}
 		if !merged {
 			clusters = append(clusters, searchCluster{
-				Name: r.Name,
-				Lat:  r.Lat,
-				Lon:  r.Lon,
-				n:    1,
+				Name:      r.Name,
+				Lat:       r.Lat,
+				Lon:       r.Lon,
+				StationID: r.StationID,
+				n:         1,
 			})
 		}
 	}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"reflect"
 	"testing"
 
 	"gobus/internal/storage"
@@ -89,3 +90,76 @@ func TestClusterSearchResults_UsesFirstName(t *testing.T) {
 		t.Errorf("cluster name = %q, want 'First' (should use first result's name)", clusters[0].Name)
 	}
 }
+
+func TestParseSearchIntent(t *testing.T) {
+	tests := []struct {
+		query string
+		want  searchIntent
+	}{
+		{"12345", searchIntent{stopCode: "12345", route: "12345"}},
+		{"#21", searchIntent{stopCode: "21", route: "21"}},
+		{"stop 12345", searchIntent{stopCode: "12345"}},
+		{"Stop #12345", searchIntent{stopCode: "12345"}},
+		{"stop code 12345", searchIntent{stopCode: "12345"}},
+		{"route 21", searchIntent{route: "21"}},
+		{"Rt. 21", searchIntent{route: "21"}},
+		{"Stop No. 12345", searchIntent{stopCode: "12345"}},
+		{"bus 6", searchIntent{route: "6"}},
+		{"  Route   21 ", searchIntent{route: "21"}},
+		{"21a", searchIntent{route: "21a"}},
+		{"Lake & Lyndale", searchIntent{names: true}},
+		{"Target Field Station", searchIntent{names: true}},
+		{"Blue Line", searchIntent{names: true}},
+	}
+	for _, tt := range tests {
+		if got := parseSearchIntent(tt.query); got != tt.want {
+			t.Errorf("parseSearchIntent(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestMatchRoutes(t *testing.T) {
+	routes := []storage.RouteRow{
+		{RouteID: "21", RouteShort: "21", RouteLong: "Selby - Lake"},
+		{RouteID: "901", RouteShort: "Blue", RouteLong: "METRO Blue Line"},
+		{RouteID: "921", RouteShort: "A", RouteLong: "METRO A Line"},
+		{RouteID: "888", RouteShort: "", RouteLong: "Northstar Commuter Rail"},
+	}
+	tests := []struct {
+		short, query string
+		want         []string
+	}{
+		{"21", "21", []string{"21"}},
+		{"blue", "route blue", []string{"901"}},
+		{"22", "22", nil},
+		{"", "Blue Line", []string{"901"}},
+		{"", "a line", []string{"921"}},
+		{"", "METRO Blue Line", []string{"901"}},
+		{"", "Green Line", nil},
+		{"", "blue", []string{"901"}},
+		{"", "Lake & Lyndale", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range matchRoutes(routes, tt.short, tt.query) {
+			got = append(got, r.RouteID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("matchRoutes(%q, %q) = %v, want %v", tt.short, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestClusterSearchResults_StationTakesOver(t *testing.T) {
+	results := []storage.StopSearchResult{
+		{Name: "Target Field Station Platform 1", Lat: 44.98300, Lon: -93.27700},
+		{Name: "Target Field Station", Lat: 44.98310, Lon: -93.27710, StationID: "51424"},
+	}
+	clusters := clusterSearchResults(results, 500)
+	if len(clusters) != 1 {
+		t.Fatalf("got %d clusters, want 1", len(clusters))
+	}
+	if clusters[0].Name != "Target Field Station" || clusters[0].StationID != "51424" {
+		t.Errorf("cluster = %+v, want the station", clusters[0])
+	}
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"gobus/internal/storage"
+)
+
+// sessionRefreshAfter is how often a session's sliding expiry is pushed
+// forward (and its cookie re-sent), so an active session never expires.
+const sessionRefreshAfter = time.Hour
+
+// Settings keys used to time cookie secret rotation.
+const (
+	settingSecretFingerprint = "cookie_secret_fingerprint"
+	settingSecretRotatedAt   = "cookie_secret_rotated_at"
+)
+
+// generateSessionToken returns the opaque value stored in the session cookie.
+func generateSessionToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sessionID derives the sessions.id stored for a token. Keying it with the
+// cookie secret means a leaked database can't be replayed as cookies.
+func sessionID(secret []byte, token string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sessionKeys returns the secrets a session ID may be keyed with: the
+// current one, then previous ones while the rotation grace period lasts.
+func (h *Handler) sessionKeys() [][]byte {
+	keys := [][]byte{h.cookieSecret}
+	if time.Now().Before(h.previousUntil) {
+		keys = append(keys, h.previousSecrets...)
+	}
+	return keys
+}
+
+// startSession creates a server-side session for a device and sets the
+// session cookie.
+func (h *Handler) startSession(w http.ResponseWriter, r *http.Request, userID int64, deviceID string) error {
+	ctx := r.Context()
+	if err := h.db.DeleteExpiredSessions(ctx); err != nil {
+		h.logger.Warn("deleting expired sessions", "error", err)
+	}
+	token := generateSessionToken()
+	expires := time.Now().Add(cookieMaxAge * time.Second)
+	if err := h.db.CreateSession(ctx, sessionID(h.cookieSecret, token), userID, deviceID, expires); err != nil {
+		return err
+	}
+	h.setCookie(w, token)
+	return nil
+}
+
+// endSession revokes the session in the request's cookie, if any.
+func (h *Handler) endSession(r *http.Request) {
+	c, err := r.Cookie(cookieName)
+	if err != nil || c.Value == "" {
+		return
+	}
+	for _, key := range h.sessionKeys() {
+		if err := h.db.DeleteSession(r.Context(), sessionID(key, c.Value)); err != nil {
+			h.logger.Error("deleting session", "error", err)
+		}
+	}
+}
+
+// Authenticate resolves the session cookie to a user. It returns the
+// request carrying the user ID for currentUserID, or a user ID of 0 if the
+// cookie is missing, expired, revoked, or belongs to a device that has been
+// signed out. Along the way it slides the session's expiry forward, re-keys
+// sessions created under a previous cookie secret, and upgrades the old
+// stateless cookies to server-side sessions.
+func (h *Handler) Authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, int64, error) {
+	ctx := r.Context()
+	c, err := r.Cookie(cookieName)
+	if err != nil || c.Value == "" {
+		return r, 0, nil
+	}
+	var deviceID string
+	if dc, err := r.Cookie(deviceCookie); err == nil {
+		deviceID = dc.Value
+	}
+	if deviceID == "" {
+		return r, 0, nil
+	}
+
+	var userID int64
+	if strings.Count(c.Value, ".") == 2 {
+		userID, err = h.upgradeLegacyCookie(w, r, c.Value, deviceID)
+	} else {
+		userID, err = h.resumeSession(w, ctx, c.Value, deviceID)
+	}
+	if err != nil || userID == 0 {
+		return r, 0, err
+	}
+
+	// The device must still be signed in to the account
+	active, err := h.db.TouchDeviceSession(ctx, userID, deviceID)
+	if err != nil || !active {
+		return r, 0, err
+	}
+	return r.WithContext(context.WithValue(ctx, sessionUserKey, userID)), userID, nil
+}
+
+func (h *Handler) resumeSession(w http.ResponseWriter, ctx context.Context, token, deviceID string) (int64, error) {
+	var sess *storage.SessionRow
+	for i, key := range h.sessionKeys() {
+		id := sessionID(key, token)
+		s, err := h.db.GetSession(ctx, id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if i > 0 {
+			// Keyed with a previous secret: move it to the current one
+			if err := h.db.RekeySession(ctx, id, sessionID(h.cookieSecret, token)); err != nil {
+				return 0, err
+			}
+			s.ID = sessionID(h.cookieSecret, token)
+		}
+		sess = s
+		break
+	}
+	if sess == nil || sess.DeviceID != deviceID {
+		return 0, nil
+	}
+
+	if time.Since(sess.LastSeen) > sessionRefreshAfter {
+		if err := h.db.RefreshSession(ctx, sess.ID, time.Now().Add(cookieMaxAge*time.Second)); err != nil {
+			h.logger.Error("refreshing session", "error", err)
+		} else {
+			h.setCookie(w, token)
+		}
+	}
+	return sess.UserID, nil
+}
+
+// upgradeLegacyCookie accepts a still-valid stateless "userID.expiry.hmac"
+// cookie from before server-side sessions and swaps it for a session, so
+// deploying sessions doesn't sign everyone out.
+func (h *Handler) upgradeLegacyCookie(w http.ResponseWriter, r *http.Request, value, deviceID string) (int64, error) {
+	var userID int64
+	for _, key := range h.sessionKeys() {
+		if userID = VerifyCookie(value, key); userID != 0 {
+			break
+		}
+	}
+	if userID == 0 {
+		return 0, nil
+	}
+	if err := h.startSession(w, r, userID, deviceID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// LogoutEverywhere revokes every session and device for the signed-in user.
+func (h *Handler) LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if err := h.db.DeleteSessionsForUser(ctx, userID); err != nil {
+		h.logger.Error("log out everywhere: sessions", "error", err)
+		h.renderAccount(w, r, userID, "", "Something went wrong. Please try again.")
+		return
+	}
+	if err := h.db.RevokeOtherDevices(ctx, userID, ""); err != nil {
+		h.logger.Error("log out everywhere: devices", "error", err)
+	}
+	h.clearCookie(w)
+	h.logger.Info("logged out everywhere", "user", userID)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// previousSecretsFrom parses GOBUS_COOKIE_SECRET_PREVIOUS. It accepts either
+// a former GOBUS_COOKIE_SECRET value or the hex contents of a former
+// .cookie_secret file, so both are tried.
+func previousSecretsFrom(s string) [][]byte {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	secrets := [][]byte{[]byte(s)}
+	if decoded, err := hex.DecodeString(s); err == nil && len(decoded) >= 16 {
+		secrets = append(secrets, decoded)
+	}
+	return secrets
+}
+
+// rotationDeadline returns when sessions keyed with a previous secret stop
+// being honored: CookieGraceDays after the current secret was first seen.
+// The first-seen time is kept in the settings table.
+func rotationDeadline(ctx context.Context, db *storage.DB, secret []byte, graceDays int) (time.Time, error) {
+	sum := sha256.Sum256(secret)
+	fingerprint := hex.EncodeToString(sum[:8])
+
+	stored, err := db.GetSetting(ctx, settingSecretFingerprint)
+	if err != nil {
+		return time.Time{}, err
+	}
+	rotatedAt := time.Now()
+	if stored == fingerprint {
+		if v, err := db.GetSetting(ctx, settingSecretRotatedAt); err == nil {
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				rotatedAt = t
+			}
+		}
+	} else {
+		if err := db.SetSetting(ctx, settingSecretFingerprint, fingerprint); err != nil {
+			return time.Time{}, err
+		}
+		if err := db.SetSetting(ctx, settingSecretRotatedAt, rotatedAt.UTC().Format(time.RFC3339)); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return rotatedAt.Add(time.Duration(graceDays) * 24 * time.Hour), nil
+}
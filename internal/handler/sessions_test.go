@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionID(t *testing.T) {
+	token := generateSessionToken()
+	if len(token) != 43 {
+		t.Errorf("token length = %d, want 43 (32 bytes base64url)", len(token))
+	}
+	if token == generateSessionToken() {
+		t.Error("two generated tokens should differ")
+	}
+
+	a := sessionID([]byte("secret-one"), token)
+	b := sessionID([]byte("secret-two"), token)
+	if a == b {
+		t.Error("session IDs under different secrets should differ")
+	}
+	if a != sessionID([]byte("secret-one"), token) {
+		t.Error("session ID should be deterministic")
+	}
+	if a == token || len(a) != 64 {
+		t.Errorf("sessionID = %q, want a 64-char hex HMAC", a)
+	}
+}
+
+func TestSessionKeys_GracePeriod(t *testing.T) {
+	current, previous := []byte("current"), []byte("previous")
+	tests := []struct {
+		name  string
+		until time.Time
+		want  int
+	}{
+		{"during grace", time.Now().Add(time.Hour), 2},
+		{"after grace", time.Now().Add(-time.Hour), 1},
+		{"no rotation", time.Time{}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{cookieSecret: current, previousSecrets: [][]byte{previous}, previousUntil: tt.until}
+			keys := h.sessionKeys()
+			if len(keys) != tt.want || string(keys[0]) != "current" {
+				t.Errorf("sessionKeys = %q, want %d keys starting with the current one", keys, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviousSecretsFrom(t *testing.T) {
+	if got := previousSecretsFrom("  "); got != nil {
+		t.Errorf("blank = %q, want nil", got)
+	}
+	if got := previousSecretsFrom("plain-env-secret"); len(got) != 1 {
+		t.Errorf("plain secret gave %d candidates, want 1", len(got))
+	}
+	hexSecret := "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	got := previousSecretsFrom(hexSecret + "\n")
+	if len(got) != 2 || string(got[0]) != hexSecret || len(got[1]) != 32 {
+		t.Errorf("hex secret candidates = %d, want the raw string and 32 decoded bytes", len(got))
+	}
+}
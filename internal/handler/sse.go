@@ -4,12 +4,25 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"math/rand/v2"
 	"net/http"
 	"time"
 
+	"gobus/internal/metrics"
+	"gobus/internal/reliability"
 	"gobus/internal/templates"
 )
 
+var (
+	sseOpen  = metrics.NewGauge("gobus_sse_connections", "Open SSE departure streams.")
+	sseTotal = metrics.NewCounter("gobus_sse_connections_total", "SSE departure streams opened.")
+)
+
+// sseHistoryRefresh is how often a stream looks up the stop's departure
+// history again. It grows by a day's observations at a time, so there is
+// no point querying it on every tick.
+const sseHistoryRefresh = time.Hour
+
 // SSEDepartures streams live departure updates for a stop via Server-Sent Events.
 // The HTMX SSE extension on the client listens for "departures" events and swaps the HTML.
 func (h *Handler) SSEDepartures(w http.ResponseWriter, r *http.Request) {
@@ -27,8 +40,16 @@ func (h *Handler) SSEDepartures(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
 
+	sseOpen.Inc()
+	sseTotal.Inc()
+	defer sseOpen.Dec()
+
+	accessible := h.accessibleOnly(r)
+	historyAt := time.Now()
+	history := h.stopHistory(ctx, stopID, historyAt)
+
 	// Send initial data immediately
-	h.sendDepartureEvent(ctx, w, flusher, stopID)
+	h.sendDepartureEvent(ctx, w, flusher, stopID, accessible, history)
 
 	// Tick every 60 seconds per user spec
 	ticker := time.NewTicker(60 * time.Second)
@@ -36,18 +57,46 @@ func (h *Handler) SSEDepartures(w http.ResponseWriter, r *http.Request) {
 
 	for {
 		select {
-		case <-ticker.C:
-			h.sendDepartureEvent(ctx, w, flusher, stopID)
+		case now := <-ticker.C:
+			if now.Sub(historyAt) >= sseHistoryRefresh {
+				historyAt = now
+				history = h.stopHistory(ctx, stopID, now)
+			}
+			h.sendDepartureEvent(ctx, w, flusher, stopID, accessible, history)
+		case <-h.streamsDone:
+			h.sendReconnectHint(w, flusher)
+			return
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// CloseStreams ends every open SSE stream, telling each client to reconnect
+// in a few seconds (to this server once restarted, or another replica).
+// Called when the server starts shutting down; streams would otherwise hold
+// their connections open until the shutdown deadline.
+func (h *Handler) CloseStreams() {
+	h.closeStreams.Do(func() { close(h.streamsDone) })
+}
+
+// sendReconnectHint sets the client's reconnect delay before the stream
+// closes. The delay is spread out so clients don't all reconnect at once.
+func (h *Handler) sendReconnectHint(w http.ResponseWriter, flusher http.Flusher) {
+	fmt.Fprintf(w, "retry: %d\n\n", 2000+rand.IntN(3000))
+	flusher.Flush()
+}
+
 // sendDepartureEvent renders the departure list as HTML and sends it as an SSE event.
-func (h *Handler) sendDepartureEvent(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, stopID string) {
+// With accessibleOnly, trips marked not wheelchair accessible are left out.
+// history is the stop's departure history, for typical delays.
+func (h *Handler) sendDepartureEvent(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, stopID string, accessibleOnly bool, history []reliability.Group) {
 	now := time.Now()
 	departures := h.fetchDepartures(ctx, stopID, now, 15)
+	if accessibleOnly {
+		departures = accessibleDepartures(departures)
+	}
+	departures = withUsualDelays(departures, history)
 
 	var buf bytes.Buffer
 	if err := templates.DepartureList(departures).Render(ctx, &buf); err != nil {
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"gobus/internal/storage"
+	"gobus/internal/templates"
+)
+
+// stationDepartureLimit is how many departures the station page lists,
+// across all platforms.
+const stationDepartureLimit = 30
+
+// StationDetail serves the page for a station (GTFS location_type 1):
+// departures from all of its platforms in one list, each labeled with the
+// platform it leaves from, and the alerts for any of them.
+func (h *Handler) StationDetail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	station, platforms, ok := h.lookupStation(w, r)
+	if !ok {
+		return
+	}
+
+	accessible := h.accessibleOnly(r)
+	data := templates.StationData{
+		Page:       h.page(station.StopName, ""),
+		StationID:  station.StopID,
+		Name:       station.StopName,
+		Departures: h.stationDepartures(ctx, station.StopName, platforms, time.Now(), stationDepartureLimit, accessible),
+		Alerts:     h.stationAlerts(ctx, station.StopID, platforms),
+
+		WheelchairBoarding: station.WheelchairBoarding,
+		AccessibleOnly:     accessible,
+	}
+	for _, p := range platforms {
+		data.Platforms = append(data.Platforms, templates.StationPlatform{
+			StopID:             p.StopID,
+			Label:              platformLabel(station.StopName, p.StopName, p.StopDesc, p.PlatformCode),
+			WheelchairBoarding: p.WheelchairBoarding,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.StationPage(data).Render(ctx, w); err != nil {
+		h.logger.Error("rendering station page", "error", err)
+	}
+}
+
+// StationDepartures serves the station page's departure list on its own,
+// polled by the page to keep it current.
+func (h *Handler) StationDepartures(w http.ResponseWriter, r *http.Request) {
+	station, platforms, ok := h.lookupStation(w, r)
+	if !ok {
+		return
+	}
+	deps := h.stationDepartures(r.Context(), station.StopName, platforms, time.Now(), stationDepartureLimit, h.accessibleOnly(r))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.DepartureList(deps).Render(r.Context(), w); err != nil {
+		h.logger.Error("rendering station departures", "error", err)
+	}
+}
+
+// lookupStation loads the {id} station and its platforms. A stop that
+// isn't a station is redirected to its stop page.
+func (h *Handler) lookupStation(w http.ResponseWriter, r *http.Request) (*storage.StopRow, []storage.StopRow, bool) {
+	ctx := r.Context()
+	station, err := h.db.GetStop(ctx, r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	if err != nil {
+		h.logger.Error("fetching station", "error", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if station.LocationType != 1 {
+		http.Redirect(w, r, fmt.Sprintf("/stops/%s", station.StopID), http.StatusSeeOther)
+		return nil, nil, false
+	}
+	platforms, err := h.db.StationPlatforms(ctx, station.StopID)
+	if err != nil {
+		h.logger.Error("fetching station platforms", "station", station.StopID, "error", err)
+	}
+	return station, platforms, true
+}
+
+// stationDepartures merges the departures from a station's platforms,
+// soonest first, labeling each with its platform. A departure's wheelchair
+// access covers boarding at its platform as well as the vehicle, since
+// platforms within a station can differ. With accessibleOnly, platforms
+// and trips marked not wheelchair accessible are left out.
+func (h *Handler) stationDepartures(ctx context.Context, stationName string, platforms []storage.StopRow, now time.Time, limit int, accessibleOnly bool) []templates.DepartureInfo {
+	var all []templates.DepartureInfo
+	for _, p := range platforms {
+		if accessibleOnly && p.WheelchairBoarding == storage.AccessNo {
+			continue
+		}
+		label := platformLabel(stationName, p.StopName, p.StopDesc, p.PlatformCode)
+		for _, dep := range h.fetchDepartures(ctx, p.StopID, now, limit) {
+			dep.StopID = p.StopID
+			dep.Platform = label
+			dep.WheelchairAccessible = combinedAccess(p.WheelchairBoarding, dep.WheelchairAccessible)
+			all = append(all, dep)
+		}
+	}
+	if accessibleOnly {
+		all = accessibleDepartures(all)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].MinutesAway < all[j].MinutesAway
+	})
+	if len(all) > limit {
+		all = all[:limit]
+	}
+	return all
+}
+
+// stationAlerts merges the alerts for a station and its platforms, each
+// once.
+func (h *Handler) stationAlerts(ctx context.Context, stationID string, platforms []storage.StopRow) []templates.AlertDisplay {
+	alerts := h.alertsForStop(ctx, stationID)
+	for _, p := range platforms {
+		for _, a := range h.alertsForStop(ctx, p.StopID) {
+			if !alertExists(alerts, a.HeaderText) {
+				alerts = append(alerts, a)
+			}
+		}
+	}
+	return alerts
+}
+
+// platformLabel names a platform within its station: by its GTFS
+// platform_code ("Platform 2"), else its stop_desc ("Northbound side"),
+// else whatever its name adds to the station's ("Union Depot Gate B" at
+// "Union Depot" is "Gate B").
+func platformLabel(stationName, stopName, desc, code string) string {
+	code = strings.TrimSpace(code)
+	switch {
+	case code != "" && len(code) <= 3:
+		return "Platform " + code
+	case code != "":
+		return code
+	case strings.TrimSpace(desc) != "":
+		return formatStopDesc(desc)
+	}
+	if rest, ok := strings.CutPrefix(stopName, stationName); ok {
+		if rest = strings.Trim(rest, " -–—:,·()"); rest != "" {
+			return rest
+		}
+	}
+	return stopName
+}
+
+// collapseStations turns the nearby stops query's rows into what the
+// nearby views list: stops where vehicles board, with the platforms of a
+// station folded into a single row for the station (LocationType 1) at
+// its nearest platform. Entrances and other station nodes are dropped.
+// A station is as accessible as its best platform.
+func collapseStations(rows []storage.NearbyStopRow) []storage.NearbyStopRow {
+	var out []storage.NearbyStopRow
+	stations := make(map[string]int) // station ID → index in out
+	for _, row := range rows {
+		if row.LocationType != 0 {
+			continue
+		}
+		if row.StationID == "" {
+			out = append(out, row)
+			continue
+		}
+		if i, ok := stations[row.StationID]; ok {
+			out[i].WheelchairBoarding = bestAccess(out[i].WheelchairBoarding, row.WheelchairBoarding)
+			continue
+		}
+		stations[row.StationID] = len(out)
+		row.StopID = row.StationID
+		row.StopName = row.StationName
+		row.StopDesc = ""
+		row.StopCode = ""
+		row.PlatformCode = ""
+		row.LocationType = 1
+		out = append(out, row)
+	}
+	return out
+}
+
+// bestAccess is the better of two wheelchair access values: accessible
+// over unknown over not accessible.
+func bestAccess(a, b int) int {
+	rank := func(v int) int {
+		switch v {
+		case storage.AccessYes:
+			return 2
+		case storage.AccessNo:
+			return 0
+		default:
+			return 1
+		}
+	}
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
+}
+
+// nearbyDepartures returns the departures from a row of collapseStations:
+// from the stop, or from every platform of a station.
+func (h *Handler) nearbyDepartures(ctx context.Context, row storage.NearbyStopRow, now time.Time, limit int, accessibleOnly bool) []templates.DepartureInfo {
+	if row.LocationType != 1 {
+		deps := h.fetchDepartures(ctx, row.StopID, now, limit)
+		if accessibleOnly {
+			deps = accessibleDepartures(deps)
+		}
+		return deps
+	}
+	platforms, err := h.db.StationPlatforms(ctx, row.StopID)
+	if err != nil {
+		h.logger.Error("fetching station platforms", "station", row.StopID, "error", err)
+		return nil
+	}
+	return h.stationDepartures(ctx, row.StopName, platforms, now, limit, accessibleOnly)
+}
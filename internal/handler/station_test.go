@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"testing"
+
+	"gobus/internal/storage"
+)
+
+func TestPlatformLabel(t *testing.T) {
+	tests := []struct {
+		station, stop, desc, code string
+		want                      string
+	}{
+		{"Union Depot", "Union Depot Station Platform", "", "2", "Platform 2"},
+		{"Union Depot", "Union Depot Gate B", "", "", "Gate B"},
+		{"Union Depot", "Union Depot (Track 1)", "", "", "Track 1"},
+		{"Target Field", "Target Field Station", "Nearside N", "", "Northbound side"},
+		{"Target Field", "Target Field", "", "", "Target Field"},
+		{"Airport", "Terminal 1", "", "", "Terminal 1"},
+		{"Airport", "Airport Track 2", "", "Track 2", "Track 2"},
+	}
+	for _, tt := range tests {
+		if got := platformLabel(tt.station, tt.stop, tt.desc, tt.code); got != tt.want {
+			t.Errorf("platformLabel(%q, %q, %q, %q) = %q, want %q", tt.station, tt.stop, tt.desc, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestCollapseStations(t *testing.T) {
+	rows := []storage.NearbyStopRow{
+		{StopID: "51424", StopName: "Target Field Station", LocationType: 1},
+		{StopID: "p1", StopName: "Target Field Platform 1", StationID: "51424", StationName: "Target Field Station", WheelchairBoarding: storage.AccessNo},
+		{StopID: "bus", StopName: "5th St & 2nd Ave"},
+		{StopID: "e1", StopName: "Target Field Entrance", LocationType: 2, StationID: "51424", StationName: "Target Field Station"},
+		{StopID: "p2", StopName: "Target Field Platform 2", StationID: "51424", StationName: "Target Field Station", WheelchairBoarding: storage.AccessYes},
+	}
+	got := collapseStations(rows)
+	if len(got) != 2 {
+		t.Fatalf("collapseStations = %+v, want the station and the bus stop", got)
+	}
+	st := got[0]
+	if st.StopID != "51424" || st.StopName != "Target Field Station" || st.LocationType != 1 {
+		t.Errorf("station row = %+v", st)
+	}
+	if st.WheelchairBoarding != storage.AccessYes {
+		t.Errorf("station access = %d, want accessible through platform 2", st.WheelchairBoarding)
+	}
+	if got[1].StopID != "bus" {
+		t.Errorf("second row = %+v, want the bus stop", got[1])
+	}
+}
@@ -16,11 +16,7 @@ func (h *Handler) StopDetail(w http.ResponseWriter, r *http.Request) {
 	now := time.Now()
 
 	// Get stop info
-	var stopName, stopCode string
-	var stopLat, stopLon float64
-	err := h.db.QueryRowContext(ctx,
-		`SELECT stop_name, stop_code, stop_lat, stop_lon FROM stops WHERE stop_id = ?`,
-		stopID).Scan(&stopName, &stopCode, &stopLat, &stopLon)
+	stop, err := h.db.GetStop(ctx, stopID)
 	if err == sql.ErrNoRows {
 		http.NotFound(w, r)
 		return
@@ -30,9 +26,20 @@ func (h *Handler) StopDetail(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
 	}
+	if stop.LocationType == 1 {
+		// Stations have no departures of their own
+		http.Redirect(w, r, fmt.Sprintf("/stations/%s", stopID), http.StatusSeeOther)
+		return
+	}
 
 	// Get merged scheduled + realtime departures
+	accessible := h.accessibleOnly(r)
 	departures := h.fetchDepartures(ctx, stopID, now, 15)
+	if accessible {
+		departures = accessibleDepartures(departures)
+	}
+	history := h.stopHistory(ctx, stopID, now)
+	departures = withUsualDelays(departures, history)
 
 	// Detect service interval from the first departure's route
 	var interval string
@@ -48,16 +55,44 @@ func (h *Handler) StopDetail(w http.ResponseWriter, r *http.Request) {
 	// Get alerts for this stop (from GTFS-RT feed + NexTrip)
 	alerts := h.alertsForStop(ctx, stopID)
 
+	// Arrival reminders for the signed-in user
+	var reminders []templates.Reminder
+	if userID := h.currentUserID(r); userID != 0 {
+		rows, err := h.db.RemindersForStop(ctx, userID, stopID)
+		if err != nil {
+			h.logger.Error("fetching reminders", "error", err)
+		}
+		for _, rem := range rows {
+			reminders = append(reminders, templates.Reminder{ID: rem.ID, Label: rem.Label, LeadMinutes: rem.LeadMinutes})
+		}
+	}
+
 	data := templates.StopDetailData{
-		Page: h.page(fmt.Sprintf("Stop %s", stopName), ""),
+		Page: h.page(fmt.Sprintf("Stop %s", stop.StopName), ""),
 		StopID:     stopID,
-		StopName:   stopName,
-		StopCode:   stopCode,
-		Lat:        stopLat,
-		Lon:        stopLon,
+		StopName:   stop.StopName,
+		StopCode:   stop.StopCode,
+		Lat:        stop.StopLat,
+		Lon:        stop.StopLon,
 		Departures: departures,
 		Interval:   interval,
 		Alerts:     alerts,
+		Pinned:     h.isPinned(r, "stop", stopID),
+
+		WheelchairBoarding: stop.WheelchairBoarding,
+		AccessibleOnly:     accessible,
+
+		ReminderOptions: reminderOptions(departures),
+		LeadChoices:     reminderLeadChoices,
+		Reminders:       reminders,
+
+		Reliability: routeReliability(history, departures),
+	}
+
+	if stop.ParentStation != "" {
+		if station, err := h.db.GetStop(ctx, stop.ParentStation); err == nil && station.LocationType == 1 {
+			data.StationID, data.StationName = station.StopID, station.StopName
+		}
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
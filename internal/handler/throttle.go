@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"gobus/internal/config"
+	"gobus/internal/throttle"
+)
+
+// throttleWindow is how long a client or username must stay quiet before
+// its failed attempts are forgotten.
+const throttleWindow = time.Hour
+
+// loginPolicy builds the backoff/lockout policy for sign-in attempts.
+func loginPolicy(cfg *config.Config, lockoutAfter int) throttle.Policy {
+	maxDelay := time.Duration(cfg.LoginMaxDelaySec) * time.Second
+	if maxDelay < time.Second {
+		maxDelay = time.Second
+	}
+	return throttle.Policy{
+		FreeAttempts:    cfg.LoginFreeAttempts,
+		BaseDelay:       time.Second,
+		MaxDelay:        maxDelay,
+		LockoutAfter:    lockoutAfter,
+		LockoutDuration: time.Duration(cfg.LoginLockoutMin) * time.Minute,
+		Window:          throttleWindow,
+	}
+}
+
+// clientIP returns the address attempts are tracked by. Behind a reverse
+// proxy (GOBUS_TRUST_PROXY) that is the last X-Forwarded-For hop, the one
+// the proxy itself appended; earlier hops are client-supplied. IPv6 clients
+// are grouped by /64, since one host can usually pick any address in it.
+func (h *Handler) clientIP(r *http.Request) string {
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if h.cfg.Load().TrustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			hops := strings.Split(xff, ",")
+			addr = strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr
+	}
+	if ip.To4() == nil {
+		return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+	}
+	return ip.String()
+}
+
+func ipKey(ip string) string         { return "ip:" + ip }
+func usernameKey(name string) string { return "user:" + strings.ToLower(name) }
+
+// loginAttempt admits a sign-in attempt unless the client IP or the
+// username must wait, and returns that wait if so. An admitted attempt is
+// counted as a failure against both straight away (see
+// throttle.Limiter.Attempt); the caller resets the username on success.
+// Any lockout it triggers is logged.
+func (h *Handler) loginAttempt(ip, username, action string) time.Duration {
+	wait, locked := h.loginIPs.Attempt(ipKey(ip))
+	if wait > 0 {
+		return wait
+	}
+	if locked {
+		h.logger.Warn("auth lockout", "kind", "ip", "ip", ip, "action", action,
+			"minutes", h.cfg.Load().LoginLockoutMin)
+	}
+	wait, locked = h.loginUsers.Attempt(usernameKey(username))
+	if locked {
+		h.logger.Warn("auth lockout", "kind", "username", "username", username, "ip", ip,
+			"action", action, "minutes", h.cfg.Load().LoginLockoutMin)
+	}
+	return wait
+}
+
+// registrationAttempt admits a registration attempt unless the client IP
+// must wait, and returns that wait if so. An admitted attempt counts
+// against the IP whether or not it succeeds. Any lockout it triggers is
+// logged.
+func (h *Handler) registrationAttempt(ip string) time.Duration {
+	wait, locked := h.registerIPs.Attempt(ipKey(ip))
+	if locked {
+		h.logger.Warn("auth lockout", "kind", "ip", "ip", ip, "action", "register",
+			"minutes", h.cfg.Load().LoginLockoutMin)
+	}
+	return wait
+}
+
+// passkeyStarted records a passkey sign-in start against the client IP and
+// logs any lockout it triggers.
+func (h *Handler) passkeyStarted(ip string) {
+	if _, locked := h.passkeyIPs.Failure(ipKey(ip)); locked {
+		h.logger.Warn("auth lockout", "kind", "ip", "ip", ip, "action", "passkey login",
+			"minutes", h.cfg.Load().LoginLockoutMin)
+	}
+}
+
+// throttledMessage tells the user how long to wait.
+func throttledMessage(wait time.Duration) string {
+	switch {
+	case wait <= 5*time.Second:
+		return "Too many attempts. Please wait a few seconds and try again."
+	case wait < 2*time.Minute:
+		return fmt.Sprintf("Too many attempts. Please try again in %d seconds.", int(wait.Round(time.Second)/time.Second))
+	default:
+		return fmt.Sprintf("Too many attempts. Please try again in %d minutes.", int((wait+time.Minute-1)/time.Minute))
+	}
+}
+
+// setRetryAfter sets the Retry-After header for a throttled response.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	secs := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", fmt.Sprint(secs))
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gobus/internal/config"
+	"gobus/internal/storage"
+	"gobus/internal/throttle"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		remote     string
+		xff        string
+		want       string
+	}{
+		{"direct IPv4", false, "192.0.2.10:51234", "", "192.0.2.10"},
+		{"spoofed header ignored", false, "192.0.2.10:51234", "203.0.113.5", "192.0.2.10"},
+		{"behind proxy", true, "127.0.0.1:40000", "203.0.113.5", "203.0.113.5"},
+		{"proxy appends last hop", true, "127.0.0.1:40000", "198.51.100.1, 203.0.113.5", "203.0.113.5"},
+		{"proxy without header", true, "127.0.0.1:40000", "", "127.0.0.1"},
+		{"IPv6 grouped by /64", false, "[2001:db8:1:2:aaaa:bbbb:cccc:dddd]:443", "", "2001:db8:1:2::/64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{}
+			h.cfg.Store(&config.Config{TrustProxy: tt.trustProxy})
+			r := httptest.NewRequest("POST", "/login", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := h.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginThrottling(t *testing.T) {
+	cfg := &config.Config{LoginFreeAttempts: 2, LoginMaxDelaySec: 60, LoginLockoutUser: 4, LoginLockoutIP: 100, LoginLockoutMin: 15}
+	h := newTestHandler()
+	h.cfg.Store(cfg)
+	h.loginIPs = throttle.New(loginPolicy(cfg, cfg.LoginLockoutIP))
+	h.loginUsers = throttle.New(loginPolicy(cfg, cfg.LoginLockoutUser))
+	h.registerIPs = throttle.New(loginPolicy(cfg, cfg.LoginLockoutIP))
+	h.passkeyIPs = throttle.New(loginPolicy(cfg, cfg.LoginLockoutIP))
+
+	for i := 0; i < 2; i++ {
+		if wait := h.loginAttempt("192.0.2.1", "Alice", "login"); wait != 0 {
+			t.Fatalf("free attempts should not wait, got %v", wait)
+		}
+	}
+	// The third is let in, but starts a backoff for the next
+	if wait := h.loginAttempt("192.0.2.1", "alice", "login"); wait != 0 {
+		t.Fatalf("third attempt should be let in, got %v", wait)
+	}
+	if wait := h.loginAttempt("198.51.100.7", "ALICE", "login"); wait <= 0 || wait > time.Second {
+		t.Errorf("username backoff should follow the user to a new IP, wait = %v", wait)
+	}
+	h.loginUsers.Failure(usernameKey("alice"))
+	if wait := h.loginAttempt("198.51.100.7", "alice", "login"); wait < 14*time.Minute {
+		t.Errorf("username should be locked out, wait = %v", wait)
+	}
+	if wait := h.loginAttempt("198.51.100.7", "bob", "login"); wait != 0 {
+		t.Errorf("other users should be unaffected, wait = %v", wait)
+	}
+
+	// A reload applies new thresholds to the existing limiters
+	reloaded := *cfg
+	reloaded.LoginLockoutIP = 1
+	h.Reload(&reloaded)
+	h.registrationAttempt("203.0.113.9")
+	if wait, _ := h.registerIPs.Check(ipKey("203.0.113.9")); wait < 14*time.Minute {
+		t.Errorf("IP should be locked out of registering after reload lowered the limit, wait = %v", wait)
+	}
+	if wait, _ := h.loginIPs.Check(ipKey("203.0.113.9")); wait != 0 {
+		t.Errorf("registrations should not hold up sign-in, wait = %v", wait)
+	}
+	h.passkeyStarted("203.0.113.10")
+	if wait, _ := h.passkeyIPs.Check(ipKey("203.0.113.10")); wait < 14*time.Minute {
+		t.Errorf("IP should be locked out of passkey sign-in, wait = %v", wait)
+	}
+	if wait, _ := h.loginIPs.Check(ipKey("203.0.113.10")); wait != 0 {
+		t.Errorf("passkey starts should not hold up passphrase sign-in, wait = %v", wait)
+	}
+}
+
+func TestLoginAttempt_Concurrent(t *testing.T) {
+	cfg := &config.Config{LoginFreeAttempts: 3, LoginMaxDelaySec: 60, LoginLockoutUser: 10, LoginLockoutIP: 100, LoginLockoutMin: 15}
+	h := newTestHandler()
+	h.cfg.Store(cfg)
+	h.loginIPs = throttle.New(loginPolicy(cfg, cfg.LoginLockoutIP))
+	h.loginUsers = throttle.New(loginPolicy(cfg, cfg.LoginLockoutUser))
+
+	// A burst of guesses, all arriving before any has been checked
+	var (
+		wg       sync.WaitGroup
+		admitted atomic.Int32
+	)
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if h.loginAttempt("192.0.2.1", "alice", "login") == 0 {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := admitted.Load(); n != int32(cfg.LoginFreeAttempts+1) {
+		t.Errorf("%d of a concurrent burst let in, want %d", n, cfg.LoginFreeAttempts+1)
+	}
+}
+
+func TestRegistrationThrottling(t *testing.T) {
+	db, err := storage.Open(filepath.Join(t.TempDir(), "gobus.db"), slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cfg := &config.Config{LoginFreeAttempts: 2, LoginMaxDelaySec: 60, LoginLockoutIP: 100, LoginLockoutMin: 15}
+	h := newTestHandler()
+	h.db = db
+	h.cfg.Store(cfg)
+	h.registerIPs = throttle.New(loginPolicy(cfg, cfg.LoginLockoutIP))
+
+	// A time gate token old enough to pass
+	ts := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	mac := hmac.New(sha256.New, h.cookieSecret)
+	mac.Write([]byte(ts))
+	timeGate := ts + "." + hex.EncodeToString(mac.Sum(nil))
+
+	register := func(username string) int {
+		form := url.Values{"username": {username}, "passphrase": {"correct horse battery"}, "ts": {timeGate}}
+		r := httptest.NewRequest("POST", "/register", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr = "192.0.2.1:40000"
+		w := httptest.NewRecorder()
+		h.registerPost(w, r)
+		return w.Code
+	}
+	// The free attempts, then one more that starts the backoff
+	for i := 0; i <= cfg.LoginFreeAttempts; i++ {
+		if code := register(fmt.Sprintf("rider%d", i)); code != http.StatusSeeOther {
+			t.Fatalf("registration %d: status %d, want %d", i+1, code, http.StatusSeeOther)
+		}
+	}
+	if code := register("rider9"); code != http.StatusTooManyRequests {
+		t.Errorf("registration after %d successful ones: status %d, want %d",
+			cfg.LoginFreeAttempts+1, code, http.StatusTooManyRequests)
+	}
+}
+
+func TestThrottledMessage(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want string
+	}{
+		{2 * time.Second, "Too many attempts. Please wait a few seconds and try again."},
+		{32 * time.Second, "Too many attempts. Please try again in 32 seconds."},
+		{14*time.Minute + 10*time.Second, "Too many attempts. Please try again in 15 minutes."},
+	}
+	for _, tt := range tests {
+		if got := throttledMessage(tt.wait); got != tt.want {
+			t.Errorf("throttledMessage(%v) = %q, want %q", tt.wait, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+
+	"gobus/internal/geo"
+	"gobus/internal/storage"
+	"gobus/internal/templates"
+	"gobus/internal/walk"
+)
+
+// maxRouteMeters is the longest walk routed over the street network.
+// Stops farther along it than this are assumed to be at least this far.
+const maxRouteMeters = 5000
+
+// SetWalkGraph gives the handler a street network to route walks over.
+func (h *Handler) SetWalkGraph(g *walk.Graph) {
+	h.walk = g
+}
+
+// riderPrefs are the signed-in user's preferences that change which
+// departures they're shown. Anonymous visitors get the zero value.
+type riderPrefs struct {
+	accessibleOnly bool    // hide stops and trips marked not wheelchair accessible
+	walkSpeed      float64 // meters per minute; 0 for geo.WalkingSpeed
+}
+
+func (h *Handler) riderPrefs(r *http.Request) riderPrefs {
+	userID := h.currentUserID(r)
+	if userID == 0 {
+		return riderPrefs{}
+	}
+	user, err := h.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("rider preferences: user lookup", "error", err)
+		return riderPrefs{}
+	}
+	return riderPrefs{accessibleOnly: user.AccessibleOnly, walkSpeed: user.WalkSpeed}
+}
+
+// walkDistances returns the walking distance in meters from lat, lon to
+// each row's stop: along the streets when a network has been imported,
+// else geo.WalkDistance. A stop with no path within maxRouteMeters (across
+// a river far from a bridge, say) is put at least that far away.
+func (h *Handler) walkDistances(lat, lon float64, rows []storage.NearbyStopRow) []float64 {
+	out := make([]float64, len(rows))
+	for i, row := range rows {
+		out[i] = geo.WalkDistance(lat, lon, row.StopLat, row.StopLon)
+	}
+	if h.walk == nil || len(rows) == 0 {
+		return out
+	}
+	to := make([]walk.Point, len(rows))
+	for i, row := range rows {
+		to[i] = walk.Point{Lat: row.StopLat, Lon: row.StopLon}
+	}
+	routed, ok := h.walk.Distances(walk.Point{Lat: lat, Lon: lon}, to, maxRouteMeters)
+	if !ok {
+		return out // off the imported network
+	}
+	for i, d := range routed {
+		if math.IsInf(d, 1) {
+			out[i] = max(out[i], maxRouteMeters)
+		} else {
+			out[i] = d
+		}
+	}
+	return out
+}
+
+// reachableDepartures drops departures that leave before someone walkMin
+// minutes from the stop could get there.
+func reachableDepartures(deps []templates.DepartureInfo, walkMin int) []templates.DepartureInfo {
+	var out []templates.DepartureInfo
+	for _, dep := range deps {
+		if dep.MinutesAway >= walkMin {
+			out = append(out, dep)
+		}
+	}
+	return out
+}
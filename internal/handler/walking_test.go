@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"testing"
+
+	"gobus/internal/templates"
+)
+
+func TestReachableDepartures(t *testing.T) {
+	deps := []templates.DepartureInfo{
+		{TripID: "a", MinutesAway: 1},
+		{TripID: "b", MinutesAway: 4},
+		{TripID: "c", MinutesAway: 5},
+		{TripID: "d", MinutesAway: 12},
+	}
+	got := reachableDepartures(deps, 5)
+	if len(got) != 2 || got[0].TripID != "c" || got[1].TripID != "d" {
+		t.Errorf("reachableDepartures = %+v, want trips c and d", got)
+	}
+	if got := reachableDepartures(deps, 20); len(got) != 0 {
+		t.Errorf("reachableDepartures(20 min walk) = %+v, want none", got)
+	}
+}
+
+func TestValidWalkSpeed(t *testing.T) {
+	for _, o := range templates.WalkSpeedOptions {
+		if !validWalkSpeed(o.MetersPerMin) {
+			t.Errorf("validWalkSpeed(%v) = false for an offered pace", o.MetersPerMin)
+		}
+	}
+	for _, v := range []float64{-1, 1, 500} {
+		if validWalkSpeed(v) {
+			t.Errorf("validWalkSpeed(%v) = true, want false", v)
+		}
+	}
+}
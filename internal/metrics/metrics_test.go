@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func scrape() string {
+	var sb strings.Builder
+	Default.Write(&sb)
+	return sb.String()
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	c := NewCounter("test_requests_total", "Requests.\nBy code.", "code")
+	c.Inc("200")
+	c.Inc("200")
+	c.Inc(`a"b\c`)
+	g := NewGauge("test_open", "Open things.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	NewGaugeFunc("test_func", "From a func.", func() float64 { return 2.5 })
+
+	out := scrape()
+	for _, want := range []string{
+		"# HELP test_requests_total Requests.\\nBy code.\n# TYPE test_requests_total counter\n",
+		`test_requests_total{code="200"} 2`,
+		`test_requests_total{code="a\"b\\c"} 1`,
+		"# TYPE test_open gauge\ntest_open 1\n",
+		"test_func 2.5\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "Durations.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.1, "/a") // bucket bounds are inclusive
+	h.Observe(0.5, "/a")
+	h.Observe(3, "/a")
+
+	out := scrape()
+	for _, want := range []string{
+		`test_duration_seconds_bucket{route="/a",le="0.1"} 2`,
+		`test_duration_seconds_bucket{route="/a",le="1"} 3`,
+		`test_duration_seconds_bucket{route="/a",le="+Inf"} 4`,
+		`test_duration_seconds_sum{route="/a"} 3.65`,
+		`test_duration_seconds_count{route="/a"} 4`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestLabelCountMismatchPanics(t *testing.T) {
+	c := NewCounter("test_mismatch_total", "Mismatch.", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc with the wrong number of label values should panic")
+		}
+	}()
+	c.Inc("only-one")
+}
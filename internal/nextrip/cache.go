@@ -1,7 +1,9 @@
 package nextrip
 
 import (
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,6 +12,17 @@ type Cache struct {
 	mu      sync.RWMutex
 	entries map[string]cacheEntry
 	ttl     time.Duration
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// CacheStats is a snapshot of cache usage, for the admin console.
+type CacheStats struct {
+	Entries int // including expired entries not yet cleaned up
+	Hits    int64
+	Misses  int64
+	TTL     time.Duration
 }
 
 type cacheEntry struct {
@@ -39,6 +52,21 @@ func (c *Cache) Get(key string) (any, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return entry.value, true
+}
+
+// Peek is Get without counting a hit or miss, for lookups that never go to
+// the API either way.
+func (c *Cache) Peek(key string) (any, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	entry, ok := c.entries[key]
 	if !ok || time.Now().After(entry.expiresAt) {
 		return nil, false
@@ -46,6 +74,13 @@ func (c *Cache) Get(key string) (any, bool) {
 	return entry.value, true
 }
 
+// Stats returns the cache's size and hit counts.
+func (c *Cache) Stats() CacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return CacheStats{Entries: len(c.entries), Hits: c.hits.Load(), Misses: c.misses.Load(), TTL: c.ttl}
+}
+
 // Set stores a value in the cache.
 func (c *Cache) Set(key string, value any) {
 	c.mu.Lock()
@@ -68,3 +103,18 @@ func (c *Cache) cleanup() {
 		}
 	}
 }
+
+// Keys returns the unexpired keys that start with prefix.
+func (c *Cache) Keys(prefix string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	var keys []string
+	for k, v := range c.entries {
+		if strings.HasPrefix(k, prefix) && now.Before(v.expiresAt) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -104,6 +104,23 @@ func TestCache_Cleanup(t *testing.T) {
 	}
 }
 
+func TestCache_Keys(t *testing.T) {
+	c := &Cache{
+		entries: make(map[string]cacheEntry),
+		ttl:     50 * time.Millisecond,
+	}
+
+	c.Set("stop:old", 1)
+	time.Sleep(60 * time.Millisecond)
+	c.Set("stop:123", 2)
+	c.Set("route:5:0:ABC", 3)
+
+	keys := c.Keys("stop:")
+	if len(keys) != 1 || keys[0] != "stop:123" {
+		t.Errorf("Keys(\"stop:\") = %v, want [stop:123]", keys)
+	}
+}
+
 func TestCache_ConcurrentAccess(t *testing.T) {
 	c := &Cache{
 		entries: make(map[string]cacheEntry),
@@ -166,3 +183,42 @@ func TestCache_DifferentTypes(t *testing.T) {
 		t.Errorf("ptr = %v, %v", got, ok)
 	}
 }
+
+func TestCache_Stats(t *testing.T) {
+	c := &Cache{
+		entries: make(map[string]cacheEntry),
+		ttl:     1 * time.Minute,
+	}
+
+	c.Set("key1", "value1")
+	c.Get("key1")
+	c.Get("key1")
+	c.Get("missing")
+
+	stats := c.Stats()
+	if stats.Entries != 1 || stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Stats() = %+v, want 1 entry, 2 hits, 1 miss", stats)
+	}
+}
+
+func TestCache_Peek(t *testing.T) {
+	c := &Cache{
+		entries: make(map[string]cacheEntry),
+		ttl:     1 * time.Minute,
+	}
+
+	c.Set("key1", "value1")
+	if v, ok := c.Peek("key1"); !ok || v != "value1" {
+		t.Errorf("Peek(key1) = %v, %v; want value1", v, ok)
+	}
+	if _, ok := c.Peek("missing"); ok {
+		t.Error("Peek(missing) found an entry")
+	}
+	c.entries["old"] = cacheEntry{value: "x", expiresAt: time.Now().Add(-time.Second)}
+	if _, ok := c.Peek("old"); ok {
+		t.Error("Peek returned an expired entry")
+	}
+	if stats := c.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("Peek counted toward the stats: %+v", stats)
+	}
+}
@@ -6,15 +6,25 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
+
+	"gobus/internal/metrics"
+	"gobus/internal/upstream"
 )
 
+var requestDuration = metrics.NewHistogram("gobus_nextrip_request_duration_seconds",
+	"Time taken by NexTrip API requests (cache misses only), by outcome.", metrics.DefBuckets, "outcome")
+
 // Client is an HTTP client for the Metro Transit NexTrip API.
 type Client struct {
 	baseURL string
 	client  *http.Client
 	cache   *Cache
 	logger  *slog.Logger
+	health  upstream.Health
+	observe func(stopID string, resp *Response) // set by SetObserver
 }
 
 // NewClient creates a NexTrip API client.
@@ -49,9 +59,40 @@ func (c *Client) DeparturesForStop(ctx context.Context, stopID string) (*Respons
 	}
 
 	c.cache.Set(cacheKey, &result)
+	if c.observe != nil {
+		c.observe(stopID, &result)
+	}
 	return &result, nil
 }
 
+// SetObserver has fn called with every stop response fetched from the API
+// (not those served from the cache). Call it before the client is used.
+func (c *Client) SetObserver(fn func(stopID string, resp *Response)) {
+	c.observe = fn
+}
+
+// CachedStopIDs returns the stops whose departures are currently cached.
+// Used to re-publish predictions without making extra upstream requests.
+func (c *Client) CachedStopIDs() []string {
+	keys := c.cache.Keys("stop:")
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = strings.TrimPrefix(k, "stop:")
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// CachedDepartures returns a stop's departures if they are cached, without
+// going to the API otherwise.
+func (c *Client) CachedDepartures(stopID string) (*Response, bool) {
+	cached, ok := c.cache.Peek("stop:" + stopID)
+	if !ok {
+		return nil, false
+	}
+	return cached.(*Response), true
+}
+
 // DeparturesForRouteStop fetches departures for a specific route/direction/stop.
 func (c *Client) DeparturesForRouteStop(ctx context.Context, routeID string, directionID int, placeCode string) (*Response, error) {
 	cacheKey := fmt.Sprintf("route:%s:%d:%s", routeID, directionID, placeCode)
@@ -127,13 +168,33 @@ func (c *Client) doGet(ctx context.Context, url string) (*http.Response, error)
 	}
 	req.Header.Set("Accept", "application/json")
 
+	start := time.Now()
 	resp, err := c.client.Do(req)
 	if err != nil {
+		if ctx.Err() == nil { // a client going away says nothing about NexTrip
+			c.health.Record(err)
+			requestDuration.ObserveSince(start, "error")
+		}
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
 		resp.Body.Close()
-		return nil, fmt.Errorf("HTTP %d from %s", resp.StatusCode, url)
+		err := fmt.Errorf("HTTP %d from %s", resp.StatusCode, url)
+		c.health.Record(err)
+		requestDuration.ObserveSince(start, "error")
+		return nil, err
 	}
+	c.health.Record(nil)
+	requestDuration.ObserveSince(start, "ok")
 	return resp, nil
 }
+
+// Health reports how recent NexTrip requests have fared.
+func (c *Client) Health() upstream.Status {
+	return c.health.Snapshot()
+}
+
+// CacheStats reports usage of the response cache.
+func (c *Client) CacheStats() CacheStats {
+	return c.cache.Stats()
+}
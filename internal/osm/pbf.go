@@ -0,0 +1,368 @@
+// Package osm reads OpenStreetMap PBF extracts, the format Geofabrik and
+// BBBike publish. It decodes only what GoBus needs — node positions and
+// ways with their tags — and skips relations and metadata.
+package osm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Node is an OSM node's ID and position.
+type Node struct {
+	ID       int64
+	Lat, Lon float64
+}
+
+// Way is an OSM way: its node IDs in order and its tags.
+type Way struct {
+	ID   int64
+	Refs []int64
+	Tags map[string]string
+}
+
+// Size limits from the PBF spec, so a corrupt file can't make Scan
+// allocate gigabytes.
+const (
+	maxHeaderSize = 64 << 10
+	maxBlobSize   = 32 << 20
+)
+
+// supportedFeatures are the required_features of a file header Scan can
+// read. A file needing anything else (history, changesets) is rejected.
+var supportedFeatures = map[string]bool{
+	"OsmSchema-V0.6": true,
+	"DenseNodes":     true,
+}
+
+// Scan reads a PBF extract from r, calling nodes for every node and ways
+// for every way in file order. Either may be nil to skip that kind of
+// element, which is much faster for ways.
+func Scan(r io.Reader, nodes func(Node), ways func(Way)) error {
+	var lenBuf [4]byte
+	for {
+		if _, err := io.ReadFull(r, lenBuf[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read blob header size: %w", err)
+		}
+		n := binary.BigEndian.Uint32(lenBuf[:])
+		if n > maxHeaderSize {
+			return fmt.Errorf("blob header of %d bytes is too large", n)
+		}
+		hdr := make([]byte, n)
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			return fmt.Errorf("read blob header: %w", err)
+		}
+		typ, size, err := parseBlobHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if size < 0 || size > maxBlobSize {
+			return fmt.Errorf("blob of %d bytes is too large", size)
+		}
+		blob := make([]byte, size)
+		if _, err := io.ReadFull(r, blob); err != nil {
+			return fmt.Errorf("read blob: %w", err)
+		}
+		switch typ {
+		case "OSMHeader":
+			data, err := blobData(blob)
+			if err != nil {
+				return err
+			}
+			if err := checkHeader(data); err != nil {
+				return err
+			}
+		case "OSMData":
+			if nodes == nil && ways == nil {
+				continue
+			}
+			data, err := blobData(blob)
+			if err != nil {
+				return err
+			}
+			if err := parseBlock(data, nodes, ways); err != nil {
+				return err
+			}
+		}
+		// Other blob types are allowed by the spec and skipped
+	}
+}
+
+// fields calls fn for each field of the protobuf message b.
+func fields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errors.New("malformed protobuf")
+		}
+		b = b[n:]
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errors.New("malformed protobuf")
+		}
+		b = b[n:]
+		if err := fn(num, typ, v, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// varints appends the values of a repeated integer field, which may be
+// packed (typ BytesType) or not, to dst.
+func varints(dst []uint64, typ protowire.Type, v []byte, x uint64) ([]uint64, error) {
+	if typ == protowire.VarintType {
+		return append(dst, x), nil
+	}
+	for len(v) > 0 {
+		x, n := protowire.ConsumeVarint(v)
+		if n < 0 {
+			return nil, errors.New("malformed packed field")
+		}
+		dst = append(dst, x)
+		v = v[n:]
+	}
+	return dst, nil
+}
+
+func parseBlobHeader(b []byte) (typ string, size int64, err error) {
+	err = fields(b, func(num protowire.Number, _ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			typ = string(v)
+		case 3:
+			size = int64(int32(x))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("blob header: %w", err)
+	}
+	return typ, size, nil
+}
+
+// blobData returns a blob's uncompressed contents. Only raw and zlib
+// blobs are supported; every common tool writes zlib.
+func blobData(b []byte) ([]byte, error) {
+	var raw, zdata []byte
+	var rawSize int64
+	var other protowire.Number
+	err := fields(b, func(num protowire.Number, _ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			raw = v
+		case 2:
+			rawSize = int64(int32(x))
+		case 3:
+			zdata = v
+		case 4, 5, 6, 7:
+			other = num
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("blob: %w", err)
+	}
+	switch {
+	case raw != nil:
+		return raw, nil
+	case zdata != nil:
+		if rawSize < 0 || rawSize > maxBlobSize {
+			return nil, fmt.Errorf("blob of %d bytes uncompressed is too large", rawSize)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(zdata))
+		if err != nil {
+			return nil, fmt.Errorf("blob: %w", err)
+		}
+		out := make([]byte, 0, rawSize)
+		buf := bytes.NewBuffer(out)
+		if _, err := io.Copy(buf, io.LimitReader(zr, maxBlobSize+1)); err != nil {
+			return nil, fmt.Errorf("blob: %w", err)
+		}
+		if buf.Len() > maxBlobSize {
+			return nil, errors.New("blob is too large uncompressed")
+		}
+		return buf.Bytes(), nil
+	case other != 0:
+		return nil, fmt.Errorf("blob compression (field %d) is not supported, only zlib", other)
+	}
+	return nil, nil
+}
+
+func checkHeader(b []byte) error {
+	return fields(b, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+		if num == 4 && !supportedFeatures[string(v)] {
+			return fmt.Errorf("extract needs unsupported feature %q", v)
+		}
+		return nil
+	})
+}
+
+// block is the coordinate encoding and string table of a PrimitiveBlock.
+type block struct {
+	strings     [][]byte
+	granularity int64
+	latOffset   int64
+	lonOffset   int64
+}
+
+func (b *block) lat(v int64) float64 { return 1e-9 * float64(b.latOffset+b.granularity*v) }
+func (b *block) lon(v int64) float64 { return 1e-9 * float64(b.lonOffset+b.granularity*v) }
+
+func (b *block) str(i uint64) string {
+	if i < uint64(len(b.strings)) {
+		return string(b.strings[i])
+	}
+	return ""
+}
+
+func parseBlock(data []byte, nodes func(Node), ways func(Way)) error {
+	blk := block{granularity: 100}
+	var groups [][]byte
+	err := fields(data, func(num protowire.Number, _ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			return fields(v, func(num protowire.Number, _ protowire.Type, s []byte, _ uint64) error {
+				if num == 1 {
+					blk.strings = append(blk.strings, s)
+				}
+				return nil
+			})
+		case 2:
+			groups = append(groups, v)
+		case 17:
+			blk.granularity = int64(int32(x))
+		case 19:
+			blk.latOffset = int64(x)
+		case 20:
+			blk.lonOffset = int64(x)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("primitive block: %w", err)
+	}
+	for _, g := range groups {
+		err := fields(g, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+			switch {
+			case num == 1 && nodes != nil:
+				return blk.node(v, nodes)
+			case num == 2 && nodes != nil:
+				return blk.denseNodes(v, nodes)
+			case num == 3 && ways != nil:
+				return blk.way(v, ways)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("primitive group: %w", err)
+		}
+	}
+	return nil
+}
+
+func (b *block) node(v []byte, fn func(Node)) error {
+	var n Node
+	err := fields(v, func(num protowire.Number, _ protowire.Type, _ []byte, x uint64) error {
+		switch num {
+		case 1:
+			n.ID = protowire.DecodeZigZag(x)
+		case 8:
+			n.Lat = b.lat(protowire.DecodeZigZag(x))
+		case 9:
+			n.Lon = b.lon(protowire.DecodeZigZag(x))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fn(n)
+	return nil
+}
+
+// denseNodes decodes a DenseNodes group, whose IDs and coordinates are
+// delta coded.
+func (b *block) denseNodes(v []byte, fn func(Node)) error {
+	var ids, lats, lons []uint64
+	err := fields(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		var err error
+		switch num {
+		case 1:
+			ids, err = varints(ids, typ, v, x)
+		case 8:
+			lats, err = varints(lats, typ, v, x)
+		case 9:
+			lons, err = varints(lons, typ, v, x)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		return errors.New("dense nodes: id, lat and lon counts differ")
+	}
+	var id, lat, lon int64
+	for i := range ids {
+		id += protowire.DecodeZigZag(ids[i])
+		lat += protowire.DecodeZigZag(lats[i])
+		lon += protowire.DecodeZigZag(lons[i])
+		fn(Node{ID: id, Lat: b.lat(lat), Lon: b.lon(lon)})
+	}
+	return nil
+}
+
+func (b *block) way(v []byte, fn func(Way)) error {
+	var w Way
+	var keys, vals, refs []uint64
+	err := fields(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		var err error
+		switch num {
+		case 1:
+			w.ID = int64(x)
+		case 2:
+			keys, err = varints(keys, typ, v, x)
+		case 3:
+			vals, err = varints(vals, typ, v, x)
+		case 8:
+			refs, err = varints(refs, typ, v, x)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(keys) != len(vals) {
+		return fmt.Errorf("way %d: key and value counts differ", w.ID)
+	}
+	w.Tags = make(map[string]string, len(keys))
+	for i := range keys {
+		w.Tags[b.str(keys[i])] = b.str(vals[i])
+	}
+	w.Refs = make([]int64, len(refs))
+	var ref int64
+	for i, r := range refs {
+		ref += protowire.DecodeZigZag(r)
+		w.Refs[i] = ref
+	}
+	fn(w)
+	return nil
+}
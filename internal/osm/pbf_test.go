@@ -0,0 +1,147 @@
+package osm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// writeBlob appends a file block: size, BlobHeader, zlib Blob.
+func writeBlob(buf *bytes.Buffer, typ string, data []byte) {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(data)
+	zw.Close()
+
+	var blob []byte
+	blob = protowire.AppendTag(blob, 2, protowire.VarintType)
+	blob = protowire.AppendVarint(blob, uint64(len(data)))
+	blob = protowire.AppendTag(blob, 3, protowire.BytesType)
+	blob = protowire.AppendBytes(blob, z.Bytes())
+
+	var hdr []byte
+	hdr = protowire.AppendTag(hdr, 1, protowire.BytesType)
+	hdr = protowire.AppendString(hdr, typ)
+	hdr = protowire.AppendTag(hdr, 3, protowire.VarintType)
+	hdr = protowire.AppendVarint(hdr, uint64(len(blob)))
+
+	binary.Write(buf, binary.BigEndian, uint32(len(hdr)))
+	buf.Write(hdr)
+	buf.Write(blob)
+}
+
+func packed(vals ...int64) []byte {
+	var b []byte
+	for _, v := range vals {
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(v))
+	}
+	return b
+}
+
+func packedUint(vals ...uint64) []byte {
+	var b []byte
+	for _, v := range vals {
+		b = protowire.AppendVarint(b, v)
+	}
+	return b
+}
+
+func bytesField(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// testExtract is a tiny extract: three dense nodes and one footway
+// through them.
+func testExtract(features ...string) []byte {
+	var header []byte
+	for _, f := range features {
+		header = bytesField(header, 4, []byte(f))
+	}
+
+	// Nodes 10, 11, 12 at (44.97, -93.26), (44.971, -93.26), (44.971, -93.259)
+	// in units of 100 nanodegrees
+	var dense []byte
+	dense = bytesField(dense, 1, packed(10, 1, 1))
+	dense = bytesField(dense, 8, packed(449700000, 10000, 0))
+	dense = bytesField(dense, 9, packed(-932600000, 0, 10000))
+
+	var way []byte
+	way = protowire.AppendTag(way, 1, protowire.VarintType)
+	way = protowire.AppendVarint(way, 500)
+	way = bytesField(way, 2, packedUint(1))
+	way = bytesField(way, 3, packedUint(2))
+	way = bytesField(way, 8, packed(10, 1, 1))
+
+	var strtab []byte
+	for _, s := range []string{"", "highway", "footway"} {
+		strtab = bytesField(strtab, 1, []byte(s))
+	}
+	var nodeGroup, wayGroup []byte
+	nodeGroup = bytesField(nodeGroup, 2, dense)
+	wayGroup = bytesField(wayGroup, 3, way)
+
+	var block []byte
+	block = bytesField(block, 1, strtab)
+	block = bytesField(block, 2, nodeGroup)
+	block = bytesField(block, 2, wayGroup)
+
+	var buf bytes.Buffer
+	writeBlob(&buf, "OSMHeader", header)
+	writeBlob(&buf, "OSMData", block)
+	return buf.Bytes()
+}
+
+func TestScan(t *testing.T) {
+	var nodes []Node
+	var ways []Way
+	err := Scan(bytes.NewReader(testExtract("OsmSchema-V0.6", "DenseNodes")),
+		func(n Node) { nodes = append(nodes, n) },
+		func(w Way) { ways = append(ways, w) })
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("got %d nodes, want 3", len(nodes))
+	}
+	want := []Node{{10, 44.97, -93.26}, {11, 44.971, -93.26}, {12, 44.971, -93.259}}
+	for i, n := range nodes {
+		if n.ID != want[i].ID || math.Abs(n.Lat-want[i].Lat) > 1e-9 || math.Abs(n.Lon-want[i].Lon) > 1e-9 {
+			t.Errorf("node %d = %+v, want %+v", i, n, want[i])
+		}
+	}
+	if len(ways) != 1 {
+		t.Fatalf("got %d ways, want 1", len(ways))
+	}
+	w := ways[0]
+	if w.ID != 500 || w.Tags["highway"] != "footway" || len(w.Refs) != 3 || w.Refs[0] != 10 || w.Refs[2] != 12 {
+		t.Errorf("way = %+v", w)
+	}
+}
+
+func TestScanSkipsWays(t *testing.T) {
+	var nodes int
+	err := Scan(bytes.NewReader(testExtract("OsmSchema-V0.6")), func(Node) { nodes++ }, nil)
+	if err != nil || nodes != 3 {
+		t.Errorf("Scan = %v with %d nodes, want 3 nodes", err, nodes)
+	}
+}
+
+func TestScanUnsupportedFeature(t *testing.T) {
+	err := Scan(bytes.NewReader(testExtract("OsmSchema-V0.6", "HistoricalInformation")), nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "HistoricalInformation") {
+		t.Errorf("Scan = %v, want unsupported feature error", err)
+	}
+}
+
+func TestScanTruncated(t *testing.T) {
+	data := testExtract("OsmSchema-V0.6")
+	if err := Scan(bytes.NewReader(data[:len(data)-5]), func(Node) {}, nil); err == nil {
+		t.Error("Scan of a truncated file succeeded")
+	}
+}
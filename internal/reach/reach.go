@@ -0,0 +1,222 @@
+// Package reach works out which stops can be reached from a place within
+// a time budget by riding the schedule, changing vehicles and walking. It
+// scans the day's connections once in departure order (the Connection
+// Scan Algorithm), so a whole city answers in milliseconds.
+package reach
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gobus/internal/geo"
+)
+
+// Stop is a place vehicles board.
+type Stop struct {
+	ID       string
+	Lat, Lon float64
+}
+
+// Connection is a vehicle going from one stop to the next on a trip.
+// Times are seconds after midnight of the service day.
+type Connection struct {
+	Trip, Route string
+	From, To    string
+	Dep, Arr    int
+	NoPickup    bool // riders can't board at From
+	NoDropOff   bool // riders can't get off at To
+}
+
+// Access is a stop the origin can walk to, and how long that takes in
+// seconds.
+type Access struct {
+	Stop string
+	Walk int
+}
+
+// Options shape a search.
+type Options struct {
+	Start  int // departure, seconds after midnight
+	Budget int // seconds of travel allowed
+
+	// WalkSpeed is the walking pace for transfers in meters per minute;
+	// 0 means geo.WalkingSpeed.
+	WalkSpeed float64
+	// TransferMeters is the farthest walk between stops to change
+	// vehicles; 0 means DefaultTransferMeters.
+	TransferMeters float64
+}
+
+// DefaultTransferMeters is how far a transfer walk may be by default,
+// about two city blocks.
+const DefaultTransferMeters = 400
+
+// transferSlack is the time allowed to get off one vehicle and onto
+// another at the same stop.
+const transferSlack = 60
+
+// Arrival is the earliest a stop can be reached.
+type Arrival struct {
+	Stop  string
+	Time  int    // seconds after midnight
+	Rides int    // vehicles taken; 0 means walking only
+	Route string // the last route ridden, "" when walking only
+}
+
+// Search returns every stop reachable from the access stops by Start +
+// Budget, soonest first. conns must be sorted by departure.
+func Search(stops []Stop, conns []Connection, access []Access, opt Options) []Arrival {
+	speed := opt.WalkSpeed
+	if speed <= 0 {
+		speed = geo.WalkingSpeed
+	}
+	transfer := opt.TransferMeters
+	if transfer <= 0 {
+		transfer = DefaultTransferMeters
+	}
+	end := opt.Start + opt.Budget
+	fp := newFootpaths(stops, transfer, speed)
+
+	best := make(map[string]Arrival)
+	byVehicle := make(map[string]bool) // best arrival was getting off a vehicle
+	improve := func(stop string, a Arrival, vehicle bool) bool {
+		if a.Time > end {
+			return false
+		}
+		if old, ok := best[stop]; ok && old.Time <= a.Time {
+			return false
+		}
+		a.Stop = stop
+		best[stop] = a
+		byVehicle[stop] = vehicle
+		return true
+	}
+	for _, a := range access {
+		improve(a.Stop, Arrival{Time: opt.Start + a.Walk}, false)
+	}
+	// Walking from one access stop on to another isn't needed: access
+	// already covers everywhere walkable from the origin
+
+	type tripState struct {
+		rides int
+	}
+	trips := make(map[string]tripState)
+	for _, c := range conns {
+		if c.Dep < opt.Start {
+			continue
+		}
+		if c.Dep > end {
+			break
+		}
+		t, onBoard := trips[c.Trip]
+		if !onBoard {
+			from, ok := best[c.From]
+			if !ok || c.NoPickup {
+				continue
+			}
+			ready := from.Time
+			if byVehicle[c.From] {
+				ready += transferSlack
+			}
+			if ready > c.Dep {
+				continue
+			}
+			t = tripState{rides: from.Rides + 1}
+			trips[c.Trip] = t
+		}
+		if c.NoDropOff {
+			continue
+		}
+		arr := Arrival{Time: c.Arr, Rides: t.rides, Route: c.Route}
+		if !improve(c.To, arr, true) {
+			continue
+		}
+		for _, n := range fp.from(c.To) {
+			improve(n.stop, Arrival{Time: c.Arr + n.walk, Rides: t.rides, Route: c.Route}, false)
+		}
+	}
+
+	out := make([]Arrival, 0, len(best))
+	for _, a := range best {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Time != out[j].Time {
+			return out[i].Time < out[j].Time
+		}
+		return out[i].Stop < out[j].Stop
+	})
+	return out
+}
+
+// footpaths finds the stops within walking distance of a stop for
+// transfers, on demand.
+type footpaths struct {
+	stops   map[string]Stop
+	cells   map[[2]int][]Stop
+	maxDist float64
+	speed   float64
+	cache   map[string][]footpath
+}
+
+type footpath struct {
+	stop string
+	walk int // seconds
+}
+
+func newFootpaths(stops []Stop, maxDist, speed float64) *footpaths {
+	f := &footpaths{
+		stops:   make(map[string]Stop, len(stops)),
+		cells:   make(map[[2]int][]Stop),
+		maxDist: maxDist,
+		speed:   speed,
+		cache:   make(map[string][]footpath),
+	}
+	for _, s := range stops {
+		f.stops[s.ID] = s
+		c := f.cell(s.Lat, s.Lon)
+		f.cells[c] = append(f.cells[c], s)
+	}
+	return f
+}
+
+// cell is a grid square maxDist on a side (north-south).
+func (f *footpaths) cell(lat, lon float64) [2]int {
+	size := f.maxDist / 111_000
+	return [2]int{int(math.Floor(lat / size)), int(math.Floor(lon / size))}
+}
+
+func (f *footpaths) from(id string) []footpath {
+	if fp, ok := f.cache[id]; ok {
+		return fp
+	}
+	s, ok := f.stops[id]
+	if !ok {
+		return nil
+	}
+	var fp []footpath
+	c := f.cell(s.Lat, s.Lon)
+	// Cells are narrower east-west than north-south
+	reach := int(math.Ceil(1 / math.Cos(s.Lat*math.Pi/180)))
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -reach; dx <= reach; dx++ {
+			for _, n := range f.cells[[2]int{c[0] + dy, c[1] + dx}] {
+				if n.ID == id {
+					continue
+				}
+				d := geo.WalkDistance(s.Lat, s.Lon, n.Lat, n.Lon)
+				if d <= f.maxDist {
+					fp = append(fp, footpath{n.ID, int(math.Ceil(d / f.speed * 60))})
+				}
+			}
+		}
+	}
+	f.cache[id] = fp
+	return fp
+}
+
+// FormatTime converts seconds after midnight to a GTFS time, "HH:MM:SS".
+func FormatTime(secs int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+}
@@ -0,0 +1,63 @@
+package reach
+
+import "testing"
+
+func TestSearch(t *testing.T) {
+	const eight = 8 * 3600
+	stops := []Stop{
+		{"A", 44.90, -93.20},
+		{"B", 44.97, -93.26},
+		{"E", 44.9709, -93.26}, // 100 m from B
+		{"C", 45.00, -93.30},
+		{"D", 45.05, -93.30},
+		{"F", 45.10, -93.30},
+		{"G", 44.80, -93.20},
+	}
+	at := func(min, sec int) int { return eight + min*60 + sec }
+	conns := []Connection{
+		{Trip: "t5", Route: "5X", From: "A", To: "G", Dep: at(2, 0), Arr: at(4, 0), NoPickup: true},
+		{Trip: "t1", Route: "5", From: "A", To: "B", Dep: at(5, 0), Arr: at(10, 0)},
+		{Trip: "t1", Route: "5", From: "B", To: "C", Dep: at(10, 0), Arr: at(15, 0)},
+		{Trip: "t2", Route: "21", From: "C", To: "D", Dep: at(15, 30), Arr: at(25, 0)},
+		{Trip: "t3", Route: "21", From: "C", To: "D", Dep: at(17, 0), Arr: at(27, 0)},
+		{Trip: "t4", Route: "X", From: "D", To: "F", Dep: at(28, 0), Arr: at(40, 0)},
+	}
+	got := Search(stops, conns, []Access{{"A", 120}}, Options{Start: eight, Budget: 30 * 60})
+
+	want := []struct {
+		stop  string
+		time  int
+		rides int
+		route string
+	}{
+		{"A", at(2, 0), 0, ""},
+		{"B", at(10, 0), 1, "5"},
+		{"E", at(11, 38), 1, "5"},
+		{"C", at(15, 0), 1, "5"},
+		{"D", at(27, 0), 2, "21"}, // too tight a change for t2
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Search = %+v, want %d stops", got, len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Stop != w.stop || g.Time != w.time || g.Rides != w.rides || g.Route != w.route {
+			t.Errorf("arrival %d = %+v (%s), want %s at %s, %d rides on %q",
+				i, g, FormatTime(g.Time), w.stop, FormatTime(w.time), w.rides, w.route)
+		}
+	}
+}
+
+func TestSearchBudget(t *testing.T) {
+	conns := []Connection{{Trip: "t", Route: "5", From: "A", To: "B", Dep: 100, Arr: 700}}
+	got := Search([]Stop{{"A", 44.9, -93.2}, {"B", 45, -93.2}}, conns, []Access{{"A", 0}}, Options{Start: 0, Budget: 600})
+	if len(got) != 1 || got[0].Stop != "A" {
+		t.Errorf("Search = %+v, want only the origin stop", got)
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	if got := FormatTime(25*3600 + 61); got != "25:01:01" {
+		t.Errorf("FormatTime = %q", got)
+	}
+}
@@ -59,27 +59,34 @@ func (f *Fetcher) fetchAlerts(ctx context.Context) {
 
 	resp, err := f.client.Do(req)
 	if err != nil {
+		if ctx.Err() == nil {
+			f.store.alertsHealth.Record(err)
+		}
 		f.logger.Warn("fetch alerts failed", "error", err)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		f.store.alertsHealth.Record(fmt.Errorf("HTTP %d", resp.StatusCode))
 		f.logger.Warn("alerts feed returned non-200", "status", resp.StatusCode)
 		return
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
+		f.store.alertsHealth.Record(err)
 		f.logger.Error("read alerts body", "error", err)
 		return
 	}
 
 	feed := &gtfs.FeedMessage{}
 	if err := proto.Unmarshal(body, feed); err != nil {
+		f.store.alertsHealth.Record(fmt.Errorf("parse alerts: %w", err))
 		f.logger.Error("parse alerts protobuf", "error", err)
 		return
 	}
+	f.store.alertsHealth.Record(nil)
 
 	var alerts []Alert
 	for _, entity := range feed.GetEntity() {
@@ -0,0 +1,58 @@
+package realtime
+
+import (
+	"time"
+
+	gtfs "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// NewFeedMessage returns an empty full-dataset GTFS-RT feed stamped with now.
+func NewFeedMessage(now time.Time) *gtfs.FeedMessage {
+	return &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Incrementality:      gtfs.FeedHeader_FULL_DATASET.Enum(),
+			Timestamp:           proto.Uint64(uint64(now.Unix())),
+		},
+	}
+}
+
+// AlertsFeed re-encodes the stored alerts as a GTFS-RT Alerts feed.
+func (s *Store) AlertsFeed(now time.Time) *gtfs.FeedMessage {
+	feed := NewFeedMessage(now)
+	for _, a := range s.AllAlerts() {
+		alert := &gtfs.Alert{
+			HeaderText:      translated(a.HeaderText),
+			DescriptionText: translated(a.DescText),
+		}
+		if v, ok := gtfs.Alert_Cause_value[a.Cause]; ok {
+			alert.Cause = gtfs.Alert_Cause(v).Enum()
+		}
+		if v, ok := gtfs.Alert_Effect_value[a.Effect]; ok {
+			alert.Effect = gtfs.Alert_Effect(v).Enum()
+		}
+		for _, rid := range a.RouteIDs {
+			alert.InformedEntity = append(alert.InformedEntity, &gtfs.EntitySelector{RouteId: proto.String(rid)})
+		}
+		for _, sid := range a.StopIDs {
+			alert.InformedEntity = append(alert.InformedEntity, &gtfs.EntitySelector{StopId: proto.String(sid)})
+		}
+		feed.Entity = append(feed.Entity, &gtfs.FeedEntity{
+			Id:    proto.String(a.ID),
+			Alert: alert,
+		})
+	}
+	return feed
+}
+
+func translated(text string) *gtfs.TranslatedString {
+	if text == "" {
+		return nil
+	}
+	return &gtfs.TranslatedString{
+		Translation: []*gtfs.TranslatedString_Translation{
+			{Text: proto.String(text), Language: proto.String("en")},
+		},
+	}
+}
@@ -2,6 +2,8 @@ package realtime
 
 import (
 	"sync"
+
+	"gobus/internal/upstream"
 )
 
 // Alert represents a parsed service alert.
@@ -19,6 +21,8 @@ type Alert struct {
 type Store struct {
 	mu     sync.RWMutex
 	alerts []Alert
+
+	alertsHealth upstream.Health // outcome of alerts feed fetches
 }
 
 // NewStore creates an empty realtime store.
@@ -33,6 +37,11 @@ func (s *Store) SetAlerts(alerts []Alert) {
 	s.alerts = alerts
 }
 
+// AlertsHealth reports how recent fetches of the alerts feed have fared.
+func (s *Store) AlertsHealth() upstream.Status {
+	return s.alertsHealth.Snapshot()
+}
+
 // AlertsForRoute returns alerts affecting a specific route.
 func (s *Store) AlertsForRoute(routeID string) []Alert {
 	s.mu.RLock()
@@ -0,0 +1,133 @@
+// Package reliability keeps a history of when vehicles actually left
+// stops, taken from the realtime predictions riders already ask for, and
+// turns it into on-time performance, typical lateness and headway
+// regularity.
+package reliability
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gobus/internal/nextrip"
+	"gobus/internal/storage"
+)
+
+const (
+	// maxLead is how close to the predicted time a prediction must have
+	// been seen to count as the departure. Earlier ones can still change
+	// a lot, so a trip whose stop nobody looked at near the end is left
+	// out rather than recorded wrong.
+	maxLead = 5 * time.Minute
+	// settle is how far past its prediction a trip is taken to have left.
+	settle = 2 * time.Minute
+	// flushEvery is how often departed trips are saved.
+	flushEvery = time.Minute
+	// pruneEvery is how often history older than the retention is deleted.
+	pruneEvery = 24 * time.Hour
+)
+
+// Recorder follows the realtime predictions for each trip at each stop and
+// saves the last one before the trip leaves as its observed departure.
+type Recorder struct {
+	db       *storage.DB
+	keepDays int
+	logger   *slog.Logger
+	now      func() time.Time
+
+	mu        sync.Mutex
+	pending   map[tripStop]prediction
+	lastPrune time.Time
+}
+
+type tripStop struct{ stop, trip string }
+
+type prediction struct {
+	at   time.Time // predicted departure
+	seen time.Time // when the prediction was fetched
+}
+
+// NewRecorder creates a recorder that keeps keepDays days of history.
+func NewRecorder(db *storage.DB, keepDays int, logger *slog.Logger) *Recorder {
+	return &Recorder{
+		db:       db,
+		keepDays: keepDays,
+		logger:   logger,
+		now:      time.Now,
+		pending:  make(map[tripStop]prediction),
+	}
+}
+
+// Observe notes the realtime predictions in a NexTrip response for stopID.
+// It doesn't touch the database, so it is cheap enough for the request
+// path; pass it to nextrip.Client.SetObserver.
+func (r *Recorder) Observe(stopID string, resp *nextrip.Response) {
+	now := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range resp.Departures {
+		if !d.Actual || d.TripID == "" {
+			continue // scheduled times only repeat the timetable
+		}
+		r.pending[tripStop{stopID, d.TripID}] = prediction{at: time.Unix(d.DepartureTime, 0), seen: now}
+	}
+}
+
+// Run saves departed trips every minute until ctx is cancelled, then once
+// more.
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(flushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.flush(ctx)
+		case <-ctx.Done():
+			r.flush(context.WithoutCancel(ctx))
+			return
+		}
+	}
+}
+
+// departed removes the trips that have left from pending and returns the
+// ones whose last prediction was recent enough to trust.
+func (r *Recorder) departed() []storage.ObservedDeparture {
+	now := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []storage.ObservedDeparture
+	for k, p := range r.pending {
+		if now.Sub(p.at) < settle {
+			continue
+		}
+		delete(r.pending, k)
+		if p.at.Sub(p.seen) <= maxLead {
+			out = append(out, storage.ObservedDeparture{StopID: k.stop, TripID: k.trip, Departed: p.at.In(now.Location())})
+		}
+	}
+	return out
+}
+
+func (r *Recorder) flush(ctx context.Context) {
+	if obs := r.departed(); len(obs) > 0 {
+		n, err := r.db.RecordDepartures(ctx, obs)
+		if err != nil {
+			r.logger.Warn("recording departures", "error", err)
+		} else {
+			r.logger.Debug("departures recorded", "observed", len(obs), "matched", n)
+		}
+	}
+
+	now := r.now()
+	if now.Sub(r.lastPrune) < pruneEvery {
+		return
+	}
+	r.lastPrune = now
+	n, err := r.db.PruneDepartureHistory(ctx, now.AddDate(0, 0, -r.keepDays))
+	if err != nil {
+		r.logger.Warn("departure history prune", "error", err)
+	} else if n > 0 {
+		r.logger.Info("departure history pruned", "departures", n)
+	}
+}
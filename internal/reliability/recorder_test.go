@@ -0,0 +1,98 @@
+package reliability
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gobus/internal/nextrip"
+	"gobus/internal/storage"
+)
+
+func newTestRecorder(t *testing.T) (*Recorder, *storage.DB) {
+	t.Helper()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.db"), slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, q := range []string{
+		`INSERT INTO routes (route_id, route_short_name) VALUES ('21', '21')`,
+		`INSERT INTO stops (stop_id, stop_name, stop_lat, stop_lon) VALUES ('1000', 'Lake & Lyndale', 44.948, -93.288)`,
+		`INSERT INTO trips (trip_id, route_id, service_id, direction_id) VALUES ('a', '21', 'wk', 1), ('b', '21', 'wk', 1), ('owl', '21', 'wk', 0)`,
+		`INSERT INTO stop_times (trip_id, arrival_time, departure_time, stop_id, stop_sequence, arrival_secs, departure_secs) VALUES
+			('a', '08:00:00', '08:00:00', '1000', 1, 28800, 28800),
+			('b', '08:10:00', '08:10:00', '1000', 1, 29400, 29400),
+			('owl', '24:30:00', '24:30:00', '1000', 1, 88200, 88200)`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	return NewRecorder(db, 90, slog.New(slog.DiscardHandler)), db
+}
+
+func TestRecorder(t *testing.T) {
+	r, db := newTestRecorder(t)
+	ctx := context.Background()
+	at := func(h, m int) time.Time { return time.Date(2026, 10, 12, h, m, 0, 0, time.Local) }
+	now := at(7, 50)
+	r.now = func() time.Time { return now }
+	resp := func(deps ...nextrip.Departure) *nextrip.Response { return &nextrip.Response{Departures: deps} }
+
+	// a is predicted 8:04 at first, then 8:03 just before it leaves. b is
+	// only seen 20 minutes early, and c is a timetable time.
+	r.Observe("1000", resp(
+		nextrip.Departure{Actual: true, TripID: "a", DepartureTime: at(8, 4).Unix()},
+		nextrip.Departure{Actual: true, TripID: "b", DepartureTime: at(8, 12).Unix()},
+		nextrip.Departure{Actual: false, TripID: "c", DepartureTime: at(8, 20).Unix()},
+	))
+	now = at(8, 1)
+	r.Observe("1000", resp(nextrip.Departure{Actual: true, TripID: "a", DepartureTime: at(8, 3).Unix()}))
+
+	now = at(8, 6)
+	r.flush(ctx)
+	if len(r.pending) != 1 {
+		t.Errorf("pending after a left = %d trips, want b still waiting", len(r.pending))
+	}
+	now = at(8, 20)
+	r.flush(ctx)
+	if len(r.pending) != 0 {
+		t.Errorf("pending = %v, want none", r.pending)
+	}
+
+	rows, err := db.DepartureHistory(ctx, "1000", at(0, 0).AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("history = %+v, want only trip a (b's prediction was too early to trust)", rows)
+	}
+	if r := rows[0]; r.TripID != "a" || r.Delay != 180 || r.ServiceDate != "20261012" || r.DirectionID != 1 || r.RouteShort != "21" {
+		t.Errorf("history row = %+v, want trip a 3 min late", r)
+	}
+}
+
+func TestRecordDeparturesPastMidnight(t *testing.T) {
+	_, db := newTestRecorder(t)
+	ctx := context.Background()
+	left := time.Date(2026, 10, 13, 0, 29, 0, 0, time.Local) // the owl trip, a minute early
+	n, err := db.RecordDepartures(ctx, []storage.ObservedDeparture{
+		{StopID: "1000", TripID: "owl", Departed: left},
+		{StopID: "1000", TripID: "unknown", Departed: left},
+		{StopID: "1000", TripID: "a", Departed: left}, // 8:00 is over two hours away
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("RecordDepartures = %d, %v; want 1 recorded", n, err)
+	}
+	rows, _ := db.DepartureHistory(ctx, "1000", left.AddDate(0, 0, -2))
+	if len(rows) != 1 || rows[0].ServiceDate != "20261012" || rows[0].Delay != -60 {
+		t.Errorf("history = %+v, want the owl on the 12th's service, 60 s early", rows)
+	}
+
+	if n, err := db.PruneDepartureHistory(ctx, left); err != nil || n != 1 {
+		t.Errorf("PruneDepartureHistory = %d, %v; want 1", n, err)
+	}
+}
@@ -0,0 +1,130 @@
+package reliability
+
+import (
+	"fmt"
+	"math"
+
+	"gobus/internal/storage"
+)
+
+const (
+	// A departure is on time from 1 minute early to 5 minutes late, the
+	// window Metro Transit reports against.
+	earliestOnTime = -60
+	latestOnTime   = 5 * 60
+	// MinSamples is the fewest departures that say anything about what a
+	// route usually does; with fewer, stats are left out.
+	MinSamples = 5
+	// maxRegularHeadway is the longest scheduled gap that counts toward
+	// regularity. On less frequent routes riders go by the timetable, not
+	// by how evenly buses come.
+	maxRegularHeadway = 30 * 60
+)
+
+// Group is the history of one route and direction at a stop.
+type Group struct {
+	RouteID     string
+	RouteShort  string
+	DirectionID int
+	Rows        []storage.DepartureHistoryRow
+}
+
+// GroupRows splits history rows, ordered as storage.DepartureHistory
+// returns them, by route and direction.
+func GroupRows(rows []storage.DepartureHistoryRow) []Group {
+	var groups []Group
+	for _, r := range rows {
+		if n := len(groups); n == 0 || groups[n-1].RouteID != r.RouteID || groups[n-1].DirectionID != r.DirectionID {
+			groups = append(groups, Group{RouteID: r.RouteID, RouteShort: r.RouteShort, DirectionID: r.DirectionID})
+		}
+		g := &groups[len(groups)-1]
+		g.Rows = append(g.Rows, r)
+	}
+	return groups
+}
+
+// Summary is how well a route keeps to its schedule at a stop.
+type Summary struct {
+	Departures int
+	OnTime     float64 // fraction of departures on time
+	AvgDelay   float64 // seconds late on average; negative when early
+	// Regularity is 1 when vehicles leave exactly as far apart as
+	// scheduled, falling toward 0 as they bunch and gap. HasRegularity is
+	// false on infrequent routes, or without back-to-back observations.
+	Regularity    float64
+	HasRegularity bool
+}
+
+// Summarize works out the summary of history rows ordered by service day
+// and scheduled time, as storage.DepartureHistory returns them per route.
+func Summarize(rows []storage.DepartureHistoryRow) Summary {
+	s := Summary{Departures: len(rows)}
+	if len(rows) == 0 {
+		return s
+	}
+	onTime, total := 0, 0
+	for _, r := range rows {
+		if r.Delay >= earliestOnTime && r.Delay <= latestOnTime {
+			onTime++
+		}
+		total += r.Delay
+	}
+	s.OnTime = float64(onTime) / float64(len(rows))
+	s.AvgDelay = float64(total) / float64(len(rows))
+	s.Regularity, s.HasRegularity = regularity(rows)
+	return s
+}
+
+// regularity compares the gaps between consecutive departures on the same
+// day with the scheduled gaps: one minus the average difference as a
+// fraction of the average scheduled gap.
+func regularity(rows []storage.DepartureHistoryRow) (float64, bool) {
+	var diff, sched float64
+	n := 0
+	for i := 1; i < len(rows); i++ {
+		a, b := rows[i-1], rows[i]
+		planned := b.Scheduled - a.Scheduled
+		if a.ServiceDate != b.ServiceDate || planned <= 0 || planned > maxRegularHeadway {
+			continue
+		}
+		actual := planned + b.Delay - a.Delay
+		diff += math.Abs(float64(actual - planned))
+		sched += float64(planned)
+		n++
+	}
+	if n < MinSamples {
+		return 0, false
+	}
+	return max(0, 1-diff/sched), true
+}
+
+// TypicalDelay returns the average delay in seconds of departures
+// scheduled in hour of the day (0–23). ok is false with fewer than
+// MinSamples of them.
+func TypicalDelay(rows []storage.DepartureHistoryRow, hour int) (delay int, ok bool) {
+	total, n := 0, 0
+	for _, r := range rows {
+		if r.Scheduled/3600%24 == hour {
+			total += r.Delay
+			n++
+		}
+	}
+	if n < MinSamples {
+		return 0, false
+	}
+	return int(math.Round(float64(total) / float64(n))), true
+}
+
+// UsuallyText describes a typical delay in seconds for a rider, e.g.
+// "usually 4 min late at this time".
+func UsuallyText(delay int) string {
+	m := int(math.Round(float64(delay) / 60))
+	switch {
+	case m > 0:
+		return fmt.Sprintf("usually %d min late at this time", m)
+	case m < 0:
+		return fmt.Sprintf("usually %d min early at this time", -m)
+	default:
+		return "usually on time at this time"
+	}
+}
@@ -0,0 +1,100 @@
+package reliability
+
+import (
+	"math"
+	"testing"
+
+	"gobus/internal/storage"
+)
+
+// day builds a day's history of a route leaving every 10 minutes from
+// 8:00, with the given delays in seconds.
+func day(date string, delays ...int) []storage.DepartureHistoryRow {
+	var rows []storage.DepartureHistoryRow
+	for i, d := range delays {
+		rows = append(rows, storage.DepartureHistoryRow{
+			RouteID: "21", ServiceDate: date, Scheduled: 8*3600 + i*600, Delay: d,
+		})
+	}
+	return rows
+}
+
+func TestSummarize(t *testing.T) {
+	rows := append(day("20261012", 0, 60, 120, 400, -90, 30), day("20261013", 0, 0, 0)...)
+	s := Summarize(rows)
+	if s.Departures != 9 {
+		t.Errorf("Departures = %d, want 9", s.Departures)
+	}
+	if math.Abs(s.OnTime-7.0/9) > 1e-9 {
+		t.Errorf("OnTime = %.3f, want 7/9 (one 6+ min late, one 1.5 min early)", s.OnTime)
+	}
+	if math.Abs(s.AvgDelay-520.0/9) > 1e-9 {
+		t.Errorf("AvgDelay = %.1f, want %.1f", s.AvgDelay, 520.0/9)
+	}
+	// Gaps differ from 10 min by 60, 60, 280, 490, 120 s, then 0 and 0
+	want := 1 - (60+60+280+490+120)/(7*600.0)
+	if !s.HasRegularity || math.Abs(s.Regularity-want) > 1e-9 {
+		t.Errorf("Regularity = %.3f (%v), want %.3f", s.Regularity, s.HasRegularity, want)
+	}
+
+	if s := Summarize(day("20261012", 0, 0, 0)); s.HasRegularity {
+		t.Error("Regularity from two gaps, want too few")
+	}
+	hourly := day("20261012", 0, 0, 0, 0, 0, 0, 0)
+	for i := range hourly {
+		hourly[i].Scheduled = 8*3600 + i*3600
+	}
+	if s := Summarize(hourly); s.HasRegularity {
+		t.Error("Regularity for an hourly route, want none")
+	}
+	if s := Summarize(nil); s.Departures != 0 || s.HasRegularity {
+		t.Errorf("Summarize(nil) = %+v", s)
+	}
+}
+
+func TestTypicalDelay(t *testing.T) {
+	rows := day("20261012", 240, 300, 180, 240, 240, 0) // 8:00–8:50
+	late := day("20261013", 60)
+	late[0].Scheduled = 25*3600 + 600 // 1:10 AM, past midnight
+	rows = append(rows, late...)
+
+	if d, ok := TypicalDelay(rows, 8); !ok || d != 200 {
+		t.Errorf("TypicalDelay(8) = %d, %v; want 200", d, ok)
+	}
+	if _, ok := TypicalDelay(rows, 1); ok {
+		t.Error("TypicalDelay(1) from one departure, want too few")
+	}
+	if _, ok := TypicalDelay(rows, 9); ok {
+		t.Error("TypicalDelay(9) with no departures, want none")
+	}
+}
+
+func TestUsuallyText(t *testing.T) {
+	tests := []struct {
+		delay int
+		want  string
+	}{
+		{240, "usually 4 min late at this time"},
+		{200, "usually 3 min late at this time"},
+		{20, "usually on time at this time"},
+		{-29, "usually on time at this time"},
+		{-120, "usually 2 min early at this time"},
+	}
+	for _, tt := range tests {
+		if got := UsuallyText(tt.delay); got != tt.want {
+			t.Errorf("UsuallyText(%d) = %q, want %q", tt.delay, got, tt.want)
+		}
+	}
+}
+
+func TestGroupRows(t *testing.T) {
+	rows := []storage.DepartureHistoryRow{
+		{RouteID: "21", DirectionID: 0}, {RouteID: "21", DirectionID: 0},
+		{RouteID: "21", DirectionID: 1},
+		{RouteID: "5", DirectionID: 0},
+	}
+	groups := GroupRows(rows)
+	if len(groups) != 3 || len(groups[0].Rows) != 2 || groups[1].DirectionID != 1 || groups[2].RouteID != "5" {
+		t.Errorf("GroupRows = %+v", groups)
+	}
+}
@@ -0,0 +1,184 @@
+// Package search normalizes place names for matching. Stop names at import
+// time and what people type at query time go through the same Terms, so
+// "Lake St & Lyndale Ave S" and "lake street and lyndale" agree.
+package search
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// canonical folds street types, directions and common abbreviations to one
+// form. The short form wins so "St" can stand for both Street and Saint.
+var canonical = map[string]string{
+	"street": "st", "str": "st", "saint": "st",
+	"avenue": "ave", "av": "ave", "avn": "ave",
+	"boulevard": "blvd", "blv": "blvd",
+	"road":    "rd",
+	"drive":   "dr",
+	"parkway": "pkwy", "pky": "pkwy",
+	"highway": "hwy",
+	"lane":    "ln",
+	"place":   "pl",
+	"court":   "ct",
+	"circle":  "cir",
+	"terrace": "ter", "terr": "ter",
+	"square":     "sq",
+	"trail":      "trl",
+	"freeway":    "fwy",
+	"expressway": "expy",
+	"center":     "ctr", "centre": "ctr",
+	"station": "sta", "stn": "sta",
+	"mount":      "mt",
+	"fort":       "ft",
+	"university": "univ",
+	"hospital":   "hosp",
+	"junction":   "jct",
+	"heights":    "hts",
+	"plaza":      "plz",
+	"north":      "n", "south": "s", "east": "e", "west": "w",
+	"northeast": "ne", "northwest": "nw", "southeast": "se", "southwest": "sw",
+}
+
+// stopWords join the parts of a cross-street query and carry no meaning.
+var stopWords = map[string]bool{
+	"and": true, "at": true, "near": true, "the": true, "of": true, "between": true,
+}
+
+var ordinalUnits = map[string]int{
+	"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5,
+	"sixth": 6, "seventh": 7, "eighth": 8, "ninth": 9, "tenth": 10,
+	"eleventh": 11, "twelfth": 12, "thirteenth": 13, "fourteenth": 14, "fifteenth": 15,
+	"sixteenth": 16, "seventeenth": 17, "eighteenth": 18, "nineteenth": 19,
+	"twentieth": 20, "thirtieth": 30, "fortieth": 40, "fiftieth": 50,
+	"sixtieth": 60, "seventieth": 70, "eightieth": 80, "ninetieth": 90,
+}
+
+var tens = map[string]int{
+	"twenty": 20, "thirty": 30, "forty": 40, "fifty": 50,
+	"sixty": 60, "seventy": 70, "eighty": 80, "ninety": 90,
+}
+
+// Terms splits s into normalized search terms: lower case, punctuation
+// removed, abbreviations folded ("Avenue" → "ave"), spelled-out ordinals
+// turned into numbers ("Twenty-Fourth" → "24th"), and connecting words
+// like "and" or "at" dropped.
+func Terms(s string) []string {
+	s = strings.NewReplacer("'", "", "’", "", ".", "").Replace(strings.ToLower(s))
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var terms []string
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if stopWords[w] {
+			continue
+		}
+		if t, ok := tens[w]; ok && i+1 < len(words) {
+			if u, ok := ordinalUnits[words[i+1]]; ok && u < 10 {
+				terms = append(terms, ordinal(t+u))
+				i++
+				continue
+			}
+		}
+		if n, ok := ordinalUnits[w]; ok {
+			w = ordinal(n)
+		} else if c, ok := canonical[w]; ok {
+			w = c
+		}
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+// Normalize returns the Terms of s joined by spaces.
+func Normalize(s string) string {
+	return strings.Join(Terms(s), " ")
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// MaxEdits is how many typos a term may contain and still match another:
+// none for short terms, where one edit turns a word into a different one.
+func MaxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 7:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Distance returns the number of single-letter insertions, deletions,
+// substitutions and adjacent swaps that turn a into b.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// Three rolling rows: the swap case looks two back
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+// Closest returns up to limit terms from vocab within MaxEdits of term,
+// nearest first.
+func Closest(term string, vocab []string, limit int) []string {
+	maxEdits := MaxEdits(term)
+	if maxEdits == 0 {
+		return nil
+	}
+	type match struct {
+		term string
+		dist int
+	}
+	var matches []match
+	for _, v := range vocab {
+		if d := len([]rune(v)) - len([]rune(term)); d > maxEdits || -d > maxEdits {
+			continue
+		}
+		if d := Distance(term, v); d <= maxEdits {
+			matches = append(matches, match{v, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].dist < matches[j].dist })
+	var out []string
+	for i := 0; i < len(matches) && i < limit; i++ {
+		out = append(out, matches[i].term)
+	}
+	return out
+}
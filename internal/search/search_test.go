@@ -0,0 +1,67 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Lake St & Lyndale Ave S", "lake st lyndale ave s"},
+		{"lake street and lyndale avenue south", "lake st lyndale ave s"},
+		{"Hennepin Ave & Fourth St", "hennepin ave 4th st"},
+		{"Twenty-Fourth St W at Nicollet", "24th st w nicollet"},
+		{"Saint Paul's Church", "st pauls church"},
+		{"St. Anthony Pkwy", "st anthony pkwy"},
+		{"Mall of America Station", "mall america sta"},
+		{"twenty fourth", "24th"},
+		{"Eleventh Ave N", "11th ave n"},
+		{"Twenty-First", "21st"},
+		{"  ", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"lyndale", "lyndale", 0},
+		{"lyndal", "lyndale", 1},
+		{"lydnale", "lyndale", 1}, // adjacent swap
+		{"lindail", "lyndale", 3},
+		{"", "abc", 3},
+	}
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestClosest(t *testing.T) {
+	vocab := []string{"lake", "lyndale", "lynnhurst", "hennepin", "nicollet", "st"}
+	tests := []struct {
+		term string
+		want []string
+	}{
+		{"lyndle", []string{"lyndale"}},
+		{"henepin", []string{"hennepin"}},
+		{"nicolet", []string{"nicollet"}},
+		{"lak", nil},   // too short to correct
+		{"xyzzy", nil}, // nothing close
+	}
+	for _, tt := range tests {
+		if got := Closest(tt.term, vocab, 3); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Closest(%q) = %v, want %v", tt.term, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"gobus/internal/metrics"
+)
+
+var requestDuration = metrics.NewHistogram("gobus_http_request_duration_seconds",
+	"Time taken to serve HTTP requests, by route pattern and status code.", metrics.DefBuckets, "route", "code")
+
+// instrument records request latency by the mux pattern that matched (e.g.
+// "GET /stops/{id}"), so paths with IDs don't each get their own series.
+// SSE streams are left out; gobus_sse_connections counts them.
+func instrument(next http.Handler, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == "text/event-stream" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: 200}
+		next.ServeHTTP(sw, r)
+		requestDuration.ObserveSince(start, route, strconv.Itoa(sw.status))
+	})
+}
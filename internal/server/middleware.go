@@ -5,13 +5,15 @@ import (
 	"net/http"
 	"strings"
 	"time"
-
-	"gobus/internal/handler"
-	"gobus/internal/storage"
 )
 
-func withMiddleware(h http.Handler, logger *slog.Logger, cookieSecret []byte, db *storage.DB, ready <-chan struct{}) http.Handler {
-	return securityHeaders(requestLogger(waitForData(requireAuth(h, cookieSecret, db), ready), logger))
+func withMiddleware(mux *http.ServeMux, logger *slog.Logger, auth authenticator, ready <-chan struct{}) http.Handler {
+	return securityHeaders(requestLogger(instrument(waitForData(requireAuth(mux, auth, logger), ready), mux), logger))
+}
+
+// authenticator resolves the session cookie; *handler.Handler implements it.
+type authenticator interface {
+	Authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, int64, error)
 }
 
 // waitForData shows a loading page while GTFS data is being downloaded.
@@ -30,11 +32,21 @@ func waitForData(next http.Handler, ready <-chan struct{}) http.Handler {
 		p := r.URL.Path
 		if strings.HasPrefix(p, "/static/") || p == "/sw.js" ||
 			p == "/manifest.json" || p == "/offline" ||
-			p == "/login" || p == "/register" {
+			p == "/login" || p == "/register" || isProbe(p) ||
+			strings.HasPrefix(p, "/login/passkey/") {
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		// API clients get a machine-readable 503 instead of the loading page
+		if strings.HasPrefix(p, "/api/v1/") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"transit data is still loading"}` + "\n"))
+			return
+		}
+
 		// Show loading page
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.Header().Set("Retry-After", "5")
@@ -89,46 +101,69 @@ const loadingPage = `<!DOCTYPE html>
 </body>
 </html>`
 
+// isProbe reports whether p is polled by monitoring (Prometheus, the
+// orchestrator, uptime checks). Probes skip auth, the loading page and the
+// request log.
+func isProbe(p string) bool {
+	return p == "/metrics" || p == "/healthz" || p == "/readyz"
+}
+
 // requireAuth redirects unauthenticated requests to /login.
 // Public paths are whitelisted and pass through without auth.
-// On authenticated requests, updates the device session last_seen time.
-func requireAuth(next http.Handler, secret []byte, db *storage.DB) http.Handler {
+// Sessions are checked against the server-side session store on every
+// request, so a revoked session or signed-out device is rejected at once.
+func requireAuth(next http.Handler, auth authenticator, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		p := r.URL.Path
 
 		// Public paths — no auth required
 		if p == "/login" || p == "/register" || p == "/offline" ||
-			p == "/sw.js" || p == "/manifest.json" ||
-			strings.HasPrefix(p, "/static/") {
+			p == "/sw.js" || p == "/manifest.json" || isProbe(p) ||
+			strings.HasPrefix(p, "/static/") || strings.HasPrefix(p, "/login/passkey/") {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Check session cookie
-		cookie, err := r.Cookie("gobus_session")
+		// The JSON API authenticates with bearer tokens in the handler
+		if strings.HasPrefix(p, "/api/v1/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r, userID, err := auth.Authenticate(w, r)
 		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			logger.Error("resolving session", "error", err)
+			http.Error(w, "Something went wrong. Please try again.", http.StatusInternalServerError)
 			return
 		}
-		userID := handler.VerifyCookie(cookie.Value, secret)
 		if userID == 0 {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			signOut(w, r)
 			return
 		}
 
-		// Update device session last_seen (best-effort, don't block on error)
-		if deviceCookie, err := r.Cookie("gobus_device"); err == nil && deviceCookie.Value != "" {
-			db.UpsertDeviceSession(r.Context(), int64(userID), deviceCookie.Value)
-		}
-
 		next.ServeHTTP(w, r)
 	})
 }
 
+// signOut clears a session cookie that is no longer valid and sends the
+// browser to the login page.
+func signOut(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "gobus_session",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
 func requestLogger(next http.Handler, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Skip logging for SSE connections (they're long-lived)
-		if r.Header.Get("Accept") == "text/event-stream" {
+		// Skip logging for SSE connections (they're long-lived) and for
+		// scrapes and probes, which would log every few seconds
+		if r.Header.Get("Accept") == "text/event-stream" || isProbe(r.URL.Path) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -1,9 +1,13 @@
 package server
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"gobus/internal/handler"
+	"gobus/internal/metrics"
 )
 
 var testSecret = []byte("test-secret-32-bytes-long-xxxxx!")
@@ -63,3 +67,40 @@ func TestVerifyCookie_Malformed(t *testing.T) {
 		})
 	}
 }
+
+func TestInstrumentLabelsByRoutePattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stops/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := instrument(mux, mux)
+	for _, path := range []string{"/stops/1", "/stops/2", "/nowhere"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	var sb strings.Builder
+	metrics.Default.Write(&sb)
+	out := sb.String()
+	for _, want := range []string{
+		`gobus_http_request_duration_seconds_count{route="GET /stops/{id}",code="418"} 2`,
+		`gobus_http_request_duration_seconds_count{route="unmatched",code="404"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestProbesSkipAuthAndLoadingPage(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	notReady := make(chan struct{})
+	// A nil authenticator would panic if requireAuth consulted it
+	h := waitForData(requireAuth(ok, nil, nil), notReady)
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", path, w.Code)
+		}
+	}
+}
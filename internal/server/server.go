@@ -2,35 +2,44 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"gobus/internal/config"
+	"gobus/internal/geo"
 	"gobus/internal/geocode"
+	"gobus/internal/gtfs"
 	"gobus/internal/handler"
 	"gobus/internal/nextrip"
 	"gobus/internal/realtime"
 	"gobus/internal/storage"
+	"gobus/internal/walk"
 	"gobus/web"
 )
 
 // Server is the HTTP server for GoBus.
 type Server struct {
-	mux          *http.ServeMux
-	cfg          *config.Config
-	logger       *slog.Logger
-	db           *storage.DB
-	cookieSecret []byte
-	ready        chan struct{} // closed when GTFS data is available
+	mux     *http.ServeMux
+	cfg     *config.Config
+	logger  *slog.Logger
+	db      *storage.DB
+	handler *handler.Handler
+	ready   chan struct{} // closed when GTFS data is available
+	http    *http.Server
 }
 
 // New creates a new Server with all routes registered.
 func New(cfg *config.Config, db *storage.DB, nt *nextrip.Client, rt *realtime.Store, logger *slog.Logger) *Server {
 	mux := http.NewServeMux()
-	geo := geocode.New("GoBus/1.0 (transit PWA)")
-	h := handler.New(db, nt, rt, geo, cfg, logger)
+	geocoder := newGeocoder(cfg, db, logger)
+	h := handler.New(db, nt, rt, geocoder, cfg, logger)
+	if g := loadWalkGraph(cfg, logger); g != nil {
+		h.SetWalkGraph(g)
+	}
 
 	ready := make(chan struct{})
 	// If data already exists, mark ready immediately
@@ -38,7 +47,7 @@ func New(cfg *config.Config, db *storage.DB, nt *nextrip.Client, rt *realtime.St
 		close(ready)
 	}
 
-	s := &Server{mux: mux, cfg: cfg, logger: logger, db: db, cookieSecret: h.CookieSecret(), ready: ready}
+	s := &Server{mux: mux, cfg: cfg, logger: logger, db: db, handler: h, ready: ready}
 
 	// Static files — served from embedded FS, versioned URLs get immutable caching
 	staticFS, _ := fs.Sub(web.StaticFiles, "static")
@@ -51,6 +60,8 @@ func New(cfg *config.Config, db *storage.DB, nt *nextrip.Client, rt *realtime.St
 	mux.HandleFunc("GET /register", h.Register)
 	mux.HandleFunc("POST /register", h.Register)
 	mux.HandleFunc("POST /logout", h.Logout)
+	mux.HandleFunc("POST /login/passkey/begin", h.PasskeyLoginBegin)
+	mux.HandleFunc("POST /login/passkey/finish", h.PasskeyLoginFinish)
 
 	// Pages
 	mux.HandleFunc("GET /", h.Home)
@@ -58,20 +69,97 @@ func New(cfg *config.Config, db *storage.DB, nt *nextrip.Client, rt *realtime.St
 	mux.HandleFunc("GET /search", h.Search)
 	mux.HandleFunc("GET /routes", h.RouteList)
 	mux.HandleFunc("GET /routes/{id}", h.RouteDetail)
+	mux.HandleFunc("GET /routes/{id}/shape.geojson", h.RouteShape)
 	mux.HandleFunc("GET /stops/{id}", h.StopDetail)
 	mux.HandleFunc("GET /stops/{stopID}/route/{routeID}", h.LaterArrivals)
+	mux.HandleFunc("GET /stations/{id}", h.StationDetail)
+	mux.HandleFunc("GET /stations/{id}/departures", h.StationDepartures)
+	mux.HandleFunc("GET /reach", h.Reach)
+	mux.HandleFunc("GET /reach.geojson", h.ReachGeoJSON)
 
 	// API
 	mux.HandleFunc("GET /api/location-label", h.LocationLabel)
+	mux.HandleFunc("GET /api/search/suggest", h.SearchSuggest)
+	mux.HandleFunc("GET /api/saved-places", h.SavedPlaces)
+	mux.HandleFunc("POST /api/saved-places", h.AddSavedPlace)
+	mux.HandleFunc("POST /api/saved-places/import", h.ImportSavedPlaces)
+	mux.HandleFunc("DELETE /api/saved-places/{stopID}", h.DeleteSavedPlace)
+	mux.HandleFunc("POST /favorites", h.ToggleFavorite)
+
+	// Public JSON API (bearer token auth, see /account/tokens)
+	mux.HandleFunc("GET /api/v1/openapi.json", h.OpenAPI)
+	mux.HandleFunc("GET /api/v1/nearby", h.RequireAPIToken(h.APINearby))
+	mux.HandleFunc("GET /api/v1/stops/{id}", h.RequireAPIToken(h.APIStop))
+	mux.HandleFunc("GET /api/v1/stops/{id}/departures", h.RequireAPIToken(h.APIStopDepartures))
+	mux.HandleFunc("GET /api/v1/routes", h.RequireAPIToken(h.APIRoutes))
+	mux.HandleFunc("GET /api/v1/routes/{id}/stops", h.RequireAPIToken(h.APIRouteStops))
+	mux.HandleFunc("GET /api/v1/alerts", h.RequireAPIToken(h.APIAlerts))
+	mux.HandleFunc("GET /api/v1/search", h.RequireAPIToken(h.APISearch))
+	mux.HandleFunc("GET /api/v1/walk", h.RequireAPIToken(h.APIWalk))
+
+	// GTFS-RT re-publication of the merged feed (.json variants for debugging)
+	mux.HandleFunc("GET /api/v1/gtfs-rt/trip-updates.pb", h.RequireFeedToken(h.GTFSRTTripUpdates))
+	mux.HandleFunc("GET /api/v1/gtfs-rt/trip-updates.json", h.RequireFeedToken(h.GTFSRTTripUpdates))
+	mux.HandleFunc("GET /api/v1/gtfs-rt/alerts.pb", h.RequireFeedToken(h.GTFSRTAlerts))
+	mux.HandleFunc("GET /api/v1/gtfs-rt/alerts.json", h.RequireFeedToken(h.GTFSRTAlerts))
+
+	// Account
+	mux.HandleFunc("GET /account", h.Account)
+	mux.HandleFunc("POST /account/devices/{id}/revoke", h.RevokeDevice)
+	mux.HandleFunc("POST /account/devices/{id}/rename", h.RenameDevice)
+	mux.HandleFunc("POST /account/accessibility", h.SetAccessibility)
+	mux.HandleFunc("POST /account/walk-speed", h.SetWalkSpeed)
+	mux.HandleFunc("POST /account/passphrase", h.ChangePassphrase)
+	mux.HandleFunc("POST /account/delete", h.DeleteAccount)
+	mux.HandleFunc("POST /account/logout-everywhere", h.LogoutEverywhere)
+	mux.HandleFunc("GET /account/tokens", h.APITokens)
+	mux.HandleFunc("POST /account/tokens", h.APITokens)
+	mux.HandleFunc("POST /account/tokens/{id}/revoke", h.RevokeAPIToken)
+	mux.HandleFunc("GET /account/passkeys", h.Passkeys)
+	mux.HandleFunc("POST /account/passkeys/begin", h.PasskeyRegisterBegin)
+	mux.HandleFunc("POST /account/passkeys/finish", h.PasskeyRegisterFinish)
+	mux.HandleFunc("POST /account/passkeys/{id}/delete", h.DeletePasskey)
+
+	// Admin console (admin role or GOBUS_ADMIN_USERS)
+	mux.HandleFunc("GET /admin", h.RequireAdmin(h.Admin))
+	mux.HandleFunc("POST /admin/feed/check", h.RequireAdmin(h.AdminFeedCheck))
+	mux.HandleFunc("POST /admin/feed/reimport", h.RequireAdmin(h.AdminFeedReimport))
+	mux.HandleFunc("GET /admin/users", h.RequireAdmin(h.AdminUsers))
+	mux.HandleFunc("POST /admin/users/{id}/{action}", h.RequireAdmin(h.AdminUserAction))
+	mux.HandleFunc("GET /admin/invites", h.RequireAdmin(h.AdminInvites))
+	mux.HandleFunc("POST /admin/invites", h.RequireAdmin(h.AdminCreateInvite))
+	mux.HandleFunc("POST /admin/invites/{id}/revoke", h.RequireAdmin(h.AdminRevokeInvite))
+	mux.HandleFunc("GET /admin/security", h.RequireAdmin(h.AdminSecurity))
+	mux.HandleFunc("POST /admin/security/unlock", h.RequireAdmin(h.AdminUnlock))
+
+	// Web Push reminders
+	mux.HandleFunc("GET /push/key", h.PushPublicKey)
+	mux.HandleFunc("POST /push/subscribe", h.PushSubscribe)
+	mux.HandleFunc("POST /push/unsubscribe", h.PushUnsubscribe)
+	mux.HandleFunc("POST /stops/{id}/reminders", h.CreateReminder)
+	mux.HandleFunc("POST /reminders/{id}/delete", h.DeleteReminder)
 
 	// SSE
 	mux.HandleFunc("GET /sse/departures/{id}", h.SSEDepartures)
 
+	// Monitoring: Prometheus scrape target (GOBUS_METRICS_TOKEN to require
+	// a token), liveness and readiness probes
+	mux.HandleFunc("GET /metrics", h.Metrics)
+	mux.HandleFunc("GET /healthz", h.Healthz)
+	mux.HandleFunc("GET /readyz", h.Readyz)
+
 	// PWA
 	mux.HandleFunc("GET /manifest.json", h.Manifest)
 	mux.HandleFunc("GET /sw.js", h.ServiceWorker)
 	mux.HandleFunc("GET /offline", h.Offline)
 
+	s.http = &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Port),
+		Handler: withMiddleware(mux, logger, h, ready),
+	}
+	// Shutdown waits for requests to finish, and SSE streams never do
+	s.http.RegisterOnShutdown(h.CloseStreams)
+
 	return s
 }
 
@@ -85,9 +173,86 @@ func (s *Server) SetReady() {
 	}
 }
 
-// ListenAndServe starts the HTTP server.
+// SetScheduler connects the GTFS scheduler to the admin console.
+func (s *Server) SetScheduler(sched *gtfs.Scheduler) {
+	s.handler.SetScheduler(sched)
+}
+
+// RunReminders runs the arrival reminder scheduler until ctx is cancelled.
+func (s *Server) RunReminders(ctx context.Context) {
+	s.handler.RunReminders(ctx)
+}
+
+// RunChallengeSweep drops expired passkey challenges until ctx is cancelled.
+func (s *Server) RunChallengeSweep(ctx context.Context) {
+	s.handler.RunChallengeSweep(ctx)
+}
+
+// Reload applies the reloadable settings of cfg (see config.Config.Reload)
+// to requests from now on.
+func (s *Server) Reload(cfg *config.Config) {
+	s.handler.Reload(cfg)
+}
+
+// ListenAndServe starts the HTTP server. It returns nil once Shutdown has
+// been called.
 func (s *Server) ListenAndServe() error {
-	addr := fmt.Sprintf(":%d", s.cfg.Port)
-	s.logger.Info("server starting", "addr", addr)
-	return http.ListenAndServe(addr, withMiddleware(s.mux, s.logger, s.cookieSecret, s.db, s.ready))
+	s.logger.Info("server starting", "addr", s.http.Addr)
+	if err := s.http.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections, tells SSE clients to reconnect
+// elsewhere, and waits for in-flight requests to finish or ctx to expire.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.Info("draining HTTP connections")
+	return s.http.Shutdown(ctx)
+}
+
+// loadWalkGraph loads the street network imported with --import-osm, or
+// returns nil if there isn't one.
+func loadWalkGraph(cfg *config.Config, logger *slog.Logger) *walk.Graph {
+	g, err := walk.LoadFile(cfg.WalkGraph)
+	if errors.Is(err, fs.ErrNotExist) {
+		logger.Info("no walking network, estimating walks from straight lines; build one with --import-osm", "path", cfg.WalkGraph)
+		return nil
+	}
+	if err != nil {
+		logger.Error("loading walking network", "path", cfg.WalkGraph, "error", err)
+		return nil
+	}
+	logger.Info("walking network loaded", "vertices", g.Vertices(), "edges", g.Edges())
+	return g
+}
+
+// newGeocoder sets up address search as configured, kept within the
+// loaded feed's stops so the same binary works in any region. Remote
+// geocoders are cached and rate limited.
+func newGeocoder(cfg *config.Config, db *storage.DB, logger *slog.Logger) geocode.Geocoder {
+	bounds := func(ctx context.Context) (geo.Bounds, bool) {
+		b, ok, err := db.StopBounds(ctx)
+		if err != nil {
+			logger.Warn("feed bounds for geocoding", "error", err)
+		}
+		return b, ok
+	}
+	g, err := geocode.New(cfg.Geocoder, cfg.GeocodeURL, "GoBus/1.0 (transit PWA)", db, bounds)
+	if err != nil {
+		// config.Load rejects unknown geocoders, so this is a bug
+		logger.Error("geocoder", "error", err)
+		g, _ = geocode.New("none", "", "", db, nil)
+	}
+	if geocode.Remote(cfg.Geocoder) {
+		ttl := time.Duration(cfg.GeocodeCacheDays) * 24 * time.Hour
+		g = geocode.NewCached(g, db, geocode.NewLimiter(cfg.GeocodeRatePerMin), ttl, logger)
+	}
+	if cfg.Geocoder == "gazetteer" {
+		if n, err := db.AddressCount(context.Background()); err == nil && n == 0 {
+			logger.Warn("address gazetteer is empty, load one with --import-addresses")
+		}
+	}
+	logger.Info("geocoder configured", "geocoder", cfg.Geocoder)
+	return g
 }
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// DeviceRow is a device signed in to a user's account.
+type DeviceRow struct {
+	ID        int64 // rowid; the device ID itself stays in the cookie
+	DeviceID  string
+	Name      string
+	UserAgent string
+	LastSeen  string
+}
+
+// ListDevices returns a user's signed-in devices, most recently seen first.
+func (db *DB) ListDevices(ctx context.Context, userID int64) ([]DeviceRow, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT rowid, device_id, name, user_agent, last_seen FROM device_sessions
+		 WHERE user_id = ? ORDER BY last_seen DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list devices: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []DeviceRow
+	for rows.Next() {
+		var d DeviceRow
+		if err := rows.Scan(&d.ID, &d.DeviceID, &d.Name, &d.UserAgent, &d.LastSeen); err != nil {
+			return nil, fmt.Errorf("scan device: %w", err)
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// TouchDeviceSession updates a device's last-seen time. It reports false if
+// the device is not signed in to the account (revoked, evicted, or never
+// signed in), in which case its session cookie must not be honored.
+func (db *DB) TouchDeviceSession(ctx context.Context, userID int64, deviceID string) (bool, error) {
+	res, err := db.ExecContext(ctx,
+		`UPDATE device_sessions SET last_seen = datetime('now') WHERE user_id = ? AND device_id = ?`,
+		userID, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("touch device session: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteDeviceSession signs a device out, identified by its cookie value.
+func (db *DB) DeleteDeviceSession(ctx context.Context, userID int64, deviceID string) error {
+	_, err := db.ExecContext(ctx,
+		`DELETE FROM device_sessions WHERE user_id = ? AND device_id = ?`, userID, deviceID)
+	return err
+}
+
+// RevokeDevice signs a device out, identified by its row ID from
+// ListDevices, and revokes its sessions.
+func (db *DB) RevokeDevice(ctx context.Context, userID, id int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin revoke device: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM sessions WHERE user_id = ? AND device_id IN (
+			SELECT device_id FROM device_sessions WHERE rowid = ? AND user_id = ?
+		)`, userID, id, userID); err != nil {
+		return fmt.Errorf("revoke device sessions: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM device_sessions WHERE rowid = ? AND user_id = ?`, id, userID); err != nil {
+		return fmt.Errorf("revoke device: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RevokeOtherDevices signs out every device except keepDeviceID and revokes
+// their sessions.
+func (db *DB) RevokeOtherDevices(ctx context.Context, userID int64, keepDeviceID string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin revoke devices: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"sessions", "device_sessions"} {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM `+table+` WHERE user_id = ? AND device_id != ?`, userID, keepDeviceID); err != nil {
+			return fmt.Errorf("revoke other devices: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// RenameDevice sets a device's friendly name.
+func (db *DB) RenameDevice(ctx context.Context, userID, id int64, name string) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE device_sessions SET name = ? WHERE rowid = ? AND user_id = ?`, name, id, userID)
+	return err
+}
+
+// UpdatePassphrase replaces a user's passphrase hash.
+func (db *DB) UpdatePassphrase(ctx context.Context, userID int64, passphraseHash string) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE users SET passphrase_hash = ? WHERE id = ?`, passphraseHash, userID)
+	if err != nil {
+		return fmt.Errorf("update passphrase: %w", err)
+	}
+	return nil
+}
+
+// SetAccessibleOnly saves a user's "accessible only" preference.
+func (db *DB) SetAccessibleOnly(ctx context.Context, userID int64, on bool) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE users SET accessible_only = ? WHERE id = ?`, on, userID)
+	if err != nil {
+		return fmt.Errorf("update accessible_only: %w", err)
+	}
+	return nil
+}
+
+// SetWalkSpeed saves a user's walking speed in meters per minute. Zero
+// goes back to the default.
+func (db *DB) SetWalkSpeed(ctx context.Context, userID int64, metersPerMin float64) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE users SET walk_speed = ? WHERE id = ?`, metersPerMin, userID)
+	if err != nil {
+		return fmt.Errorf("update walk_speed: %w", err)
+	}
+	return nil
+}
+
+// userTables lists every table holding per-user rows. DeleteUser purges
+// them before the user row itself; tables added later must be listed here.
+var userTables = []string{
+	"sessions",
+	"device_sessions",
+	"api_tokens",
+	"push_reminders",
+	"push_subscriptions",
+	"saved_places",
+	"favorites",
+	"webauthn_credentials",
+}
+
+// DeleteUser removes a user and all of their data in one transaction.
+func (db *DB) DeleteUser(ctx context.Context, userID int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin delete user: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range userTables {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			return fmt.Errorf("delete user %s: %w", table, err)
+		}
+	}
+	// Invites outlive their creator: they may still be in circulation
+	if _, err := tx.ExecContext(ctx, `UPDATE invites SET created_by = NULL WHERE created_by = ?`, userID); err != nil {
+		return fmt.Errorf("delete user invites: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, userID); err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gobus/internal/geo"
+	"gobus/internal/search"
+)
+
+// AddressRow is one address point in the local gazetteer.
+type AddressRow struct {
+	Number   string // house number as written, e.g. "3501" or "3501A"
+	Street   string
+	City     string
+	Postcode string
+	Lat      float64
+	Lon      float64
+}
+
+// ImportAddresses replaces the gazetteer with the addresses next returns,
+// in one transaction. next returns nil when there are no more. Rows
+// without a leading house number are skipped. Returns how many were stored.
+func (db *DB) ImportAddresses(ctx context.Context, next func() (*AddressRow, error)) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM addresses`); err != nil {
+		return 0, fmt.Errorf("clear addresses: %w", err)
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO addresses (number, num, street, street_norm, city, city_norm, postcode, lat, lon)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("prepare addresses: %w", err)
+	}
+	defer stmt.Close()
+
+	n := 0
+	for {
+		a, err := next()
+		if err != nil {
+			return 0, err
+		}
+		if a == nil {
+			break
+		}
+		num, ok := HouseNumber(a.Number)
+		street := search.Normalize(a.Street)
+		if !ok || street == "" {
+			continue
+		}
+		if _, err := stmt.ExecContext(ctx, strings.TrimSpace(a.Number), num, a.Street, street,
+			a.City, search.Normalize(a.City), a.Postcode, a.Lat, a.Lon); err != nil {
+			return 0, fmt.Errorf("insert address: %w", err)
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
+
+// HouseNumber returns the leading number of a house number such as "3501"
+// or "3501-A".
+func HouseNumber(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(s[:end])
+	return n, err == nil
+}
+
+// AddressCount returns how many addresses the gazetteer holds.
+func (db *DB) AddressCount(ctx context.Context) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM addresses`).Scan(&n)
+	return n, err
+}
+
+// FindAddress looks up the house nearest number on a street, given as
+// search.Normalize forms. The street may leave off a trailing part such as
+// a direction ("chicago ave" finds "chicago ave s"); an exact street and a
+// matching city, if given, rank first. Returns nil if the street is unknown.
+func (db *DB) FindAddress(ctx context.Context, num int, streetNorm, cityNorm string) (*AddressRow, error) {
+	var a AddressRow
+	err := db.QueryRowContext(ctx, `
+		SELECT number, street, city, postcode, lat, lon
+		FROM addresses
+		WHERE street_norm = ?1 OR (street_norm >= ?1 || ' ' AND street_norm < ?1 || '!')
+		ORDER BY street_norm = ?1 DESC, city_norm = ?2 DESC, ABS(num - ?3)
+		LIMIT 1`, streetNorm, cityNorm, num).Scan(&a.Number, &a.Street, &a.City, &a.Postcode, &a.Lat, &a.Lon)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find address: %w", err)
+	}
+	return &a, nil
+}
+
+// NearestAddress returns the address point closest to lat/lon within
+// about radiusMeters, or nil if there is none.
+func (db *DB) NearestAddress(ctx context.Context, lat, lon, radiusMeters float64) (*AddressRow, error) {
+	latDeg, lonDeg := geo.BoundingBoxRadius(lat, radiusMeters)
+	// Squared distance in latitude degrees, good enough to rank neighbours
+	cos2 := math.Pow(math.Cos(lat*math.Pi/180), 2)
+	var a AddressRow
+	err := db.QueryRowContext(ctx, `
+		SELECT number, street, city, postcode, lat, lon
+		FROM addresses
+		WHERE lat BETWEEN ?1 - ?3 AND ?1 + ?3
+		  AND lon BETWEEN ?2 - ?4 AND ?2 + ?4
+		ORDER BY (lat - ?1) * (lat - ?1) + (lon - ?2) * (lon - ?2) * ?5
+		LIMIT 1`, lat, lon, latDeg, lonDeg, cos2).Scan(&a.Number, &a.Street, &a.City, &a.Postcode, &a.Lat, &a.Lon)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("nearest address: %w", err)
+	}
+	return &a, nil
+}
+
+// StopBounds returns the bounding box of the feed's stops, or ok false if
+// no feed is imported.
+func (db *DB) StopBounds(ctx context.Context) (b geo.Bounds, ok bool, err error) {
+	var minLat, minLon, maxLat, maxLon sql.NullFloat64
+	err = db.QueryRowContext(ctx, `
+		SELECT MIN(stop_lat), MIN(stop_lon), MAX(stop_lat), MAX(stop_lon)
+		FROM stops
+		WHERE location_type = 0`).Scan(&minLat, &minLon, &maxLat, &maxLon)
+	if err != nil {
+		return b, false, fmt.Errorf("stop bounds: %w", err)
+	}
+	if !minLat.Valid {
+		return b, false, nil
+	}
+	return geo.Bounds{MinLat: minLat.Float64, MinLon: minLon.Float64, MaxLat: maxLat.Float64, MaxLon: maxLon.Float64}, true, nil
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// AdminUserRow is a user as listed in the admin console.
+type AdminUserRow struct {
+	ID        int64
+	Username  string
+	CreatedAt string
+	IsAdmin   bool
+	Disabled  bool
+	Devices   int
+	LastSeen  string // most recent device activity; empty if never
+	Invite    string // note (or code) of the invite they registered with
+}
+
+// ListUsers returns every user with a summary of their devices, newest
+// account first.
+func (db *DB) ListUsers(ctx context.Context) ([]AdminUserRow, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT u.id, u.username, u.created_at, u.is_admin, u.disabled,
+		        COUNT(d.device_id), COALESCE(MAX(d.last_seen), ''),
+		        COALESCE(NULLIF(i.note, ''), i.code, '')
+		 FROM users u
+		 LEFT JOIN device_sessions d ON d.user_id = u.id
+		 LEFT JOIN invites i ON i.id = u.invite_id
+		 GROUP BY u.id ORDER BY u.id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []AdminUserRow
+	for rows.Next() {
+		var u AdminUserRow
+		if err := rows.Scan(&u.ID, &u.Username, &u.CreatedAt, &u.IsAdmin, &u.Disabled, &u.Devices, &u.LastSeen, &u.Invite); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// SetUserDisabled suspends or reinstates an account. Disabling also signs
+// out all of the user's devices and revokes their sessions.
+func (db *DB) SetUserDisabled(ctx context.Context, userID int64, disabled bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin set disabled: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE users SET disabled = ? WHERE id = ?`, disabled, userID); err != nil {
+		return fmt.Errorf("set disabled: %w", err)
+	}
+	if disabled {
+		for _, table := range []string{"sessions", "device_sessions"} {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+				return fmt.Errorf("set disabled: sign out %s: %w", table, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// SetUserAdmin grants or removes the admin role.
+func (db *DB) SetUserAdmin(ctx context.Context, userID int64, admin bool) error {
+	_, err := db.ExecContext(ctx, `UPDATE users SET is_admin = ? WHERE id = ?`, admin, userID)
+	if err != nil {
+		return fmt.Errorf("set admin: %w", err)
+	}
+	return nil
+}
+
+// SiteCounts summarizes accounts and sign-ins for the admin console.
+type SiteCounts struct {
+	Users         int
+	DisabledUsers int
+	Devices       int
+	Sessions      int // unexpired
+}
+
+// CountSite returns account and session totals.
+func (db *DB) CountSite(ctx context.Context) (SiteCounts, error) {
+	var c SiteCounts
+	err := db.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM users),
+		        (SELECT COUNT(*) FROM users WHERE disabled = 1),
+		        (SELECT COUNT(*) FROM device_sessions),
+		        (SELECT COUNT(*) FROM sessions WHERE expires_at > datetime('now'))`).
+		Scan(&c.Users, &c.DisabledUsers, &c.Devices, &c.Sessions)
+	if err != nil {
+		return c, fmt.Errorf("count site: %w", err)
+	}
+	return c, nil
+}
+
+// FeedCounts is the size of the imported GTFS feed.
+type FeedCounts struct {
+	Routes int
+	Stops  int
+	Trips  int
+}
+
+// CountFeed returns how many routes, stops and trips are imported.
+func (db *DB) CountFeed(ctx context.Context) (FeedCounts, error) {
+	var c FeedCounts
+	err := db.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM routes), (SELECT COUNT(*) FROM stops), (SELECT COUNT(*) FROM trips)`).
+		Scan(&c.Routes, &c.Stops, &c.Trips)
+	if err != nil {
+		return c, fmt.Errorf("count feed: %w", err)
+	}
+	return c, nil
+}
+
+// ListMetadata returns every feed_metadata entry.
+func (db *DB) ListMetadata(ctx context.Context) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT key, value FROM feed_metadata`)
+	if err != nil {
+		return nil, fmt.Errorf("list metadata: %w", err)
+	}
+	defer rows.Close()
+
+	meta := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, fmt.Errorf("scan metadata: %w", err)
+		}
+		meta[k] = v
+	}
+	return meta, rows.Err()
+}
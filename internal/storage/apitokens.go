@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// APITokenRow is an API token as listed to its owner (the hash is never exposed).
+type APITokenRow struct {
+	ID        int64
+	Name      string
+	CreatedAt string
+	LastUsed  string // empty if never used
+}
+
+// CreateAPIToken stores the hash of a new API token for a user. Returns the token ID.
+func (db *DB) CreateAPIToken(ctx context.Context, userID int64, name, tokenHash string) (int64, error) {
+	result, err := db.ExecContext(ctx,
+		`INSERT INTO api_tokens (user_id, name, token_hash) VALUES (?, ?, ?)`,
+		userID, name, tokenHash)
+	if err != nil {
+		return 0, fmt.Errorf("create api token: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// ListAPITokens returns a user's API tokens, newest first.
+func (db *DB) ListAPITokens(ctx context.Context, userID int64) ([]APITokenRow, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, name, created_at, last_used FROM api_tokens
+		 WHERE user_id = ? ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []APITokenRow
+	for rows.Next() {
+		var t APITokenRow
+		var lastUsed sql.NullString
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt, &lastUsed); err != nil {
+			return nil, fmt.Errorf("scan api token: %w", err)
+		}
+		t.LastUsed = lastUsed.String
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken deletes one of a user's API tokens.
+func (db *DB) RevokeAPIToken(ctx context.Context, userID, tokenID int64) error {
+	_, err := db.ExecContext(ctx,
+		`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, tokenID, userID)
+	return err
+}
+
+// UserForAPIToken resolves a token hash to its user and records the use.
+// Returns 0 if the token is unknown or its account is disabled.
+func (db *DB) UserForAPIToken(ctx context.Context, tokenHash string) (int64, error) {
+	var userID int64
+	err := db.QueryRowContext(ctx,
+		`UPDATE api_tokens SET last_used = datetime('now')
+		 WHERE token_hash = ? AND user_id NOT IN (SELECT id FROM users WHERE disabled = 1)
+		 RETURNING user_id`, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return userID, err
+}
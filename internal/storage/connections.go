@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ConnectionRow is a vehicle going from one stop to the next on a trip.
+type ConnectionRow struct {
+	TripID     string
+	RouteID    string
+	RouteShort string
+	FromStop   string
+	ToStop     string
+	Departure  int  // from FromStop, seconds after midnight
+	Arrival    int  // at ToStop, seconds after midnight
+	NoPickup   bool // riders can't board at FromStop
+	NoDropOff  bool // riders can't get off at ToStop
+	// WheelchairAccessible is the trip's AccessUnknown, AccessYes or AccessNo
+	WheelchairAccessible int
+}
+
+// Connections returns every connection that leaves at or after from and
+// arrives by to (seconds after midnight of date), ordered by departure.
+// That includes trips of the previous service day still running past
+// midnight, whose times of 24:00 and later are given on date's clock.
+// Stops a trip passes without picking up or dropping off are skipped over.
+func (db *DB) Connections(ctx context.Context, date time.Time, from, to int) ([]ConnectionRow, error) {
+	conns, err := db.connectionsOn(ctx, date, from, to)
+	if err != nil {
+		return nil, err
+	}
+	const day = 24 * 60 * 60
+	late, err := db.connectionsOn(ctx, date.AddDate(0, 0, -1), from+day, to+day)
+	if err != nil {
+		return nil, err
+	}
+	if len(late) == 0 {
+		return conns, nil
+	}
+	for i := range late {
+		late[i].Departure -= day
+		late[i].Arrival -= day
+	}
+	conns = append(conns, late...)
+	slices.SortStableFunc(conns, func(a, b ConnectionRow) int { return cmp.Compare(a.Departure, b.Departure) })
+	return conns, nil
+}
+
+// connectionsOn returns the connections of the trips running on service
+// day date between from and to, on that day's clock.
+func (db *DB) connectionsOn(ctx context.Context, date time.Time, from, to int) ([]ConnectionRow, error) {
+	dateStr := date.Format("20060102")
+	dayCol := dayColumn(date.Weekday())
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT trip_id, route_id, route_short, stop_id, departure_secs, next_stop, next_arrival,
+		       pickup_type IS 1, next_drop_off IS 1, wheelchair_accessible
+		FROM (
+		  SELECT st.trip_id, t.route_id, COALESCE(NULLIF(r.route_short_name, ''), r.route_long_name) AS route_short,
+		         t.wheelchair_accessible,
+		         st.stop_id, st.departure_secs, st.pickup_type,
+		         LEAD(st.stop_id) OVER w AS next_stop,
+		         LEAD(st.arrival_secs) OVER w AS next_arrival,
+		         LEAD(st.drop_off_type) OVER w AS next_drop_off
+		  FROM stop_times st
+		  JOIN trips t ON t.trip_id = st.trip_id
+		  JOIN routes r ON r.route_id = t.route_id
+		  WHERE st.departure_secs >= ? AND st.arrival_secs <= ?
+		    AND NOT (st.pickup_type IS 1 AND st.drop_off_type IS 1)
+		    AND (
+		      (t.service_id IN (
+		        SELECT service_id FROM calendar
+		        WHERE %s = 1 AND start_date <= ? AND end_date >= ?
+		      ) AND t.service_id NOT IN (
+		        SELECT service_id FROM calendar_dates
+		        WHERE date = ? AND exception_type = 2
+		      ))
+		      OR t.service_id IN (
+		        SELECT service_id FROM calendar_dates
+		        WHERE date = ? AND exception_type = 1
+		      )
+		    )
+		  WINDOW w AS (PARTITION BY st.trip_id ORDER BY st.stop_sequence)
+		)
+		WHERE next_stop IS NOT NULL
+		ORDER BY departure_secs`, dayCol),
+		from, to,
+		dateStr, dateStr,
+		dateStr,
+		dateStr,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connections query: %w", err)
+	}
+	defer rows.Close()
+
+	var conns []ConnectionRow
+	for rows.Next() {
+		var c ConnectionRow
+		if err := rows.Scan(&c.TripID, &c.RouteID, &c.RouteShort, &c.FromStop,
+			&c.Departure, &c.ToStop, &c.Arrival, &c.NoPickup, &c.NoDropOff, &c.WheelchairAccessible); err != nil {
+			return nil, fmt.Errorf("scan connection: %w", err)
+		}
+		conns = append(conns, c)
+	}
+	return conns, rows.Err()
+}
+
+// BoardingStops returns every stop where vehicles board (location_type 0),
+// with its wheelchair boarding.
+func (db *DB) BoardingStops(ctx context.Context) ([]StopRow, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT s.stop_id, COALESCE(s.stop_code, ''), s.stop_name, s.stop_lat, s.stop_lon,
+		       `+stopWheelchairBoarding+`
+		FROM stops s
+		LEFT JOIN stops p ON p.stop_id = s.parent_station
+		WHERE COALESCE(s.location_type, 0) = 0`)
+	if err != nil {
+		return nil, fmt.Errorf("boarding stops query: %w", err)
+	}
+	defer rows.Close()
+
+	var stops []StopRow
+	for rows.Next() {
+		var s StopRow
+		if err := rows.Scan(&s.StopID, &s.StopCode, &s.StopName, &s.StopLat, &s.StopLon, &s.WheelchairBoarding); err != nil {
+			return nil, fmt.Errorf("scan boarding stop: %w", err)
+		}
+		stops = append(stops, s)
+	}
+	return stops, rows.Err()
+}
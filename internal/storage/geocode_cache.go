@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GeocodeCacheRow is a cached geocoder answer. For a reverse lookup Name
+// is the address and Lat/Lon are unused.
+type GeocodeCacheRow struct {
+	Found     bool
+	Lat       float64
+	Lon       float64
+	Name      string
+	FetchedAt time.Time
+}
+
+// GetGeocodeCache returns the cached answer for op and key, or nil if there
+// is none.
+func (db *DB) GetGeocodeCache(ctx context.Context, op, key string) (*GeocodeCacheRow, error) {
+	var r GeocodeCacheRow
+	var fetched int64
+	err := db.QueryRowContext(ctx, `
+		SELECT found, lat, lon, name, fetched_at
+		FROM geocode_cache
+		WHERE op = ? AND key = ?`, op, key).Scan(&r.Found, &r.Lat, &r.Lon, &r.Name, &fetched)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get geocode cache: %w", err)
+	}
+	r.FetchedAt = time.Unix(fetched, 0)
+	return &r, nil
+}
+
+// PutGeocodeCache stores an answer, replacing any older one.
+func (db *DB) PutGeocodeCache(ctx context.Context, op, key string, r GeocodeCacheRow) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO geocode_cache (op, key, found, lat, lon, name, fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, op, key, r.Found, r.Lat, r.Lon, r.Name, r.FetchedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("put geocode cache: %w", err)
+	}
+	return nil
+}
+
+// PruneGeocodeCache deletes answers fetched before cutoff and returns how
+// many there were.
+func (db *DB) PruneGeocodeCache(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM geocode_cache WHERE fetched_at < ?`, cutoff.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("prune geocode cache: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ObservedDeparture is a trip seen leaving a stop, at the time its last
+// realtime prediction gave.
+type ObservedDeparture struct {
+	StopID   string
+	TripID   string
+	Departed time.Time
+}
+
+// maxHistoryDelay is the farthest an observed departure can be from its
+// scheduled time and still count. Past it the prediction more likely
+// belongs to another day's trip than to a very late one.
+const maxHistoryDelay = 2 * time.Hour
+
+// RecordDepartures matches observed departures to their scheduled times
+// and adds them to the departure history, replacing earlier observations
+// of the same trip at the same stop on the same day. Departures that match
+// no scheduled trip at the stop are skipped. It returns how many were
+// recorded.
+func (db *DB) RecordDepartures(ctx context.Context, obs []ObservedDeparture) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin record departures: %w", err)
+	}
+	defer tx.Rollback()
+
+	lookup, err := tx.PrepareContext(ctx, `
+		SELECT st.departure_secs, t.route_id, COALESCE(t.direction_id, 0)
+		FROM stop_times st
+		JOIN trips t ON t.trip_id = st.trip_id
+		WHERE st.trip_id = ? AND st.stop_id = ? AND st.departure_secs IS NOT NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("prepare schedule lookup: %w", err)
+	}
+	defer lookup.Close()
+	insert, err := tx.PrepareContext(ctx, `
+		INSERT OR REPLACE INTO departure_history
+			(stop_id, service_date, trip_id, route_id, direction_id, scheduled, delay)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("prepare history insert: %w", err)
+	}
+	defer insert.Close()
+
+	recorded := 0
+	for _, o := range obs {
+		rows, err := lookup.QueryContext(ctx, o.TripID, o.StopID)
+		if err != nil {
+			return 0, fmt.Errorf("schedule lookup: %w", err)
+		}
+		var (
+			found       bool
+			routeID     string
+			directionID int
+			bestDate    time.Time
+			bestSched   int
+			bestDelay   time.Duration
+			sched       int
+			route       string
+			dir         int
+		)
+		for rows.Next() {
+			if err := rows.Scan(&sched, &route, &dir); err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("scan schedule: %w", err)
+			}
+			// A trip past midnight may belong to the previous service day
+			for _, back := range []int{0, 1} {
+				d := o.Departed
+				date := time.Date(d.Year(), d.Month(), d.Day()-back, 0, 0, 0, 0, d.Location())
+				delay := d.Sub(serviceDayStart(date).Add(time.Duration(sched) * time.Second))
+				if !found || delay.Abs() < bestDelay.Abs() {
+					found, routeID, directionID = true, route, dir
+					bestDate, bestSched, bestDelay = date, sched, delay
+				}
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, fmt.Errorf("schedule lookup: %w", err)
+		}
+		if !found || bestDelay.Abs() > maxHistoryDelay {
+			continue
+		}
+		if _, err := insert.ExecContext(ctx, o.StopID, bestDate.Format("20060102"), o.TripID,
+			routeID, directionID, bestSched, int(bestDelay.Seconds())); err != nil {
+			return 0, fmt.Errorf("insert history: %w", err)
+		}
+		recorded++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit record departures: %w", err)
+	}
+	return recorded, nil
+}
+
+// serviceDayStart returns the time GTFS stop times on date count from:
+// noon minus 12 hours, which is midnight except on days the clocks change.
+func serviceDayStart(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, date.Location()).Add(-12 * time.Hour)
+}
+
+// DepartureHistoryRow is a departure observed at a stop.
+type DepartureHistoryRow struct {
+	RouteID     string
+	RouteShort  string
+	DirectionID int
+	ServiceDate string // YYYYMMDD
+	TripID      string
+	Scheduled   int // seconds after midnight of ServiceDate
+	Delay       int // seconds late; negative when early
+}
+
+// DepartureHistory returns the departures observed at stopID on service
+// days from since on, ordered by route, direction, day and scheduled time.
+func (db *DB) DepartureHistory(ctx context.Context, stopID string, since time.Time) ([]DepartureHistoryRow, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT h.route_id, COALESCE(NULLIF(r.route_short_name, ''), r.route_long_name, h.route_id),
+		       h.direction_id, h.service_date, h.trip_id, h.scheduled, h.delay
+		FROM departure_history h
+		LEFT JOIN routes r ON r.route_id = h.route_id
+		WHERE h.stop_id = ? AND h.service_date >= ?
+		ORDER BY h.route_id, h.direction_id, h.service_date, h.scheduled`,
+		stopID, since.Format("20060102"))
+	if err != nil {
+		return nil, fmt.Errorf("departure history query: %w", err)
+	}
+	defer rows.Close()
+
+	var out []DepartureHistoryRow
+	for rows.Next() {
+		var r DepartureHistoryRow
+		if err := rows.Scan(&r.RouteID, &r.RouteShort, &r.DirectionID, &r.ServiceDate,
+			&r.TripID, &r.Scheduled, &r.Delay); err != nil {
+			return nil, fmt.Errorf("scan departure history: %w", err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// PruneDepartureHistory deletes departures from service days before cutoff
+// and returns how many there were.
+func (db *DB) PruneDepartureHistory(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM departure_history WHERE service_date < ?`,
+		cutoff.Format("20060102"))
+	if err != nil {
+		return 0, fmt.Errorf("prune departure history: %w", err)
+	}
+	return res.RowsAffected()
+}
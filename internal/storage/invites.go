@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInviteInvalid is returned when an invite code is unknown, revoked,
+// used up or expired.
+var ErrInviteInvalid = errors.New("invite code is invalid")
+
+// InviteRow is an invite code as listed in the admin console.
+type InviteRow struct {
+	ID        int64
+	Code      string
+	Note      string
+	MaxUses   int // 0 = unlimited
+	Uses      int
+	ExpiresAt time.Time // zero = never
+	CreatedBy string    // creator's username; empty if they've since been deleted
+	CreatedAt string
+	Revoked   bool
+	Users     int // accounts still registered with this code
+}
+
+// inviteUsable is the SQL condition for an invite that can still be redeemed.
+const inviteUsable = `revoked = 0 AND (max_uses = 0 OR uses < max_uses)
+	AND (expires_at IS NULL OR expires_at > datetime('now'))`
+
+// CreateInvite stores a new invite code. A zero expiresAt never expires.
+func (db *DB) CreateInvite(ctx context.Context, code, note string, maxUses int, expiresAt time.Time, createdBy int64) (int64, error) {
+	var expires any
+	if !expiresAt.IsZero() {
+		expires = expiresAt.Unix()
+	}
+	res, err := db.ExecContext(ctx,
+		`INSERT INTO invites (code, note, max_uses, expires_at, created_by)
+		 VALUES (?, ?, ?, datetime(?, 'unixepoch'), ?)`,
+		code, note, maxUses, expires, createdBy)
+	if err != nil {
+		return 0, fmt.Errorf("create invite: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// ListInvites returns every invite, newest first.
+func (db *DB) ListInvites(ctx context.Context) ([]InviteRow, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT i.id, i.code, i.note, i.max_uses, i.uses,
+		        CAST(strftime('%s', i.expires_at) AS INTEGER), COALESCE(c.username, ''),
+		        i.created_at, i.revoked,
+		        (SELECT COUNT(*) FROM users u WHERE u.invite_id = i.id)
+		 FROM invites i LEFT JOIN users c ON c.id = i.created_by
+		 ORDER BY i.id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list invites: %w", err)
+	}
+	defer rows.Close()
+
+	var invites []InviteRow
+	for rows.Next() {
+		var inv InviteRow
+		var expires sql.NullInt64
+		if err := rows.Scan(&inv.ID, &inv.Code, &inv.Note, &inv.MaxUses, &inv.Uses,
+			&expires, &inv.CreatedBy, &inv.CreatedAt, &inv.Revoked, &inv.Users); err != nil {
+			return nil, fmt.Errorf("scan invite: %w", err)
+		}
+		if expires.Valid {
+			inv.ExpiresAt = time.Unix(expires.Int64, 0)
+		}
+		invites = append(invites, inv)
+	}
+	return invites, rows.Err()
+}
+
+// RevokeInvite stops an invite code from being redeemed.
+func (db *DB) RevokeInvite(ctx context.Context, id int64) error {
+	_, err := db.ExecContext(ctx, `UPDATE invites SET revoked = 1 WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("revoke invite: %w", err)
+	}
+	return nil
+}
+
+// InviteUsable reports whether code can currently be redeemed.
+func (db *DB) InviteUsable(ctx context.Context, code string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM invites WHERE code = ? AND `+inviteUsable, code).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("check invite: %w", err)
+	}
+	return n > 0, nil
+}
+
+// CreateUserWithInvite redeems an invite code and creates the user in one
+// transaction, so a failed registration (e.g. a taken username) doesn't use
+// up the code. Returns ErrInviteInvalid if the code can't be redeemed.
+func (db *DB) CreateUserWithInvite(ctx context.Context, username, passphraseHash, code string) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin redeem invite: %w", err)
+	}
+	defer tx.Rollback()
+
+	var inviteID int64
+	err = tx.QueryRowContext(ctx,
+		`UPDATE invites SET uses = uses + 1 WHERE code = ? AND `+inviteUsable+` RETURNING id`,
+		code).Scan(&inviteID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInviteInvalid
+	}
+	if err != nil {
+		return 0, fmt.Errorf("redeem invite: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO users (username, passphrase_hash, invite_id) VALUES (?, ?, ?)`,
+		username, passphraseHash, inviteID)
+	if err != nil {
+		return 0, fmt.Errorf("create user: %w", err)
+	}
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
@@ -9,10 +9,97 @@ func (db *DB) migrate() error {
 			return fmt.Errorf("migration %d: %w", i, err)
 		}
 	}
+	for _, c := range addedColumns {
+		if err := db.addColumn(c.table, c.column, c.def); err != nil {
+			return err
+		}
+	}
+	for i, stmt := range columnMigrations {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("column migration %d: %w", i, err)
+		}
+	}
+	if err := db.createSearchFTS(); err != nil {
+		return err
+	}
 	db.logger.Info("database migrations applied")
 	return nil
 }
 
+// addColumn adds a column to an existing table unless it is already there.
+// SQLite has no ADD COLUMN IF NOT EXISTS, so check table_info first.
+func (db *DB) addColumn(table, column, def string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return fmt.Errorf("inspect %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("inspect %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("inspect %s: %w", table, err)
+	}
+	rows.Close()
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, def)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// addedColumns are columns added to tables after they first shipped,
+// applied in order after the CREATE statements. Defaults must be constant.
+var addedColumns = []struct{ table, column, def string }{
+	// Friendly device names for the account page
+	{"device_sessions", "name", "TEXT NOT NULL DEFAULT ''"},
+	{"device_sessions", "user_agent", "TEXT NOT NULL DEFAULT ''"},
+	// Admin console: operator role and account suspension
+	{"users", "is_admin", "INTEGER NOT NULL DEFAULT 0"},
+	{"users", "disabled", "INTEGER NOT NULL DEFAULT 0"},
+	// Which invite code a user registered with
+	{"users", "invite_id", "INTEGER REFERENCES invites(id)"},
+	// Stations (location_type 1) in stop search
+	{"stop_search", "station_id", "TEXT NOT NULL DEFAULT ''"},
+	// Trip-level accessibility (GTFS: 0 unknown, 1 yes, 2 no)
+	{"trips", "wheelchair_accessible", "INTEGER NOT NULL DEFAULT 0"},
+	{"trips", "bikes_allowed", "INTEGER NOT NULL DEFAULT 0"},
+	// Per-user "accessible only" preference
+	{"users", "accessible_only", "INTEGER NOT NULL DEFAULT 0"},
+	// Platform labels on the station page
+	{"stops", "platform_code", "TEXT NOT NULL DEFAULT ''"},
+	// Per-user walking speed in meters per minute (0: the default)
+	{"users", "walk_speed", "REAL NOT NULL DEFAULT 0"},
+	// Stop times as seconds after midnight, for comparing times that
+	// aren't zero-padded ("8:05:00"); NULL where the feed gives none
+	{"stop_times", "arrival_secs", "INTEGER"},
+	{"stop_times", "departure_secs", "INTEGER"},
+}
+
+// gtfsSecondsSQL converts the GTFS time in column c, "H:MM:SS" or
+// "HH:MM:SS", to seconds after midnight.
+func gtfsSecondsSQL(c string) string {
+	return fmt.Sprintf(`CASE WHEN instr(%[1]s, ':') > 0 THEN
+		CAST(substr(%[1]s, 1, instr(%[1]s, ':') - 1) AS INTEGER) * 3600
+		+ CAST(substr(%[1]s, instr(%[1]s, ':') + 1, 2) AS INTEGER) * 60
+		+ CAST(substr(%[1]s, -2) AS INTEGER) END`, c)
+}
+
+// columnMigrations use addedColumns, so they run after them.
+var columnMigrations = []string{
+	// Every trip running in a time window, for reachability
+	`CREATE INDEX IF NOT EXISTS idx_stop_times_departure_secs ON stop_times(departure_secs)`,
+	// Stop times imported before the columns existed
+	`UPDATE stop_times SET arrival_secs = ` + gtfsSecondsSQL("arrival_time") + `,
+		departure_secs = ` + gtfsSecondsSQL("departure_time") + `
+	 WHERE departure_secs IS NULL AND departure_time != ''`,
+}
+
 var migrations = []string{
 	// Agency
 	`CREATE TABLE IF NOT EXISTS agency (
@@ -143,4 +230,174 @@ var migrations = []string{
 		PRIMARY KEY (user_id, device_id)
 	)`,
 	`CREATE INDEX IF NOT EXISTS idx_device_sessions_user ON device_sessions(user_id, last_seen)`,
+
+	// API tokens (bearer auth for /api/v1, stored as SHA-256 hashes)
+	`CREATE TABLE IF NOT EXISTS api_tokens (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL REFERENCES users(id),
+		name       TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		created_at TEXT NOT NULL DEFAULT (datetime('now')),
+		last_used  TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id)`,
+
+	// Web Push subscriptions (one per browser/device) and arrival reminders
+	`CREATE TABLE IF NOT EXISTS push_subscriptions (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL REFERENCES users(id),
+		endpoint   TEXT UNIQUE NOT NULL,
+		p256dh     TEXT NOT NULL,
+		auth       TEXT NOT NULL,
+		created_at TEXT NOT NULL DEFAULT (datetime('now'))
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_push_subscriptions_user ON push_subscriptions(user_id)`,
+	`CREATE TABLE IF NOT EXISTS push_reminders (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id      INTEGER NOT NULL REFERENCES users(id),
+		stop_id      TEXT NOT NULL,
+		route_id     TEXT NOT NULL,
+		direction_id INTEGER NOT NULL,
+		trip_id      TEXT NOT NULL DEFAULT '',
+		lead_minutes INTEGER NOT NULL,
+		label        TEXT NOT NULL DEFAULT '',
+		expires_at   TEXT NOT NULL,
+		created_at   TEXT NOT NULL DEFAULT (datetime('now'))
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_push_reminders_user ON push_reminders(user_id, stop_id)`,
+
+	// Saved locations (synced from the browser's localStorage list) and
+	// pinned favorite stops/routes
+	`CREATE TABLE IF NOT EXISTS saved_places (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL REFERENCES users(id),
+		stop_id    TEXT NOT NULL,
+		name       TEXT NOT NULL,
+		label      TEXT NOT NULL DEFAULT '',
+		lat        REAL NOT NULL,
+		lon        REAL NOT NULL,
+		created_at TEXT NOT NULL DEFAULT (datetime('now')),
+		UNIQUE (user_id, stop_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS favorites (
+		user_id    INTEGER NOT NULL REFERENCES users(id),
+		kind       TEXT NOT NULL CHECK (kind IN ('stop', 'route')),
+		ref_id     TEXT NOT NULL,
+		name       TEXT NOT NULL,
+		created_at TEXT NOT NULL DEFAULT (datetime('now')),
+		PRIMARY KEY (user_id, kind, ref_id)
+	)`,
+
+	// Passkeys (WebAuthn credentials); a user may have several
+	`CREATE TABLE IF NOT EXISTS webauthn_credentials (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id       INTEGER NOT NULL REFERENCES users(id),
+		credential_id BLOB NOT NULL UNIQUE,
+		public_key    BLOB NOT NULL,
+		sign_count    INTEGER NOT NULL DEFAULT 0,
+		name          TEXT NOT NULL DEFAULT '',
+		created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+		last_used     TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user ON webauthn_credentials(user_id)`,
+
+	// Server-side sessions. id is an HMAC of the opaque token in the cookie,
+	// so a copy of the database can't be used to sign in.
+	`CREATE TABLE IF NOT EXISTS sessions (
+		id         TEXT PRIMARY KEY,
+		user_id    INTEGER NOT NULL REFERENCES users(id),
+		device_id  TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL DEFAULT (datetime('now')),
+		last_seen  TEXT NOT NULL DEFAULT (datetime('now')),
+		expires_at TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id, device_id)`,
+
+	// Small server settings that must survive a GTFS re-import
+	// (feed_metadata is cleared with the feed)
+	`CREATE TABLE IF NOT EXISTS settings (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+
+	// Admin-issued invite codes. max_uses = 0 means unlimited; expires_at
+	// NULL means never. Invites are revoked rather than deleted, since
+	// users.invite_id keeps pointing at them for attribution.
+	`CREATE TABLE IF NOT EXISTS invites (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		code       TEXT UNIQUE NOT NULL,
+		note       TEXT NOT NULL DEFAULT '',
+		max_uses   INTEGER NOT NULL DEFAULT 1,
+		uses       INTEGER NOT NULL DEFAULT 0,
+		expires_at TEXT,
+		created_by INTEGER REFERENCES users(id),
+		created_at TEXT NOT NULL DEFAULT (datetime('now')),
+		revoked    INTEGER NOT NULL DEFAULT 0
+	)`,
+
+	// Stop name search, rebuilt with each GTFS import: one row per distinct
+	// stop name or station with its normalized terms (see package search),
+	// and the vocabulary of those terms for typo correction. The FTS5 index over
+	// stop_search is created separately since it needs the sqlite_fts5 tag.
+	`CREATE TABLE IF NOT EXISTS stop_search (
+		id    INTEGER PRIMARY KEY,
+		name  TEXT NOT NULL,
+		norm  TEXT NOT NULL,
+		lat   REAL NOT NULL,
+		lon   REAL NOT NULL,
+		stops INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS search_terms (
+		term TEXT PRIMARY KEY,
+		freq INTEGER NOT NULL
+	) WITHOUT ROWID`,
+
+	// Local address gazetteer for offline geocoding, loaded with
+	// --import-addresses. num is the leading number of number, for finding
+	// the nearest house on a street; street_norm and city_norm hold
+	// search.Normalize forms.
+	`CREATE TABLE IF NOT EXISTS addresses (
+		id          INTEGER PRIMARY KEY,
+		number      TEXT NOT NULL,
+		num         INTEGER NOT NULL,
+		street      TEXT NOT NULL,
+		street_norm TEXT NOT NULL,
+		city        TEXT NOT NULL DEFAULT '',
+		city_norm   TEXT NOT NULL DEFAULT '',
+		postcode    TEXT NOT NULL DEFAULT '',
+		lat         REAL NOT NULL,
+		lon         REAL NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_addresses_street ON addresses(street_norm, num)`,
+	`CREATE INDEX IF NOT EXISTS idx_addresses_lat ON addresses(lat)`,
+
+	// Geocoder answers shared by all users, so a busy instance stays within
+	// the upstream's rate limit. op is "search" (key: normalized query) or
+	// "reverse" (key: rounded "lat,lon"); found = 0 remembers a miss.
+	`CREATE TABLE IF NOT EXISTS geocode_cache (
+		op         TEXT NOT NULL,
+		key        TEXT NOT NULL,
+		found      INTEGER NOT NULL,
+		lat        REAL NOT NULL DEFAULT 0,
+		lon        REAL NOT NULL DEFAULT 0,
+		name       TEXT NOT NULL DEFAULT '',
+		fetched_at INTEGER NOT NULL,
+		PRIMARY KEY (op, key)
+	) WITHOUT ROWID`,
+
+	// Observed departures: the last realtime prediction before each trip
+	// left each stop, against its schedule. Kept across GTFS imports.
+	// scheduled is seconds after midnight of service_date (YYYYMMDD);
+	// delay is seconds late, negative when early.
+	`CREATE TABLE IF NOT EXISTS departure_history (
+		stop_id      TEXT NOT NULL,
+		service_date TEXT NOT NULL,
+		trip_id      TEXT NOT NULL,
+		route_id     TEXT NOT NULL,
+		direction_id INTEGER NOT NULL DEFAULT 0,
+		scheduled    INTEGER NOT NULL,
+		delay        INTEGER NOT NULL,
+		PRIMARY KEY (stop_id, service_date, trip_id)
+	) WITHOUT ROWID`,
+	`CREATE INDEX IF NOT EXISTS idx_departure_history_date ON departure_history(service_date)`,
 }
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// PasskeyRow is a WebAuthn credential registered to a user.
+type PasskeyRow struct {
+	ID           int64
+	UserID       int64
+	CredentialID []byte
+	PublicKey    []byte // COSE_Key
+	SignCount    uint32
+	Name         string
+	CreatedAt    string
+	LastUsed     string // empty if never used
+}
+
+// CreatePasskey stores a newly registered credential. Returns its row ID.
+func (db *DB) CreatePasskey(ctx context.Context, userID int64, credentialID, publicKey []byte, signCount uint32, name string) (int64, error) {
+	result, err := db.ExecContext(ctx,
+		`INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, name)
+		 VALUES (?, ?, ?, ?, ?)`,
+		userID, credentialID, publicKey, signCount, name)
+	if err != nil {
+		return 0, fmt.Errorf("create passkey: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// ListPasskeys returns a user's passkeys in the order they were added.
+func (db *DB) ListPasskeys(ctx context.Context, userID int64) ([]PasskeyRow, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, user_id, credential_id, public_key, sign_count, name, created_at, last_used
+		 FROM webauthn_credentials WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []PasskeyRow
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *p)
+	}
+	return keys, rows.Err()
+}
+
+// GetPasskey looks up a credential by its WebAuthn credential ID.
+// Returns sql.ErrNoRows if not found.
+func (db *DB) GetPasskey(ctx context.Context, credentialID []byte) (*PasskeyRow, error) {
+	row := db.QueryRowContext(ctx,
+		`SELECT id, user_id, credential_id, public_key, sign_count, name, created_at, last_used
+		 FROM webauthn_credentials WHERE credential_id = ?`, credentialID)
+	return scanPasskey(row)
+}
+
+func scanPasskey(s interface{ Scan(...any) error }) (*PasskeyRow, error) {
+	var p PasskeyRow
+	var lastUsed sql.NullString
+	if err := s.Scan(&p.ID, &p.UserID, &p.CredentialID, &p.PublicKey, &p.SignCount, &p.Name, &p.CreatedAt, &lastUsed); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan passkey: %w", err)
+	}
+	p.LastUsed = lastUsed.String
+	return &p, nil
+}
+
+// RecordPasskeyUse stores the authenticator's new signature counter after a
+// successful sign-in.
+func (db *DB) RecordPasskeyUse(ctx context.Context, id int64, signCount uint32) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE webauthn_credentials SET sign_count = ?, last_used = datetime('now') WHERE id = ?`,
+		signCount, id)
+	if err != nil {
+		return fmt.Errorf("record passkey use: %w", err)
+	}
+	return nil
+}
+
+// DeletePasskey removes one of a user's passkeys.
+func (db *DB) DeletePasskey(ctx context.Context, userID, id int64) error {
+	_, err := db.ExecContext(ctx,
+		`DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?`, id, userID)
+	return err
+}
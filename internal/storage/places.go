@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// SavedPlaceRow is a user's saved location (a stop with a short label such
+// as "Home"), mirroring the entries app.js keeps in localStorage.
+type SavedPlaceRow struct {
+	StopID string
+	Name   string
+	Label  string
+	Lat    float64
+	Lon    float64
+}
+
+// ListSavedPlaces returns a user's saved places in the order they were added.
+func (db *DB) ListSavedPlaces(ctx context.Context, userID int64) ([]SavedPlaceRow, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT stop_id, name, label, lat, lon FROM saved_places
+		 WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list saved places: %w", err)
+	}
+	defer rows.Close()
+
+	var places []SavedPlaceRow
+	for rows.Next() {
+		var p SavedPlaceRow
+		if err := rows.Scan(&p.StopID, &p.Name, &p.Label, &p.Lat, &p.Lon); err != nil {
+			return nil, fmt.Errorf("scan saved place: %w", err)
+		}
+		places = append(places, p)
+	}
+	return places, rows.Err()
+}
+
+// SaveSavedPlace adds a saved place, or updates its name and label if the
+// user already saved that stop.
+func (db *DB) SaveSavedPlace(ctx context.Context, userID int64, p SavedPlaceRow) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO saved_places (user_id, stop_id, name, label, lat, lon) VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(user_id, stop_id) DO UPDATE SET name = excluded.name, label = excluded.label`,
+		userID, p.StopID, p.Name, p.Label, p.Lat, p.Lon)
+	if err != nil {
+		return fmt.Errorf("save place: %w", err)
+	}
+	return nil
+}
+
+// ImportSavedPlaces merges a batch of places (the browser's pre-login list)
+// into a user's saved places, stopping once the user has limit of them.
+// Stops the user already saved keep their server-side label. It returns
+// how many places were added.
+func (db *DB) ImportSavedPlaces(ctx context.Context, userID int64, places []SavedPlaceRow, limit int) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin import: %w", err)
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM saved_places WHERE user_id = ?`, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count saved places: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT OR IGNORE INTO saved_places (user_id, stop_id, name, label, lat, lon) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("prepare import: %w", err)
+	}
+	defer stmt.Close()
+
+	added := 0
+	for _, p := range places {
+		if count+added >= limit {
+			break
+		}
+		res, err := stmt.ExecContext(ctx, userID, p.StopID, p.Name, p.Label, p.Lat, p.Lon)
+		if err != nil {
+			return 0, fmt.Errorf("import place %s: %w", p.StopID, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit import: %w", err)
+	}
+	return added, nil
+}
+
+// DeleteSavedPlace removes a user's saved stop.
+func (db *DB) DeleteSavedPlace(ctx context.Context, userID int64, stopID string) error {
+	_, err := db.ExecContext(ctx,
+		`DELETE FROM saved_places WHERE user_id = ? AND stop_id = ?`, userID, stopID)
+	return err
+}
+
+// FavoriteRow is a pinned stop or route.
+type FavoriteRow struct {
+	Kind  string // "stop" or "route"
+	RefID string // stop_id or route_id
+	Name  string
+}
+
+// ListFavorites returns a user's pinned stops and routes, routes first.
+func (db *DB) ListFavorites(ctx context.Context, userID int64) ([]FavoriteRow, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT kind, ref_id, name FROM favorites WHERE user_id = ?
+		 ORDER BY kind, created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list favorites: %w", err)
+	}
+	defer rows.Close()
+
+	var favs []FavoriteRow
+	for rows.Next() {
+		var f FavoriteRow
+		if err := rows.Scan(&f.Kind, &f.RefID, &f.Name); err != nil {
+			return nil, fmt.Errorf("scan favorite: %w", err)
+		}
+		favs = append(favs, f)
+	}
+	return favs, rows.Err()
+}
+
+// IsFavorite reports whether a user has pinned a stop or route.
+func (db *DB) IsFavorite(ctx context.Context, userID int64, kind, refID string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM favorites WHERE user_id = ? AND kind = ? AND ref_id = ?`,
+		userID, kind, refID).Scan(&n)
+	return n > 0, err
+}
+
+// SetFavorite pins or unpins a stop or route.
+func (db *DB) SetFavorite(ctx context.Context, userID int64, f FavoriteRow, pinned bool) error {
+	var err error
+	if pinned {
+		_, err = db.ExecContext(ctx,
+			`INSERT OR IGNORE INTO favorites (user_id, kind, ref_id, name) VALUES (?, ?, ?, ?)`,
+			userID, f.Kind, f.RefID, f.Name)
+	} else {
+		_, err = db.ExecContext(ctx,
+			`DELETE FROM favorites WHERE user_id = ? AND kind = ? AND ref_id = ?`,
+			userID, f.Kind, f.RefID)
+	}
+	if err != nil {
+		return fmt.Errorf("set favorite: %w", err)
+	}
+	return nil
+}
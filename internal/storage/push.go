@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrPushEndpointTaken is returned when a push endpoint is already
+// registered to another user.
+var ErrPushEndpointTaken = errors.New("push endpoint belongs to another user")
+
+// PushSubscriptionRow is a stored browser push subscription.
+type PushSubscriptionRow struct {
+	ID       int64
+	UserID   int64
+	Endpoint string
+	P256dh   string
+	Auth     string
+}
+
+// SavePushSubscription stores a subscription for a user. Browsers reuse the
+// endpoint across re-subscribes, so the user's existing row is updated in
+// place. Returns ErrPushEndpointTaken if another user has the endpoint.
+func (db *DB) SavePushSubscription(ctx context.Context, userID int64, endpoint, p256dh, auth string) error {
+	res, err := db.ExecContext(ctx,
+		`INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(endpoint) DO UPDATE SET p256dh = excluded.p256dh, auth = excluded.auth
+		 WHERE push_subscriptions.user_id = excluded.user_id`,
+		userID, endpoint, p256dh, auth)
+	if err != nil {
+		return fmt.Errorf("save push subscription: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrPushEndpointTaken
+	}
+	return nil
+}
+
+// DeletePushSubscription removes one of a user's subscriptions by endpoint.
+func (db *DB) DeletePushSubscription(ctx context.Context, userID int64, endpoint string) error {
+	_, err := db.ExecContext(ctx,
+		`DELETE FROM push_subscriptions WHERE endpoint = ? AND user_id = ?`, endpoint, userID)
+	return err
+}
+
+// PushSubscriptionsForUser returns all of a user's push subscriptions.
+func (db *DB) PushSubscriptionsForUser(ctx context.Context, userID int64) ([]PushSubscriptionRow, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, user_id, endpoint, p256dh, auth FROM push_subscriptions WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("push subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []PushSubscriptionRow
+	for rows.Next() {
+		var s PushSubscriptionRow
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Endpoint, &s.P256dh, &s.Auth); err != nil {
+			return nil, fmt.Errorf("scan push subscription: %w", err)
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// ReminderRow is a pending "notify me before the bus comes" reminder.
+// TripID pins the reminder to the departure that was next when it was set;
+// it is empty if no departure was known yet, in which case the next matching
+// departure is used.
+type ReminderRow struct {
+	ID          int64
+	UserID      int64
+	StopID      string
+	RouteID     string
+	DirectionID int
+	TripID      string
+	LeadMinutes int
+	Label       string // e.g. "18 Southbound", for the notification text
+	ExpiresAt   time.Time
+}
+
+// CreateReminder stores a new reminder. Returns the reminder ID.
+func (db *DB) CreateReminder(ctx context.Context, r ReminderRow) (int64, error) {
+	result, err := db.ExecContext(ctx,
+		`INSERT INTO push_reminders
+		   (user_id, stop_id, route_id, direction_id, trip_id, lead_minutes, label, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, datetime(?, 'unixepoch'))`,
+		r.UserID, r.StopID, r.RouteID, r.DirectionID, r.TripID, r.LeadMinutes, r.Label, r.ExpiresAt.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("create reminder: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// DeleteReminder removes a reminder. userID scopes the delete to its owner;
+// pass 0 to delete regardless of owner (used by the scheduler).
+func (db *DB) DeleteReminder(ctx context.Context, userID, id int64) error {
+	_, err := db.ExecContext(ctx,
+		`DELETE FROM push_reminders WHERE id = ? AND (? = 0 OR user_id = ?)`, id, userID, userID)
+	return err
+}
+
+// PendingReminders returns every reminder, oldest first. Expired reminders
+// are included so the scheduler can clean them up; disabled accounts'
+// reminders are held back.
+func (db *DB) PendingReminders(ctx context.Context) ([]ReminderRow, error) {
+	return db.queryReminders(ctx, `user_id NOT IN (SELECT id FROM users WHERE disabled = 1)`)
+}
+
+// RemindersForStop returns a user's unexpired reminders at a stop.
+func (db *DB) RemindersForStop(ctx context.Context, userID int64, stopID string) ([]ReminderRow, error) {
+	return db.queryReminders(ctx, `user_id = ? AND stop_id = ? AND expires_at > datetime('now')`, userID, stopID)
+}
+
+// CountReminders returns how many unexpired reminders a user has.
+func (db *DB) CountReminders(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM push_reminders WHERE user_id = ? AND expires_at > datetime('now')`,
+		userID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count reminders: %w", err)
+	}
+	return n, nil
+}
+
+func (db *DB) queryReminders(ctx context.Context, where string, args ...any) ([]ReminderRow, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, user_id, stop_id, route_id, direction_id, trip_id, lead_minutes, label,
+		        CAST(strftime('%s', expires_at) AS INTEGER)
+		 FROM push_reminders WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query reminders: %w", err)
+	}
+	defer rows.Close()
+
+	var out []ReminderRow
+	for rows.Next() {
+		var r ReminderRow
+		var expires int64
+		if err := rows.Scan(&r.ID, &r.UserID, &r.StopID, &r.RouteID, &r.DirectionID,
+			&r.TripID, &r.LeadMinutes, &r.Label, &expires); err != nil {
+			return nil, fmt.Errorf("scan reminder: %w", err)
+		}
+		r.ExpiresAt = time.Unix(expires, 0)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"strings"
 	"time"
 )
 
@@ -26,6 +25,22 @@ func (db *DB) SetMetadata(ctx context.Context, key, value string) error {
 	return err
 }
 
+// Values of the GTFS wheelchair_boarding, wheelchair_accessible and
+// bikes_allowed fields.
+const (
+	AccessUnknown = 0
+	AccessYes     = 1
+	AccessNo      = 2
+)
+
+// stopWheelchairBoarding selects stop s's wheelchair_boarding, or for a
+// platform that doesn't say, that of its parent station p, which the GTFS
+// spec says it inherits. Queries using it LEFT JOIN stops AS p.
+const stopWheelchairBoarding = `CASE
+		         WHEN s.wheelchair_boarding IN (1, 2) THEN s.wheelchair_boarding
+		         WHEN p.wheelchair_boarding IN (1, 2) THEN p.wheelchair_boarding
+		         ELSE 0 END`
+
 // NearbyStopRow represents a stop with its distance from a query point.
 type NearbyStopRow struct {
 	StopID             string
@@ -35,8 +50,13 @@ type NearbyStopRow struct {
 	StopLat            float64
 	StopLon            float64
 	LocationType       int
-	WheelchairBoarding int
+	WheelchairBoarding int     // AccessUnknown, AccessYes or AccessNo, inherited from the station
 	DistanceMeters     float64 // Computed after query via Haversine
+
+	// For a platform of a station (location_type 1)
+	StationID    string
+	StationName  string
+	PlatformCode string
 }
 
 // NearbyStops finds stops within a bounding box using the R-Tree index.
@@ -45,9 +65,13 @@ func (db *DB) NearbyStops(ctx context.Context, lat, lon, latDeg, lonDeg float64,
 	rows, err := db.QueryContext(ctx, `
 		SELECT s.stop_id, s.stop_code, s.stop_name, s.stop_desc,
 		       s.stop_lat, s.stop_lon,
-		       s.location_type, s.wheelchair_boarding
+		       s.location_type, `+stopWheelchairBoarding+`,
+		       CASE WHEN p.location_type = 1 THEN p.stop_id ELSE '' END,
+		       CASE WHEN p.location_type = 1 THEN p.stop_name ELSE '' END,
+		       s.platform_code
 		FROM stops_rtree AS r
 		JOIN stops AS s ON s.rowid = r.id
+		LEFT JOIN stops AS p ON p.stop_id = s.parent_station
 		WHERE r.min_lat >= ? AND r.max_lat <= ?
 		  AND r.min_lon >= ? AND r.max_lon <= ?
 		ORDER BY (s.stop_lat - ?)*(s.stop_lat - ?) + (s.stop_lon - ?)*(s.stop_lon - ?)
@@ -68,7 +92,8 @@ func (db *DB) NearbyStops(ctx context.Context, lat, lon, latDeg, lonDeg float64,
 		var stopDesc sql.NullString
 		if err := rows.Scan(&s.StopID, &s.StopCode, &s.StopName, &stopDesc,
 			&s.StopLat, &s.StopLon,
-			&s.LocationType, &s.WheelchairBoarding); err != nil {
+			&s.LocationType, &s.WheelchairBoarding,
+			&s.StationID, &s.StationName, &s.PlatformCode); err != nil {
 			return nil, fmt.Errorf("scan stop: %w", err)
 		}
 		s.StopDesc = stopDesc.String
@@ -77,6 +102,72 @@ func (db *DB) NearbyStops(ctx context.Context, lat, lon, latDeg, lonDeg float64,
 	return stops, rows.Err()
 }
 
+// StopRow is a single stop's static details.
+type StopRow struct {
+	StopID             string
+	StopCode           string
+	StopName           string
+	StopDesc           string
+	StopLat            float64
+	StopLon            float64
+	LocationType       int
+	ParentStation      string
+	WheelchairBoarding int
+	PlatformCode       string
+}
+
+// GetStop looks up a stop by ID. Returns sql.ErrNoRows if not found.
+func (db *DB) GetStop(ctx context.Context, stopID string) (*StopRow, error) {
+	var s StopRow
+	var code, desc, parent sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT s.stop_id, s.stop_code, s.stop_name, s.stop_desc, s.stop_lat, s.stop_lon,
+		       s.location_type, s.parent_station, `+stopWheelchairBoarding+`, s.platform_code
+		FROM stops AS s
+		LEFT JOIN stops AS p ON p.stop_id = s.parent_station
+		WHERE s.stop_id = ?`, stopID).Scan(
+		&s.StopID, &code, &s.StopName, &desc, &s.StopLat, &s.StopLon,
+		&s.LocationType, &parent, &s.WheelchairBoarding, &s.PlatformCode)
+	if err != nil {
+		return nil, err
+	}
+	s.StopCode = code.String
+	s.StopDesc = desc.String
+	s.ParentStation = parent.String
+	return &s, nil
+}
+
+// StationPlatforms returns the stops where vehicles board (location_type 0)
+// within station stationID, ordered by platform code then name.
+func (db *DB) StationPlatforms(ctx context.Context, stationID string) ([]StopRow, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT s.stop_id, s.stop_code, s.stop_name, s.stop_desc, s.stop_lat, s.stop_lon,
+		       s.location_type, s.parent_station, `+stopWheelchairBoarding+`, s.platform_code
+		FROM stops AS s
+		JOIN stops AS p ON p.stop_id = s.parent_station
+		WHERE s.parent_station = ? AND s.location_type = 0
+		ORDER BY s.platform_code = '', s.platform_code, s.stop_name, s.stop_id`, stationID)
+	if err != nil {
+		return nil, fmt.Errorf("station platforms query: %w", err)
+	}
+	defer rows.Close()
+
+	var stops []StopRow
+	for rows.Next() {
+		var s StopRow
+		var code, desc, parent sql.NullString
+		if err := rows.Scan(&s.StopID, &code, &s.StopName, &desc, &s.StopLat, &s.StopLon,
+			&s.LocationType, &parent, &s.WheelchairBoarding, &s.PlatformCode); err != nil {
+			return nil, fmt.Errorf("scan platform: %w", err)
+		}
+		s.StopCode = code.String
+		s.StopDesc = desc.String
+		s.ParentStation = parent.String
+		stops = append(stops, s)
+	}
+	return stops, rows.Err()
+}
+
 // DepartureRow represents a scheduled departure at a stop.
 type DepartureRow struct {
 	TripID        string
@@ -89,70 +180,9 @@ type DepartureRow struct {
 	DirectionID   int
 	DepartureTime string // HH:MM:SS format (can exceed 24:00:00 for next-day trips)
 	StopSequence  int
-}
-
-// StopSearchResult is a distinct intersection found by a cross-street search.
-type StopSearchResult struct {
-	Name string
-	Lat  float64
-	Lon  float64
-}
-
-// SearchStops searches for stops matching a cross-street query.
-// It splits the query on common separators and finds stops whose name
-// contains both parts. Results are grouped by stop_name with averaged coordinates.
-func (db *DB) SearchStops(ctx context.Context, query string) ([]StopSearchResult, error) {
-	q := strings.ToLower(strings.TrimSpace(query))
-	var parts []string
-	for _, sep := range []string{" and ", " & ", " at ", "/", " n ", " near "} {
-		if i := strings.Index(q, sep); i > 0 {
-			parts = []string{
-				strings.TrimSpace(q[:i]),
-				strings.TrimSpace(q[i+len(sep):]),
-			}
-			break
-		}
-	}
-	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
-		parts = []string{q}
-	}
-
-	var rows *sql.Rows
-	var err error
-	if len(parts) == 2 {
-		rows, err = db.QueryContext(ctx, `
-			SELECT stop_name, AVG(stop_lat), AVG(stop_lon)
-			FROM stops
-			WHERE LOWER(stop_name) LIKE '%' || ? || '%'
-			  AND LOWER(stop_name) LIKE '%' || ? || '%'
-			  AND location_type = 0
-			GROUP BY stop_name
-			ORDER BY stop_name
-			LIMIT 20`, parts[0], parts[1])
-	} else {
-		rows, err = db.QueryContext(ctx, `
-			SELECT stop_name, AVG(stop_lat), AVG(stop_lon)
-			FROM stops
-			WHERE LOWER(stop_name) LIKE '%' || ? || '%'
-			  AND location_type = 0
-			GROUP BY stop_name
-			ORDER BY stop_name
-			LIMIT 20`, parts[0])
-	}
-	if err != nil {
-		return nil, fmt.Errorf("search stops: %w", err)
-	}
-	defer rows.Close()
 
-	var results []StopSearchResult
-	for rows.Next() {
-		var r StopSearchResult
-		if err := rows.Scan(&r.Name, &r.Lat, &r.Lon); err != nil {
-			return nil, fmt.Errorf("scan stop: %w", err)
-		}
-		results = append(results, r)
-	}
-	return results, rows.Err()
+	WheelchairAccessible int // AccessUnknown, AccessYes or AccessNo
+	BikesAllowed         int
 }
 
 // DeparturesForStop returns upcoming scheduled departures for a stop on a given date.
@@ -165,7 +195,8 @@ func (db *DB) DeparturesForStop(ctx context.Context, stopID string, date time.Ti
 	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
 		SELECT st.trip_id, t.route_id, r.route_short_name, r.route_long_name,
 		       r.route_color, r.route_type, t.trip_headsign, t.direction_id,
-		       st.departure_time, st.stop_sequence
+		       st.departure_time, st.stop_sequence,
+		       t.wheelchair_accessible, t.bikes_allowed
 		FROM stop_times st
 		JOIN trips t ON t.trip_id = st.trip_id
 		JOIN routes r ON r.route_id = t.route_id
@@ -202,7 +233,8 @@ func (db *DB) DeparturesForStop(ctx context.Context, stopID string, date time.Ti
 		var d DepartureRow
 		if err := rows.Scan(&d.TripID, &d.RouteID, &d.RouteShort, &d.RouteLong,
 			&d.RouteColor, &d.RouteType, &d.TripHeadsign, &d.DirectionID,
-			&d.DepartureTime, &d.StopSequence); err != nil {
+			&d.DepartureTime, &d.StopSequence,
+			&d.WheelchairAccessible, &d.BikesAllowed); err != nil {
 			return nil, fmt.Errorf("scan departure: %w", err)
 		}
 		deps = append(deps, d)
@@ -258,15 +290,46 @@ func (db *DB) AllDeparturesForStopRoute(ctx context.Context, stopID, routeID str
 	return times, rows.Err()
 }
 
-// StopsForRoute returns all stops on a route in a given direction, ordered by stop_sequence.
-func (db *DB) StopsForRoute(ctx context.Context, routeID string, directionID int, date time.Time) ([]StopOnRoute, error) {
+// StopsForTrip returns the stops a trip serves, ordered by stop_sequence.
+// With RepresentativeTrip it lists the stops of a route in one direction.
+func (db *DB) StopsForTrip(ctx context.Context, tripID string) ([]StopOnRoute, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT s.stop_id, s.stop_name, s.stop_lat, s.stop_lon, st.stop_sequence
+		FROM stop_times st
+		JOIN stops s ON s.stop_id = st.stop_id
+		WHERE st.trip_id = ?
+		ORDER BY st.stop_sequence`,
+		tripID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("stops for route query: %w", err)
+	}
+	defer rows.Close()
+
+	var stops []StopOnRoute
+	for rows.Next() {
+		var s StopOnRoute
+		if err := rows.Scan(&s.StopID, &s.StopName, &s.StopLat, &s.StopLon, &s.StopSequence); err != nil {
+			return nil, fmt.Errorf("scan stop on route: %w", err)
+		}
+		stops = append(stops, s)
+	}
+	return stops, rows.Err()
+}
+
+// RepresentativeTrip picks the trip that stands for a route/direction on the
+// given date: of the trips running that day, the one serving the most stops,
+// so short turns and partial trips lose to the full pattern, then the lowest
+// trip_id, so the choice is the same on every request.
+// Returns the trip_id and its shape_id (empty if the trip has no shape).
+func (db *DB) RepresentativeTrip(ctx context.Context, routeID string, directionID int, date time.Time) (string, string, error) {
 	dateStr := date.Format("20060102")
 	dayCol := dayColumn(date.Weekday())
 
-	// Get a representative trip for this route/direction on this date
 	var tripID string
+	var shapeID sql.NullString
 	err := db.QueryRowContext(ctx, fmt.Sprintf(`
-		SELECT t.trip_id
+		SELECT t.trip_id, t.shape_id
 		FROM trips t
 		WHERE t.route_id = ?
 		  AND t.direction_id = ?
@@ -283,38 +346,17 @@ func (db *DB) StopsForRoute(ctx context.Context, routeID string, directionID int
 		      WHERE date = ? AND exception_type = 1
 		    )
 		  )
+		ORDER BY (SELECT COUNT(*) FROM stop_times st WHERE st.trip_id = t.trip_id) DESC, t.trip_id
 		LIMIT 1`, dayCol),
 		routeID, directionID,
 		dateStr, dateStr,
 		dateStr,
 		dateStr,
-	).Scan(&tripID)
-	if err != nil {
-		return nil, fmt.Errorf("find representative trip: %w", err)
-	}
-
-	rows, err := db.QueryContext(ctx, `
-		SELECT s.stop_id, s.stop_name, s.stop_lat, s.stop_lon, st.stop_sequence
-		FROM stop_times st
-		JOIN stops s ON s.stop_id = st.stop_id
-		WHERE st.trip_id = ?
-		ORDER BY st.stop_sequence`,
-		tripID,
-	)
+	).Scan(&tripID, &shapeID)
 	if err != nil {
-		return nil, fmt.Errorf("stops for route query: %w", err)
+		return "", "", fmt.Errorf("find representative trip: %w", err)
 	}
-	defer rows.Close()
-
-	var stops []StopOnRoute
-	for rows.Next() {
-		var s StopOnRoute
-		if err := rows.Scan(&s.StopID, &s.StopName, &s.StopLat, &s.StopLon, &s.StopSequence); err != nil {
-			return nil, fmt.Errorf("scan stop on route: %w", err)
-		}
-		stops = append(stops, s)
-	}
-	return stops, rows.Err()
+	return tripID, shapeID.String, nil
 }
 
 // StopOnRoute represents a stop along a specific route.
@@ -367,6 +409,31 @@ func (db *DB) HasData(ctx context.Context) bool {
 	return err == nil && count > 0
 }
 
+// ServiceEndDate returns the last date (YYYYMMDD) the imported schedule has
+// service on, or "" if nothing is imported.
+func (db *DB) ServiceEndDate(ctx context.Context) (string, error) {
+	var end sql.NullString
+	err := db.QueryRowContext(ctx,
+		`SELECT MAX(d) FROM (
+		   SELECT MAX(end_date) AS d FROM calendar
+		   UNION ALL
+		   SELECT MAX(date) FROM calendar_dates WHERE exception_type = 1
+		 )`).Scan(&end)
+	if err != nil {
+		return "", fmt.Errorf("service end date: %w", err)
+	}
+	return end.String, nil
+}
+
+// CheckWritable confirms the database accepts writes by updating a
+// settings row, for the readiness probe.
+func (db *DB) CheckWritable(ctx context.Context) error {
+	if err := db.SetSetting(ctx, "health_check", time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("write check: %w", err)
+	}
+	return nil
+}
+
 // RebuildRTree repopulates the R-Tree index from the stops table.
 func (db *DB) RebuildRTree(ctx context.Context, tx *sql.Tx) error {
 	if _, err := tx.ExecContext(ctx, `DELETE FROM stops_rtree`); err != nil {
@@ -385,6 +452,10 @@ type UserRow struct {
 	ID             int
 	Username       string
 	PassphraseHash string
+	IsAdmin        bool
+	Disabled       bool
+	AccessibleOnly bool    // hide stops and trips marked not wheelchair accessible
+	WalkSpeed      float64 // meters per minute; 0 means the default
 }
 
 // CreateUser inserts a new user. Returns the user ID.
@@ -402,8 +473,20 @@ func (db *DB) CreateUser(ctx context.Context, username, passphraseHash string) (
 func (db *DB) GetUserByUsername(ctx context.Context, username string) (*UserRow, error) {
 	var u UserRow
 	err := db.QueryRowContext(ctx,
-		`SELECT id, username, passphrase_hash FROM users WHERE username = ?`,
-		username).Scan(&u.ID, &u.Username, &u.PassphraseHash)
+		`SELECT id, username, passphrase_hash, is_admin, disabled, accessible_only, walk_speed FROM users WHERE username = ?`,
+		username).Scan(&u.ID, &u.Username, &u.PassphraseHash, &u.IsAdmin, &u.Disabled, &u.AccessibleOnly, &u.WalkSpeed)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetUserByID looks up a user by ID. Returns sql.ErrNoRows if not found.
+func (db *DB) GetUserByID(ctx context.Context, id int64) (*UserRow, error) {
+	var u UserRow
+	err := db.QueryRowContext(ctx,
+		`SELECT id, username, passphrase_hash, is_admin, disabled, accessible_only, walk_speed FROM users WHERE id = ?`,
+		id).Scan(&u.ID, &u.Username, &u.PassphraseHash, &u.IsAdmin, &u.Disabled, &u.AccessibleOnly, &u.WalkSpeed)
 	if err != nil {
 		return nil, err
 	}
@@ -417,12 +500,14 @@ func (db *DB) CountUsers(ctx context.Context) (int, error) {
 	return count, err
 }
 
-// UpsertDeviceSession records or updates a device's last-seen time for a user.
-func (db *DB) UpsertDeviceSession(ctx context.Context, userID int64, deviceID string) error {
+// UpsertDeviceSession records a sign-in from a device, or updates its
+// last-seen time and user agent. name is only used for a new device, so a
+// name the user chose is kept.
+func (db *DB) UpsertDeviceSession(ctx context.Context, userID int64, deviceID, name, userAgent string) error {
 	_, err := db.ExecContext(ctx,
-		`INSERT INTO device_sessions (user_id, device_id, last_seen) VALUES (?, ?, datetime('now'))
-		 ON CONFLICT(user_id, device_id) DO UPDATE SET last_seen = datetime('now')`,
-		userID, deviceID)
+		`INSERT INTO device_sessions (user_id, device_id, last_seen, name, user_agent) VALUES (?, ?, datetime('now'), ?, ?)
+		 ON CONFLICT(user_id, device_id) DO UPDATE SET last_seen = datetime('now'), user_agent = excluded.user_agent`,
+		userID, deviceID, name, userAgent)
 	return err
 }
 
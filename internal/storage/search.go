@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"gobus/internal/search"
+)
+
+// StopSearchResult is a distinct stop name found by a search, at the
+// average position of the stops that share it, or a station.
+type StopSearchResult struct {
+	Name      string
+	Lat       float64
+	Lon       float64
+	StationID string // set if the result is a station (location_type 1)
+}
+
+// searchIndexVersion changes whenever RebuildSearchIndex would build a
+// different index from the same stops, so ensureSearchIndex rebuilds it.
+const searchIndexVersion = "2"
+
+// createSearchFTS creates the FTS5 index over stop_search. Without FTS5
+// (a binary built without the sqlite_fts5 tag) searches fall back to LIKE
+// over stop_search.norm, which gives the same matches, only ranked more
+// crudely and slower.
+func (db *DB) createSearchFTS() error {
+	_, err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS stop_search_fts USING fts5(
+		norm, content='stop_search', content_rowid='id', prefix='2 3'
+	)`)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			db.logger.Warn("SQLite has no FTS5, stop search falls back to LIKE matching; build with -tags sqlite_fts5")
+			return nil
+		}
+		return fmt.Errorf("create stop_search_fts: %w", err)
+	}
+	db.fts = true
+	return nil
+}
+
+// ensureSearchIndex builds the search tables for a database imported before
+// they existed or changed, and refreshes the FTS index, which is cheap and
+// may be stale if a binary without FTS5 last imported the feed.
+func (db *DB) ensureSearchIndex(ctx context.Context) error {
+	version, err := db.GetMetadata(ctx, "search_index")
+	if err != nil {
+		return fmt.Errorf("read search index version: %w", err)
+	}
+	if version != searchIndexVersion && db.HasData(ctx) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := db.RebuildSearchIndex(ctx, tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	if db.fts {
+		if _, err := db.ExecContext(ctx, `INSERT INTO stop_search_fts(stop_search_fts) VALUES('rebuild')`); err != nil {
+			return fmt.Errorf("rebuild stop_search_fts: %w", err)
+		}
+	}
+	return nil
+}
+
+// RebuildSearchIndex repopulates the stop name search tables from the stops
+// table. Names are normalized with search.Terms so that abbreviations and
+// spelled-out forms match each other. Stations get a row each, ranked by
+// how many stops they contain.
+func (db *DB) RebuildSearchIndex(ctx context.Context, tx *sql.Tx) error {
+	type stopName struct {
+		name      string
+		lat, lon  float64
+		stops     int
+		stationID string
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT stop_name, AVG(stop_lat), AVG(stop_lon), COUNT(*), ''
+		FROM stops
+		WHERE location_type = 0
+		GROUP BY stop_name
+		UNION ALL
+		SELECT st.stop_name, st.stop_lat, st.stop_lon,
+		       (SELECT COUNT(*) FROM stops AS p WHERE p.parent_station = st.stop_id), st.stop_id
+		FROM stops AS st
+		WHERE st.location_type = 1`)
+	if err != nil {
+		return fmt.Errorf("read stop names: %w", err)
+	}
+	var names []stopName
+	for rows.Next() {
+		var n stopName
+		if err := rows.Scan(&n.name, &n.lat, &n.lon, &n.stops, &n.stationID); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan stop name: %w", err)
+		}
+		names = append(names, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read stop names: %w", err)
+	}
+
+	for _, t := range []string{"stop_search", "search_terms"} {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", t)); err != nil {
+			return fmt.Errorf("clear %s: %w", t, err)
+		}
+	}
+	insName, err := tx.PrepareContext(ctx,
+		`INSERT INTO stop_search (name, norm, lat, lon, stops, station_id) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare stop_search: %w", err)
+	}
+	defer insName.Close()
+	freq := make(map[string]int)
+	for _, n := range names {
+		terms := search.Terms(n.name)
+		for _, t := range terms {
+			freq[t]++
+		}
+		if _, err := insName.ExecContext(ctx, n.name, strings.Join(terms, " "), n.lat, n.lon, n.stops, n.stationID); err != nil {
+			return fmt.Errorf("insert stop_search: %w", err)
+		}
+	}
+
+	insTerm, err := tx.PrepareContext(ctx, `INSERT INTO search_terms (term, freq) VALUES (?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare search_terms: %w", err)
+	}
+	defer insTerm.Close()
+	for t, n := range freq {
+		if _, err := insTerm.ExecContext(ctx, t, n); err != nil {
+			return fmt.Errorf("insert search_terms: %w", err)
+		}
+	}
+
+	if db.fts {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO stop_search_fts(stop_search_fts) VALUES('rebuild')`); err != nil {
+			return fmt.Errorf("rebuild stop_search_fts: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT OR REPLACE INTO feed_metadata (key, value) VALUES ('search_index', ?)`, searchIndexVersion); err != nil {
+		return fmt.Errorf("set search_index: %w", err)
+	}
+	return nil
+}
+
+// SearchStops finds stop names matching a query such as cross streets
+// ("Lake & Lyndale"), in any word order. Words may be abbreviated,
+// spelled out, cut short or have a typo. Best matches come first.
+func (db *DB) SearchStops(ctx context.Context, query string) ([]StopSearchResult, error) {
+	return db.searchStops(ctx, query, false, 20)
+}
+
+// SuggestStops is SearchStops for autocomplete: the last word is taken to
+// be unfinished, so it also matches longer words it starts.
+func (db *DB) SuggestStops(ctx context.Context, query string, limit int) ([]StopSearchResult, error) {
+	return db.searchStops(ctx, query, true, limit)
+}
+
+// StopsByCode returns the stops whose stop_code, the number on the stop
+// sign, is code. Codes should be unique but feeds don't promise it.
+func (db *DB) StopsByCode(ctx context.Context, code string) ([]StopRow, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT stop_id, stop_code, stop_name, stop_desc, stop_lat, stop_lon,
+		       location_type, parent_station, wheelchair_boarding
+		FROM stops
+		WHERE stop_code = ? AND location_type = 0
+		ORDER BY stop_id`, code)
+	if err != nil {
+		return nil, fmt.Errorf("stops by code: %w", err)
+	}
+	defer rows.Close()
+
+	var stops []StopRow
+	for rows.Next() {
+		var s StopRow
+		var code, desc, parent sql.NullString
+		if err := rows.Scan(&s.StopID, &code, &s.StopName, &desc, &s.StopLat, &s.StopLon,
+			&s.LocationType, &parent, &s.WheelchairBoarding); err != nil {
+			return nil, fmt.Errorf("scan stop: %w", err)
+		}
+		s.StopCode, s.StopDesc, s.ParentStation = code.String, desc.String, parent.String
+		stops = append(stops, s)
+	}
+	return stops, rows.Err()
+}
+
+// termMatch is what one query term may match in a stop name: any of the
+// exact terms, or any term starting with prefix.
+type termMatch struct {
+	exact  []string
+	prefix string
+}
+
+func (db *DB) searchStops(ctx context.Context, query string, typing bool, limit int) ([]StopSearchResult, error) {
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	matches := make([]termMatch, len(terms))
+	for i, t := range terms {
+		m, err := db.matchTerm(ctx, t, typing && i == len(terms)-1)
+		if err != nil {
+			return nil, err
+		}
+		if len(m.exact) == 0 && m.prefix == "" {
+			return nil, nil // every term must match something
+		}
+		matches[i] = m
+	}
+
+	var rows *sql.Rows
+	var err error
+	if db.fts {
+		rows, err = db.QueryContext(ctx, `
+			SELECT s.name, s.lat, s.lon, s.station_id
+			FROM stop_search_fts AS f
+			JOIN stop_search AS s ON s.id = f.rowid
+			WHERE stop_search_fts MATCH ?
+			ORDER BY bm25(stop_search_fts), s.stops DESC, s.name
+			LIMIT ?`, ftsQuery(matches), limit)
+	} else {
+		where, args := likeQuery(matches)
+		rows, err = db.QueryContext(ctx, `
+			SELECT name, lat, lon, station_id
+			FROM stop_search
+			WHERE `+where+`
+			ORDER BY stops DESC, name
+			LIMIT ?`, append(args, limit)...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("search stops: %w", err)
+	}
+	defer rows.Close()
+
+	var results []StopSearchResult
+	for rows.Next() {
+		var r StopSearchResult
+		if err := rows.Scan(&r.Name, &r.Lat, &r.Lon, &r.StationID); err != nil {
+			return nil, fmt.Errorf("scan stop: %w", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// matchTerm decides what a query term matches. A known term matches
+// itself; otherwise a term that starts known terms matches them as a
+// prefix; failing that, a likely typo matches the closest known terms.
+// typing also lets a known term match as a prefix.
+func (db *DB) matchTerm(ctx context.Context, term string, typing bool) (termMatch, error) {
+	var known int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM search_terms WHERE term = ?`, term).Scan(&known)
+	if err != nil {
+		return termMatch{}, fmt.Errorf("look up term: %w", err)
+	}
+	if known > 0 {
+		m := termMatch{exact: []string{term}}
+		if typing {
+			m.prefix = term
+		}
+		return m, nil
+	}
+
+	if len(term) >= 2 {
+		var starts int
+		err := db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM search_terms
+			WHERE term > ? AND term < ? || char(1114111)`, term, term).Scan(&starts)
+		if err != nil {
+			return termMatch{}, fmt.Errorf("look up term prefix: %w", err)
+		}
+		if starts > 0 {
+			return termMatch{prefix: term}, nil
+		}
+	}
+
+	// Typos rarely hit the first letter, so only words sharing it are
+	// compared; that keeps the candidate list to a few hundred.
+	first := []rune(term)[0]
+	rows, err := db.QueryContext(ctx, `
+		SELECT term FROM search_terms WHERE term >= ? AND term < ?`,
+		string(first), string(first+1))
+	if err != nil {
+		return termMatch{}, fmt.Errorf("load terms: %w", err)
+	}
+	defer rows.Close()
+	var vocab []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return termMatch{}, fmt.Errorf("scan term: %w", err)
+		}
+		vocab = append(vocab, t)
+	}
+	if err := rows.Err(); err != nil {
+		return termMatch{}, fmt.Errorf("load terms: %w", err)
+	}
+	return termMatch{exact: search.Closest(term, vocab, 3)}, nil
+}
+
+// ftsQuery builds an FTS5 MATCH expression requiring every term. Terms
+// are letters and digits only, so quoting them is enough.
+func ftsQuery(matches []termMatch) string {
+	groups := make([]string, len(matches))
+	for i, m := range matches {
+		var alts []string
+		for _, t := range m.exact {
+			alts = append(alts, `"`+t+`"`)
+		}
+		if m.prefix != "" {
+			alts = append(alts, `"`+m.prefix+`"*`)
+		}
+		groups[i] = "(" + strings.Join(alts, " OR ") + ")"
+	}
+	return strings.Join(groups, " AND ")
+}
+
+// likeQuery is ftsQuery as a WHERE clause over stop_search.norm.
+func likeQuery(matches []termMatch) (string, []any) {
+	var groups []string
+	var args []any
+	for _, m := range matches {
+		var alts []string
+		for _, t := range m.exact {
+			alts = append(alts, `' ' || norm || ' ' LIKE ?`)
+			args = append(args, "% "+t+" %")
+		}
+		if m.prefix != "" {
+			alts = append(alts, `' ' || norm LIKE ?`)
+			args = append(args, "% "+m.prefix+"%")
+		}
+		groups = append(groups, "("+strings.Join(alts, " OR ")+")")
+	}
+	return strings.Join(groups, " AND "), args
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SessionRow is a signed-in browser session.
+type SessionRow struct {
+	ID        string // HMAC of the cookie token
+	UserID    int64
+	DeviceID  string
+	LastSeen  time.Time
+	ExpiresAt time.Time
+}
+
+// CreateSession stores a new session.
+func (db *DB) CreateSession(ctx context.Context, id string, userID int64, deviceID string, expiresAt time.Time) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO sessions (id, user_id, device_id, expires_at) VALUES (?, ?, ?, datetime(?, 'unixepoch'))`,
+		id, userID, deviceID, expiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	return nil
+}
+
+// GetSession returns an unexpired session. Returns sql.ErrNoRows if the
+// session doesn't exist, was revoked, or has expired.
+func (db *DB) GetSession(ctx context.Context, id string) (*SessionRow, error) {
+	var s SessionRow
+	var lastSeen, expires int64
+	err := db.QueryRowContext(ctx,
+		`SELECT id, user_id, device_id,
+		        CAST(strftime('%s', last_seen) AS INTEGER),
+		        CAST(strftime('%s', expires_at) AS INTEGER)
+		 FROM sessions WHERE id = ? AND expires_at > datetime('now')`, id).
+		Scan(&s.ID, &s.UserID, &s.DeviceID, &lastSeen, &expires)
+	if err != nil {
+		return nil, err
+	}
+	s.LastSeen = time.Unix(lastSeen, 0)
+	s.ExpiresAt = time.Unix(expires, 0)
+	return &s, nil
+}
+
+// RefreshSession slides a session's expiry forward.
+func (db *DB) RefreshSession(ctx context.Context, id string, expiresAt time.Time) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE sessions SET last_seen = datetime('now'), expires_at = datetime(?, 'unixepoch') WHERE id = ?`,
+		expiresAt.Unix(), id)
+	if err != nil {
+		return fmt.Errorf("refresh session: %w", err)
+	}
+	return nil
+}
+
+// RekeySession replaces a session's ID, used when the token was hashed with
+// a previous cookie secret.
+func (db *DB) RekeySession(ctx context.Context, oldID, newID string) error {
+	_, err := db.ExecContext(ctx, `UPDATE sessions SET id = ? WHERE id = ?`, newID, oldID)
+	if err != nil {
+		return fmt.Errorf("rekey session: %w", err)
+	}
+	return nil
+}
+
+// DeleteSession revokes one session.
+func (db *DB) DeleteSession(ctx context.Context, id string) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, id)
+	return err
+}
+
+// DeleteSessionsForUser revokes every session a user has ("log out everywhere").
+func (db *DB) DeleteSessionsForUser(ctx context.Context, userID int64) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?`, userID)
+	return err
+}
+
+// DeleteSessionsForDevice revokes a user's sessions on one device.
+func (db *DB) DeleteSessionsForDevice(ctx context.Context, userID int64, deviceID string) error {
+	_, err := db.ExecContext(ctx,
+		`DELETE FROM sessions WHERE user_id = ? AND device_id = ?`, userID, deviceID)
+	return err
+}
+
+// DeleteExpiredSessions removes sessions past their expiry.
+func (db *DB) DeleteExpiredSessions(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= datetime('now')`)
+	return err
+}
+
+// GetSetting reads a server setting, returning "" if unset.
+func (db *DB) GetSetting(ctx context.Context, key string) (string, error) {
+	var value string
+	err := db.QueryRowContext(ctx, `SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetSetting stores a server setting.
+func (db *DB) SetSetting(ctx context.Context, key, value string) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)`, key, value)
+	return err
+}
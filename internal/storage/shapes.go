@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// ShapePoint is a single vertex of a route's geometry.
+type ShapePoint struct {
+	Lat float64
+	Lon float64
+}
+
+// Shape returns the points of a shape in order. Returns nil (no error) for
+// an empty shapeID, as RepresentativeTrip gives for a trip without a shape.
+func (db *DB) Shape(ctx context.Context, shapeID string) ([]ShapePoint, error) {
+	if shapeID == "" {
+		return nil, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT shape_pt_lat, shape_pt_lon
+		FROM shapes
+		WHERE shape_id = ?
+		ORDER BY shape_pt_sequence`,
+		shapeID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("shape query: %w", err)
+	}
+	defer rows.Close()
+
+	var points []ShapePoint
+	for rows.Next() {
+		var p ShapePoint
+		if err := rows.Scan(&p.Lat, &p.Lon); err != nil {
+			return nil, fmt.Errorf("scan shape point: %w", err)
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
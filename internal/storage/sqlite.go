@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
@@ -12,6 +13,7 @@ import (
 type DB struct {
 	*sql.DB
 	logger *slog.Logger
+	fts    bool // SQLite was built with FTS5 (the sqlite_fts5 build tag)
 }
 
 // Open creates or opens a SQLite database at the given path and applies migrations.
@@ -34,6 +36,10 @@ func Open(path string, logger *slog.Logger) (*DB, error) {
 		sqlDB.Close()
 		return nil, fmt.Errorf("migrate database: %w", err)
 	}
+	if err := db.ensureSearchIndex(context.Background()); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("build search index: %w", err)
+	}
 
 	logger.Info("database opened", "path", path)
 	return db, nil
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"gobus/internal/metrics"
+)
+
+var queryDuration = metrics.NewHistogram("gobus_db_query_duration_seconds",
+	"Time taken by SQLite statements, by the storage method that ran them. Statements inside transactions aren't included.",
+	[]float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5}, "method")
+
+// The methods below shadow those of the embedded *sql.DB so every query made
+// through DB is timed. For QueryContext the time is until the first row is
+// ready, not until the rows are read.
+
+// ExecContext runs a statement that returns no rows.
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer queryDuration.ObserveSince(time.Now(), callerMethod())
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+// QueryContext runs a query that returns rows.
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	defer queryDuration.ObserveSince(time.Now(), callerMethod())
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext runs a query that returns at most one row.
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	defer queryDuration.ObserveSince(time.Now(), callerMethod())
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+// callerNames caches method names by program counter; runtime.FuncForPC is
+// too slow to call on every query.
+var callerNames sync.Map
+
+// callerMethod names the function that called the DB method, e.g.
+// "ListInvites" or "handler.LaterArrivals" from outside this package.
+func callerMethod() string {
+	pc, _, _, ok := runtime.Caller(2)
+	if !ok {
+		return "unknown"
+	}
+	if name, ok := callerNames.Load(pc); ok {
+		return name.(string)
+	}
+	name := "unknown"
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name = methodName(fn.Name())
+	}
+	callerNames.Store(pc, name)
+	return name
+}
+
+// methodName shortens "gobus/internal/storage.(*DB).ListInvites.func1" to
+// "ListInvites" and "gobus/internal/handler.(*Handler).LaterArrivals" to
+// "handler.LaterArrivals".
+func methodName(full string) string {
+	pkg, rest, _ := strings.Cut(full[strings.LastIndex(full, "/")+1:], ".")
+	if i := strings.LastIndex(rest, ")."); i >= 0 {
+		rest = rest[i+2:]
+	}
+	rest, _, _ = strings.Cut(rest, ".")
+	if pkg == "storage" {
+		return rest
+	}
+	return pkg + "." + rest
+}
@@ -0,0 +1,200 @@
+// Package throttle tracks failed attempts per key (a client IP, a username)
+// and applies exponential backoff and temporary lockouts.
+//
+// After Policy.FreeAttempts failures within Policy.Window, each further
+// failure blocks the key for BaseDelay, 2×BaseDelay, 4×BaseDelay… up to
+// MaxDelay. Reaching Policy.LockoutAfter failures locks the key out for
+// LockoutDuration. A key's count resets once it has been quiet for Window.
+package throttle
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Policy holds the thresholds for one kind of key.
+type Policy struct {
+	FreeAttempts    int           // failures allowed before backoff starts
+	BaseDelay       time.Duration // first backoff delay
+	MaxDelay        time.Duration // cap on the backoff delay
+	LockoutAfter    int           // failures that trigger a lockout (0 = never)
+	LockoutDuration time.Duration
+	Window          time.Duration // quiet period after which failures are forgotten
+}
+
+// Lock is a key that is currently locked out.
+type Lock struct {
+	Key      string
+	Failures int
+	Until    time.Time
+}
+
+// Event records a lockout, for the admin view.
+type Event struct {
+	Key      string
+	Failures int
+	At       time.Time
+	Until    time.Time
+}
+
+// maxEvents bounds the lockout history kept in memory.
+const maxEvents = 200
+
+type entry struct {
+	failures     int
+	last         time.Time
+	blockedUntil time.Time // backoff or lockout, whichever ends later
+	locked       bool      // blockedUntil is a lockout rather than a backoff
+}
+
+// Limiter tracks failures for one Policy. It is safe for concurrent use.
+type Limiter struct {
+	policy Policy
+	now    func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	events    []Event
+	lastPrune time.Time
+}
+
+// New creates a Limiter.
+func New(p Policy) *Limiter {
+	return &Limiter{policy: p, now: time.Now, entries: make(map[string]*entry)}
+}
+
+// SetPolicy replaces the thresholds. Recorded failures are kept and judged
+// by the new policy from the next failure on; current blocks run out as set.
+func (l *Limiter) SetPolicy(p Policy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.policy = p
+}
+
+// Check returns how long key must wait before its next attempt, or 0 if it
+// may try now. locked reports whether the wait is a lockout.
+func (l *Limiter) Check(key string) (wait time.Duration, locked bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	if !ok {
+		return 0, false
+	}
+	now := l.now()
+	if now.Before(e.blockedUntil) {
+		return e.blockedUntil.Sub(now), e.locked
+	}
+	return 0, false
+}
+
+// Attempt admits an attempt for key unless it must wait, and counts an
+// admitted attempt as a failure right away, before the caller does the
+// slow work of checking it; a caller whose attempt succeeds calls Reset.
+// A burst of concurrent attempts therefore can't all get past a Check made
+// before any of them failed. wait is how long key must wait if the attempt
+// was refused, 0 if it was admitted. lockedOut reports whether counting it
+// started a lockout.
+func (l *Limiter) Attempt(key string) (wait time.Duration, lockedOut bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if e, ok := l.entries[key]; ok && now.Before(e.blockedUntil) {
+		return e.blockedUntil.Sub(now), false
+	}
+	_, lockedOut = l.failure(key, now)
+	return 0, lockedOut
+}
+
+// Failure records a failed attempt for key. It returns the wait now imposed
+// on the key, and whether this failure started a lockout.
+func (l *Limiter) Failure(key string) (wait time.Duration, lockedOut bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.failure(key, l.now())
+}
+
+// failure is Failure with l.mu held.
+func (l *Limiter) failure(key string, now time.Time) (wait time.Duration, lockedOut bool) {
+	l.prune(now)
+
+	e, ok := l.entries[key]
+	if !ok || (now.Sub(e.last) > l.policy.Window && !now.Before(e.blockedUntil)) {
+		e = &entry{}
+		l.entries[key] = e
+	}
+	e.failures++
+	e.last = now
+
+	p := l.policy
+	switch {
+	case p.LockoutAfter > 0 && e.failures >= p.LockoutAfter:
+		// Further failures while locked don't extend or re-log the lockout
+		if e.locked && now.Before(e.blockedUntil) {
+			return e.blockedUntil.Sub(now), false
+		}
+		e.locked = true
+		e.blockedUntil = now.Add(p.LockoutDuration)
+		l.events = append(l.events, Event{Key: key, Failures: e.failures, At: now, Until: e.blockedUntil})
+		if len(l.events) > maxEvents {
+			l.events = l.events[len(l.events)-maxEvents:]
+		}
+		return p.LockoutDuration, true
+	case e.failures > p.FreeAttempts:
+		delay := p.BaseDelay << (e.failures - p.FreeAttempts - 1)
+		if delay <= 0 || delay > p.MaxDelay { // <= 0 catches shift overflow
+			delay = p.MaxDelay
+		}
+		e.blockedUntil = now.Add(delay)
+		return delay, false
+	}
+	return 0, false
+}
+
+// Reset forgets key's failures and lifts any backoff or lockout, e.g. after
+// a successful sign-in or when an admin unlocks it.
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// Locks returns the keys currently locked out, soonest expiry first.
+func (l *Limiter) Locks() []Lock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	var locks []Lock
+	for key, e := range l.entries {
+		if e.locked && now.Before(e.blockedUntil) {
+			locks = append(locks, Lock{Key: key, Failures: e.failures, Until: e.blockedUntil})
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Until.Before(locks[j].Until) })
+	return locks
+}
+
+// Events returns recent lockouts, newest first.
+func (l *Limiter) Events() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := make([]Event, len(l.events))
+	for i, ev := range l.events {
+		events[len(events)-1-i] = ev
+	}
+	return events
+}
+
+// prune drops entries that have gone quiet, at most once per Window, so a
+// spray of one-off keys can't grow the map without bound.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.policy.Window {
+		return
+	}
+	l.lastPrune = now
+	for key, e := range l.entries {
+		if now.Sub(e.last) > l.policy.Window && !now.Before(e.blockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package throttle
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        4 * time.Second,
+	LockoutAfter:    8,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter() (*Limiter, *clock) {
+	c := &clock{t: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)}
+	l := New(testPolicy)
+	l.now = c.now
+	return l, c
+}
+
+func TestFailure_Backoff(t *testing.T) {
+	l, _ := newTestLimiter()
+	want := []time.Duration{0, 0, 0, 1 * time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	for i, w := range want {
+		got, locked := l.Failure("user:alice")
+		if got != w || locked {
+			t.Errorf("failure %d: wait = %v, locked = %v; want %v, false", i+1, got, locked, w)
+		}
+	}
+	if wait, locked := l.Check("user:alice"); wait != 4*time.Second || locked {
+		t.Errorf("Check = %v, %v; want 4s backoff", wait, locked)
+	}
+	if wait, _ := l.Check("user:bob"); wait != 0 {
+		t.Errorf("unrelated key should not wait, got %v", wait)
+	}
+}
+
+func TestFailure_Lockout(t *testing.T) {
+	l, c := newTestLimiter()
+	for i := 0; i < testPolicy.LockoutAfter-1; i++ {
+		l.Failure("ip:192.0.2.1")
+	}
+	wait, lockedOut := l.Failure("ip:192.0.2.1")
+	if !lockedOut || wait != testPolicy.LockoutDuration {
+		t.Fatalf("failure %d: wait = %v, lockedOut = %v; want lockout", testPolicy.LockoutAfter, wait, lockedOut)
+	}
+	if _, lockedOut := l.Failure("ip:192.0.2.1"); lockedOut {
+		t.Error("a failure during a lockout should not start a new one")
+	}
+	if locks := l.Locks(); len(locks) != 1 || locks[0].Key != "ip:192.0.2.1" {
+		t.Errorf("Locks = %+v, want one lock for ip:192.0.2.1", locks)
+	}
+	if events := l.Events(); len(events) != 1 {
+		t.Errorf("Events = %+v, want one lockout event", events)
+	}
+
+	c.advance(testPolicy.LockoutDuration + time.Second)
+	if wait, _ := l.Check("ip:192.0.2.1"); wait != 0 {
+		t.Errorf("lockout should have expired, wait = %v", wait)
+	}
+	if locks := l.Locks(); len(locks) != 0 {
+		t.Errorf("Locks after expiry = %+v, want none", locks)
+	}
+}
+
+func TestAttempt_Concurrent(t *testing.T) {
+	l, _ := newTestLimiter()
+	var (
+		wg       sync.WaitGroup
+		admitted atomic.Int32
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if wait, _ := l.Attempt("ip:192.0.2.1"); wait == 0 {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	// The free attempts, then the one that starts the backoff
+	if n := admitted.Load(); n != int32(testPolicy.FreeAttempts+1) {
+		t.Errorf("%d attempts admitted, want %d", n, testPolicy.FreeAttempts+1)
+	}
+}
+
+func TestFailure_WindowForgets(t *testing.T) {
+	l, c := newTestLimiter()
+	for i := 0; i < 5; i++ {
+		l.Failure("user:alice")
+	}
+	c.advance(testPolicy.Window + time.Minute)
+	if wait, _ := l.Failure("user:alice"); wait != 0 {
+		t.Errorf("failures older than the window should be forgotten, wait = %v", wait)
+	}
+}
+
+func TestReset(t *testing.T) {
+	l, _ := newTestLimiter()
+	for i := 0; i < testPolicy.LockoutAfter; i++ {
+		l.Failure("user:alice")
+	}
+	l.Reset("user:alice")
+	if wait, _ := l.Check("user:alice"); wait != 0 {
+		t.Errorf("Reset should lift the lockout, wait = %v", wait)
+	}
+	if events := l.Events(); len(events) != 1 {
+		t.Errorf("Reset should keep the lockout history, got %d events", len(events))
+	}
+}
+
+func TestPrune(t *testing.T) {
+	l, c := newTestLimiter()
+	l.Failure("ip:192.0.2.1")
+	for i := 0; i < testPolicy.LockoutAfter; i++ {
+		l.Failure("ip:192.0.2.2")
+	}
+	c.advance(testPolicy.Window + time.Minute)
+	l.Failure("ip:192.0.2.3")
+	if _, ok := l.entries["ip:192.0.2.1"]; ok {
+		t.Error("quiet entry should have been pruned")
+	}
+	if len(l.entries) != 1 {
+		t.Errorf("entries = %d, want 1", len(l.entries))
+	}
+}
@@ -0,0 +1,51 @@
+// Package upstream tracks the health of the external services GoBus depends
+// on (NexTrip, the GTFS-RT alerts feed), for the admin console.
+package upstream
+
+import (
+	"sync"
+	"time"
+)
+
+// Health records the outcome of requests to one upstream service. The zero
+// value is ready to use and safe for concurrent use.
+type Health struct {
+	mu     sync.Mutex
+	status Status
+}
+
+// Status is a snapshot of a service's health.
+type Status struct {
+	Requests    int64
+	Failures    int64
+	LastSuccess time.Time
+	LastFailure time.Time
+	LastError   string
+}
+
+// Record notes the outcome of one request; err is nil on success.
+func (h *Health) Record(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status.Requests++
+	if err == nil {
+		h.status.LastSuccess = time.Now()
+		return
+	}
+	h.status.Failures++
+	h.status.LastFailure = time.Now()
+	h.status.LastError = err.Error()
+}
+
+// Snapshot returns the current status.
+func (h *Health) Snapshot() Status {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+// OK reports whether the most recent request succeeded. A service that
+// hasn't been contacted yet counts as OK.
+func (s Status) OK() bool {
+	return !s.LastFailure.After(s.LastSuccess)
+}
@@ -0,0 +1,28 @@
+package upstream
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	var h Health
+	if !h.Snapshot().OK() {
+		t.Error("an upstream that hasn't been contacted should count as OK")
+	}
+
+	h.Record(errors.New("HTTP 503"))
+	s := h.Snapshot()
+	if s.OK() || s.Requests != 1 || s.Failures != 1 || s.LastError != "HTTP 503" {
+		t.Errorf("after a failure: %+v, OK = %v", s, s.OK())
+	}
+
+	h.Record(nil)
+	s = h.Snapshot()
+	if !s.OK() || s.Requests != 2 || s.Failures != 1 {
+		t.Errorf("after recovering: %+v, OK = %v", s, s.OK())
+	}
+	if s.LastError != "HTTP 503" {
+		t.Errorf("the last error should be kept after recovery, got %q", s.LastError)
+	}
+}
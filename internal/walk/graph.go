@@ -0,0 +1,327 @@
+// Package walk finds walking paths over a street network imported from an
+// OpenStreetMap extract, so walk times to stops follow real streets,
+// bridges and crossings instead of a straight line.
+package walk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"gobus/internal/geo"
+	"gobus/internal/osm"
+)
+
+// Point is a latitude/longitude position.
+type Point struct {
+	Lat, Lon float64
+}
+
+// Graph is a compact walk network: intersections and way ends as
+// vertices, and the walkable stretches between them as edges weighted by
+// their length along the way. Long stretches are split every
+// maxEdgeMeters so positions along them snap to a nearby vertex.
+type Graph struct {
+	lat, lon []int32   // vertex positions in units of 1e-7 degrees
+	first    []uint32  // the edges of vertex v are first[v]:first[v+1]
+	to       []uint32  // edge target vertex
+	length   []float32 // edge length in meters
+	cells    map[cell][]uint32
+}
+
+// maxEdgeMeters is the longest an edge gets before it is split.
+const maxEdgeMeters = 75
+
+// Vertices returns the number of vertices in g.
+func (g *Graph) Vertices() int { return len(g.lat) }
+
+// Edges returns the number of directed edges in g, two per stretch of way.
+func (g *Graph) Edges() int { return len(g.to) }
+
+func (g *Graph) point(v uint32) Point {
+	return Point{float64(g.lat[v]) * 1e-7, float64(g.lon[v]) * 1e-7}
+}
+
+// Import builds a walk graph from an OSM PBF extract. It reads r twice,
+// ways first and then the nodes they use, so memory goes on the walkable
+// network rather than the whole extract.
+func Import(r io.ReadSeeker) (*Graph, error) {
+	var ways [][]int64
+	used := make(map[int64]Point)
+	err := osm.Scan(r, nil, func(w osm.Way) {
+		if len(w.Refs) < 2 || !walkable(w.Tags) {
+			return
+		}
+		ways = append(ways, w.Refs)
+		for _, id := range w.Refs {
+			used[id] = Point{}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read ways: %w", err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	found := make(map[int64]bool, len(used))
+	err = osm.Scan(r, func(n osm.Node) {
+		if _, ok := used[n.ID]; ok {
+			used[n.ID] = Point{n.Lat, n.Lon}
+			found[n.ID] = true
+		}
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("read nodes: %w", err)
+	}
+	// Ways clipped at the edge of the extract reference nodes it leaves out
+	for id := range used {
+		if !found[id] {
+			delete(used, id)
+		}
+	}
+	g := build(ways, used)
+	if g.Vertices() == 0 {
+		return nil, errors.New("extract has no walkable ways")
+	}
+	return g, nil
+}
+
+// build makes a graph from walkable ways (node ID lists) and the node
+// positions. Nodes without a position break their way in two. Only the
+// largest connected network is kept: footpaths inside a mall or a
+// parking ramp that join nothing else would otherwise catch positions
+// nearby and leave them no way out.
+func build(ways [][]int64, nodes map[int64]Point) *Graph {
+	// A node is a vertex where ways meet or end
+	uses := make(map[int64]int)
+	for _, refs := range ways {
+		for i, id := range refs {
+			uses[id]++
+			if i == 0 || i == len(refs)-1 {
+				uses[id]++
+			}
+		}
+	}
+
+	vertex := make(map[int64]uint32)
+	var pts []Point
+	vertexOf := func(id int64) uint32 {
+		v, ok := vertex[id]
+		if !ok {
+			v = uint32(len(pts))
+			vertex[id] = v
+			pts = append(pts, nodes[id])
+		}
+		return v
+	}
+	type edge struct {
+		a, b   uint32
+		length float32
+	}
+	var edges []edge
+	for _, refs := range ways {
+		var last uint32
+		var lastPt Point
+		started := false
+		var acc float64
+		for i, id := range refs {
+			p, ok := nodes[id]
+			if !ok {
+				started = false
+				continue
+			}
+			if !started {
+				last, lastPt, acc, started = vertexOf(id), p, 0, true
+				continue
+			}
+			acc += geo.Haversine(lastPt.Lat, lastPt.Lon, p.Lat, p.Lon)
+			lastPt = p
+			end := i == len(refs)-1
+			if !end {
+				if _, ok := nodes[refs[i+1]]; !ok {
+					end = true
+				}
+			}
+			if uses[id] >= 2 || end || acc >= maxEdgeMeters {
+				v := vertexOf(id)
+				if v != last {
+					edges = append(edges, edge{last, v, float32(acc)})
+				}
+				last, acc = v, 0
+			}
+		}
+	}
+
+	// Keep the largest connected component
+	parent := make([]uint32, len(pts))
+	for i := range parent {
+		parent[i] = uint32(i)
+	}
+	var find func(uint32) uint32
+	find = func(v uint32) uint32 {
+		for parent[v] != v {
+			parent[v] = parent[parent[v]]
+			v = parent[v]
+		}
+		return v
+	}
+	for _, e := range edges {
+		if ra, rb := find(e.a), find(e.b); ra != rb {
+			parent[ra] = rb
+		}
+	}
+	size := make(map[uint32]int)
+	var biggest uint32
+	for v := range pts {
+		r := find(uint32(v))
+		size[r]++
+		if size[r] > size[biggest] {
+			biggest = r
+		}
+	}
+	remap := make([]int64, len(pts))
+	g := &Graph{}
+	for v, p := range pts {
+		if find(uint32(v)) != biggest {
+			remap[v] = -1
+			continue
+		}
+		remap[v] = int64(len(g.lat))
+		g.lat = append(g.lat, int32(math.Round(p.Lat*1e7)))
+		g.lon = append(g.lon, int32(math.Round(p.Lon*1e7)))
+	}
+
+	// Both directions of every edge, grouped by source vertex
+	degree := make([]uint32, len(g.lat)+1)
+	for _, e := range edges {
+		if remap[e.a] >= 0 {
+			degree[remap[e.a]]++
+			degree[remap[e.b]]++
+		}
+	}
+	g.first = make([]uint32, len(g.lat)+1)
+	for v := range g.lat {
+		g.first[v+1] = g.first[v] + degree[v]
+	}
+	g.to = make([]uint32, g.first[len(g.lat)])
+	g.length = make([]float32, len(g.to))
+	next := append([]uint32(nil), g.first[:len(g.lat)]...)
+	add := func(a, b int64, l float32) {
+		g.to[next[a]] = uint32(b)
+		g.length[next[a]] = l
+		next[a]++
+	}
+	for _, e := range edges {
+		a, b := remap[e.a], remap[e.b]
+		if a >= 0 {
+			add(a, b, e.length)
+			add(b, a, e.length)
+		}
+	}
+	g.index()
+	return g
+}
+
+// File format: magic, vertex and edge counts, then the arrays of Graph
+// in order, all little-endian.
+var magic = [8]byte{'G', 'B', 'W', 'A', 'L', 'K', 0, 1}
+
+// maxCount bounds the counts Load accepts; a whole-continent extract
+// stays well under it.
+const maxCount = 1 << 30
+
+// Save writes g to w.
+func (g *Graph) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, v := range []any{magic, uint32(len(g.lat)), uint32(len(g.to)), g.lat, g.lon, g.first, g.to, g.length} {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Load reads a graph written by Save.
+func Load(r io.Reader) (*Graph, error) {
+	br := bufio.NewReader(r)
+	var m [8]byte
+	var n, e uint32
+	if err := binary.Read(br, binary.LittleEndian, &m); err != nil {
+		return nil, fmt.Errorf("read walk graph: %w", err)
+	}
+	if m != magic {
+		return nil, errors.New("not a walk graph file, or from another version; import the extract again")
+	}
+	if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+		return nil, fmt.Errorf("read walk graph: %w", err)
+	}
+	if err := binary.Read(br, binary.LittleEndian, &e); err != nil {
+		return nil, fmt.Errorf("read walk graph: %w", err)
+	}
+	if n > maxCount || e > maxCount {
+		return nil, fmt.Errorf("walk graph counts %d/%d are out of range", n, e)
+	}
+	g := &Graph{
+		lat:    make([]int32, n),
+		lon:    make([]int32, n),
+		first:  make([]uint32, n+1),
+		to:     make([]uint32, e),
+		length: make([]float32, e),
+	}
+	for _, v := range []any{g.lat, g.lon, g.first, g.to, g.length} {
+		if err := binary.Read(br, binary.LittleEndian, v); err != nil {
+			return nil, fmt.Errorf("read walk graph: %w", err)
+		}
+	}
+	// Edge ranges must run in order from 0 to e, or neighbors would index
+	// out of range
+	if g.first[0] != 0 || g.first[n] != e {
+		return nil, errors.New("walk graph is corrupt")
+	}
+	for v := range n {
+		if g.first[v] > g.first[v+1] || g.first[v] > e {
+			return nil, errors.New("walk graph is corrupt")
+		}
+	}
+	for i, t := range g.to {
+		if l := float64(g.length[i]); t >= n || !(l >= 0) || math.IsInf(l, 0) {
+			return nil, errors.New("walk graph is corrupt")
+		}
+	}
+	g.index()
+	return g, nil
+}
+
+// LoadFile reads the graph at path.
+func LoadFile(path string) (*Graph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// SaveFile writes g to path, replacing it only once the new graph is
+// completely written.
+func (g *Graph) SaveFile(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := g.Save(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
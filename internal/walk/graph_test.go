@@ -0,0 +1,151 @@
+package walk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// riverGraph is two streets on either bank of a river, joined only by a
+// bridge 1.1 km to the north, plus a footpath loop that joins nothing.
+func riverGraph() *Graph {
+	nodes := map[int64]Point{
+		1: {44.9700, -93.2600}, // west bank, south
+		2: {44.9800, -93.2600}, // west end of the bridge
+		3: {44.9800, -93.2550}, // east end of the bridge
+		4: {44.9700, -93.2550}, // east bank, south
+		5: {44.9750, -93.2650}, // isolated footpath
+		6: {44.9751, -93.2650},
+	}
+	ways := [][]int64{
+		{1, 2},
+		{2, 3},
+		{3, 4},
+		{5, 6},
+		{4, 99}, // 99 is outside the extract
+	}
+	return build(ways, nodes)
+}
+
+func TestBuildKeepsLargestNetwork(t *testing.T) {
+	g := riverGraph()
+	if g.Vertices() != 4 {
+		t.Errorf("Vertices() = %d, want 4 (the isolated footpath dropped)", g.Vertices())
+	}
+	if g.Edges() != 6 {
+		t.Errorf("Edges() = %d, want 6 (3 stretches, both ways)", g.Edges())
+	}
+}
+
+func TestDistancesFollowStreets(t *testing.T) {
+	g := riverGraph()
+	from := Point{44.9700, -93.2600}
+	to := []Point{
+		{44.9700, -93.2550}, // across the river, 400 m as the crow flies
+		{44.9800, -93.2600}, // straight up the west bank
+		{45.5000, -93.2600}, // nowhere near the network
+	}
+	d, ok := g.Distances(from, to, 5000)
+	if !ok {
+		t.Fatal("Distances: origin not routable")
+	}
+	if math.Abs(d[0]-2618) > 20 {
+		t.Errorf("across the river = %.0f m, want about 2618 (via the bridge)", d[0])
+	}
+	if math.Abs(d[1]-1112) > 10 {
+		t.Errorf("up the west bank = %.0f m, want about 1112", d[1])
+	}
+	if !math.IsInf(d[2], 1) {
+		t.Errorf("off the network = %.0f m, want +Inf", d[2])
+	}
+
+	d, _ = g.Distances(from, to[:1], 2000)
+	if !math.IsInf(d[0], 1) {
+		t.Errorf("across the river with a 2 km limit = %.0f m, want +Inf", d[0])
+	}
+
+	if _, ok := g.Distances(Point{45.5, -93.26}, to, 5000); ok {
+		t.Error("Distances from off the network: ok = true")
+	}
+}
+
+func TestRoute(t *testing.T) {
+	g := riverGraph()
+	from, to := Point{44.9701, -93.2601}, Point{44.9701, -93.2549}
+	p, ok := g.Route(from, to, 5000)
+	if !ok {
+		t.Fatal("Route: no path")
+	}
+	if math.Abs(p.Meters-2618) > 40 {
+		t.Errorf("Meters = %.0f, want about 2618", p.Meters)
+	}
+	// Start, the four vertices along the way, end
+	if len(p.Points) != 6 || p.Points[0] != from || p.Points[5] != to {
+		t.Errorf("Points = %v", p.Points)
+	}
+	if p.Points[2].Lat < 44.979 || p.Points[3].Lat < 44.979 {
+		t.Errorf("path doesn't cross the bridge: %v", p.Points)
+	}
+	if _, ok := g.Route(from, to, 1000); ok {
+		t.Error("Route with a 1 km limit found a path")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	g := riverGraph()
+	var buf bytes.Buffer
+	if err := g.Save(&buf); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	g2, err := Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if g2.Vertices() != g.Vertices() || g2.Edges() != g.Edges() {
+		t.Fatalf("loaded %d/%d, want %d/%d", g2.Vertices(), g2.Edges(), g.Vertices(), g.Edges())
+	}
+	d, _ := g2.Distances(Point{44.97, -93.26}, []Point{{44.97, -93.255}}, 5000)
+	if math.Abs(d[0]-2618) > 20 {
+		t.Errorf("loaded graph distance = %.0f m", d[0])
+	}
+
+	if _, err := Load(bytes.NewReader([]byte("not a graph"))); err == nil {
+		t.Error("Load of garbage succeeded")
+	}
+	data := buf.Bytes()
+	if _, err := Load(bytes.NewReader(data[:len(data)-3])); err == nil {
+		t.Error("Load of a truncated graph succeeded")
+	}
+	// first[1] past the edge count: header, then lat and lon, then first
+	bad := bytes.Clone(data)
+	binary.LittleEndian.PutUint32(bad[16+8*g.Vertices()+4:], uint32(g.Edges()+1))
+	if _, err := Load(bytes.NewReader(bad)); err == nil {
+		t.Error("Load of a graph with out-of-order edge ranges succeeded")
+	}
+}
+
+func TestWalkable(t *testing.T) {
+	tests := []struct {
+		tags map[string]string
+		want bool
+	}{
+		{map[string]string{"highway": "footway"}, true},
+		{map[string]string{"highway": "residential", "oneway": "yes"}, true},
+		{map[string]string{"highway": "motorway"}, false},
+		{map[string]string{"highway": "trunk"}, false},
+		{map[string]string{"highway": "trunk", "foot": "yes"}, true},
+		{map[string]string{"highway": "primary", "foot": "no"}, false},
+		{map[string]string{"highway": "service", "access": "private"}, false},
+		{map[string]string{"highway": "service", "access": "private", "foot": "yes"}, true},
+		{map[string]string{"railway": "platform"}, true},
+		{map[string]string{"building": "yes"}, false},
+		{map[string]string{"highway": "service", "area": "yes"}, false},
+		{map[string]string{"highway": "pedestrian", "area": "yes"}, true},
+	}
+	for _, tt := range tests {
+		if got := walkable(tt.tags); got != tt.want {
+			t.Errorf("walkable(%v) = %v, want %v", tt.tags, got, tt.want)
+		}
+	}
+}
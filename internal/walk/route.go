@@ -0,0 +1,192 @@
+package walk
+
+import (
+	"container/heap"
+	"math"
+
+	"gobus/internal/geo"
+)
+
+// MaxSnapMeters is the farthest a position can be from the network and
+// still be routed from. Past it (off the imported extract, or across a
+// field with no paths) callers should fall back to an estimate.
+const MaxSnapMeters = 400
+
+// cellDegrees is the size of the grid cells vertices are indexed by,
+// about 280 m north-south.
+const cellDegrees = 0.0025
+
+type cell struct{ y, x int32 }
+
+func cellOf(lat, lon float64) cell {
+	return cell{int32(math.Floor(lat / cellDegrees)), int32(math.Floor(lon / cellDegrees))}
+}
+
+func (g *Graph) index() {
+	g.cells = make(map[cell][]uint32)
+	for v := range g.lat {
+		p := g.point(uint32(v))
+		c := cellOf(p.Lat, p.Lon)
+		g.cells[c] = append(g.cells[c], uint32(v))
+	}
+}
+
+// nearest returns the vertex closest to p within MaxSnapMeters and how
+// far it is.
+func (g *Graph) nearest(p Point) (uint32, float64, bool) {
+	c := cellOf(p.Lat, p.Lon)
+	// Cells are narrower east-west away from the equator
+	rings := int32(math.Ceil(MaxSnapMeters / (cellDegrees * 111_000 * math.Cos(p.Lat*math.Pi/180))))
+	best, bestDist := uint32(0), math.Inf(1)
+	for dy := -rings; dy <= rings; dy++ {
+		for dx := -rings; dx <= rings; dx++ {
+			for _, v := range g.cells[cell{c.y + dy, c.x + dx}] {
+				q := g.point(v)
+				if d := geo.Haversine(p.Lat, p.Lon, q.Lat, q.Lon); d < bestDist {
+					best, bestDist = v, d
+				}
+			}
+		}
+	}
+	return best, bestDist, bestDist <= MaxSnapMeters
+}
+
+// Distances returns the walking distance in meters from from to each of
+// to, along the network: the walk to the nearest vertex at each end plus
+// the shortest path between them. A target with no path of at most
+// maxMeters, or too far from the network, gets math.Inf(1). ok is false
+// if from itself is too far from the network to route.
+func (g *Graph) Distances(from Point, to []Point, maxMeters float64) (dists []float64, ok bool) {
+	src, srcSnap, ok := g.nearest(from)
+	if !ok {
+		return nil, false
+	}
+	dists = make([]float64, len(to))
+	targets := make(map[uint32][]int) // vertex → indexes into to
+	for i, p := range to {
+		dists[i] = math.Inf(1)
+		if v, snap, ok := g.nearest(p); ok {
+			targets[v] = append(targets[v], i)
+			dists[i] = snap // plus the path, once found
+		}
+	}
+	remaining := len(targets)
+	found := make(map[int]bool)
+	g.search(src, maxMeters-srcSnap, func(v uint32, d float64) bool {
+		for _, i := range targets[v] {
+			dists[i] += srcSnap + d
+			found[i] = true
+		}
+		if len(targets[v]) > 0 {
+			remaining--
+		}
+		return remaining > 0
+	}, nil)
+	for i := range dists {
+		if !found[i] || dists[i] > maxMeters {
+			dists[i] = math.Inf(1)
+		}
+	}
+	return dists, true
+}
+
+// Path is a walking route.
+type Path struct {
+	Meters float64
+	Points []Point // from the start to the end, along the network
+}
+
+// Route returns the shortest walk from from to to of at most maxMeters.
+// ok is false if there is none, or either end is too far from the
+// network.
+func (g *Graph) Route(from, to Point, maxMeters float64) (Path, bool) {
+	src, srcSnap, ok := g.nearest(from)
+	if !ok {
+		return Path{}, false
+	}
+	dst, dstSnap, ok := g.nearest(to)
+	if !ok {
+		return Path{}, false
+	}
+	prev := make(map[uint32]uint32)
+	var total float64
+	reached := false
+	g.search(src, maxMeters-srcSnap-dstSnap, func(v uint32, d float64) bool {
+		if v == dst {
+			total, reached = srcSnap+d+dstSnap, true
+			return false
+		}
+		return true
+	}, prev)
+	if !reached {
+		return Path{}, false
+	}
+	var rev []Point
+	for v := dst; ; v = prev[v] {
+		rev = append(rev, g.point(v))
+		if v == src {
+			break
+		}
+	}
+	path := Path{Meters: total, Points: make([]Point, 0, len(rev)+2)}
+	path.Points = append(path.Points, from)
+	for i := len(rev) - 1; i >= 0; i-- {
+		path.Points = append(path.Points, rev[i])
+	}
+	path.Points = append(path.Points, to)
+	return path, true
+}
+
+// search runs Dijkstra's algorithm from src, calling settled for each
+// vertex in order of distance until it returns false or the distance
+// passes maxMeters. If prev is not nil it records each vertex's
+// predecessor on its shortest path.
+func (g *Graph) search(src uint32, maxMeters float64, settled func(v uint32, d float64) bool, prev map[uint32]uint32) {
+	dist := map[uint32]float64{src: 0}
+	done := make(map[uint32]bool)
+	q := &queue{{src, 0}}
+	for q.Len() > 0 {
+		it := heap.Pop(q).(item)
+		if done[it.v] {
+			continue
+		}
+		if it.d > maxMeters {
+			return
+		}
+		done[it.v] = true
+		if !settled(it.v, it.d) {
+			return
+		}
+		for e := g.first[it.v]; e < g.first[it.v+1]; e++ {
+			w := g.to[e]
+			d := it.d + float64(g.length[e])
+			if old, ok := dist[w]; ok && old <= d {
+				continue
+			}
+			dist[w] = d
+			if prev != nil {
+				prev[w] = it.v
+			}
+			heap.Push(q, item{w, d})
+		}
+	}
+}
+
+type item struct {
+	v uint32
+	d float64
+}
+
+// queue is a min-heap of items by distance.
+type queue []item
+
+func (q queue) Len() int           { return len(q) }
+func (q queue) Less(i, j int) bool { return q[i].d < q[j].d }
+func (q queue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *queue) Push(x any)        { *q = append(*q, x.(item)) }
+func (q *queue) Pop() any {
+	old := *q
+	it := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,49 @@
+package walk
+
+// walkableHighways are the highway=* values people can walk along without
+// an explicit foot tag. Motorways and trunk roads need foot=yes.
+var walkableHighways = map[string]bool{
+	"footway":        true,
+	"pedestrian":     true,
+	"path":           true,
+	"steps":          true,
+	"corridor":       true,
+	"platform":       true,
+	"living_street":  true,
+	"residential":    true,
+	"service":        true,
+	"unclassified":   true,
+	"road":           true,
+	"track":          true,
+	"cycleway":       true,
+	"bridleway":      true,
+	"tertiary":       true,
+	"tertiary_link":  true,
+	"secondary":      true,
+	"secondary_link": true,
+	"primary":        true,
+	"primary_link":   true,
+}
+
+// walkable reports whether a way with these tags can be walked along.
+// Pedestrians ignore oneway, so every walkable way goes both directions.
+func walkable(tags map[string]string) bool {
+	switch tags["foot"] {
+	case "no", "private", "use_sidepath":
+		return false
+	case "yes", "designated", "permissive":
+		return tags["highway"] != "" || isPlatform(tags)
+	}
+	switch tags["access"] {
+	case "no", "private":
+		return false
+	}
+	if tags["area"] == "yes" && tags["highway"] != "pedestrian" {
+		return false
+	}
+	return walkableHighways[tags["highway"]] || isPlatform(tags)
+}
+
+func isPlatform(tags map[string]string) bool {
+	return tags["railway"] == "platform" || tags["public_transport"] == "platform"
+}
@@ -0,0 +1,161 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// A minimal CBOR (RFC 8949) decoder covering what authenticators send:
+// attestation objects and COSE keys. Integers decode to int64, byte and text
+// strings to []byte and string, arrays to []any and maps to map[any]any.
+// Indefinite lengths, tags and floats are rejected; authenticators use the
+// CTAP2 canonical subset, which has none of them.
+
+var errCBOR = errors.New("malformed cbor")
+
+// maxCBORDepth bounds nesting so a hostile payload can't exhaust the stack.
+const maxCBORDepth = 16
+
+// decodeCBOR decodes one item from b and returns it with the number of
+// bytes it occupied. Trailing bytes are left to the caller: authenticator
+// data places extensions directly after the credential public key.
+func decodeCBOR(b []byte) (any, int, error) {
+	d := cborDecoder{buf: b}
+	v, err := d.item(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, d.off, nil
+}
+
+type cborDecoder struct {
+	buf []byte
+	off int
+}
+
+func (d *cborDecoder) item(depth int) (any, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", errCBOR)
+	}
+	if d.off >= len(d.buf) {
+		return nil, fmt.Errorf("%w: unexpected end", errCBOR)
+	}
+	initial := d.buf[d.off]
+	d.off++
+	major, info := initial>>5, initial&0x1f
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("%w: unsupported simple value %d", errCBOR, info)
+		}
+	}
+
+	n, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return int64(n), nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return -1 - int64(n), nil
+	case 2, 3:
+		if n > uint64(len(d.buf)-d.off) {
+			return nil, fmt.Errorf("%w: string runs past end", errCBOR)
+		}
+		s := d.buf[d.off : d.off+int(n)]
+		d.off += int(n)
+		if major == 3 {
+			return string(s), nil
+		}
+		return append([]byte(nil), s...), nil
+	case 4:
+		// Every item takes at least one byte, which bounds the allocation
+		if n > uint64(len(d.buf)-d.off) {
+			return nil, fmt.Errorf("%w: array runs past end", errCBOR)
+		}
+		arr := make([]any, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case 5:
+		if n > uint64(len(d.buf)-d.off) {
+			return nil, fmt.Errorf("%w: map runs past end", errCBOR)
+		}
+		m := make(map[any]any, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: unsupported map key %T", errCBOR, k)
+			}
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported major type %d", errCBOR, major)
+	}
+}
+
+// argument reads the length or value that follows an initial byte.
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, fmt.Errorf("%w: indefinite or reserved length", errCBOR)
+	}
+	if len(d.buf)-d.off < size {
+		return 0, fmt.Errorf("%w: unexpected end", errCBOR)
+	}
+	p := d.buf[d.off : d.off+size]
+	d.off += size
+	switch size {
+	case 1:
+		return uint64(p[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(p)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(p)), nil
+	default:
+		return binary.BigEndian.Uint64(p), nil
+	}
+}
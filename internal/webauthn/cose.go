@@ -0,0 +1,97 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053) GoBus accepts. ES256 covers phones
+// and security keys; RS256 is what Windows Hello uses.
+const (
+	AlgES256 = -7
+	AlgRS256 = -257
+)
+
+// COSE key parameters (RFC 9052 §7, RFC 9053 §7).
+const (
+	coseKty   = 1
+	coseAlg   = 3
+	coseCrv   = -1 // EC2
+	coseX     = -2 // EC2
+	coseY     = -3 // EC2
+	coseN     = -1 // RSA
+	coseE     = -2 // RSA
+	ktyEC2    = 2
+	ktyRSA    = 3
+	crvP256   = 1
+	minRSABit = 2048
+)
+
+var errBadSignature = errors.New("signature verification failed")
+
+// parseCOSEKey decodes a COSE_Key from its CBOR map.
+func parseCOSEKey(raw []byte) (crypto.PublicKey, error) {
+	v, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode public key: %w", err)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("public key is not a cbor map")
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("unsupported EC2 key parameters")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("EC2 key is not on P-256")
+		}
+		return pub, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseN)].([]byte)
+		e, _ := m[int64(coseE)].([]byte)
+		if len(n)*8 < minRSABit || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("unsupported RSA key parameters")
+		}
+		exp := int(new(big.Int).SetBytes(e).Int64())
+		if exp < 3 {
+			return nil, errors.New("unsupported RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %d / algorithm %d", kty, alg)
+	}
+}
+
+// verifySignature checks sig over msg with a key from parseCOSEKey.
+// ES256 signatures are ASN.1 DER, as WebAuthn specifies.
+func verifySignature(pub crypto.PublicKey, msg, sig []byte) error {
+	digest := sha256.Sum256(msg)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errBadSignature
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			return errBadSignature
+		}
+	default:
+		return fmt.Errorf("unsupported public key %T", pub)
+	}
+	return nil
+}
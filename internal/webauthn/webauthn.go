@@ -0,0 +1,349 @@
+// Package webauthn implements the relying-party side of WebAuthn passkey
+// registration and sign-in: building the options for
+// navigator.credentials.create/get and verifying what the browser sends back.
+//
+// Attestation statements are not checked. GoBus requests attestation "none"
+// and treats a passkey like a passphrase the user chose, so it only needs the
+// public key and proof that the authenticator holds the private half.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors callers may want to tell apart from a generic verification failure.
+var (
+	ErrChallenge = errors.New("challenge mismatch")
+	ErrOrigin    = errors.New("origin mismatch")
+	ErrCloned    = errors.New("signature counter went backwards; the authenticator may be cloned")
+)
+
+const (
+	challengeSize = 32
+	timeoutMillis = 120000
+)
+
+// Authenticator data flags (WebAuthn §6.1).
+const (
+	flagUserPresent = 0x01
+	flagAttested    = 0x40
+)
+
+// RelyingParty identifies the site passkeys are bound to. ID is the domain
+// (no scheme or port), Origin the full origin the browser reports, such as
+// "https://gobus.example.org".
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// URLEncoded is binary data carried as unpadded base64url in JSON, the
+// encoding the WebAuthn JSON serialization uses.
+type URLEncoded []byte
+
+func (u URLEncoded) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(u))
+}
+
+func (u *URLEncoded) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*u = v
+	return nil
+}
+
+// NewChallenge returns a fresh random challenge.
+func NewChallenge() ([]byte, error) {
+	b := make([]byte, challengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generate challenge: %w", err)
+	}
+	return b, nil
+}
+
+// User is the account a new passkey is created for. ID is the opaque user
+// handle stored on the authenticator; it must not contain personal data.
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// CreationOptions is PublicKeyCredentialCreationOptionsJSON.
+type CreationOptions struct {
+	Challenge              URLEncoded             `json:"challenge"`
+	RP                     rpEntity               `json:"rp"`
+	User                   userEntity             `json:"user"`
+	PubKeyCredParams       []credParam            `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is PublicKeyCredentialRequestOptionsJSON.
+type RequestOptions struct {
+	Challenge        URLEncoded             `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int                    `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CredentialDescriptor names an existing credential.
+type CredentialDescriptor struct {
+	Type string     `json:"type"`
+	ID   URLEncoded `json:"id"`
+}
+
+type rpEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userEntity struct {
+	ID          URLEncoded `json:"id"`
+	Name        string     `json:"name"`
+	DisplayName string     `json:"displayName"`
+}
+
+type credParam struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions builds the options for navigator.credentials.create.
+// Passkeys are created as discoverable credentials so sign-in works without
+// typing a username. exclude lists the user's existing credential IDs so the
+// same authenticator isn't registered twice.
+func (rp RelyingParty) CreationOptions(challenge []byte, user User, exclude [][]byte) CreationOptions {
+	ex := make([]CredentialDescriptor, 0, len(exclude))
+	for _, id := range exclude {
+		ex = append(ex, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return CreationOptions{
+		Challenge:          challenge,
+		RP:                 rpEntity{ID: rp.ID, Name: rp.Name},
+		User:               userEntity{ID: user.ID, Name: user.Name, DisplayName: user.DisplayName},
+		PubKeyCredParams:   []credParam{{"public-key", AlgES256}, {"public-key", AlgRS256}},
+		Timeout:            timeoutMillis,
+		ExcludeCredentials: ex,
+		AuthenticatorSelection: authenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions builds the options for navigator.credentials.get. The
+// allow list is left empty so the browser offers any passkey for this site.
+func (rp RelyingParty) RequestOptions(challenge []byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          timeoutMillis,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "preferred",
+	}
+}
+
+// RegistrationResponse is RegistrationResponseJSON, the result of
+// navigator.credentials.create serialized by the browser or by passkey.js.
+type RegistrationResponse struct {
+	ID       string     `json:"id"`
+	RawID    URLEncoded `json:"rawId"`
+	Type     string     `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncoded `json:"clientDataJSON"`
+		AttestationObject URLEncoded `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is AuthenticationResponseJSON, the result of
+// navigator.credentials.get.
+type AssertionResponse struct {
+	ID       string     `json:"id"`
+	RawID    URLEncoded `json:"rawId"`
+	Type     string     `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncoded `json:"clientDataJSON"`
+		AuthenticatorData URLEncoded `json:"authenticatorData"`
+		Signature         URLEncoded `json:"signature"`
+		UserHandle        URLEncoded `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential is a verified passkey: what the relying party stores.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key, CBOR-encoded
+	SignCount uint32
+}
+
+// VerifyRegistration checks a navigator.credentials.create result against
+// the challenge issued for it and returns the new credential.
+func (rp RelyingParty) VerifyRegistration(challenge []byte, resp RegistrationResponse) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("unexpected credential type %q", resp.Type)
+	}
+	if err := rp.checkClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	v, _, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("decode attestation object: %w", err)
+	}
+	att, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("attestation object is not a cbor map")
+	}
+	authData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object has no authData")
+	}
+
+	ad, err := rp.parseAuthData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if ad.flags&flagAttested == 0 || len(ad.credentialID) == 0 {
+		return nil, errors.New("authenticator data has no attested credential")
+	}
+	if len(resp.RawID) > 0 && !bytes.Equal(resp.RawID, ad.credentialID) {
+		return nil, errors.New("rawId does not match the attested credential")
+	}
+	if _, err := parseCOSEKey(ad.publicKey); err != nil {
+		return nil, err
+	}
+	return &Credential{ID: ad.credentialID, PublicKey: ad.publicKey, SignCount: ad.signCount}, nil
+}
+
+// VerifyAssertion checks a navigator.credentials.get result signed by cred
+// and returns the authenticator's new signature counter, which the caller
+// should store.
+func (rp RelyingParty) VerifyAssertion(challenge []byte, cred Credential, resp AssertionResponse) (uint32, error) {
+	if resp.Type != "public-key" {
+		return 0, fmt.Errorf("unexpected credential type %q", resp.Type)
+	}
+	if !bytes.Equal(resp.RawID, cred.ID) {
+		return 0, errors.New("assertion is for a different credential")
+	}
+	clientData := resp.Response.ClientDataJSON
+	if err := rp.checkClientData(clientData, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	ad, err := rp.parseAuthData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	pub, err := parseCOSEKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientHash := sha256.Sum256(clientData)
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientHash[:]...)
+	if err := verifySignature(pub, signed, resp.Response.Signature); err != nil {
+		return 0, err
+	}
+
+	// Authenticators that keep no counter always report zero
+	if (ad.signCount != 0 || cred.SignCount != 0) && ad.signCount <= cred.SignCount {
+		return 0, ErrCloned
+	}
+	return ad.signCount, nil
+}
+
+// collectedClientData is the part of clientDataJSON the relying party checks.
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (rp RelyingParty) checkClientData(raw []byte, wantType string, challenge []byte) error {
+	var cd collectedClientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("decode client data: %w", err)
+	}
+	if cd.Type != wantType {
+		return fmt.Errorf("client data type %q, want %q", cd.Type, wantType)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || !bytes.Equal(got, challenge) {
+		return ErrChallenge
+	}
+	if cd.Origin != rp.Origin || cd.CrossOrigin {
+		return fmt.Errorf("%w: %q", ErrOrigin, cd.Origin)
+	}
+	return nil
+}
+
+// authData is parsed authenticator data (WebAuthn §6.1).
+type authData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func (rp RelyingParty) parseAuthData(b []byte) (*authData, error) {
+	if len(b) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+	rpHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(b[:32], rpHash[:]) {
+		return nil, errors.New("authenticator data is for a different relying party")
+	}
+	ad := &authData{flags: b[32], signCount: binary.BigEndian.Uint32(b[33:37])}
+	if ad.flags&flagUserPresent == 0 {
+		return nil, errors.New("user was not present")
+	}
+	if ad.flags&flagAttested == 0 {
+		return ad, nil
+	}
+
+	// Attested credential data: AAGUID (16), ID length (2), ID, COSE key
+	rest := b[37:]
+	if len(rest) < 18 {
+		return nil, errors.New("attested credential data too short")
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return nil, errors.New("invalid credential ID length")
+	}
+	ad.credentialID = append([]byte(nil), rest[:idLen]...)
+	rest = rest[idLen:]
+	_, n, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("decode credential public key: %w", err)
+	}
+	ad.publicKey = append([]byte(nil), rest[:n]...)
+	return ad, nil
+}
@@ -0,0 +1,293 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+var testRP = RelyingParty{ID: "gobus.test", Name: "GoBus", Origin: "https://gobus.test"}
+
+// softAuthenticator is a software passkey: an ES256 key pair plus the
+// counter a hardware authenticator would keep.
+type softAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	credID    []byte
+	signCount uint32
+	rpID      string
+	origin    string
+}
+
+func newSoftAuthenticator(t *testing.T, rp RelyingParty) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{key: key, credID: id, rpID: rp.ID, origin: rp.Origin}
+}
+
+func (a *softAuthenticator) clientData(typ string, challenge []byte) []byte {
+	b, _ := json.Marshal(map[string]any{
+		"type":      typ,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.origin,
+	})
+	return b
+}
+
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpHash := sha256.Sum256([]byte(a.rpID))
+	b := append([]byte(nil), rpHash[:]...)
+	flags := byte(flagUserPresent | 0x04)
+	if attested {
+		flags |= flagAttested
+	}
+	b = append(b, flags)
+	b = binary.BigEndian.AppendUint32(b, a.signCount)
+	if attested {
+		b = append(b, make([]byte, 16)...) // AAGUID
+		b = binary.BigEndian.AppendUint16(b, uint16(len(a.credID)))
+		b = append(b, a.credID...)
+		b = append(b, a.coseKey()...)
+	}
+	return b
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	return cborMap(
+		cborInt(1), cborInt(2),
+		cborInt(3), cborInt(-7),
+		cborInt(-1), cborInt(1),
+		cborInt(-2), cborBytes(x),
+		cborInt(-3), cborBytes(y),
+	)
+}
+
+func (a *softAuthenticator) create(challenge []byte) RegistrationResponse {
+	var r RegistrationResponse
+	r.ID = base64.RawURLEncoding.EncodeToString(a.credID)
+	r.RawID = a.credID
+	r.Type = "public-key"
+	r.Response.ClientDataJSON = a.clientData("webauthn.create", challenge)
+	r.Response.AttestationObject = cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authData(true)),
+	)
+	return r
+}
+
+func (a *softAuthenticator) get(t *testing.T, challenge []byte) AssertionResponse {
+	t.Helper()
+	a.signCount++
+	var r AssertionResponse
+	r.ID = base64.RawURLEncoding.EncodeToString(a.credID)
+	r.RawID = a.credID
+	r.Type = "public-key"
+	r.Response.ClientDataJSON = a.clientData("webauthn.get", challenge)
+	r.Response.AuthenticatorData = a.authData(false)
+	h := sha256.Sum256(r.Response.ClientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), r.Response.AuthenticatorData...), h[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Response.Signature = sig
+	return r
+}
+
+// Just enough CBOR encoding to build authenticator output.
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n < 1<<16:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+}
+
+func cborInt(v int64) []byte {
+	if v < 0 {
+		return cborHead(1, uint64(-1-v))
+	}
+	return cborHead(0, uint64(v))
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, uint64(len(b))), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, uint64(len(s))), s...) }
+
+func cborMap(kv ...[]byte) []byte {
+	out := cborHead(5, uint64(len(kv)/2))
+	for _, b := range kv {
+		out = append(out, b...)
+	}
+	return out
+}
+
+func mustChallenge(t *testing.T) []byte {
+	t.Helper()
+	c, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRegisterAndSignIn(t *testing.T) {
+	auth := newSoftAuthenticator(t, testRP)
+
+	regChallenge := mustChallenge(t)
+	cred, err := testRP.VerifyRegistration(regChallenge, auth.create(regChallenge))
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	if string(cred.ID) != string(auth.credID) {
+		t.Errorf("credential ID = %x, want %x", cred.ID, auth.credID)
+	}
+
+	for i := 1; i <= 2; i++ {
+		challenge := mustChallenge(t)
+		count, err := testRP.VerifyAssertion(challenge, *cred, auth.get(t, challenge))
+		if err != nil {
+			t.Fatalf("sign-in %d: %v", i, err)
+		}
+		if count != uint32(i) {
+			t.Errorf("sign-in %d: count = %d", i, count)
+		}
+		cred.SignCount = count
+	}
+}
+
+func TestVerifyRegistration_Rejects(t *testing.T) {
+	challenge := mustChallenge(t)
+
+	tests := []struct {
+		name   string
+		mutate func(a *softAuthenticator)
+		resp   func(a *softAuthenticator) RegistrationResponse
+		want   error
+	}{
+		{
+			name: "wrong challenge",
+			resp: func(a *softAuthenticator) RegistrationResponse { return a.create(mustChallenge(t)) },
+			want: ErrChallenge,
+		},
+		{
+			name:   "wrong origin",
+			mutate: func(a *softAuthenticator) { a.origin = "https://evil.test" },
+			want:   ErrOrigin,
+		},
+		{
+			name:   "wrong rp id",
+			mutate: func(a *softAuthenticator) { a.rpID = "evil.test" },
+		},
+		{
+			name: "assertion type",
+			resp: func(a *softAuthenticator) RegistrationResponse {
+				r := a.create(challenge)
+				r.Response.ClientDataJSON = a.clientData("webauthn.get", challenge)
+				return r
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newSoftAuthenticator(t, testRP)
+			if tt.mutate != nil {
+				tt.mutate(a)
+			}
+			resp := a.create(challenge)
+			if tt.resp != nil {
+				resp = tt.resp(a)
+			}
+			_, err := testRP.VerifyRegistration(challenge, resp)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion_Rejects(t *testing.T) {
+	auth := newSoftAuthenticator(t, testRP)
+	regChallenge := mustChallenge(t)
+	cred, err := testRP.VerifyRegistration(regChallenge, auth.create(regChallenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("replayed counter", func(t *testing.T) {
+		challenge := mustChallenge(t)
+		stale := *cred
+		stale.SignCount = 10
+		if _, err := testRP.VerifyAssertion(challenge, stale, auth.get(t, challenge)); !errors.Is(err, ErrCloned) {
+			t.Errorf("err = %v, want ErrCloned", err)
+		}
+	})
+
+	t.Run("tampered signature", func(t *testing.T) {
+		challenge := mustChallenge(t)
+		resp := auth.get(t, challenge)
+		resp.Response.AuthenticatorData[33] ^= 0xff
+		if _, err := testRP.VerifyAssertion(challenge, *cred, resp); err == nil {
+			t.Error("expected an error for modified authenticator data")
+		}
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		other := newSoftAuthenticator(t, testRP)
+		other.credID = auth.credID
+		challenge := mustChallenge(t)
+		if _, err := testRP.VerifyAssertion(challenge, *cred, other.get(t, challenge)); err == nil {
+			t.Error("expected an error for a signature from another key")
+		}
+	})
+
+	t.Run("stale challenge", func(t *testing.T) {
+		resp := auth.get(t, mustChallenge(t))
+		if _, err := testRP.VerifyAssertion(mustChallenge(t), *cred, resp); !errors.Is(err, ErrChallenge) {
+			t.Errorf("err = %v, want ErrChallenge", err)
+		}
+	})
+}
+
+func TestDecodeCBOR_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"empty", nil},
+		{"truncated string", []byte{0x45, 1, 2}},
+		{"huge array", []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"indefinite map", []byte{0xbf, 0xff}},
+		{"array map key", []byte{0xa1, 0x80, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(tt.in); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
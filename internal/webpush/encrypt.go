@@ -0,0 +1,107 @@
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	recordSize = 4096
+	// A single aes128gcm record holds the plaintext, a 1-byte delimiter and a
+	// 16-byte tag, after the 86-byte header (salt, rs, idlen, keyid).
+	maxPayload = recordSize - 86 - 1 - 16
+)
+
+// encrypt encrypts a push payload for a subscription per RFC 8291, using a
+// fresh ephemeral key and salt.
+func encrypt(plaintext []byte, p256dh, auth string) ([]byte, error) {
+	uaPublic, err := decodeBase64(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("decode p256dh: %w", err)
+	}
+	authSecret, err := decodeBase64(auth)
+	if err != nil {
+		return nil, fmt.Errorf("decode auth secret: %w", err)
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate ephemeral key: %w", err)
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+	return encryptWith(plaintext, uaPublic, authSecret, asPrivate, salt)
+}
+
+// encryptWith is encrypt with the ephemeral key and salt supplied, so tests
+// can check against known values.
+func encryptWith(plaintext, uaPublic, authSecret []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	if len(plaintext) > maxPayload {
+		return nil, fmt.Errorf("push payload is %d bytes, max %d", len(plaintext), maxPayload)
+	}
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("parse p256dh: %w", err)
+	}
+	shared, err := asPrivate.ECDH(uaKey)
+	if err != nil {
+		return nil, fmt.Errorf("ecdh: %w", err)
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	cek, nonce, err := deriveKeys(shared, authSecret, uaPublic, asPublic, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: salt (16) || rs (4) || idlen (1) || keyid (the sender's public key)
+	out := make([]byte, 0, 86+len(plaintext)+1+gcm.Overhead())
+	out = append(out, salt...)
+	out = binary.BigEndian.AppendUint32(out, recordSize)
+	out = append(out, byte(len(asPublic)))
+	out = append(out, asPublic...)
+
+	// Single (and therefore last) record: plaintext || 0x02, no padding
+	record := append(append([]byte{}, plaintext...), 0x02)
+	return gcm.Seal(out, nonce, record, nil), nil
+}
+
+// deriveKeys runs the RFC 8291 key schedule, returning the content
+// encryption key and nonce. Decryption uses the same schedule.
+func deriveKeys(shared, authSecret, uaPublic, asPublic, salt []byte) (cek, nonce []byte, err error) {
+	prkKey, err := hkdf.Extract(sha256.New, shared, authSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPublic) + string(asPublic)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cek, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16); err != nil {
+		return nil, nil, err
+	}
+	if nonce, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12); err != nil {
+		return nil, nil, err
+	}
+	return cek, nonce, nil
+}
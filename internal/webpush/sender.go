@@ -0,0 +1,147 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrGone is returned by Send when the push service reports the subscription
+// no longer exists (404/410). The caller should delete it.
+var ErrGone = errors.New("push subscription gone")
+
+// Subscription is a browser PushSubscription as returned by
+// pushManager.subscribe().toJSON().
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// Sender delivers encrypted push messages.
+type Sender struct {
+	keys         *Keys
+	subject      string // VAPID contact, "mailto:" or "https:" URL
+	client       *http.Client
+	allowPrivate atomic.Bool // set by SetAllowPrivate
+}
+
+// NewSender creates a push sender signing with keys. It refuses to connect
+// to loopback, private and link-local addresses until SetAllowPrivate.
+func NewSender(keys *Keys, subject string) *Sender {
+	s := &Sender{keys: keys, subject: subject}
+	// Endpoints come from browsers, so they are checked again when dialing:
+	// a name that resolved to a public address at subscribe time may not now.
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if s.allowPrivate.Load() {
+				return nil
+			}
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || !publicAddr(ap.Addr()) {
+				return fmt.Errorf("push endpoint address %s is not public", address)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	s.client = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	return s
+}
+
+// SetAllowPrivate lets the sender reach loopback, private and link-local
+// addresses, for a local push service stand-in.
+func (s *Sender) SetAllowPrivate(allow bool) {
+	s.allowPrivate.Store(allow)
+}
+
+// PublicKey returns the VAPID public key for pushManager.subscribe.
+func (s *Sender) PublicKey() string {
+	return s.keys.PublicKey()
+}
+
+// Send encrypts payload for the subscription and posts it to the push
+// service. ttl bounds how long the service may hold an undelivered message.
+func (s *Sender) Send(ctx context.Context, sub Subscription, payload []byte, ttl time.Duration) error {
+	body, err := encrypt(payload, sub.Keys.P256dh, sub.Keys.Auth)
+	if err != nil {
+		return err
+	}
+	auth, err := s.keys.authorization(sub.Endpoint, s.subject, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create push request: %w", err)
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Urgency", "high")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("push request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("push service returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ValidateEndpoint checks that a subscription endpoint is an absolute https
+// URL whose host resolves only to public addresses. allowHTTP permits plain
+// http, and private addresses, for a local push service stand-in.
+func ValidateEndpoint(ctx context.Context, endpoint string, allowHTTP bool) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("invalid push endpoint")
+	}
+	if u.Scheme != "https" && !(allowHTTP && u.Scheme == "http") {
+		return fmt.Errorf("push endpoint must use https")
+	}
+	if allowHTTP {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("push endpoint host does not resolve")
+	}
+	for _, a := range addrs {
+		if !publicAddr(a) {
+			return fmt.Errorf("push endpoint host is not public")
+		}
+	}
+	return nil
+}
+
+// publicAddr reports whether a is a unicast address on the public internet,
+// as opposed to loopback, private, link-local or unspecified.
+func publicAddr(a netip.Addr) bool {
+	a = a.Unmap()
+	return a.IsGlobalUnicast() && !a.IsPrivate() && !a.IsLoopback() && !a.IsLinkLocalUnicast()
+}
@@ -0,0 +1,113 @@
+// Package webpush sends Web Push messages (RFC 8030) with VAPID
+// authentication (RFC 8292) and aes128gcm payload encryption (RFC 8291),
+// using only the standard library.
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Keys is a VAPID application server key pair (ECDSA P-256).
+type Keys struct {
+	private *ecdh.PrivateKey
+	signer  *ecdsa.PrivateKey
+}
+
+// GenerateKeys creates a new random VAPID key pair.
+func GenerateKeys() (*Keys, error) {
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate vapid key: %w", err)
+	}
+	return newKeys(priv)
+}
+
+// ParsePrivateKey loads a key pair from the base64url-encoded 32-byte private
+// scalar, the format printed by the common web-push tooling.
+func ParsePrivateKey(s string) (*Keys, error) {
+	raw, err := decodeBase64(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode vapid key: %w", err)
+	}
+	priv, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse vapid key: %w", err)
+	}
+	return newKeys(priv)
+}
+
+func newKeys(priv *ecdh.PrivateKey) (*Keys, error) {
+	// crypto/ecdh has no signing, so mirror the key into an ecdsa.PrivateKey.
+	// The uncompressed public point is 0x04 || X || Y.
+	pub := priv.PublicKey().Bytes()
+	signer := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(pub[1:33]),
+			Y:     new(big.Int).SetBytes(pub[33:65]),
+		},
+		D: new(big.Int).SetBytes(priv.Bytes()),
+	}
+	return &Keys{private: priv, signer: signer}, nil
+}
+
+// PrivateKey returns the base64url-encoded private scalar for persisting.
+func (k *Keys) PrivateKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.private.Bytes())
+}
+
+// PublicKey returns the base64url-encoded uncompressed public key. Browsers
+// pass it to pushManager.subscribe as applicationServerKey.
+func (k *Keys) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.private.PublicKey().Bytes())
+}
+
+// authorization builds the "vapid t=<jwt>, k=<public key>" header value for a
+// push endpoint. The JWT audience is the endpoint's origin.
+func (k *Keys) authorization(endpoint, subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid push endpoint %q", endpoint)
+	}
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, _ := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(12 * time.Hour).Unix(),
+		"sub": subject,
+	})
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, k.signer, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign vapid jwt: %w", err)
+	}
+	// JWS ES256 signatures are the fixed-width R || S, not ASN.1
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	jwt := signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+	return "vapid t=" + jwt + ", k=" + k.PublicKey(), nil
+}
+
+// decodeBase64 accepts base64url or standard base64, padded or not, since
+// browsers and libraries disagree on which one subscription keys use.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	if strings.ContainsAny(s, "+/") {
+		return base64.RawStdEncoding.DecodeString(s)
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
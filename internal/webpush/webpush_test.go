@@ -0,0 +1,253 @@
+package webpush
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := decodeBase64(s)
+	if err != nil {
+		t.Fatalf("decode %q: %v", s, err)
+	}
+	return b
+}
+
+// decrypt is the user agent side of RFC 8291, used to check our output.
+func decrypt(t *testing.T, body []byte, uaPrivate *ecdh.PrivateKey, authSecret []byte) []byte {
+	t.Helper()
+	if len(body) < 86 {
+		t.Fatalf("body too short: %d bytes", len(body))
+	}
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != recordSize {
+		t.Errorf("rs = %d, want %d", rs, recordSize)
+	}
+	idlen := int(body[20])
+	asPublic := body[21 : 21+idlen]
+
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		t.Fatalf("keyid is not a P-256 point: %v", err)
+	}
+	shared, err := uaPrivate.ECDH(asKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cek, nonce, err := deriveKeys(shared, authSecret, uaPrivate.PublicKey().Bytes(), asPublic, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	record, err := gcm.Open(nil, nonce, body[21+idlen:], nil)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if record[len(record)-1] != 0x02 {
+		t.Errorf("last record delimiter = %#x, want 0x02", record[len(record)-1])
+	}
+	return record[:len(record)-1]
+}
+
+// RFC 8291 Appendix A test vector.
+func TestEncrypt_RFC8291Vector(t *testing.T) {
+	asPrivate, err := ecdh.P256().NewPrivateKey(mustDecode(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := encryptWith(
+		[]byte("When I grow up, I want to be a watermelon"),
+		mustDecode(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"),
+		mustDecode(t, "BTBZMqHH6r4Tts7J_aSIgg"),
+		asPrivate,
+		mustDecode(t, "DGv6ra1nlYgDCS1FRnbzlw"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if enc := base64.RawURLEncoding.EncodeToString(got); enc != want {
+		t.Errorf("encrypt mismatch\n got %s\nwant %s", enc, want)
+	}
+}
+
+func TestEncrypt_TooLarge(t *testing.T) {
+	ua, _ := ecdh.P256().GenerateKey(rand.Reader)
+	p256dh := base64.RawURLEncoding.EncodeToString(ua.PublicKey().Bytes())
+	if _, err := encrypt(make([]byte, maxPayload+1), p256dh, "BTBZMqHH6r4Tts7J_aSIgg"); err == nil {
+		t.Error("expected an error for an oversized payload")
+	}
+}
+
+func TestKeys_RoundTrip(t *testing.T) {
+	k, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := ParsePrivateKey(k.PrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.PublicKey() != k2.PublicKey() {
+		t.Error("public key changed after a private key round trip")
+	}
+	if len(mustDecode(t, k.PublicKey())) != 65 {
+		t.Error("public key should be a 65-byte uncompressed point")
+	}
+}
+
+// verifyVAPID checks the Authorization header the way a push service would.
+func verifyVAPID(t *testing.T, header, wantAud string) {
+	t.Helper()
+	if !strings.HasPrefix(header, "vapid t=") {
+		t.Fatalf("authorization = %q, want vapid scheme", header)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(header, "vapid t="), ", k=", 2)
+	if len(parts) != 2 {
+		t.Fatalf("malformed vapid header %q", header)
+	}
+	jwt, pub := parts[0], mustDecode(t, parts[1])
+
+	segs := strings.Split(jwt, ".")
+	if len(segs) != 3 {
+		t.Fatalf("jwt has %d segments", len(segs))
+	}
+	var claims struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(mustDecode(t, segs[1]), &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Aud != wantAud {
+		t.Errorf("aud = %q, want %q", claims.Aud, wantAud)
+	}
+	if claims.Exp <= time.Now().Unix() || claims.Exp > time.Now().Add(24*time.Hour).Unix() {
+		t.Errorf("exp %d should be in the future and within 24h", claims.Exp)
+	}
+
+	sig := mustDecode(t, segs[2])
+	if len(sig) != 64 {
+		t.Fatalf("signature is %d bytes, want 64", len(sig))
+	}
+	pk := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(pub[1:33]),
+		Y:     new(big.Int).SetBytes(pub[33:65]),
+	}
+	digest := sha256.Sum256([]byte(segs[0] + "." + segs[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(pk, digest[:], r, s) {
+		t.Error("vapid jwt signature does not verify")
+	}
+}
+
+func TestSender_Send(t *testing.T) {
+	ua, _ := ecdh.P256().GenerateKey(rand.Reader)
+	authSecret := make([]byte, 16)
+	rand.Read(authSecret)
+
+	var gotBody []byte
+	var gotHeader http.Header
+	pushService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer pushService.Close()
+
+	keys, _ := GenerateKeys()
+	sender := NewSender(keys, "mailto:ops@example.com")
+	sender.SetAllowPrivate(true) // httptest listens on loopback
+
+	var sub Subscription
+	sub.Endpoint = pushService.URL + "/push/abc"
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(ua.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(authSecret)
+
+	payload := []byte(`{"title":"Route 18"}`)
+	if err := sender.Send(context.Background(), sub, payload, 5*time.Minute); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if gotHeader.Get("Content-Encoding") != "aes128gcm" {
+		t.Errorf("Content-Encoding = %q", gotHeader.Get("Content-Encoding"))
+	}
+	if gotHeader.Get("TTL") != "300" {
+		t.Errorf("TTL = %q, want 300", gotHeader.Get("TTL"))
+	}
+	verifyVAPID(t, gotHeader.Get("Authorization"), pushService.URL)
+	if got := decrypt(t, gotBody, ua, authSecret); string(got) != string(payload) {
+		t.Errorf("decrypted payload = %q, want %q", got, payload)
+	}
+}
+
+func TestSender_Gone(t *testing.T) {
+	pushService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer pushService.Close()
+
+	ua, _ := ecdh.P256().GenerateKey(rand.Reader)
+	keys, _ := GenerateKeys()
+	var sub Subscription
+	sub.Endpoint = pushService.URL
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(ua.PublicKey().Bytes())
+	sub.Keys.Auth = "BTBZMqHH6r4Tts7J_aSIgg"
+
+	sender := NewSender(keys, "mailto:ops@example.com")
+	if err := sender.Send(context.Background(), sub, []byte("x"), time.Minute); errors.Is(err, ErrGone) || err == nil {
+		t.Errorf("Send to a loopback endpoint = %v, want refused", err)
+	}
+	sender.SetAllowPrivate(true)
+	err := sender.Send(context.Background(), sub, []byte("x"), time.Minute)
+	if !errors.Is(err, ErrGone) {
+		t.Errorf("Send to a 410 endpoint = %v, want ErrGone", err)
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint  string
+		allowHTTP bool
+		ok        bool
+	}{
+		{"https://93.184.215.14/push/abc", false, true},
+		{"http://localhost:9999/push", false, false},
+		{"http://localhost:9999/push", true, true},
+		{"https://127.0.0.1/push", false, false},
+		{"https://10.1.2.3/push", false, false},
+		{"https://169.254.169.254/latest/meta-data", false, false},
+		{"https://[::1]/push", false, false},
+		{"https://[::ffff:192.168.0.1]/push", false, false},
+		{"https://0.0.0.0/push", false, false},
+		{"ftp://example.com/x", true, false},
+		{"/relative", true, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateEndpoint(context.Background(), tt.endpoint, tt.allowHTTP); (err == nil) != tt.ok {
+			t.Errorf("ValidateEndpoint(%q, %v) = %v, want ok=%v", tt.endpoint, tt.allowHTTP, err, tt.ok)
+		}
+	}
+}
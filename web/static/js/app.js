@@ -1,5 +1,5 @@
 // GoBus - Minimal JS for browser APIs
-// Handles: geolocation, service worker, idle timeout, install prompt, saved locations
+// Handles: geolocation, service worker, idle timeout, install prompt, saved locations, push reminders
 
 (function () {
   'use strict';
@@ -41,6 +41,7 @@
     }
     locs.push(loc);
     saveSavedLocations(locs);
+    syncPlaces('POST', '/api/saved-places', loc);
     return true;
   }
 
@@ -48,6 +49,55 @@
     var locs = getSavedLocations();
     locs = locs.filter(function (l) { return l.stopID !== stopID; });
     saveSavedLocations(locs);
+    syncPlaces('DELETE', '/api/saved-places/' + encodeURIComponent(stopID));
+  }
+
+  // --- Saved Locations: server sync ---
+  // localStorage is a cache of the account's saved places so the list works
+  // offline and renders instantly; the server copy is shared across devices.
+  var SYNCED_KEY = 'gobus-saved-synced';
+
+  function syncPlaces(method, url, body) {
+    var opts = { method: method, credentials: 'same-origin', headers: {} };
+    if (body !== undefined) {
+      opts.headers['Content-Type'] = 'application/json';
+      opts.body = JSON.stringify(body);
+    }
+    return fetch(url, opts).then(function (r) {
+      if (!r.ok) throw new Error('sync ' + r.status);
+      return r.json();
+    }).then(function (data) {
+      saveSavedLocations(data.places || []);
+      renderSavedLocations();
+      return data.places;
+    }).catch(function () { /* offline: keep the cached list */ });
+  }
+
+  // On this device's first signed-in visit, upload places saved before
+  // logging in; afterwards just refresh the cache from the server.
+  function loadSavedPlacesFromServer() {
+    var synced = false;
+    try { synced = localStorage.getItem(SYNCED_KEY) === '1'; } catch (e) { /* ignore */ }
+    var local = getSavedLocations();
+    var p = (!synced && local.length > 0)
+      ? syncPlaces('POST', '/api/saved-places/import', { places: local })
+      : syncPlaces('GET', '/api/saved-places');
+    p.then(function (places) {
+      if (places === undefined) return;
+      try { localStorage.setItem(SYNCED_KEY, '1'); } catch (e) { /* ignore */ }
+      updateSaveStopBtn();
+    });
+  }
+
+  // Signing out clears the cache so the next account on this device starts clean
+  var logoutForm = document.querySelector('.logout-form');
+  if (logoutForm) {
+    logoutForm.addEventListener('submit', function () {
+      try {
+        localStorage.removeItem(STORAGE_KEY);
+        localStorage.removeItem(SYNCED_KEY);
+      } catch (e) { /* ignore */ }
+    });
   }
 
   function isSaved(stopID) {
@@ -58,6 +108,20 @@
     return false;
   }
 
+  // Reflect saved state on the stop page's "Save stop" button
+  function updateSaveStopBtn() {
+    var btn = document.getElementById('save-stop-btn');
+    if (!btn) return;
+    var name = btn.getAttribute('data-stop-name');
+    if (isSaved(btn.getAttribute('data-stop-id'))) {
+      btn.textContent = 'Saved';
+      btn.setAttribute('aria-label', name + ' is saved');
+    } else {
+      btn.textContent = 'Save stop';
+      btn.setAttribute('aria-label', 'Save ' + name + ' to your locations');
+    }
+  }
+
   // Render saved location buttons on the nearby page
   function renderSavedLocations() {
     var container = document.getElementById('saved-locations');
@@ -152,8 +216,11 @@
     }
   });
 
-  // Render saved locations on nearby page load
+  // Render saved locations on nearby page load, then refresh from the server
   renderSavedLocations();
+  if (document.querySelector('.logout-form')) {
+    loadSavedPlacesFromServer();
+  }
 
   // --- Direction Toggle ---
   // Works for both route-nearby-row clicks and direction-toggle button clicks
@@ -195,10 +262,7 @@
     var stopName = saveStopBtn.getAttribute('data-stop-name');
 
     // Update button state based on whether already saved
-    if (isSaved(stopID)) {
-      saveStopBtn.textContent = 'Saved';
-      saveStopBtn.setAttribute('aria-label', stopName + ' is saved');
-    }
+    updateSaveStopBtn();
 
     saveStopBtn.addEventListener('click', function () {
       if (isSaved(stopID)) {
@@ -224,6 +288,48 @@
     });
   }
 
+  // --- Search Suggestions ---
+  // HTMX fills #search-suggestions as the user types. Down arrow moves from
+  // the input into the suggestions, up/down move between them, and Escape
+  // goes back to the input.
+  var searchInput = document.getElementById('q');
+  var suggestBox = document.getElementById('search-suggestions');
+
+  if (searchInput && suggestBox) {
+    var suggestionLinks = function () {
+      return Array.prototype.slice.call(suggestBox.querySelectorAll('a'));
+    };
+
+    searchInput.addEventListener('keydown', function (e) {
+      if (e.key === 'ArrowDown') {
+        var links = suggestionLinks();
+        if (links.length) {
+          e.preventDefault();
+          links[0].focus();
+        }
+      } else if (e.key === 'Escape') {
+        suggestBox.innerHTML = '';
+      }
+    });
+
+    suggestBox.addEventListener('keydown', function (e) {
+      var links = suggestionLinks();
+      var i = links.indexOf(document.activeElement);
+      if (i < 0) return;
+      if (e.key === 'ArrowDown') {
+        e.preventDefault();
+        if (i < links.length - 1) links[i + 1].focus();
+      } else if (e.key === 'ArrowUp') {
+        e.preventDefault();
+        if (i > 0) links[i - 1].focus();
+        else searchInput.focus();
+      } else if (e.key === 'Escape') {
+        e.preventDefault();
+        searchInput.focus();
+      }
+    });
+  }
+
   // --- Geolocation ---
   var nearbyForm = document.getElementById('nearby-form');
   var latInput = document.getElementById('lat');
@@ -362,6 +468,69 @@
     if (installBanner) installBanner.setAttribute('hidden', '');
   }
 
+  // --- Arrival Reminders (Web Push) ---
+  var reminderForm = document.getElementById('reminder-form');
+  var reminderUnsupported = document.getElementById('reminder-unsupported');
+  var pushSupported = 'serviceWorker' in navigator && 'PushManager' in window && 'Notification' in window;
+
+  if (reminderUnsupported && pushSupported) {
+    reminderUnsupported.setAttribute('hidden', '');
+  }
+
+  function urlBase64ToUint8Array(s) {
+    var padded = (s + '===='.slice((s.length + 3) % 4)).replace(/-/g, '+').replace(/_/g, '/');
+    var raw = atob(padded);
+    var out = new Uint8Array(raw.length);
+    for (var i = 0; i < raw.length; i++) out[i] = raw.charCodeAt(i);
+    return out;
+  }
+
+  // Subscribe this browser (or refresh an existing subscription) and tell the server
+  function ensurePushSubscription() {
+    return Notification.requestPermission().then(function (perm) {
+      if (perm !== 'granted') throw new Error('permission');
+      return navigator.serviceWorker.ready;
+    }).then(function (reg) {
+      return reg.pushManager.getSubscription().then(function (existing) {
+        if (existing) return existing;
+        return fetch('/push/key', { credentials: 'same-origin' })
+          .then(function (r) { return r.json(); })
+          .then(function (k) {
+            return reg.pushManager.subscribe({
+              userVisibleOnly: true,
+              applicationServerKey: urlBase64ToUint8Array(k.publicKey)
+            });
+          });
+      });
+    }).then(function (sub) {
+      return fetch('/push/subscribe', {
+        method: 'POST',
+        credentials: 'same-origin',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(sub)
+      }).then(function (r) {
+        if (!r.ok) throw new Error('subscribe');
+      });
+    });
+  }
+
+  if (reminderForm && pushSupported) {
+    var reminderStatus = document.getElementById('reminder-status');
+    reminderForm.removeAttribute('hidden');
+    reminderForm.addEventListener('submit', function (e) {
+      e.preventDefault();
+      if (reminderStatus) reminderStatus.textContent = 'Setting up notifications\u2026';
+      ensurePushSubscription().then(function () {
+        reminderForm.submit();
+      }).catch(function (err) {
+        if (!reminderStatus) return;
+        reminderStatus.textContent = err.message === 'permission'
+          ? 'Notifications are blocked. Allow them in your browser settings to get reminders.'
+          : 'Could not set up notifications. Please try again.';
+      });
+    });
+  }
+
   // --- Distance Unit Toggle ---
   var UNIT_KEY = 'gobus-distance-unit';
 
@@ -394,10 +563,10 @@
     var els = document.querySelectorAll('[data-meters]');
     for (var i = 0; i < els.length; i++) {
       var meters = parseFloat(els[i].getAttribute('data-meters'));
-      var walkMeters = parseFloat(els[i].getAttribute('data-walk-meters'));
       if (isNaN(meters)) continue;
-      if (isNaN(walkMeters)) walkMeters = meters;
-      var walkMin = Math.max(1, Math.round(walkMeters / 80.467));
+      // Walk time comes from the server, at the user's walking speed
+      var walkMin = parseInt(els[i].getAttribute('data-walk-min'), 10);
+      if (isNaN(walkMin)) walkMin = Math.max(1, Math.ceil(meters * 1.3 / 80.467));
       els[i].textContent = formatDistText(meters, unit) + ' (' + walkMin + ' min walk)';
     }
     var btn = document.getElementById('unit-toggle');
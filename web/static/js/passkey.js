@@ -0,0 +1,141 @@
+// GoBus passkeys — WebAuthn sign-in on /login and registration on /account/passkeys
+(function () {
+  'use strict';
+
+  if (!window.PublicKeyCredential || !navigator.credentials) return;
+
+  var status = document.getElementById('passkey-status');
+  function say(msg) { if (status) status.textContent = msg; }
+
+  // --- base64url <-> ArrayBuffer ---
+
+  function toBuffer(s) {
+    var padded = (s + '===='.slice((s.length + 3) % 4)).replace(/-/g, '+').replace(/_/g, '/');
+    var raw = atob(padded);
+    var out = new Uint8Array(raw.length);
+    for (var i = 0; i < raw.length; i++) out[i] = raw.charCodeAt(i);
+    return out.buffer;
+  }
+
+  function toBase64url(buf) {
+    var bytes = new Uint8Array(buf);
+    var s = '';
+    for (var i = 0; i < bytes.length; i++) s += String.fromCharCode(bytes[i]);
+    return btoa(s).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+  }
+
+  // The server sends the WebAuthn JSON forms; convert them for browsers
+  // without PublicKeyCredential.parse*OptionsFromJSON.
+  function creationOptions(o) {
+    if (PublicKeyCredential.parseCreationOptionsFromJSON) {
+      return PublicKeyCredential.parseCreationOptionsFromJSON(o);
+    }
+    o.challenge = toBuffer(o.challenge);
+    o.user.id = toBuffer(o.user.id);
+    o.excludeCredentials = (o.excludeCredentials || []).map(function (c) {
+      return { type: c.type, id: toBuffer(c.id) };
+    });
+    return o;
+  }
+
+  function requestOptions(o) {
+    if (PublicKeyCredential.parseRequestOptionsFromJSON) {
+      return PublicKeyCredential.parseRequestOptionsFromJSON(o);
+    }
+    o.challenge = toBuffer(o.challenge);
+    o.allowCredentials = (o.allowCredentials || []).map(function (c) {
+      return { type: c.type, id: toBuffer(c.id) };
+    });
+    return o;
+  }
+
+  function credentialJSON(cred) {
+    var r = cred.response;
+    var out = { id: cred.id, rawId: toBase64url(cred.rawId), type: cred.type, response: {} };
+    out.response.clientDataJSON = toBase64url(r.clientDataJSON);
+    if (r.attestationObject) out.response.attestationObject = toBase64url(r.attestationObject);
+    if (r.authenticatorData) out.response.authenticatorData = toBase64url(r.authenticatorData);
+    if (r.signature) out.response.signature = toBase64url(r.signature);
+    if (r.userHandle) out.response.userHandle = toBase64url(r.userHandle);
+    return out;
+  }
+
+  function postJSON(url, body) {
+    return fetch(url, {
+      method: 'POST',
+      credentials: 'same-origin',
+      headers: { 'Content-Type': 'application/json' },
+      body: body === undefined ? undefined : JSON.stringify(body)
+    }).then(function (r) {
+      return r.json().catch(function () { return {}; }).then(function (data) {
+        if (!r.ok) throw new Error(data.error || 'Something went wrong. Please try again.');
+        return data;
+      });
+    });
+  }
+
+  function failed(err) {
+    // NotAllowedError: the user cancelled or the prompt timed out
+    if (err && err.name === 'NotAllowedError') {
+      say('Passkey request was cancelled.');
+    } else if (err && err.name === 'InvalidStateError') {
+      say('This device already has a passkey for your account.');
+    } else {
+      say(err && err.message ? err.message : 'Passkey request failed.');
+    }
+  }
+
+  // --- Sign-in (/login) ---
+
+  var loginBox = document.getElementById('passkey-login');
+  var loginBtn = document.getElementById('passkey-login-btn');
+  if (loginBox && loginBtn) {
+    loginBox.hidden = false;
+    loginBtn.addEventListener('click', function () {
+      loginBtn.disabled = true;
+      say('Waiting for your passkey…');
+      postJSON('/login/passkey/begin')
+        .then(function (opts) {
+          return navigator.credentials.get({ publicKey: requestOptions(opts) });
+        })
+        .then(function (cred) {
+          return postJSON('/login/passkey/finish', credentialJSON(cred));
+        })
+        .then(function (data) {
+          say('Signed in.');
+          window.location.href = data.redirect || '/nearby';
+        })
+        .catch(failed)
+        .then(function () { loginBtn.disabled = false; });
+    });
+  }
+
+  // --- Registration (/account/passkeys) ---
+
+  var addForm = document.getElementById('passkey-add');
+  var unsupported = document.getElementById('passkey-unsupported');
+  if (unsupported) unsupported.hidden = true;
+  if (addForm) {
+    addForm.hidden = false;
+    addForm.addEventListener('submit', function (e) {
+      e.preventDefault();
+      var btn = addForm.querySelector('button');
+      var name = addForm.querySelector('input[name="name"]').value;
+      btn.disabled = true;
+      say('Follow your device\'s prompt to create the passkey…');
+      postJSON('/account/passkeys/begin')
+        .then(function (opts) {
+          return navigator.credentials.create({ publicKey: creationOptions(opts) });
+        })
+        .then(function (cred) {
+          return postJSON('/account/passkeys/finish', { name: name, credential: credentialJSON(cred) });
+        })
+        .then(function (data) {
+          say('Passkey added.');
+          window.location.href = data.redirect || '/account/passkeys';
+        })
+        .catch(failed)
+        .then(function () { btn.disabled = false; });
+    });
+  }
+})();